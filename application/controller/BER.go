@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"fmt"
+)
+
+const (
+	berBoolean     = 0x01
+	berInteger     = 0x02
+	berBitString   = 0x03
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+	berSet         = 0x31
+)
+
+func berTLV(tag byte, content ...[]byte) []byte {
+	length := 0
+	for _, part := range content {
+		length += len(part)
+	}
+
+	value := []byte{tag}
+	switch {
+	case length < 0x80:
+		value = append(value, byte(length))
+	case length < 0x100:
+		value = append(value, 0x81, byte(length))
+	case length < 0x10000:
+		value = append(value, 0x82, byte(length>>8), byte(length))
+	default:
+		value = append(value, 0x83, byte(length>>16), byte(length>>8), byte(length))
+	}
+	for _, part := range content {
+		value = append(value, part...)
+	}
+	return value
+}
+
+func berInt(tag byte, value int64) []byte {
+	content := []byte{byte(value)}
+	for value > 0x7f || value < -0x80 {
+		value >>= 8
+		content = append([]byte{byte(value)}, content...)
+	}
+	return berTLV(tag, content)
+}
+
+func berString(tag byte, value string) []byte {
+	return berTLV(tag, []byte(value))
+}
+
+// Возвращает тег, содержимое и остаток буфера после элемента
+func berRead(buf []byte) (byte, []byte, []byte, error) {
+	if len(buf) < 2 {
+		return 0, nil, nil, fmt.Errorf("ber element is truncated")
+	}
+	tag := buf[0]
+	length := int(buf[1])
+	pos := 2
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		if size == 0 || size > 3 || pos+size > len(buf) {
+			return 0, nil, nil, fmt.Errorf("unsupported ber length")
+		}
+		length = 0
+		for _, b := range buf[pos : pos+size] {
+			length = length<<8 | int(b)
+		}
+		pos += size
+	}
+	if length > len(buf)-pos {
+		return 0, nil, nil, fmt.Errorf("ber element is truncated")
+	}
+	return tag, buf[pos : pos+length], buf[pos+length:], nil
+}
+
+func berReadInt(content []byte) int64 {
+	if len(content) == 0 {
+		return 0
+	}
+	value := int64(int8(content[0]))
+	for _, b := range content[1:] {
+		value = value<<8 | int64(b)
+	}
+	return value
+}
+
+// Раскладывает содержимое составного элемента на дочерние элементы по тегам
+func berChildren(content []byte) (map[byte][]byte, error) {
+	children := make(map[byte][]byte)
+	for len(content) > 0 {
+		tag, value, rest, err := berRead(content)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := children[tag]; !ok {
+			children[tag] = value
+		}
+		content = rest
+	}
+	return children, nil
+}
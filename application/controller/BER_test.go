@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBERRead(t *testing.T) {
+	long := append([]byte{0x04, 0x81, 0x80}, bytes.Repeat([]byte{'a'}, 0x80)...)
+	tests := []struct {
+		name    string
+		buf     []byte
+		tag     byte
+		content []byte
+		rest    []byte
+		ok      bool
+	}{
+		{"short form", []byte{0x02, 0x01, 0x05, 0xff}, berInteger, []byte{0x05}, []byte{0xff}, true},
+		{"empty", []byte{0x05, 0x00}, berNull, []byte{}, []byte{}, true},
+		{"long form", long, berOctetString, long[3:], []byte{}, true},
+		{"two length bytes", []byte{0x30, 0x82, 0x00, 0x01, 0x00}, berSequence, []byte{0x00}, []byte{}, true},
+		{"no length", []byte{0x30}, 0, nil, nil, false},
+		{"indefinite length", []byte{0x30, 0x80, 0x00, 0x00}, 0, nil, nil, false},
+		{"four length bytes", []byte{0x30, 0x84, 0, 0, 0, 1, 0}, 0, nil, nil, false},
+		{"length bytes missing", []byte{0x30, 0x82, 0x01}, 0, nil, nil, false},
+		{"content truncated", []byte{0x04, 0x05, 'a', 'b'}, 0, nil, nil, false},
+	}
+	for _, test := range tests {
+		tag, content, rest, err := berRead(test.buf)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if test.ok && (tag != test.tag || !bytes.Equal(content, test.content) || !bytes.Equal(rest, test.rest)) {
+			t.Errorf("%s: got %02x %x %x", test.name, tag, content, rest)
+		}
+	}
+}
+
+func TestBERInt(t *testing.T) {
+	tests := []struct {
+		value int64
+		want  []byte
+	}{
+		{0, []byte{0x02, 0x01, 0x00}},
+		{127, []byte{0x02, 0x01, 0x7f}},
+		{128, []byte{0x02, 0x02, 0x00, 0x80}},
+		{256, []byte{0x02, 0x02, 0x01, 0x00}},
+		{-1, []byte{0x02, 0x01, 0xff}},
+		{-129, []byte{0x02, 0x02, 0xff, 0x7f}},
+		{0x7fffffff, []byte{0x02, 0x04, 0x7f, 0xff, 0xff, 0xff}},
+	}
+	for _, test := range tests {
+		encoded := berInt(berInteger, test.value)
+		if !bytes.Equal(encoded, test.want) {
+			t.Errorf("berInt(%d) = %x, want %x", test.value, encoded, test.want)
+		}
+		_, content, _, err := berRead(encoded)
+		if err != nil || berReadInt(content) != test.value {
+			t.Errorf("berReadInt(%x) = %d, want %d", content, berReadInt(content), test.value)
+		}
+	}
+}
+
+func TestBERTLVLength(t *testing.T) {
+	for _, length := range []int{0, 0x7f, 0x80, 0xff, 0x100, 0xffff, 0x10000} {
+		encoded := berTLV(berOctetString, make([]byte, length))
+		_, content, rest, err := berRead(encoded)
+		if err != nil || len(content) != length || len(rest) != 0 {
+			t.Errorf("length %d: got %d bytes, %d left, error %v", length, len(content), len(rest), err)
+		}
+	}
+}
+
+func TestBERChildren(t *testing.T) {
+	content := append(berInt(0xa0, 5), berString(0xa1, "first")...)
+	content = append(content, berString(0xa1, "second")...)
+	children, err := berChildren(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Повторный тег не перезаписывает первый элемент
+	if len(children) != 2 || string(children[0xa1]) != "first" || berReadInt(children[0xa0]) != 5 {
+		t.Errorf("got %v", children)
+	}
+	if _, err := berChildren(append(content, 0x04, 0x02, 'a')); err == nil {
+		t.Error("truncated child: expected error")
+	}
+}
@@ -0,0 +1,415 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+const memcachedPort = 11211
+
+func detectAMQP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("AMQP\x00\x00\x09\x01"))
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 7)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return nil, err
+	}
+
+	// Брокер без поддержки 0-9-1 отвечает заголовком своей версии протокола
+	if bytes.HasPrefix(header, []byte("AMQP")) {
+		rest := make([]byte, 1)
+		_, err = io.ReadFull(conn, rest)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.Detection{
+			Protocol: "AMQP",
+			Evidence: domain.EvidenceHandshake,
+			Version:  fmt.Sprintf("%d.%d.%d", header[5], header[6], rest[0]),
+		}, nil
+	}
+
+	size := int(binary.BigEndian.Uint32(header[3:7]))
+	if header[0] != 1 || size < 10 || size > 64*1024 {
+		return nil, fmt.Errorf("not an amqp frame")
+	}
+	payload := make([]byte, size+1)
+	_, err = io.ReadFull(conn, payload)
+	if err != nil {
+		return nil, err
+	}
+	if payload[size] != 0xce || binary.BigEndian.Uint16(payload[0:2]) != 10 || binary.BigEndian.Uint16(payload[2:4]) != 10 {
+		return nil, fmt.Errorf("not a connection.start method")
+	}
+
+	detection := &domain.Detection{
+		Protocol: "AMQP",
+		Evidence: domain.EvidenceHandshake,
+		Version:  fmt.Sprintf("0-%d-%d", payload[4], payload[5]),
+	}
+
+	tableSize := int(binary.BigEndian.Uint32(payload[6:10]))
+	if 10+tableSize > size {
+		return detection, nil
+	}
+	properties := parseAMQPTable(payload[10 : 10+tableSize])
+	if product, ok := properties["product"]; ok {
+		detection.Product = product
+		detection.Version = properties["version"]
+	}
+	if platform, ok := properties["platform"]; ok {
+		detection.Info = append(detection.Info, "platform: "+platform)
+	}
+
+	rest := payload[10+tableSize : size]
+	if len(rest) >= 4 {
+		length := int(binary.BigEndian.Uint32(rest[0:4]))
+		if 4+length <= len(rest) {
+			mechanisms := string(rest[4 : 4+length])
+			detection.Info = append(detection.Info, "mechanisms: "+mechanisms)
+			if strings.Contains(" "+mechanisms+" ", " ANONYMOUS ") {
+				detection.Findings = append(detection.Findings, domain.Finding{
+					Check:    "amqp-anonymous",
+					Severity: domain.SeverityHigh,
+					Detail:   "broker offers the ANONYMOUS SASL mechanism",
+				})
+			}
+		}
+	}
+	return detection, nil
+}
+
+// Возвращает только строковые значения таблицы, остальные поля пропускаются
+func parseAMQPTable(table []byte) map[string]string {
+	result := make(map[string]string)
+	pos := 0
+	for pos < len(table) {
+		keyLength := int(table[pos])
+		if pos+1+keyLength+1 > len(table) {
+			break
+		}
+		key := string(table[pos+1 : pos+1+keyLength])
+		pos += 1 + keyLength
+		kind := table[pos]
+		pos++
+
+		size := 0
+		switch kind {
+		case 'S', 'F', 'A', 'x':
+			if pos+4 > len(table) {
+				return result
+			}
+			size = 4 + int(binary.BigEndian.Uint32(table[pos:pos+4]))
+		case 's':
+			if pos+1 > len(table) {
+				return result
+			}
+			size = 1 + int(table[pos])
+		case 't', 'b', 'B':
+			size = 1
+		case 'u', 'U':
+			size = 2
+		case 'i', 'I', 'f':
+			size = 4
+		case 'D':
+			size = 5
+		case 'l', 'L', 'd', 'T':
+			size = 8
+		case 'V':
+			size = 0
+		default:
+			return result
+		}
+		if pos+size > len(table) {
+			return result
+		}
+		if kind == 'S' {
+			result[key] = string(table[pos+4 : pos+size])
+		}
+		pos += size
+	}
+	return result
+}
+
+func detectMQTT(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	clientID := "portscan-" + hex.EncodeToString(suffix)
+
+	// Протокол MQTT 3.1.1, чистая сессия, без логина и пароля
+	variable := []byte{0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x02, 0x00, 0x3c}
+	variable = binary.BigEndian.AppendUint16(variable, uint16(len(clientID)))
+	variable = append(variable, clientID...)
+	packet := append([]byte{0x10, byte(len(variable))}, variable...)
+
+	_, err = conn.Write(packet)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := make([]byte, 4)
+	_, err = io.ReadFull(conn, answer)
+	if err != nil {
+		return nil, err
+	}
+	if answer[0] != 0x20 || answer[1] != 0x02 {
+		return nil, fmt.Errorf("not an mqtt connack")
+	}
+	conn.Write([]byte{0xe0, 0x00})
+
+	detection := &domain.Detection{Protocol: "MQTT", Version: "3.1.1", Evidence: domain.EvidenceHandshake}
+	switch answer[3] {
+	case 0x00:
+		detection.Info = append(detection.Info, "auth: not required")
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "mqtt-anonymous",
+			Severity: domain.SeverityHigh,
+			Detail:   "broker accepted CONNECT without credentials",
+		})
+	case 0x01:
+		detection.Info = append(detection.Info, "protocol 3.1.1 is not supported")
+		detection.Version = ""
+	case 0x02:
+		detection.Info = append(detection.Info, "client identifier rejected")
+	case 0x03:
+		detection.Info = append(detection.Info, "server unavailable")
+	case 0x04, 0x05:
+		detection.Info = append(detection.Info, "auth: required")
+	default:
+		return nil, fmt.Errorf("unknown connack return code %d", answer[3])
+	}
+	return detection, nil
+}
+
+func detectKafka(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// ApiVersions v0
+	response, err := kafkaRequest(conn, 18, 0, 1, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(response) < 6 {
+		return nil, fmt.Errorf("apiversions response is truncated")
+	}
+	errorCode := binary.BigEndian.Uint16(response[0:2])
+	count := int(binary.BigEndian.Uint32(response[2:6]))
+	if errorCode != 0 || count <= 0 || 6+count*6 > len(response) {
+		return nil, fmt.Errorf("not a kafka apiversions response")
+	}
+
+	detection := &domain.Detection{Protocol: "Kafka", Product: "Apache Kafka", Evidence: domain.EvidenceHandshake}
+	maxKey := uint16(0)
+	for i := 0; i < count; i++ {
+		key := binary.BigEndian.Uint16(response[6+i*6 : 8+i*6])
+		maxKey = max(maxKey, key)
+	}
+	detection.Info = append(detection.Info, fmt.Sprintf("api keys: %d, highest: %d", count, maxKey))
+
+	// Metadata v0 с пустым списком возвращает все топики; SASL-листенер разорвёт соединение
+	metadata, err := kafkaRequest(conn, 3, 0, 2, []byte{0x00, 0x00, 0x00, 0x00})
+	if err == nil && len(metadata) >= 4 {
+		brokers := int32(binary.BigEndian.Uint32(metadata[0:4]))
+		detection.Info = append(detection.Info, fmt.Sprintf("brokers: %d", brokers))
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "kafka-anonymous",
+			Severity: domain.SeverityHigh,
+			Detail:   "broker returned cluster metadata without authentication",
+		})
+	}
+	return detection, nil
+}
+
+func kafkaRequest(conn net.Conn, apiKey, apiVersion uint16, correlationID uint32, body []byte) ([]byte, error) {
+	clientID := "portscan"
+	request := make([]byte, 4, 64)
+	request = binary.BigEndian.AppendUint16(request, apiKey)
+	request = binary.BigEndian.AppendUint16(request, apiVersion)
+	request = binary.BigEndian.AppendUint32(request, correlationID)
+	request = binary.BigEndian.AppendUint16(request, uint16(len(clientID)))
+	request = append(request, clientID...)
+	request = append(request, body...)
+	binary.BigEndian.PutUint32(request[0:4], uint32(len(request)-4))
+
+	_, err := conn.Write(request)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 8)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint32(header[0:4]))
+	if binary.BigEndian.Uint32(header[4:8]) != correlationID || size < 4 || size > 1024*1024 {
+		return nil, fmt.Errorf("unexpected kafka response")
+	}
+	response := make([]byte, size-4)
+	_, err = io.ReadFull(conn, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func detectMemcached(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("version\r\n"))
+	if err != nil {
+		return nil, err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	version, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), "VERSION ")
+	if !ok {
+		return nil, fmt.Errorf("not a memcached server")
+	}
+
+	return &domain.Detection{
+		Protocol: "memcached",
+		Evidence: domain.EvidenceHandshake,
+		Product:  "memcached",
+		Version:  version,
+		Findings: []domain.Finding{{
+			Check:    "memcached-no-auth",
+			Severity: domain.SeverityMedium,
+			Detail:   "text protocol is available without authentication",
+		}},
+	}, nil
+}
+
+func detectMemcachedUDP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("udp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	request := buildMemcachedUDPVersion()
+	_, err = conn.Write(request)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := make([]byte, 1500)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return nil, err
+	}
+	if n < 8 || !bytes.Equal(buffer[0:2], request[0:2]) {
+		return nil, fmt.Errorf("not a memcached udp frame")
+	}
+	version, ok := strings.CutPrefix(strings.TrimRight(string(buffer[8:n]), "\r\n"), "VERSION ")
+	if !ok {
+		return nil, fmt.Errorf("not a memcached server")
+	}
+
+	return &domain.Detection{
+		Protocol: "memcached",
+		Evidence: domain.EvidenceHandshake,
+		Product:  "memcached",
+		Version:  version,
+		Findings: []domain.Finding{{
+			Check:    "memcached-udp",
+			Severity: domain.SeverityHigh,
+			Detail:   "UDP interface is enabled and can be abused for amplification",
+		}},
+	}, nil
+}
+
+func buildMemcachedUDPVersion() []byte {
+	// Заголовок UDP-кадра: id запроса, номер и число датаграмм, резерв
+	request := []byte{0x50, 0x53, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00}
+	return append(request, "version\r\n"...)
+}
+
+func detectNATS(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	payload, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		return nil, fmt.Errorf("not a nats server")
+	}
+
+	var info struct {
+		ServerID     string `json:"server_id"`
+		ServerName   string `json:"server_name"`
+		Version      string `json:"version"`
+		Go           string `json:"go"`
+		AuthRequired bool   `json:"auth_required"`
+		TLSRequired  bool   `json:"tls_required"`
+		Cluster      string `json:"cluster"`
+	}
+	err = json.Unmarshal([]byte(payload), &info)
+	if err != nil {
+		return nil, err
+	}
+
+	detection := &domain.Detection{
+		Protocol: "NATS",
+		Evidence: domain.EvidenceHandshake,
+		Product:  "NATS Server",
+		Version:  info.Version,
+	}
+	if info.ServerName != "" {
+		detection.Info = append(detection.Info, "server name: "+info.ServerName)
+	}
+	if info.Cluster != "" {
+		detection.Info = append(detection.Info, "cluster: "+info.Cluster)
+	}
+	detection.Info = append(detection.Info, fmt.Sprintf("tls required: %t", info.TLSRequired))
+	if !info.AuthRequired {
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "nats-no-auth",
+			Severity: domain.SeverityHigh,
+			Detail:   "server does not require authentication",
+		})
+	}
+	return detection, nil
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+	"testing"
+)
+
+// Поле таблицы AMQP: короткое имя, тип и значение
+func amqpField(key string, kind byte, value []byte) []byte {
+	field := append([]byte{byte(len(key))}, key...)
+	field = append(field, kind)
+	return append(field, value...)
+}
+
+func amqpLongString(value string) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(value))), value...)
+}
+
+// server-properties из Connection.Start RabbitMQ 3.12
+func rabbitMQProperties() []byte {
+	capabilities := amqpField("publisher_confirms", 't', []byte{1})
+	capabilities = append(capabilities, amqpField("consumer_priorities", 't', []byte{1})...)
+
+	table := amqpField("capabilities", 'F', append(binary.BigEndian.AppendUint32(nil, uint32(len(capabilities))), capabilities...))
+	table = append(table, amqpField("cluster_name", 'S', amqpLongString("rabbit@mq01"))...)
+	table = append(table, amqpField("copyright", 'S', amqpLongString("Copyright (c) 2007-2023 VMware, Inc. or its affiliates."))...)
+	table = append(table, amqpField("platform", 'S', amqpLongString("Erlang/OTP 25.3.2.7"))...)
+	table = append(table, amqpField("product", 'S', amqpLongString("RabbitMQ"))...)
+	table = append(table, amqpField("version", 'S', amqpLongString("3.12.12"))...)
+	return table
+}
+
+func TestParseAMQPTable(t *testing.T) {
+	properties := parseAMQPTable(rabbitMQProperties())
+	if len(properties) != 5 || properties["product"] != "RabbitMQ" || properties["version"] != "3.12.12" {
+		t.Errorf("got %v", properties)
+	}
+	if _, ok := properties["capabilities"]; ok {
+		t.Error("nested table returned as a string")
+	}
+
+	mixed := amqpField("timeout", 'I', []byte{0, 0, 0, 60})
+	mixed = append(mixed, amqpField("short", 's', []byte{2, 'o', 'k'})...)
+	mixed = append(mixed, amqpField("void", 'V', nil)...)
+	mixed = append(mixed, amqpField("name", 'S', amqpLongString("broker"))...)
+	if got := parseAMQPTable(mixed); len(got) != 1 || got["name"] != "broker" {
+		t.Errorf("mixed: got %v", got)
+	}
+
+	// Неизвестный тип и обрезанная строка останавливают разбор, но не теряют прочитанное
+	unknown := append(amqpField("name", 'S', amqpLongString("broker")), amqpField("odd", '?', []byte{1})...)
+	unknown = append(unknown, amqpField("later", 'S', amqpLongString("lost"))...)
+	if got := parseAMQPTable(unknown); len(got) != 1 || got["name"] != "broker" {
+		t.Errorf("unknown type: got %v", got)
+	}
+	truncated := amqpField("product", 'S', amqpLongString("RabbitMQ"))
+	if got := parseAMQPTable(truncated[:len(truncated)-2]); len(got) != 0 {
+		t.Errorf("truncated: got %v", got)
+	}
+}
+
+func fakeRabbitMQ(mechanisms string) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		if _, err := io.ReadFull(conn, make([]byte, 8)); err != nil {
+			return
+		}
+		properties := rabbitMQProperties()
+		payload := []byte{0, 10, 0, 10, 0, 9}
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(properties)))
+		payload = append(payload, properties...)
+		payload = append(payload, amqpLongString(mechanisms)...)
+		payload = append(payload, amqpLongString("en_US")...)
+
+		frame := []byte{1, 0, 0}
+		frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+		frame = append(frame, payload...)
+		conn.Write(append(frame, 0xce))
+	}
+}
+
+func TestDetectAMQP(t *testing.T) {
+	ip, port := serveTCP(t, fakeRabbitMQ("AMQPLAIN PLAIN ANONYMOUS"))
+	detection, err := detectAMQP(ip, port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"platform: Erlang/OTP 25.3.2.7", "mechanisms: AMQPLAIN PLAIN ANONYMOUS"}
+	if detection.Product != "RabbitMQ" || detection.Version != "3.12.12" || !slices.Equal(detection.Info, want) {
+		t.Errorf("got %q %q %q", detection.Product, detection.Version, detection.Info)
+	}
+	if len(detection.Findings) != 1 || detection.Findings[0].Check != "amqp-anonymous" {
+		t.Errorf("got findings %v", detection.Findings)
+	}
+
+	ip, port = serveTCP(t, fakeRabbitMQ("PLAIN ANONYMOUS-LIKE"))
+	detection, err = detectAMQP(ip, port, testConfig())
+	if err != nil || len(detection.Findings) != 0 {
+		t.Errorf("got findings %v, error %v", detection.Findings, err)
+	}
+
+	// Брокер AMQP 1.0 отвечает своим заголовком протокола
+	ip, port = serveTCP(t, func(conn net.Conn) { conn.Write([]byte("AMQP\x00\x01\x00\x00")) })
+	detection, err = detectAMQP(ip, port, testConfig())
+	if err != nil || detection.Version != "1.0.0" {
+		t.Errorf("got %v, error %v", detection, err)
+	}
+
+	// Заголовок оборван на последнем байте версии
+	ip, port = serveTCP(t, func(conn net.Conn) { conn.Write([]byte("AMQP\x00\x01\x00")) })
+	if detection, err = detectAMQP(ip, port, testConfig()); err == nil {
+		t.Errorf("expected error for truncated header, got %v", detection)
+	}
+}
+
+// Kafka-брокер без аутентификации: ApiVersions v0 и Metadata v0 с одним брокером
+func fakeKafka(conn net.Conn) {
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		request := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		var body []byte
+		switch binary.BigEndian.Uint16(request[0:2]) {
+		case 18:
+			body = binary.BigEndian.AppendUint16(nil, 0)
+			body = binary.BigEndian.AppendUint32(body, 3)
+			for _, key := range []uint16{0, 3, 18} {
+				body = binary.BigEndian.AppendUint16(body, key)
+				body = binary.BigEndian.AppendUint16(body, 0)
+				body = binary.BigEndian.AppendUint16(body, 3)
+			}
+		case 3:
+			body = binary.BigEndian.AppendUint32(nil, 1)
+		default:
+			return
+		}
+		response := binary.BigEndian.AppendUint32(nil, uint32(4+len(body)))
+		response = append(response, request[4:8]...)
+		conn.Write(append(response, body...))
+	}
+}
+
+func TestDetectKafka(t *testing.T) {
+	ip, port := serveTCP(t, fakeKafka)
+	detection, err := detectKafka(ip, port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"api keys: 3, highest: 18", "brokers: 1"}
+	if !slices.Equal(detection.Info, want) || len(detection.Findings) != 1 {
+		t.Errorf("got %q, findings %v", detection.Info, detection.Findings)
+	}
+
+	// Ответ с чужим correlation id
+	ip, port = serveTCP(t, func(conn net.Conn) {
+		io.ReadFull(conn, make([]byte, 4))
+		conn.Write([]byte{0, 0, 0, 10, 0, 0, 0, 9, 0, 0, 0, 0, 0, 0})
+	})
+	if _, err := detectKafka(ip, port, testConfig()); err == nil {
+		t.Error("wrong correlation id: expected error")
+	}
+}
+
+func TestDetectMQTT(t *testing.T) {
+	tests := []struct {
+		code     byte
+		info     string
+		findings int
+		ok       bool
+	}{
+		{0x00, "auth: not required", 1, true},
+		{0x01, "protocol 3.1.1 is not supported", 0, true},
+		{0x05, "auth: required", 0, true},
+		{0x87, "", 0, false},
+	}
+	for _, test := range tests {
+		ip, port := serveTCP(t, func(conn net.Conn) {
+			header := make([]byte, 2)
+			if _, err := io.ReadFull(conn, header); err != nil || header[0] != 0x10 {
+				return
+			}
+			io.ReadFull(conn, make([]byte, header[1]))
+			conn.Write([]byte{0x20, 0x02, 0x00, test.code})
+		})
+		detection, err := detectMQTT(ip, port, testConfig())
+		if (err == nil) != test.ok {
+			t.Errorf("code %d: got error %v", test.code, err)
+			continue
+		}
+		if test.ok && (detection.Info[0] != test.info || len(detection.Findings) != test.findings) {
+			t.Errorf("code %d: got %q, findings %v", test.code, detection.Info, detection.Findings)
+		}
+	}
+}
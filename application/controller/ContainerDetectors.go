@@ -0,0 +1,391 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+// Порт Docker Engine API с TLS
+var dockerTLSPorts = []int{2376}
+
+type apiClient struct {
+	client  *http.Client
+	address string
+	scheme  string
+	// Сервер запросил клиентский сертификат при рукопожатии TLS
+	certRequested atomic.Bool
+}
+
+type apiResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func newAPIClient(ip net.IP, port int, timeout time.Duration) *apiClient {
+	c := &apiClient{address: net.JoinHostPort(ip.String(), strconv.Itoa(port))}
+	c.client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				// Сертификата у нас нет: отправляем пустой и запоминаем, что его просили
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					c.certRequested.Store(true)
+					return &tls.Certificate{}, nil
+				},
+			},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return c
+}
+
+func (c *apiClient) get(path string) (*apiResponse, error) {
+	return c.do(http.MethodGet, path, "", nil)
+}
+
+func (c *apiClient) post(path string, contentType string, body []byte) (*apiResponse, error) {
+	return c.do(http.MethodPost, path, contentType, body)
+}
+
+// При первом запросе пробует HTTPS, затем HTTP, и запоминает подошедшую схему
+func (c *apiClient) do(method string, path string, contentType string, body []byte) (*apiResponse, error) {
+	schemes := []string{c.scheme}
+	if c.scheme == "" {
+		schemes = []string{"https", "http"}
+	}
+
+	var err error
+	for _, scheme := range schemes {
+		var request *http.Request
+		request, err = http.NewRequest(method, fmt.Sprintf("%s://%s%s", scheme, c.address, path), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+		var resp *http.Response
+		resp, err = c.client.Do(request)
+		if err != nil {
+			continue
+		}
+		defer resp.Body.Close()
+		c.scheme = scheme
+
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return nil, err
+		}
+		return &apiResponse{status: resp.StatusCode, header: resp.Header, body: data}, nil
+	}
+	return nil, err
+}
+
+func (c *apiClient) getJSON(path string, value any) (*apiResponse, error) {
+	resp, err := c.get(path)
+	if err != nil {
+		return nil, err
+	}
+	if resp.status == http.StatusOK {
+		err = json.Unmarshal(resp.body, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (c *apiClient) info() string {
+	return "transport: " + c.scheme
+}
+
+func detectDocker(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	client := newAPIClient(targetIP, port, cfg.Timeout)
+	var version struct {
+		Version       string
+		ApiVersion    string
+		Os            string
+		Arch          string
+		KernelVersion string
+	}
+	resp, err := client.getJSON("/version", &version)
+	// С --tlsverify демон обрывает рукопожатие без клиентского сертификата
+	if client.certRequested.Load() && client.scheme != "https" && slices.Contains(dockerTLSPorts, port) {
+		return &domain.Detection{
+			Protocol: "Docker",
+			// Ответа API нет, о Docker говорит только номер порта
+			Evidence: domain.EvidencePortHint,
+			Product:  "Docker Engine",
+			Info:     []string{"transport: https", "auth: client certificate required"},
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.status != http.StatusOK || version.ApiVersion == "" {
+		return nil, fmt.Errorf("not a docker engine api")
+	}
+
+	detection := &domain.Detection{
+		Protocol: "Docker",
+		Evidence: domain.EvidenceHandshake,
+		Product:  "Docker Engine",
+		Version:  version.Version,
+		Info: []string{
+			client.info(),
+			"api: " + version.ApiVersion,
+			fmt.Sprintf("os: %s/%s %s", version.Os, version.Arch, version.KernelVersion),
+		},
+		Findings: []domain.Finding{{
+			Check:    "docker-api-unauthenticated",
+			Severity: domain.SeverityHigh,
+			Detail:   "Docker Engine API is accessible without authentication",
+		}},
+	}
+	return detection, nil
+}
+
+func detectKubernetes(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	client := newAPIClient(targetIP, port, cfg.Timeout)
+	var version struct {
+		GitVersion string `json:"gitVersion"`
+		Platform   string `json:"platform"`
+	}
+	resp, err := client.getJSON("/version", &version)
+	if err != nil {
+		return nil, err
+	}
+
+	detection := &domain.Detection{
+		Protocol: "Kubernetes",
+		Evidence: domain.EvidenceHandshake,
+		Product:  "kube-apiserver",
+		Version:  version.GitVersion,
+		Info:     []string{client.info()},
+	}
+	switch {
+	case resp.status == http.StatusOK && version.GitVersion != "":
+		detection.Info = append(detection.Info, "platform: "+version.Platform)
+	case isKubernetesStatus(resp):
+		// /version закрыт для анонимов, но ответ всё равно в формате Status
+	default:
+		return nil, fmt.Errorf("not a kubernetes api server")
+	}
+
+	if health, err := client.get("/healthz"); err == nil {
+		detection.Info = append(detection.Info, fmt.Sprintf("healthz: %d %s", health.status, strings.TrimSpace(string(health.body))))
+	}
+
+	pods, err := client.get("/api/v1/pods")
+	if err != nil {
+		return detection, nil
+	}
+	switch pods.status {
+	case http.StatusOK:
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "kubernetes-anonymous-access",
+			Severity: domain.SeverityHigh,
+			Detail:   "anonymous requests can list pods in all namespaces",
+		})
+	case http.StatusForbidden:
+		detection.Info = append(detection.Info, "anonymous: enabled, pods forbidden")
+	case http.StatusUnauthorized:
+		detection.Info = append(detection.Info, "anonymous: disabled")
+	}
+	return detection, nil
+}
+
+func isKubernetesStatus(resp *apiResponse) bool {
+	var status struct {
+		Kind       string `json:"kind"`
+		APIVersion string `json:"apiVersion"`
+	}
+	return json.Unmarshal(resp.body, &status) == nil && status.Kind == "Status" && status.APIVersion == "v1"
+}
+
+func detectKubelet(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	client := newAPIClient(targetIP, port, cfg.Timeout)
+	pods, err := client.get("/pods")
+	if err != nil {
+		return nil, err
+	}
+
+	detection := &domain.Detection{
+		Protocol: "kubelet",
+		Evidence: domain.EvidenceHandshake,
+		Info:     []string{client.info()},
+	}
+	body := strings.TrimSpace(string(pods.body))
+	switch {
+	case pods.status == http.StatusOK && strings.Contains(body, `"kind":"PodList"`):
+		var list struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(pods.body, &list)
+		detection.Info = append(detection.Info, fmt.Sprintf("pods: %d", len(list.Items)))
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "kubelet-anonymous-access",
+			Severity: domain.SeverityHigh,
+			Detail:   "kubelet API lists pods without authentication",
+		})
+	// Сам API-сервер отвечает на ошибки объектом Status, а kubelet — простым текстом
+	case pods.status == http.StatusForbidden && strings.Contains(body, "resource=nodes"):
+		detection.Info = append(detection.Info, "anonymous: enabled, pods forbidden")
+	case pods.status == http.StatusUnauthorized && body == "Unauthorized":
+		detection.Info = append(detection.Info, "anonymous: disabled")
+	default:
+		return nil, fmt.Errorf("not a kubelet api")
+	}
+
+	if health, err := client.get("/healthz"); err == nil {
+		detection.Info = append(detection.Info, fmt.Sprintf("healthz: %d %s", health.status, strings.TrimSpace(string(health.body))))
+	}
+	return detection, nil
+}
+
+func detectEtcd(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	client := newAPIClient(targetIP, port, cfg.Timeout)
+	var version struct {
+		Server  string `json:"etcdserver"`
+		Cluster string `json:"etcdcluster"`
+	}
+	resp, err := client.getJSON("/version", &version)
+	if err != nil {
+		return nil, err
+	}
+	if resp.status != http.StatusOK || version.Server == "" {
+		return nil, fmt.Errorf("not an etcd server")
+	}
+
+	detection := &domain.Detection{
+		Protocol: "etcd",
+		Evidence: domain.EvidenceHandshake,
+		Product:  "etcd",
+		Version:  version.Server,
+		Info:     []string{client.info(), "cluster: " + version.Cluster},
+	}
+
+	// Чтение ключа через шлюз v3 требует токен, если включена аутентификация
+	rangeResp, err := client.post("/v3/kv/range", "application/json", []byte(`{"key":"AA==","limit":1}`))
+	if err != nil {
+		return detection, nil
+	}
+	switch rangeResp.status {
+	case http.StatusOK:
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "etcd-unauthenticated",
+			Severity: domain.SeverityHigh,
+			Detail:   "etcd keys can be read without authentication",
+		})
+	case http.StatusUnauthorized, http.StatusForbidden:
+		detection.Info = append(detection.Info, "auth: enabled")
+	}
+	return detection, nil
+}
+
+func detectConsul(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	return detectHashiCorpAPI(targetIP, port, cfg.Timeout, "Consul")
+}
+
+func detectNomad(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	return detectHashiCorpAPI(targetIP, port, cfg.Timeout, "Nomad")
+}
+
+// Consul и Nomad отвечают на /v1/status/leader без токена. Отличаем их по порту
+// RPC в адресе лидера: 8300 у Consul и 4647 у Nomad
+func detectHashiCorpAPI(targetIP net.IP, port int, timeout time.Duration, product string) (*domain.Detection, error) {
+	client := newAPIClient(targetIP, port, timeout)
+	var leader string
+	resp, err := client.getJSON("/v1/status/leader", &leader)
+	if err != nil {
+		return nil, err
+	}
+	if resp.status != http.StatusOK {
+		return nil, fmt.Errorf("not a %s api", product)
+	}
+	_, leaderPort, _ := net.SplitHostPort(leader)
+	switch {
+	case product == "Consul" && (leaderPort == "8300" || resp.header.Get("X-Consul-Knownleader") != ""):
+	case product == "Nomad" && leaderPort == "4647":
+	default:
+		return nil, fmt.Errorf("not a %s api", product)
+	}
+
+	detection := &domain.Detection{
+		Protocol: product,
+		Evidence: domain.EvidenceHandshake,
+		Product:  product,
+		Info:     []string{client.info()},
+	}
+	if leader == "" {
+		detection.Info = append(detection.Info, "leader: none")
+	} else {
+		detection.Info = append(detection.Info, "leader: "+leader)
+	}
+
+	var agent *apiResponse
+	protected := "/v1/agent/self"
+	if product == "Consul" {
+		var self struct {
+			Config struct {
+				Datacenter string
+				NodeName   string
+				Version    string
+			}
+		}
+		agent, err = client.getJSON(protected, &self)
+		if err != nil {
+			return detection, nil
+		}
+		detection.Version = self.Config.Version
+		if self.Config.Datacenter != "" {
+			detection.Info = append(detection.Info, "datacenter: "+self.Config.Datacenter, "node: "+self.Config.NodeName)
+		}
+	} else {
+		var self struct {
+			Config struct {
+				Version struct {
+					Version string
+				}
+			} `json:"config"`
+		}
+		_, err = client.getJSON("/v1/agent/self", &self)
+		if err == nil {
+			detection.Version = self.Config.Version.Version
+		}
+		protected = "/v1/jobs"
+		agent, err = client.get(protected)
+		if err != nil {
+			return detection, nil
+		}
+	}
+
+	switch agent.status {
+	case http.StatusOK:
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    strings.ToLower(product) + "-unauthenticated",
+			Severity: domain.SeverityHigh,
+			Detail:   fmt.Sprintf("%s HTTP API answers %s without an ACL token", product, protected),
+		})
+	case http.StatusForbidden:
+		detection.Info = append(detection.Info, "acl: enforced")
+	}
+	return detection, nil
+}
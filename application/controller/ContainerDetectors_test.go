@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+type apiReply struct {
+	status int
+	body   string
+}
+
+// Ответы, записанные с Docker 24.0.7, Kubernetes 1.28 и kubelet того же кластера
+const (
+	dockerVersion = `{"Platform":{"Name":"Docker Engine - Community"},"Version":"24.0.7","ApiVersion":"1.43",` +
+		`"MinAPIVersion":"1.12","GitCommit":"311b9ff","GoVersion":"go1.20.10","Os":"linux","Arch":"amd64",` +
+		`"KernelVersion":"6.1.0-13-amd64","BuildTime":"2023-10-26T09:07:41.000000000+00:00"}`
+	kubernetesVersion = `{"major":"1","minor":"28","gitVersion":"v1.28.3","gitCommit":"a8a1abc25cad87333840cd7d54be2efaf31a3177",` +
+		`"gitTreeState":"clean","buildDate":"2023-10-18T11:33:18Z","goVersion":"go1.20.10","compiler":"gc","platform":"linux/amd64"}`
+	kubernetesUnauthorized = `{"kind":"Status","apiVersion":"v1","metadata":{},"status":"Failure","message":"Unauthorized",` +
+		`"reason":"Unauthorized","code":401}`
+	kubernetesPodsForbidden = `{"kind":"Status","apiVersion":"v1","metadata":{},"status":"Failure",` +
+		`"message":"pods is forbidden: User \"system:anonymous\" cannot list resource \"pods\" in API group \"\" at the cluster scope",` +
+		`"reason":"Forbidden","details":{"kind":"pods"},"code":403}`
+	kubeletPods = `{"kind":"PodList","apiVersion":"v1","metadata":{},"items":[` +
+		`{"metadata":{"name":"coredns-5dd5756b68-2xq7w","namespace":"kube-system"}},` +
+		`{"metadata":{"name":"kube-proxy-8fz4k","namespace":"kube-system"}}]}`
+	kubeletForbidden = "Forbidden (user=system:anonymous, verb=get, resource=nodes, subresource=proxy)"
+)
+
+func serveAPI(t *testing.T, replies map[string]apiReply) (net.IP, int) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply, ok := replies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(reply.status)
+		w.Write([]byte(reply.body))
+	}))
+	// Клиент сначала пробует HTTPS, и сервер пишет об этом в журнал
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.Start()
+	t.Cleanup(server.Close)
+	address := server.Listener.Addr().(*net.TCPAddr)
+	return address.IP, address.Port
+}
+
+func TestContainerDetectors(t *testing.T) {
+	type detectFunc = func(net.IP, int, *domain.ScannerConfig) (*domain.Detection, error)
+	tests := []struct {
+		name     string
+		detect   detectFunc
+		replies  map[string]apiReply
+		version  string
+		info     []string
+		findings []string
+		ok       bool
+	}{
+		{
+			name:     "docker without tls",
+			detect:   detectDocker,
+			replies:  map[string]apiReply{"/version": {200, dockerVersion}},
+			version:  "24.0.7",
+			info:     []string{"transport: http", "api: 1.43", "os: linux/amd64 6.1.0-13-amd64"},
+			findings: []string{"docker-api-unauthenticated"},
+			ok:       true,
+		},
+		{
+			name:    "kubernetes version of another api",
+			detect:  detectDocker,
+			replies: map[string]apiReply{"/version": {200, kubernetesVersion}},
+		},
+		{
+			name:   "kubernetes with anonymous access",
+			detect: detectKubernetes,
+			replies: map[string]apiReply{
+				"/version":     {200, kubernetesVersion},
+				"/healthz":     {200, "ok"},
+				"/api/v1/pods": {200, `{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"1042"},"items":[]}`},
+			},
+			version:  "v1.28.3",
+			info:     []string{"transport: http", "platform: linux/amd64", "healthz: 200 ok"},
+			findings: []string{"kubernetes-anonymous-access"},
+			ok:       true,
+		},
+		{
+			name:   "kubernetes pods forbidden",
+			detect: detectKubernetes,
+			replies: map[string]apiReply{
+				"/version":     {200, kubernetesVersion},
+				"/healthz":     {200, "ok"},
+				"/api/v1/pods": {403, kubernetesPodsForbidden},
+			},
+			version: "v1.28.3",
+			info:    []string{"transport: http", "platform: linux/amd64", "healthz: 200 ok", "anonymous: enabled, pods forbidden"},
+			ok:      true,
+		},
+		{
+			name:   "kubernetes without anonymous access",
+			detect: detectKubernetes,
+			replies: map[string]apiReply{
+				"/version":     {401, kubernetesUnauthorized},
+				"/healthz":     {401, kubernetesUnauthorized},
+				"/api/v1/pods": {401, kubernetesUnauthorized},
+			},
+			info: []string{"transport: http", "healthz: 401 " + kubernetesUnauthorized, "anonymous: disabled"},
+			ok:   true,
+		},
+		{
+			name:    "plain web server is not kubernetes",
+			detect:  detectKubernetes,
+			replies: map[string]apiReply{"/version": {401, "Unauthorized"}},
+		},
+		{
+			name:   "kubelet lists pods",
+			detect: detectKubelet,
+			replies: map[string]apiReply{
+				"/pods":    {200, kubeletPods},
+				"/healthz": {200, "ok"},
+			},
+			info:     []string{"transport: http", "pods: 2", "healthz: 200 ok"},
+			findings: []string{"kubelet-anonymous-access"},
+			ok:       true,
+		},
+		{
+			name:    "kubelet forbids anonymous",
+			detect:  detectKubelet,
+			replies: map[string]apiReply{"/pods": {403, kubeletForbidden}},
+			info:    []string{"transport: http", "anonymous: enabled, pods forbidden", "healthz: 404 404 page not found"},
+			ok:      true,
+		},
+		{
+			name:    "kubelet requires authentication",
+			detect:  detectKubelet,
+			replies: map[string]apiReply{"/pods": {401, "Unauthorized"}},
+			info:    []string{"transport: http", "anonymous: disabled", "healthz: 404 404 page not found"},
+			ok:      true,
+		},
+		{
+			name:    "api server status is not kubelet",
+			detect:  detectKubelet,
+			replies: map[string]apiReply{"/pods": {403, kubernetesPodsForbidden}},
+		},
+	}
+	for _, test := range tests {
+		ip, port := serveAPI(t, test.replies)
+		detection, err := test.detect(ip, port, testConfig())
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%s: expected error, got %+v", test.name, detection)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var findings []string
+		for _, finding := range detection.Findings {
+			findings = append(findings, finding.Check)
+		}
+		if detection.Version != test.version || !slices.Equal(detection.Info, test.info) || !slices.Equal(findings, test.findings) {
+			t.Errorf("%s: got version %q, info %q, findings %q", test.name, detection.Version, detection.Info, findings)
+		}
+	}
+}
+
+func TestDetectDockerClientCertificate(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(dockerVersion))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	address := server.Listener.Addr().(*net.TCPAddr)
+
+	// На другом порту отказ в рукопожатии ни о чём не говорит
+	if detection, err := detectDocker(address.IP, address.Port, testConfig()); err == nil {
+		t.Errorf("got %+v on a port other than 2376", detection)
+	}
+
+	ports := dockerTLSPorts
+	dockerTLSPorts = []int{address.Port}
+	t.Cleanup(func() { dockerTLSPorts = ports })
+	detection, err := detectDocker(address.IP, address.Port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"transport: https", "auth: client certificate required"}
+	if detection.Protocol != "Docker" || !slices.Equal(detection.Info, want) || len(detection.Findings) != 0 {
+		t.Errorf("got %+v", detection)
+	}
+}
+
+func TestAPIClientSchemeFallback(t *testing.T) {
+	ip, port := serveAPI(t, map[string]apiReply{"/version": {200, dockerVersion}})
+	client := newAPIClient(ip, port, testConfig().Timeout)
+	if _, err := client.get("/version"); err != nil || client.scheme != "http" {
+		t.Fatalf("got scheme %q, error %v", client.scheme, err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	address := server.Listener.Addr().(*net.TCPAddr)
+	client = newAPIClient(address.IP, address.Port, testConfig().Timeout)
+	if _, err := client.get("/"); err != nil || client.scheme != "https" || client.certRequested.Load() {
+		t.Errorf("got scheme %q, error %v", client.scheme, err)
+	}
+	if client.address != net.JoinHostPort("127.0.0.1", strconv.Itoa(address.Port)) {
+		t.Errorf("got address %q", client.address)
+	}
+}
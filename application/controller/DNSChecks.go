@@ -0,0 +1,296 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/futig/PortScannerGo/application/dns"
+	"github.com/futig/PortScannerGo/domain"
+)
+
+// Имя вне зон проверяемого сервера: ответить на него может только рекурсивный резолвер
+const openResolverName = "example.com"
+
+// Размер буфера, который указывают в запросах для усиления
+const amplificationUDPSize uint16 = 4096
+
+// Запросы с заведомо большими ответами, из которых берётся наибольший
+var amplificationQueries = []struct {
+	name  string
+	qtype uint16
+}{
+	{".", dns.TypeANY},
+	{".", dns.TypeDNSKEY},
+	{"google.com", dns.TypeTXT},
+}
+
+// Проверяет найденный DNS-сервер на открытую рекурсию и усиление ответов
+func auditDNSServer(detection *domain.Detection, network string, client *dns.Client) {
+	response, err := exchangeQuestion(client, network, openResolverName, dns.TypeA, dns.ClassIN)
+	if err == nil && isRecursiveAnswer(response) {
+		detection.Info = append(detection.Info, "recursion: open")
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "dns-open-resolver",
+			Severity: domain.SeverityHigh,
+			Detail:   fmt.Sprintf("server recursively resolved %s for an arbitrary client", openResolverName),
+		})
+	} else if err == nil {
+		detection.Info = append(detection.Info, "recursion: closed")
+	}
+
+	// Усиление имеет смысл только для UDP, где адрес отправителя не проверяется
+	if network != "udp" {
+		return
+	}
+	samples := make([]amplificationSample, 0, len(amplificationQueries))
+	for _, q := range amplificationQueries {
+		query, err := dns.NewQuery(q.name, q.qtype, dns.ClassIN)
+		if err != nil {
+			continue
+		}
+		query.WithEDNS(amplificationUDPSize).EDNS.DO = true
+		size := len(query.Encode())
+		response, err := client.ExchangeOver("udp", query)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, amplificationSample{q.name + " " + dns.TypeName(q.qtype), size, response.Size})
+	}
+	largest := largestAmplification(samples)
+	if finding, ok := amplificationFinding("dns", largest.request, largest.response); ok {
+		detection.Info = append(detection.Info, fmt.Sprintf("amplification: %.1fx (%s)",
+			float64(largest.response)/float64(largest.request), largest.query))
+		detection.Findings = append(detection.Findings, finding)
+	}
+}
+
+// Размеры запроса и ответа на одну из проб усиления
+type amplificationSample struct {
+	query    string
+	request  int
+	response int
+}
+
+// Проба с наибольшим отношением ответа к запросу; при равенстве остаётся первая
+func largestAmplification(samples []amplificationSample) amplificationSample {
+	var largest amplificationSample
+	for _, sample := range samples {
+		if sample.request <= 0 {
+			continue
+		}
+		// Сравниваем отношения размеров без деления
+		if largest.request == 0 || sample.response*largest.request > largest.response*sample.request {
+			largest = sample
+		}
+	}
+	return largest
+}
+
+// Запрос с одним вопросом; недопустимое имя считается такой же ошибкой, как сбой сети
+func exchangeQuestion(client *dns.Client, network string, name string, qtype uint16, class uint16) (*dns.Response, error) {
+	query, err := dns.NewQuery(name, qtype, class)
+	if err != nil {
+		return nil, err
+	}
+	return client.ExchangeOver(network, query)
+}
+
+// Неавторитетный успешный ответ с записями, полученный с доступной рекурсией
+func isRecursiveAnswer(response *dns.Response) bool {
+	return response.Header.RA == 1 && response.Header.AA == 0 &&
+		response.RCode() == 0 && len(response.Answers) > 0
+}
+
+// Строки версий, которые серверы отдают на version.bind
+var dnsVersionPatterns = []struct {
+	product string
+	re      *regexp.Regexp
+}{
+	{"Unbound", regexp.MustCompile(`(?i)^unbound\s+([\d.]+)`)},
+	{"PowerDNS Recursor", regexp.MustCompile(`(?i)^powerdns recursor\s+([\w.-]+)`)},
+	{"PowerDNS Authoritative Server", regexp.MustCompile(`(?i)^powerdns authoritative server\s+([\w.-]+)`)},
+	{"dnsmasq", regexp.MustCompile(`(?i)^dnsmasq-([\w.]+)`)},
+	{"CoreDNS", regexp.MustCompile(`(?i)^coredns-([\d.]+)`)},
+	{"Windows DNS", regexp.MustCompile(`(?i)^microsoft dns\s+([\d.]+)`)},
+	{"BIND", regexp.MustCompile(`^(9\.\d+\.\d+\S*)`)},
+}
+
+// Ответы сервера на запросы, по которым различаются реализации со скрытой версией
+type dnsBehaviour struct {
+	chaos *dns.Response
+}
+
+var dnsBehaviourSignatures = []struct {
+	product string
+	match   func(b dnsBehaviour) bool
+}{
+	// При "version none" BIND остаётся авторитетным для встроенной зоны bind. CH, но запись не отдаёт
+	{"BIND", func(b dnsBehaviour) bool {
+		return b.chaos != nil && b.chaos.RCode() == 0 && b.chaos.Header.AA == 1 && len(b.chaos.Answers) == 0
+	}},
+}
+
+// Определяет реализацию DNS-сервера по CHAOS-запросам, а если версия скрыта — по поведению
+func fingerprintDNSServer(detection *domain.Detection, network string, client *dns.Client) {
+	var behaviour dnsBehaviour
+	for _, name := range []string{"version.bind", "hostname.bind", "id.server"} {
+		response, err := exchangeQuestion(client, network, name, dns.TypeTXT, dns.ClassCHAOS)
+		if err != nil {
+			continue
+		}
+		if name == "version.bind" {
+			behaviour.chaos = response
+		}
+		text := chaosText(response)
+		if text == "" {
+			continue
+		}
+		detection.Info = append(detection.Info, fmt.Sprintf("%s: %s", name, text))
+		if name == "version.bind" {
+			detection.Product, detection.Version = matchDNSVersion(text)
+		}
+	}
+	if detection.Product != "" {
+		return
+	}
+
+	for _, signature := range dnsBehaviourSignatures {
+		if signature.match(behaviour) {
+			detection.Product = signature.product
+			return
+		}
+	}
+}
+
+// Текст первой TXT-записи ответа
+func chaosText(response *dns.Response) string {
+	if response.RCode() != 0 {
+		return ""
+	}
+	for _, answer := range response.Answers {
+		if answer.Type == dns.TypeTXT {
+			return strings.Join(dns.ParseTxtRecord(answer.Data), "")
+		}
+	}
+	return ""
+}
+
+func matchDNSVersion(version string) (string, string) {
+	for _, pattern := range dnsVersionPatterns {
+		if match := pattern.re.FindStringSubmatch(version); match != nil {
+			return pattern.product, match[1]
+		}
+	}
+	return "", ""
+}
+
+// Пробует передачу зон, заданных пользователем или найденных на самом сервере
+func auditZoneTransfer(detection *domain.Detection, client *dns.Client, targetIP net.IP, cfg *domain.ScannerConfig) {
+	zones := append([]string{}, cfg.AxfrZones...)
+	for _, zone := range learnZones(client, targetIP) {
+		if !slices.Contains(zones, zone) {
+			zones = append(zones, zone)
+		}
+	}
+	if len(zones) == 0 {
+		detection.Info = append(detection.Info, "axfr: no zones to try")
+		return
+	}
+
+	for _, zone := range zones {
+		records, err := client.Transfer(zone)
+		if err != nil {
+			detection.Info = append(detection.Info, fmt.Sprintf("axfr %s: %v", zoneName(zone), err))
+			continue
+		}
+		detection.Info = append(detection.Info, fmt.Sprintf("axfr %s: allowed, %d records", zoneName(zone), len(records)))
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "dns-zone-transfer",
+			Severity: domain.SeverityHigh,
+			Detail:   fmt.Sprintf("zone %s can be transferred by anyone (%d records)", zoneName(zone), len(records)),
+		})
+		if cfg.AxfrDir == "" {
+			continue
+		}
+		path, err := saveZone(cfg.AxfrDir, zone, records)
+		if err != nil {
+			detection.Info = append(detection.Info, fmt.Sprintf("axfr %s: failed to save: %v", zoneName(zone), err))
+		} else {
+			detection.Info = append(detection.Info, fmt.Sprintf("axfr %s: saved to %s", zoneName(zone), path))
+		}
+	}
+}
+
+// Зоны, за которые сервер отвечает авторитетно: обратная зона адреса и зоны имён из её PTR-записей
+func learnZones(client *dns.Client, targetIP net.IP) []string {
+	reverse := dns.ReverseName(targetIP)
+	names := []string{reverse}
+	response, err := exchangeQuestion(client, "tcp", reverse, dns.TypePTR, dns.ClassIN)
+	if err == nil {
+		for _, answer := range response.Answers {
+			if answer.Type == dns.TypePTR {
+				names = append(names, dns.RecordToName(answer.Data))
+			}
+		}
+	}
+
+	zones := make([]string, 0)
+	for _, name := range names {
+		response, err := exchangeQuestion(client, "tcp", name, dns.TypeSOA, dns.ClassIN)
+		if err != nil || response.Header.AA != 1 {
+			continue
+		}
+		// Владелец SOA или NS в ответе или в секции полномочий и есть вершина зоны
+		for _, record := range append(response.Answers, response.Authorities...) {
+			zone := dns.RecordToName(record.Name)
+			if (record.Type == dns.TypeSOA || record.Type == dns.TypeNS) && !slices.Contains(zones, zone) {
+				zones = append(zones, zone)
+			}
+		}
+	}
+	return zones
+}
+
+func saveZone(dir string, zone string, records []*dns.ResponseData) (string, error) {
+	var b strings.Builder
+	for _, record := range records {
+		b.WriteString(record.ZoneString())
+		b.WriteByte('\n')
+	}
+	path := filepath.Join(dir, zoneFileName(zone)+".zone")
+	if filepath.Dir(path) != filepath.Clean(dir) {
+		return "", fmt.Errorf("zone file %s is outside %s", path, dir)
+	}
+	return path, os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// Имя файла зоны. Метки приходят с сервера и могут содержать '/' и "..", поэтому
+// всё, кроме букв, цифр, '-', '_' и одиночных точек между метками, записывается как %XX
+func zoneFileName(zone string) string {
+	zone = strings.TrimSuffix(zone, ".")
+	if zone == "" {
+		return "root"
+	}
+	var b strings.Builder
+	for i := 0; i < len(zone); i++ {
+		c := zone[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_':
+			b.WriteByte(c)
+		case c == '.' && i > 0 && zone[i-1] != '.':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func zoneName(zone string) string {
+	return strings.TrimSuffix(zone, ".") + "."
+}
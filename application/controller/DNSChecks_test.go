@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/futig/PortScannerGo/application/dns"
+	"github.com/futig/PortScannerGo/domain"
+)
+
+func TestIsRecursiveAnswer(t *testing.T) {
+	answer := []*dns.ResponseData{{Name: dnsName("example.com"), Type: dns.TypeA, Class: dns.ClassIN, Data: []byte{93, 184, 216, 34}}}
+	tests := []struct {
+		name   string
+		header dns.Header
+		answer []*dns.ResponseData
+		want   bool
+	}{
+		{"recursive answer", dns.Header{QR: 1, RA: 1}, answer, true},
+		{"recursion not available", dns.Header{QR: 1}, answer, false},
+		{"authoritative answer", dns.Header{QR: 1, RA: 1, AA: 1}, answer, false},
+		{"refused", dns.Header{QR: 1, RA: 1, RCode: 5}, nil, false},
+		{"servfail with answer", dns.Header{QR: 1, RA: 1, RCode: 2}, answer, false},
+		{"referral without answers", dns.Header{QR: 1, RA: 1}, nil, false},
+	}
+	for _, test := range tests {
+		response := &dns.Response{Header: test.header, Answers: test.answer}
+		if got := isRecursiveAnswer(response); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLargestAmplification(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []amplificationSample
+		want    string
+	}{
+		{"no responses", nil, ""},
+		{"single", []amplificationSample{{". ANY", 40, 400}}, ". ANY"},
+		// Больший ответ на больший запрос усиливает слабее
+		{"ratio over size", []amplificationSample{{". DNSKEY", 40, 1200}, {"google.com TXT", 60, 1500}}, ". DNSKEY"},
+		{"later wins", []amplificationSample{{". ANY", 40, 100}, {". DNSKEY", 40, 1200}}, ". DNSKEY"},
+		{"tie keeps first", []amplificationSample{{". ANY", 40, 400}, {". DNSKEY", 80, 800}}, ". ANY"},
+		{"empty request ignored", []amplificationSample{{"bad", 0, 500}, {". ANY", 40, 80}}, ". ANY"},
+	}
+	for _, test := range tests {
+		if got := largestAmplification(test.samples); got.query != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got.query, test.want)
+		}
+	}
+}
+
+// Открытый резолвер: отвечает на любое имя, а на ANY корня — большим ответом.
+// Возвращает имена всех полученных запросов
+func serveOpenResolver(t *testing.T) (*domain.ScannerConfig, func() []string, int) {
+	var mu sync.Mutex
+	var names []string
+	ip, port := serveUDP(t, func(request []byte) []byte {
+		query, err := dns.ParseResponse(request)
+		if err != nil {
+			return nil
+		}
+		name := dns.RecordToName(query.Question.QName)
+		mu.Lock()
+		names = append(names, name)
+		mu.Unlock()
+
+		response := &dns.Response{
+			Header:   dns.Header{ID: query.Header.ID, QR: 1, RD: 1, RA: 1, QDCount: 1},
+			Question: query.Question,
+		}
+		switch {
+		case name == openResolverName:
+			response.Answers = []*dns.ResponseData{{Name: query.Question.QName, Type: dns.TypeA, Class: dns.ClassIN, TTL: 60, Data: []byte{93, 184, 216, 34}}}
+		case name == "" && query.Question.QType == dns.TypeANY:
+			txt := append([]byte{200}, bytes.Repeat([]byte{'x'}, 200)...)
+			response.Answers = []*dns.ResponseData{{Type: dns.TypeTXT, Class: dns.ClassIN, TTL: 60, Data: bytes.Repeat(txt, 4)}}
+		}
+		response.Header.ANCount = uint16(len(response.Answers))
+		return response.Encode()
+	})
+	cfg := testConfig()
+	cfg.Ip = ip
+	seen := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(names)
+	}
+	return cfg, seen, port
+}
+
+func TestDNSAuditNeedsOption(t *testing.T) {
+	cfg, seen, port := serveOpenResolver(t)
+	detection, err := probeDNS("udp", cfg.Ip, port, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(detection.Findings) != 0 {
+		t.Errorf("got findings %v without --dns-audit", detection.Findings)
+	}
+	if names := seen(); slices.Contains(names, openResolverName) || slices.Contains(names, "google.com") {
+		t.Errorf("audit queries sent without --dns-audit: %q", names)
+	}
+
+	cfg.DnsAudit = true
+	detection, err = probeDNS("udp", cfg.Ip, port, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := make([]string, 0)
+	for _, finding := range detection.Findings {
+		checks = append(checks, finding.Check)
+	}
+	if !slices.Contains(checks, "dns-open-resolver") || !slices.Contains(checks, "dns-amplification") {
+		t.Errorf("got findings %q", checks)
+	}
+}
+
+func TestMatchDNSVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		product string
+		number  string
+	}{
+		{"unbound 1.17.1", "Unbound", "1.17.1"},
+		{"PowerDNS Recursor 4.8.4", "PowerDNS Recursor", "4.8.4"},
+		{"PowerDNS Authoritative Server 4.7.3 (built Jan 12 2023 by root@localhost)", "PowerDNS Authoritative Server", "4.7.3"},
+		{"dnsmasq-2.89", "dnsmasq", "2.89"},
+		{"CoreDNS-1.10.1", "CoreDNS", "1.10.1"},
+		{"Microsoft DNS 10.0.17763 (4A6159E3)", "Windows DNS", "10.0.17763"},
+		{"9.18.19-1~deb12u1-Debian", "BIND", "9.18.19-1~deb12u1-Debian"},
+		{"9.11.4-P2-RedHat-9.11.4-26.P2.el7_9.13", "BIND", "9.11.4-P2-RedHat-9.11.4-26.P2.el7_9.13"},
+		{"none", "", ""},
+		{"Go away!", "", ""},
+		{"9.x", "", ""},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		product, number := matchDNSVersion(test.version)
+		if product != test.product || number != test.number {
+			t.Errorf("%q: got %q %q, want %q %q", test.version, product, number, test.product, test.number)
+		}
+	}
+}
+
+func TestDNSBehaviourSignatures(t *testing.T) {
+	txt := []*dns.ResponseData{{Type: dns.TypeTXT, Class: dns.ClassCHAOS, Data: []byte("\x04none")}}
+	tests := []struct {
+		name      string
+		behaviour dnsBehaviour
+		want      string
+	}{
+		{"bind with hidden version", dnsBehaviour{chaos: &dns.Response{Header: dns.Header{AA: 1}}}, "BIND"},
+		{"chaos answered", dnsBehaviour{chaos: &dns.Response{Header: dns.Header{AA: 1}, Answers: txt}}, ""},
+		{"chaos refused", dnsBehaviour{chaos: &dns.Response{Header: dns.Header{AA: 1, RCode: 5}}}, ""},
+		{"chaos not authoritative", dnsBehaviour{chaos: &dns.Response{}}, ""},
+		{"no responses", dnsBehaviour{}, ""},
+	}
+	for _, test := range tests {
+		got := ""
+		for _, signature := range dnsBehaviourSignatures {
+			if signature.match(test.behaviour) {
+				got = signature.product
+				break
+			}
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDNSFingerprintNeedsOption(t *testing.T) {
+	cfg, seen, port := serveOpenResolver(t)
+	if _, err := probeDNS("udp", cfg.Ip, port, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if names := seen(); slices.Contains(names, "version.bind") || len(names) != 1 {
+		t.Errorf("got queries %q without --dns-fingerprint", names)
+	}
+
+	cfg.DnsFingerprint = true
+	detection, err := probeDNS("udp", cfg.Ip, port, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Кроме проб детектора уходят только CHAOS-запросы
+	if names := seen(); !slices.Equal(names, []string{"", "", "version.bind", "hostname.bind", "id.server"}) {
+		t.Errorf("got queries %q with --dns-fingerprint", names)
+	}
+	// Сервер не авторитетен для bind. CH, поэтому продукт остаётся неизвестным
+	if detection.Product != "" {
+		t.Errorf("got product %q", detection.Product)
+	}
+}
+
+func TestSaveZoneStaysInDir(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		zone string
+		file string
+	}{
+		{"example.com", "example.com.zone"},
+		{"example.com.", "example.com.zone"},
+		{"", "root.zone"},
+		{"2.0.192.in-addr.arpa", "2.0.192.in-addr.arpa.zone"},
+		{"../../../tmp/x", "%2E%2E%2F.%2E%2F.%2E%2Ftmp%2Fx.zone"},
+		{"..", "%2E.zone"},
+		{"a/b", "a%2Fb.zone"},
+		{"%2F", "%252F.zone"},
+		{"a\\b", "a%5Cb.zone"},
+	}
+	records := []*dns.ResponseData{{Name: dnsName("example.com"), Type: dns.TypeA, Class: dns.ClassIN, Data: []byte{192, 0, 2, 1}}}
+	for _, test := range tests {
+		path, err := saveZone(dir, test.zone, records)
+		if err != nil {
+			t.Errorf("%q: %v", test.zone, err)
+			continue
+		}
+		if path != filepath.Join(dir, test.file) {
+			t.Errorf("%q: saved to %s, want %s", test.zone, path, test.file)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(tests)-1 {
+		t.Errorf("got %d files in %s", len(entries), dir)
+	}
+}
@@ -0,0 +1,624 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+const (
+	mongoOpReply = 1
+	mongoOpQuery = 2004
+	mongoOpMsg   = 2013
+
+	mongoOpMsgWireVersion = 6
+)
+
+var mssqlReleases = map[byte]string{
+	8:  "2000",
+	9:  "2005",
+	10: "2008",
+	11: "2012",
+	12: "2014",
+	13: "2016",
+	14: "2017",
+	15: "2019",
+	16: "2022",
+}
+
+func detectMySQL(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	header := make([]byte, 4)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return nil, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if header[3] != 0 || length < 1 || length > 1024 {
+		return nil, fmt.Errorf("not a mysql greeting")
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(conn, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	detection := &domain.Detection{Protocol: "MySQL", Product: "MySQL", Evidence: domain.EvidenceHandshake}
+
+	// Сервер может сразу отказать в подключении, например "Host is not allowed"
+	if payload[0] == 0xff {
+		if len(payload) < 3 {
+			return nil, fmt.Errorf("not a mysql greeting")
+		}
+		message := string(payload[3:])
+		if strings.HasPrefix(message, "#") && len(message) > 6 {
+			message = message[6:]
+		}
+		detection.Info = append(detection.Info, "error: "+message)
+		return detection, nil
+	}
+
+	if payload[0] != 10 {
+		return nil, fmt.Errorf("unsupported mysql protocol version %d", payload[0])
+	}
+	end := bytes.IndexByte(payload[1:], 0)
+	if end == -1 {
+		return nil, fmt.Errorf("not a mysql greeting")
+	}
+	version := string(payload[1 : end+1])
+	detection.Version = version
+	if strings.Contains(version, "MariaDB") {
+		detection.Product = "MariaDB"
+		detection.Version = strings.TrimPrefix(version, "5.5.5-")
+	}
+
+	plugin := readMySQLAuthPlugin(payload[end+2:])
+	if plugin != "" {
+		detection.Info = append(detection.Info, "auth plugin: "+plugin)
+		if plugin == "mysql_old_password" {
+			detection.Findings = append(detection.Findings, domain.Finding{
+				Check:    "mysql-old-password",
+				Severity: domain.SeverityHigh,
+				Detail:   "server uses pre-4.1 password hashing",
+			})
+		}
+	}
+	return detection, nil
+}
+
+func readMySQLAuthPlugin(rest []byte) string {
+	// connection id(4), auth data(8), filler(1), capabilities(2), charset(1),
+	// status(2), capabilities(2), auth data length(1), reserved(10)
+	if len(rest) < 31 {
+		return ""
+	}
+	capabilities := uint32(binary.LittleEndian.Uint16(rest[13:15])) |
+		uint32(binary.LittleEndian.Uint16(rest[18:20]))<<16
+	authDataLength := int(rest[20])
+	rest = rest[31:]
+
+	const clientPluginAuth = 0x00080000
+	if capabilities&clientPluginAuth == 0 {
+		return ""
+	}
+	skip := max(13, authDataLength-8)
+	if len(rest) < skip {
+		return ""
+	}
+	rest = rest[skip:]
+	end := bytes.IndexByte(rest, 0)
+	if end == -1 {
+		end = len(rest)
+	}
+	return string(rest[:end])
+}
+
+func detectPostgreSQL(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	sslRequest := make([]byte, 8)
+	binary.BigEndian.PutUint32(sslRequest[0:4], 8)
+	binary.BigEndian.PutUint32(sslRequest[4:8], 80877103)
+	_, err = conn.Write(sslRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := make([]byte, 1)
+	_, err = io.ReadFull(conn, answer)
+	if err != nil {
+		return nil, err
+	}
+
+	// Один байт в ответ на SSLRequest — слабый признак, рукопожатием его делает только ответ на StartupMessage
+	detection := &domain.Detection{Protocol: "PostgreSQL", Product: "PostgreSQL", Evidence: domain.EvidenceBanner}
+	switch answer[0] {
+	case 'S':
+		detection.Info = append(detection.Info, "ssl: supported")
+	case 'N':
+		detection.Info = append(detection.Info, "ssl: not supported")
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "postgresql-no-ssl",
+			Severity: domain.SeverityMedium,
+			Detail:   "server does not support SSL connections",
+		})
+	default:
+		return nil, fmt.Errorf("not a postgresql server")
+	}
+
+	auth, err := probePostgreSQLStartup(targetIP, port, cfg)
+	if err == nil {
+		detection.Evidence = domain.EvidenceHandshake
+		detection.Info = append(detection.Info, auth)
+		if auth == "auth: trust" {
+			detection.Findings = append(detection.Findings, domain.Finding{
+				Check:    "postgresql-no-auth",
+				Severity: domain.SeverityHigh,
+				Detail:   "server accepted a startup message without authentication",
+			})
+		}
+	}
+	return detection, nil
+}
+
+func probePostgreSQLStartup(targetIP net.IP, port int, cfg *domain.ScannerConfig) (string, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	params := []byte("user\x00postgres\x00database\x00postgres\x00application_name\x00portscan\x00\x00")
+	startup := make([]byte, 8, 8+len(params))
+	binary.BigEndian.PutUint32(startup[0:4], uint32(8+len(params)))
+	binary.BigEndian.PutUint32(startup[4:8], 196608)
+	startup = append(startup, params...)
+	_, err = conn.Write(startup)
+	if err != nil {
+		return "", err
+	}
+
+	header := make([]byte, 5)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return "", err
+	}
+	length := int(binary.BigEndian.Uint32(header[1:5]))
+	if length < 4 || length > 8192 {
+		return "", fmt.Errorf("invalid postgresql message")
+	}
+	body := make([]byte, length-4)
+	_, err = io.ReadFull(conn, body)
+	if err != nil {
+		return "", err
+	}
+
+	switch header[0] {
+	case 'R':
+		if len(body) < 4 {
+			return "", fmt.Errorf("invalid authentication request")
+		}
+		switch binary.BigEndian.Uint32(body[0:4]) {
+		case 0:
+			return "auth: trust", nil
+		case 3:
+			return "auth: cleartext password", nil
+		case 5:
+			return "auth: md5", nil
+		case 10:
+			return "auth: " + strings.ReplaceAll(strings.Trim(string(body[4:]), "\x00"), "\x00", ","), nil
+		default:
+			return fmt.Sprintf("auth: method %d", binary.BigEndian.Uint32(body[0:4])), nil
+		}
+	case 'E':
+		return "error: " + parsePostgreSQLError(body), nil
+	}
+	return "", fmt.Errorf("unexpected postgresql message '%c'", header[0])
+}
+
+func parsePostgreSQLError(body []byte) string {
+	var code, message string
+	for _, field := range bytes.Split(body, []byte{0}) {
+		if len(field) < 2 {
+			continue
+		}
+		switch field[0] {
+		case 'C':
+			code = string(field[1:])
+		case 'M':
+			message = string(field[1:])
+		}
+	}
+	return fmt.Sprintf("%s %s", code, message)
+}
+
+func detectMSSQL(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// VERSION, ENCRYPTION, INSTOPT, THREADID, MARS и терминатор
+	options := []byte{
+		0x00, 0x00, 0x1a, 0x00, 0x06,
+		0x01, 0x00, 0x20, 0x00, 0x01,
+		0x02, 0x00, 0x21, 0x00, 0x01,
+		0x03, 0x00, 0x22, 0x00, 0x04,
+		0x04, 0x00, 0x26, 0x00, 0x01,
+		0xff,
+	}
+	data := []byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00,
+		0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00,
+	}
+	payload := append(options, data...)
+	packet := []byte{0x12, 0x01, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00}
+	binary.BigEndian.PutUint16(packet[2:4], uint16(8+len(payload)))
+	packet = append(packet, payload...)
+
+	_, err = conn.Write(packet)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 8)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header[2:4]))
+	if header[0] != 0x04 || length < 8 {
+		return nil, fmt.Errorf("not a tds response")
+	}
+	body := make([]byte, length-8)
+	_, err = io.ReadFull(conn, body)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := parsePreloginTokens(body)
+	if err != nil {
+		return nil, err
+	}
+	version, ok := tokens[0x00]
+	if !ok || len(version) < 4 {
+		return nil, fmt.Errorf("prelogin response has no version")
+	}
+
+	detection := &domain.Detection{
+		Protocol: "MSSQL",
+		Evidence: domain.EvidenceHandshake,
+		Product:  "Microsoft SQL Server",
+		Version:  fmt.Sprintf("%d.%d.%d", version[0], version[1], binary.BigEndian.Uint16(version[2:4])),
+	}
+	if release, ok := mssqlReleases[version[0]]; ok {
+		detection.Product += " " + release
+	}
+
+	if encryption, ok := tokens[0x01]; ok && len(encryption) == 1 {
+		switch encryption[0] {
+		case 0x00:
+			detection.Info = append(detection.Info, "encryption: login only")
+		case 0x01:
+			detection.Info = append(detection.Info, "encryption: on")
+		case 0x02:
+			detection.Info = append(detection.Info, "encryption: not supported")
+			detection.Findings = append(detection.Findings, domain.Finding{
+				Check:    "mssql-no-encryption",
+				Severity: domain.SeverityMedium,
+				Detail:   "server does not support TDS encryption",
+			})
+		case 0x03:
+			detection.Info = append(detection.Info, "encryption: required")
+		}
+	}
+	return detection, nil
+}
+
+func parsePreloginTokens(body []byte) (map[byte][]byte, error) {
+	tokens := make(map[byte][]byte)
+	for pos := 0; pos < len(body); pos += 5 {
+		if body[pos] == 0xff {
+			return tokens, nil
+		}
+		if pos+5 > len(body) {
+			break
+		}
+		offset := int(binary.BigEndian.Uint16(body[pos+1 : pos+3]))
+		length := int(binary.BigEndian.Uint16(body[pos+3 : pos+5]))
+		if offset+length > len(body) {
+			return nil, fmt.Errorf("prelogin token is out of bounds")
+		}
+		tokens[body[pos]] = body[offset : offset+length]
+	}
+	return nil, fmt.Errorf("prelogin response is truncated")
+}
+
+func detectMongoDB(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	hello, err := mongoCommand(conn, 1, "isMaster", false)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := hello["maxWireVersion"]; !ok {
+		return nil, fmt.Errorf("not a mongodb server")
+	}
+
+	detection := &domain.Detection{Protocol: "MongoDB", Product: "MongoDB", Evidence: domain.EvidenceHandshake}
+	if msg, ok := hello["msg"].(string); ok && msg == "isdbgrid" {
+		detection.Info = append(detection.Info, "role: mongos")
+	}
+	if setName, ok := hello["setName"].(string); ok {
+		detection.Info = append(detection.Info, "replica set: "+setName)
+	}
+
+	// OP_MSG появился в 3.6 (wire version 6), а с 5.1 OP_QUERY принимается только для hello/isMaster
+	wireVersion, _ := hello["maxWireVersion"].(float64)
+	opMsg := wireVersion >= mongoOpMsgWireVersion
+	buildInfo, err := mongoCommand(conn, 2, "buildinfo", opMsg)
+	if err == nil {
+		if version, ok := buildInfo["version"].(string); ok {
+			detection.Version = version
+		}
+	}
+
+	databases, err := mongoCommand(conn, 3, "listDatabases", opMsg)
+	if err == nil {
+		if ok, _ := databases["ok"].(float64); ok == 1 {
+			detection.Findings = append(detection.Findings, domain.Finding{
+				Check:    "mongodb-no-auth",
+				Severity: domain.SeverityHigh,
+				Detail:   "listDatabases succeeded without authentication",
+			})
+		}
+	}
+	return detection, nil
+}
+
+func mongoCommand(conn net.Conn, requestID uint32, command string, opMsg bool) (map[string]any, error) {
+	body := make([]byte, 0, 64)
+	opCode, replyCode := uint32(mongoOpQuery), uint32(mongoOpReply)
+	if opMsg {
+		opCode, replyCode = mongoOpMsg, mongoOpMsg
+		// flagBits и одна секция типа 0 с документом команды
+		body = binary.LittleEndian.AppendUint32(body, 0)
+		body = append(body, 0)
+		body = append(body, encodeBSONCommand(command, "admin")...)
+	} else {
+		// OP_QUERY к admin.$cmd поддерживается всеми версиями для команд рукопожатия
+		body = binary.LittleEndian.AppendUint32(body, 0)
+		body = append(body, []byte("admin.$cmd\x00")...)
+		body = binary.LittleEndian.AppendUint32(body, 0)
+		body = binary.LittleEndian.AppendUint32(body, math.MaxUint32)
+		body = append(body, encodeBSONCommand(command, "")...)
+	}
+
+	message := make([]byte, 16, 16+len(body))
+	binary.LittleEndian.PutUint32(message[0:4], uint32(16+len(body)))
+	binary.LittleEndian.PutUint32(message[4:8], requestID)
+	binary.LittleEndian.PutUint32(message[12:16], opCode)
+	message = append(message, body...)
+
+	_, err := conn.Write(message)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 16)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return nil, err
+	}
+	length := int(binary.LittleEndian.Uint32(header[0:4]))
+	if binary.LittleEndian.Uint32(header[12:16]) != replyCode || length < 26 || length > 16*1024*1024 {
+		return nil, fmt.Errorf("unexpected mongodb reply")
+	}
+	reply := make([]byte, length-16)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return nil, err
+	}
+	if opMsg {
+		if reply[4] != 0 {
+			return nil, fmt.Errorf("unexpected OP_MSG section %d", reply[4])
+		}
+		return decodeBSON(reply[5:])
+	}
+	if len(reply) < 20 {
+		return nil, fmt.Errorf("OP_REPLY is truncated")
+	}
+	return decodeBSON(reply[20:])
+}
+
+// Документ {command: 1}, а для OP_MSG ещё и {$db: db}
+func encodeBSONCommand(command string, db string) []byte {
+	doc := []byte{0, 0, 0, 0}
+	doc = append(doc, 0x10)
+	doc = append(doc, command...)
+	doc = append(doc, 0)
+	doc = binary.LittleEndian.AppendUint32(doc, 1)
+	if db != "" {
+		doc = append(doc, 0x02)
+		doc = append(doc, "$db\x00"...)
+		doc = binary.LittleEndian.AppendUint32(doc, uint32(len(db)+1))
+		doc = append(doc, db...)
+		doc = append(doc, 0)
+	}
+	doc = append(doc, 0)
+	binary.LittleEndian.PutUint32(doc[0:4], uint32(len(doc)))
+	return doc
+}
+
+// Разбирает только верхний уровень документа; вложенные документы пропускаются
+func decodeBSON(doc []byte) (map[string]any, error) {
+	if len(doc) < 5 {
+		return nil, fmt.Errorf("bson document is too short")
+	}
+	length := int(binary.LittleEndian.Uint32(doc[0:4]))
+	if length > len(doc) || length < 5 {
+		return nil, fmt.Errorf("bson document is truncated")
+	}
+	doc = doc[:length]
+
+	result := make(map[string]any)
+	pos := 4
+	for pos < len(doc) && doc[pos] != 0 {
+		kind := doc[pos]
+		end := bytes.IndexByte(doc[pos+1:], 0)
+		if end == -1 {
+			return nil, fmt.Errorf("bson key is truncated")
+		}
+		key := string(doc[pos+1 : pos+1+end])
+		pos += end + 2
+
+		size := 0
+		switch kind {
+		case 0x01, 0x09, 0x11, 0x12:
+			size = 8
+		case 0x02, 0x0d, 0x0e:
+			if pos+4 > len(doc) {
+				return nil, fmt.Errorf("bson string is truncated")
+			}
+			size = 4 + int(binary.LittleEndian.Uint32(doc[pos:pos+4]))
+		case 0x03, 0x04:
+			if pos+4 > len(doc) {
+				return nil, fmt.Errorf("bson document is truncated")
+			}
+			size = int(binary.LittleEndian.Uint32(doc[pos : pos+4]))
+		case 0x05:
+			if pos+4 > len(doc) {
+				return nil, fmt.Errorf("bson binary is truncated")
+			}
+			size = 5 + int(binary.LittleEndian.Uint32(doc[pos:pos+4]))
+		case 0x07:
+			size = 12
+		case 0x08:
+			size = 1
+		case 0x0a, 0xff, 0x7f:
+			size = 0
+		case 0x10:
+			size = 4
+		case 0x13:
+			size = 16
+		default:
+			return nil, fmt.Errorf("unsupported bson type 0x%02x", kind)
+		}
+		if size < 0 || pos+size > len(doc) {
+			return nil, fmt.Errorf("bson value is truncated")
+		}
+		value := doc[pos : pos+size]
+		pos += size
+
+		switch kind {
+		case 0x01:
+			result[key] = math.Float64frombits(binary.LittleEndian.Uint64(value))
+		case 0x02:
+			result[key] = strings.TrimSuffix(string(value[4:]), "\x00")
+		case 0x08:
+			result[key] = value[0] == 1
+		case 0x10:
+			result[key] = float64(int32(binary.LittleEndian.Uint32(value)))
+		case 0x12:
+			result[key] = float64(int64(binary.LittleEndian.Uint64(value)))
+		default:
+			result[key] = value
+		}
+	}
+	return result, nil
+}
+
+func detectRedis(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	_, err = conn.Write([]byte("PING\r\n"))
+	if err != nil {
+		return nil, err
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	detection := &domain.Detection{Protocol: "Redis", Product: "Redis", Evidence: domain.EvidenceHandshake}
+	switch {
+	case line == "+PONG":
+	case strings.HasPrefix(line, "-NOAUTH"), strings.HasPrefix(line, "-WRONGPASS"):
+		detection.Info = append(detection.Info, "auth: required")
+		return detection, nil
+	case strings.HasPrefix(line, "-DENIED"):
+		detection.Info = append(detection.Info, "protected mode: enabled")
+		return detection, nil
+	default:
+		return nil, fmt.Errorf("not a redis server")
+	}
+
+	detection.Findings = append(detection.Findings, domain.Finding{
+		Check:    "redis-no-auth",
+		Severity: domain.SeverityHigh,
+		Detail:   "server answered PING without authentication",
+	})
+
+	_, err = conn.Write([]byte("INFO server\r\n"))
+	if err != nil {
+		return detection, nil
+	}
+	sizeLine, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(sizeLine, "$") {
+		return detection, nil
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(sizeLine[1:]))
+	if err != nil || size < 0 || size > 64*1024 {
+		return detection, nil
+	}
+	info := make([]byte, size)
+	_, err = io.ReadFull(reader, info)
+	if err != nil {
+		return detection, nil
+	}
+
+	for _, field := range strings.Split(string(info), "\r\n") {
+		name, value, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		switch name {
+		case "redis_version":
+			detection.Version = value
+		case "redis_mode", "os":
+			detection.Info = append(detection.Info, fmt.Sprintf("%s: %s", name, value))
+		}
+	}
+	return detection, nil
+}
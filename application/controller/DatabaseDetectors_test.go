@@ -0,0 +1,294 @@
+package controller
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+func testConfig() *domain.ScannerConfig {
+	cfg := domain.NewDefaultScannerConfig()
+	cfg.Timeout = time.Second
+	return cfg
+}
+
+// Документ BSON из строк, чисел double и int32
+func bsonDocument(fields ...any) []byte {
+	doc := []byte{0, 0, 0, 0}
+	for i := 0; i+1 < len(fields); i += 2 {
+		key := fields[i].(string)
+		switch value := fields[i+1].(type) {
+		case string:
+			doc = append(doc, 0x02)
+			doc = append(doc, key+"\x00"...)
+			doc = binary.LittleEndian.AppendUint32(doc, uint32(len(value)+1))
+			doc = append(doc, value+"\x00"...)
+		case float64:
+			doc = append(doc, 0x01)
+			doc = append(doc, key+"\x00"...)
+			doc = binary.LittleEndian.AppendUint64(doc, math.Float64bits(value))
+		case int:
+			doc = append(doc, 0x10)
+			doc = append(doc, key+"\x00"...)
+			doc = binary.LittleEndian.AppendUint32(doc, uint32(value))
+		}
+	}
+	doc = append(doc, 0)
+	binary.LittleEndian.PutUint32(doc, uint32(len(doc)))
+	return doc
+}
+
+// Ведёт себя как MongoDB 5.1+: на OP_QUERY отвечает только для isMaster
+func fakeMongoDB(conn net.Conn) {
+	for {
+		header := make([]byte, 16)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.LittleEndian.Uint32(header[0:4])-16)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		var reply []byte
+		opCode := binary.LittleEndian.Uint32(header[12:16])
+		switch opCode {
+		case mongoOpQuery:
+			// flags, "admin.$cmd\0", skip, limit и документ команды
+			command, _ := decodeBSON(body[4+11+8:])
+			if _, ok := command["isMaster"]; !ok {
+				return
+			}
+			reply = binary.LittleEndian.AppendUint32(nil, 0)
+			reply = binary.LittleEndian.AppendUint64(reply, 0)
+			reply = binary.LittleEndian.AppendUint32(reply, 0)
+			reply = binary.LittleEndian.AppendUint32(reply, 1)
+			reply = append(reply, bsonDocument("ismaster", 1.0, "maxWireVersion", 21, "ok", 1.0)...)
+			opCode = mongoOpReply
+		case mongoOpMsg:
+			command, err := decodeBSON(body[5:])
+			if err != nil || command["$db"] != "admin" {
+				return
+			}
+			reply = binary.LittleEndian.AppendUint32(nil, 0)
+			reply = append(reply, 0)
+			if _, ok := command["buildinfo"]; ok {
+				reply = append(reply, bsonDocument("version", "7.0.4", "ok", 1.0)...)
+			} else {
+				reply = append(reply, bsonDocument("totalSize", 8192.0, "ok", 1.0)...)
+			}
+		default:
+			return
+		}
+		response := binary.LittleEndian.AppendUint32(nil, uint32(16+len(reply)))
+		response = binary.LittleEndian.AppendUint32(response, 100)
+		response = append(response, header[4:8]...)
+		response = binary.LittleEndian.AppendUint32(response, opCode)
+		conn.Write(append(response, reply...))
+	}
+}
+
+func TestDetectMongoDBUsesOpMsg(t *testing.T) {
+	ip, port := serveTCP(t, fakeMongoDB)
+	detection, err := detectMongoDB(ip, port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detection.Version != "7.0.4" {
+		t.Errorf("got version %q, want 7.0.4", detection.Version)
+	}
+	if len(detection.Findings) != 1 || detection.Findings[0].Check != "mongodb-no-auth" {
+		t.Errorf("got findings %v", detection.Findings)
+	}
+}
+
+func TestDecodeBSON(t *testing.T) {
+	doc := bsonDocument("version", "7.0.4", "maxWireVersion", 21, "ok", 1.0)
+	result, err := decodeBSON(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["version"] != "7.0.4" || result["maxWireVersion"] != 21.0 || result["ok"] != 1.0 {
+		t.Errorf("got %v", result)
+	}
+	for _, length := range []int{0, 4, 10, len(doc) - 1} {
+		if _, err := decodeBSON(doc[:length]); err == nil {
+			t.Errorf("length %d: expected error", length)
+		}
+	}
+}
+
+func fakePostgreSQL(startup bool) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		request := make([]byte, 8)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		if binary.BigEndian.Uint32(request[4:8]) == 80877103 {
+			conn.Write([]byte("N"))
+			return
+		}
+		if startup {
+			// AuthenticationOk: сервер пускает без пароля
+			conn.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+		}
+	}
+}
+
+func TestDetectPostgreSQLEvidence(t *testing.T) {
+	ip, port := serveTCP(t, fakePostgreSQL(true))
+	detection, err := detectPostgreSQL(ip, port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detection.Evidence != domain.EvidenceHandshake {
+		t.Errorf("got evidence %q with startup reply", detection.Evidence)
+	}
+	if len(detection.Findings) != 2 {
+		t.Errorf("got findings %v", detection.Findings)
+	}
+
+	ip, port = serveTCP(t, fakePostgreSQL(false))
+	detection, err = detectPostgreSQL(ip, port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detection.Evidence != domain.EvidenceBanner {
+		t.Errorf("got evidence %q from SSLRequest alone", detection.Evidence)
+	}
+}
+
+// Приветствие MySQL protocol 10 с именем плагина аутентификации
+func mysqlGreeting(version string, capabilitiesHigh uint16, plugin string) []byte {
+	payload := append([]byte{10}, version+"\x00"...)
+	payload = append(payload, 0x0b, 0x00, 0x00, 0x00)
+	payload = append(payload, "01234567\x00"...)
+	payload = binary.LittleEndian.AppendUint16(payload, 0xffff)
+	payload = append(payload, 0xff)
+	payload = binary.LittleEndian.AppendUint16(payload, 0x0002)
+	payload = binary.LittleEndian.AppendUint16(payload, capabilitiesHigh)
+	payload = append(payload, 21)
+	payload = append(payload, make([]byte, 10)...)
+	payload = append(payload, "89abcdefghij\x00"...)
+	return append(payload, plugin+"\x00"...)
+}
+
+func mysqlPacket(payload []byte) []byte {
+	packet := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), 0}
+	return append(packet, payload...)
+}
+
+func TestDetectMySQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		product string
+		version string
+		info    string
+	}{
+		{"mysql 8", mysqlGreeting("8.0.36", 0xdfff, "caching_sha2_password"), "MySQL", "8.0.36", "auth plugin: caching_sha2_password"},
+		{"mariadb", mysqlGreeting("5.5.5-10.11.6-MariaDB-0+deb12u1", 0x81bf, "mysql_native_password"),
+			"MariaDB", "10.11.6-MariaDB-0+deb12u1", "auth plugin: mysql_native_password"},
+		{"no plugin auth", mysqlGreeting("5.1.73", 0x0007, ""), "MySQL", "5.1.73", ""},
+		{"host not allowed", append([]byte{0xff, 0x6a, 0x04}, "Host '10.0.0.5' is not allowed to connect to this MySQL server"...),
+			"MySQL", "", "error: Host '10.0.0.5' is not allowed to connect to this MySQL server"},
+		{"sql state", append([]byte{0xff, 0x10, 0x04}, "#08S01Too many connections"...), "MySQL", "", "error: Too many connections"},
+	}
+	for _, test := range tests {
+		ip, port := serveTCP(t, func(conn net.Conn) { conn.Write(mysqlPacket(test.payload)) })
+		detection, err := detectMySQL(ip, port, testConfig())
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		info := ""
+		if len(detection.Info) > 0 {
+			info = detection.Info[0]
+		}
+		if detection.Product != test.product || detection.Version != test.version || info != test.info {
+			t.Errorf("%s: got %q %q %q", test.name, detection.Product, detection.Version, detection.Info)
+		}
+	}
+
+	ip, port := serveTCP(t, func(conn net.Conn) { conn.Write(mysqlPacket(mysqlGreeting("4.0.27", 0, "")[:5])) })
+	if _, err := detectMySQL(ip, port, testConfig()); err == nil {
+		t.Error("greeting without version terminator: expected error")
+	}
+	ip, port = serveTCP(t, func(conn net.Conn) { conn.Write([]byte("SSH-2.0-OpenSSH_9.2\r\n")) })
+	if _, err := detectMySQL(ip, port, testConfig()); err == nil {
+		t.Error("ssh banner detected as mysql")
+	}
+}
+
+// Ответ PRELOGIN SQL Server 2019 CU: VERSION, ENCRYPTION, INSTOPT, THREADID и MARS
+var mssqlPreloginResponse = []byte{
+	0x00, 0x00, 0x1a, 0x00, 0x06,
+	0x01, 0x00, 0x20, 0x00, 0x01,
+	0x02, 0x00, 0x21, 0x00, 0x01,
+	0x03, 0x00, 0x22, 0x00, 0x00,
+	0x04, 0x00, 0x22, 0x00, 0x01,
+	0xff,
+	0x0f, 0x00, 0x10, 0x7a, 0x00, 0x00,
+	0x02,
+	0x00,
+	0x00,
+}
+
+func TestParsePreloginTokens(t *testing.T) {
+	tokens, err := parsePreloginTokens(mssqlPreloginResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 5 || len(tokens[0x00]) != 6 || tokens[0x01][0] != 0x02 || len(tokens[0x03]) != 0 {
+		t.Errorf("got %v", tokens)
+	}
+
+	outOfBounds := slices.Clone(mssqlPreloginResponse)
+	outOfBounds[4] = 0x40
+	for name, body := range map[string][]byte{
+		"no terminator":  mssqlPreloginResponse[:25],
+		"partial option": mssqlPreloginResponse[:7],
+		"token past end": outOfBounds,
+		"empty":          {},
+	} {
+		if _, err := parsePreloginTokens(body); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestDetectMSSQL(t *testing.T) {
+	ip, port := serveTCP(t, func(conn net.Conn) {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(conn, header); err != nil || header[0] != 0x12 {
+			return
+		}
+		io.ReadFull(conn, make([]byte, binary.BigEndian.Uint16(header[2:4])-8))
+		response := []byte{0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00}
+		binary.BigEndian.PutUint16(response[2:4], uint16(8+len(mssqlPreloginResponse)))
+		conn.Write(append(response, mssqlPreloginResponse...))
+	})
+	detection, err := detectMSSQL(ip, port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detection.Product != "Microsoft SQL Server 2019" || detection.Version != "15.0.4218" {
+		t.Errorf("got %q %q", detection.Product, detection.Version)
+	}
+	if len(detection.Findings) != 1 || detection.Findings[0].Check != "mssql-no-encryption" {
+		t.Errorf("got findings %v", detection.Findings)
+	}
+}
+
+func TestParsePostgreSQLError(t *testing.T) {
+	body := []byte("SFATAL\x00VFATAL\x00C28000\x00Mno pg_hba.conf entry for host \"10.0.0.5\", user \"postgres\", database \"postgres\", no encryption\x00Fauth.c\x00L543\x00RClientAuthentication\x00\x00")
+	want := `28000 no pg_hba.conf entry for host "10.0.0.5", user "postgres", database "postgres", no encryption`
+	if got := parsePostgreSQLError(body); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,449 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+const (
+	coapPort = 5683
+	stunPort = 3478
+
+	stunMagicCookie = 0x2112a442
+)
+
+// Принтеры без поддержки PJL печатают полученный текст, поэтому запрос
+// отправляется только на порты JetDirect
+var jetdirectPorts = []int{9100, 9101, 9102}
+
+var ippRequestedAttributes = []string{
+	"printer-make-and-model",
+	"printer-name",
+	"printer-info",
+	"printer-location",
+	"printer-firmware-string-version",
+	"printer-device-id",
+	"ipp-versions-supported",
+}
+
+func detectIPP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	client := newAPIClient(targetIP, port, cfg.Timeout)
+	// Сетевые принтеры принимают запросы на /ipp/print, CUPS — на корень
+	var resp *apiResponse
+	for _, path := range []string{"/ipp/print", "/"} {
+		uri := fmt.Sprintf("ipp://%s%s", net.JoinHostPort(targetIP.String(), strconv.Itoa(port)), path)
+		var err error
+		resp, err = client.post(path, "application/ipp", buildIPPGetPrinterAttributes(uri))
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(resp.header.Get("Content-Type"), "application/ipp") && len(resp.body) >= 8 {
+			break
+		}
+		resp = nil
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("not an ipp response")
+	}
+
+	status := binary.BigEndian.Uint16(resp.body[2:4])
+	attributes := parseIPPAttributes(resp.body[8:])
+	detection := &domain.Detection{
+		Protocol: "IPP",
+		Evidence: domain.EvidenceHandshake,
+		Info:     []string{client.info(), fmt.Sprintf("status: 0x%04x", status)},
+	}
+	if values := attributes["printer-make-and-model"]; len(values) > 0 {
+		detection.Product = values[0]
+	}
+	if values := attributes["printer-firmware-string-version"]; len(values) > 0 {
+		detection.Version = values[0]
+	}
+	for _, name := range []string{"printer-name", "printer-info", "printer-location", "printer-device-id", "ipp-versions-supported"} {
+		if values := attributes[name]; len(values) > 0 {
+			detection.Info = append(detection.Info, strings.TrimPrefix(name, "printer-")+": "+strings.Join(values, ","))
+		}
+	}
+	return detection, nil
+}
+
+func buildIPPGetPrinterAttributes(uri string) []byte {
+	request := []byte{0x01, 0x01, 0x00, 0x0b, 0x00, 0x00, 0x00, 0x01, 0x01}
+	request = appendIPPAttribute(request, 0x47, "attributes-charset", "utf-8")
+	request = appendIPPAttribute(request, 0x48, "attributes-natural-language", "en")
+	request = appendIPPAttribute(request, 0x45, "printer-uri", uri)
+	for i, name := range ippRequestedAttributes {
+		// Дополнительные значения атрибута передаются с пустым именем
+		attribute := "requested-attributes"
+		if i > 0 {
+			attribute = ""
+		}
+		request = appendIPPAttribute(request, 0x44, attribute, name)
+	}
+	return append(request, 0x03)
+}
+
+func appendIPPAttribute(buf []byte, tag byte, name string, value string) []byte {
+	buf = append(buf, tag)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(name)))
+	buf = append(buf, name...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(value)))
+	return append(buf, value...)
+}
+
+// Возвращает строковые значения атрибутов; числовые и прочие значения пропускаются
+func parseIPPAttributes(buf []byte) map[string][]string {
+	attributes := make(map[string][]string)
+	name := ""
+	pos := 0
+	for pos < len(buf) {
+		tag := buf[pos]
+		pos++
+		if tag == 0x03 {
+			break
+		}
+		if tag < 0x10 {
+			continue
+		}
+		if pos+2 > len(buf) {
+			break
+		}
+		nameLength := int(binary.BigEndian.Uint16(buf[pos:]))
+		pos += 2
+		if pos+nameLength+2 > len(buf) {
+			break
+		}
+		if nameLength > 0 {
+			name = string(buf[pos : pos+nameLength])
+		}
+		pos += nameLength
+		valueLength := int(binary.BigEndian.Uint16(buf[pos:]))
+		pos += 2
+		if pos+valueLength > len(buf) {
+			break
+		}
+		if tag >= 0x41 && tag <= 0x49 {
+			attributes[name] = append(attributes[name], string(buf[pos:pos+valueLength]))
+		}
+		pos += valueLength
+	}
+	return attributes
+}
+
+func detectJetDirect(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	if !slices.Contains(jetdirectPorts, port) {
+		return nil, fmt.Errorf("jetdirect probe is limited to printer ports")
+	}
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("\x1b%-12345X@PJL INFO ID\r\n\x1b%-12345X\r\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(strings.TrimSpace(line), "@PJL INFO ID") {
+		return nil, fmt.Errorf("not a pjl response")
+	}
+	id, err := reader.ReadString('\n')
+	if err != nil && id == "" {
+		return nil, err
+	}
+
+	return &domain.Detection{
+		Protocol: "JetDirect",
+		Evidence: domain.EvidenceHandshake,
+		Product:  strings.Trim(strings.TrimSpace(id), "\"\f"),
+	}, nil
+}
+
+type rtspResponse struct {
+	status int
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+func detectRTSP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	url := fmt.Sprintf("rtsp://%s/", net.JoinHostPort(targetIP.String(), strconv.Itoa(port)))
+
+	options, err := exchangeRTSP(conn, reader, "OPTIONS", url, 1)
+	if err != nil {
+		return nil, err
+	}
+	detection := &domain.Detection{
+		Protocol: "RTSP",
+		Evidence: domain.EvidenceHandshake,
+		Product:  options.header.Get("Server"),
+	}
+	if public := options.header.Get("Public"); public != "" {
+		detection.Info = append(detection.Info, "methods: "+public)
+	}
+
+	describe, err := exchangeRTSP(conn, reader, "DESCRIBE", url, 2)
+	if err != nil {
+		return detection, nil
+	}
+	if detection.Product == "" {
+		detection.Product = describe.header.Get("Server")
+	}
+	switch describe.status {
+	case 200:
+		for _, line := range strings.Split(string(describe.body), "\n") {
+			line = strings.TrimSpace(line)
+			if value, ok := strings.CutPrefix(line, "s="); ok && value != "" && value != "-" {
+				detection.Info = append(detection.Info, "session: "+value)
+			}
+			if value, ok := strings.CutPrefix(line, "a=tool:"); ok {
+				detection.Info = append(detection.Info, "tool: "+value)
+			}
+		}
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "rtsp-unauthenticated",
+			Severity: domain.SeverityMedium,
+			Detail:   "stream description is available without authentication",
+		})
+	case 401:
+		detection.Info = append(detection.Info, "auth: "+describe.header.Get("Www-Authenticate"))
+	}
+	return detection, nil
+}
+
+func exchangeRTSP(conn net.Conn, reader *bufio.Reader, method string, url string, cseq int) (*rtspResponse, error) {
+	request := fmt.Sprintf("%s %s RTSP/1.0\r\nCSeq: %d\r\nAccept: application/sdp\r\n\r\n", method, url, cseq)
+	_, err := conn.Write([]byte(request))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := textproto.NewReader(reader)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "RTSP/") {
+		return nil, fmt.Errorf("not an rtsp response")
+	}
+	status, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid rtsp status %q", fields[1])
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && len(header) == 0 {
+		return nil, err
+	}
+
+	response := &rtspResponse{status: status, header: header}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length > 0 && length < 1<<16 {
+		response.body = make([]byte, length)
+		_, err = io.ReadFull(reader, response.body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+func detectCoAP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	response, err := exchangeUDP(targetIP, port, cfg.Timeout, buildCoAPDiscovery())
+	if err != nil {
+		return nil, err
+	}
+	if len(response) < 4 || response[0]>>6 != 1 {
+		return nil, fmt.Errorf("not a coap message")
+	}
+
+	code := response[1]
+	detection := &domain.Detection{
+		Protocol: "CoAP",
+		Evidence: domain.EvidenceHandshake,
+		Info:     []string{fmt.Sprintf("code: %d.%02d", code>>5, code&0x1f)},
+	}
+	payload := coapPayload(response)
+	if len(payload) == 0 {
+		return detection, nil
+	}
+
+	resources := make([]string, 0)
+	for _, link := range strings.Split(string(payload), ",") {
+		target, _, _ := strings.Cut(link, ";")
+		resources = append(resources, strings.Trim(target, "<>"))
+	}
+	if len(resources) > 20 {
+		resources = append(resources[:20], fmt.Sprintf("... %d more", len(resources)-20))
+	}
+	detection.Info = append(detection.Info, "resources: "+strings.Join(resources, " "))
+	return detection, nil
+}
+
+func buildCoAPDiscovery() []byte {
+	id := make([]byte, 2)
+	rand.Read(id)
+	// CON GET, Uri-Path ".well-known" (опция 11) и "core"
+	request := []byte{0x40, 0x01, id[0], id[1], 0xbb}
+	request = append(request, ".well-known"...)
+	request = append(request, 0x04)
+	return append(request, "core"...)
+}
+
+func coapPayload(message []byte) []byte {
+	pos := 4 + int(message[0]&0x0f)
+	for pos < len(message) {
+		if message[pos] == 0xff {
+			return message[pos+1:]
+		}
+		delta, length := int(message[pos]>>4), int(message[pos]&0x0f)
+		pos++
+		for _, value := range []*int{&delta, &length} {
+			switch *value {
+			case 13:
+				if pos >= len(message) {
+					return nil
+				}
+				*value = int(message[pos]) + 13
+				pos++
+			case 14:
+				if pos+2 > len(message) {
+					return nil
+				}
+				*value = int(binary.BigEndian.Uint16(message[pos:])) + 269
+				pos += 2
+			}
+		}
+		pos += length
+	}
+	return nil
+}
+
+func buildSTUNBindingRequest() ([]byte, []byte) {
+	request := make([]byte, 20)
+	binary.BigEndian.PutUint16(request[0:2], 0x0001)
+	binary.BigEndian.PutUint32(request[4:8], stunMagicCookie)
+	rand.Read(request[8:20])
+	return request, request[8:20]
+}
+
+func detectSTUN(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	request, transaction := buildSTUNBindingRequest()
+	response, err := exchangeUDP(targetIP, port, cfg.Timeout, request)
+	if err != nil {
+		return nil, err
+	}
+	if len(response) < 20 || binary.BigEndian.Uint32(response[4:8]) != stunMagicCookie ||
+		!bytes.Equal(response[8:20], transaction) {
+		return nil, fmt.Errorf("not a stun response")
+	}
+
+	detection := &domain.Detection{Protocol: "STUN", Evidence: domain.EvidenceHandshake}
+	if binary.BigEndian.Uint16(response[0:2]) != 0x0101 {
+		detection.Info = append(detection.Info, fmt.Sprintf("response type: 0x%04x", binary.BigEndian.Uint16(response[0:2])))
+	}
+
+	pos := 20
+	for pos+4 <= len(response) {
+		kind := binary.BigEndian.Uint16(response[pos:])
+		length := int(binary.BigEndian.Uint16(response[pos+2:]))
+		pos += 4
+		if pos+length > len(response) {
+			break
+		}
+		value := response[pos : pos+length]
+		switch kind {
+		case 0x8022:
+			detection.Product = strings.TrimRight(string(value), "\x00 ")
+		case 0x0020:
+			if address := stunXorAddress(value, transaction); address != "" {
+				detection.Info = append(detection.Info, "mapped address: "+address)
+			}
+		case 0x802c:
+			if address := stunAddress(value); address != "" {
+				detection.Info = append(detection.Info, "other address: "+address)
+			}
+		}
+		// Атрибуты выровнены по границе четырёх байт
+		pos += (length + 3) &^ 3
+	}
+	return detection, nil
+}
+
+func stunAddress(value []byte) string {
+	if len(value) < 8 {
+		return ""
+	}
+	port := int(binary.BigEndian.Uint16(value[2:4]))
+	switch {
+	case value[1] == 0x01:
+		return net.JoinHostPort(net.IP(value[4:8]).String(), strconv.Itoa(port))
+	case value[1] == 0x02 && len(value) >= 20:
+		return net.JoinHostPort(net.IP(value[4:20]).String(), strconv.Itoa(port))
+	}
+	return ""
+}
+
+func stunXorAddress(value []byte, transaction []byte) string {
+	if len(value) < 8 {
+		return ""
+	}
+	key := binary.BigEndian.AppendUint32(nil, stunMagicCookie)
+	key = append(key, transaction...)
+	plain := slices.Clone(value)
+	for i := 2; i < len(plain) && i < 20; i++ {
+		if i < 4 {
+			plain[i] ^= key[i-2]
+		} else {
+			plain[i] ^= key[i-4]
+		}
+	}
+	return stunAddress(plain)
+}
+
+func detectMQTTSN(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	// SEARCHGW с радиусом 0: шлюз отвечает GWINFO со своим идентификатором
+	response, err := exchangeUDP(targetIP, port, cfg.Timeout, []byte{0x03, 0x01, 0x00})
+	if err != nil {
+		return nil, err
+	}
+	if len(response) < 3 || int(response[0]) != len(response) {
+		return nil, fmt.Errorf("not an mqtt-sn message")
+	}
+
+	detection := &domain.Detection{Protocol: "MQTT-SN", Evidence: domain.EvidenceHandshake}
+	switch response[1] {
+	case 0x02:
+		detection.Info = append(detection.Info, fmt.Sprintf("gateway: %d", response[2]))
+	case 0x00:
+		if len(response) >= 5 {
+			duration := time.Duration(binary.BigEndian.Uint16(response[3:5])) * time.Second
+			detection.Info = append(detection.Info, fmt.Sprintf("gateway: %d, advertise every %s", response[2], duration))
+		}
+	default:
+		return nil, fmt.Errorf("unexpected mqtt-sn message 0x%02x", response[1])
+	}
+	return detection, nil
+}
@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseIPPAttributes(t *testing.T) {
+	// Ответ Get-Printer-Attributes: группа operation, группа printer и конец
+	body := []byte{0x01}
+	body = appendIPPAttribute(body, 0x47, "attributes-charset", "utf-8")
+	body = append(body, 0x04)
+	body = appendIPPAttribute(body, 0x41, "printer-make-and-model", "HP LaserJet Pro M404dn")
+	body = appendIPPAttribute(body, 0x42, "printer-name", "HP_LaserJet")
+	body = appendIPPAttribute(body, 0x21, "printer-state", "\x00\x00\x00\x03")
+	body = appendIPPAttribute(body, 0x44, "ipp-versions-supported", "1.1")
+	body = appendIPPAttribute(body, 0x44, "", "2.0")
+	body = append(body, 0x03)
+	body = appendIPPAttribute(body, 0x41, "after-end", "ignored")
+
+	attributes := parseIPPAttributes(body)
+	if got := attributes["printer-make-and-model"]; !slices.Equal(got, []string{"HP LaserJet Pro M404dn"}) {
+		t.Errorf("make and model: got %q", got)
+	}
+	if got := attributes["ipp-versions-supported"]; !slices.Equal(got, []string{"1.1", "2.0"}) {
+		t.Errorf("versions: got %q", got)
+	}
+	if _, ok := attributes["printer-state"]; ok {
+		t.Error("integer attribute kept")
+	}
+	if _, ok := attributes["after-end"]; ok {
+		t.Error("attribute after end-of-attributes kept")
+	}
+
+	// Оборванный атрибут отбрасывается, предыдущие сохраняются
+	truncated := appendIPPAttribute([]byte{0x04}, 0x42, "printer-name", "Office")
+	truncated = appendIPPAttribute(truncated, 0x41, "printer-location", "Floor 3")
+	attributes = parseIPPAttributes(truncated[:len(truncated)-3])
+	if len(attributes) != 1 || attributes["printer-name"][0] != "Office" {
+		t.Errorf("truncated: got %q", attributes)
+	}
+	for length := range truncated {
+		parseIPPAttributes(truncated[:length])
+	}
+}
+
+func TestBuildIPPGetPrinterAttributes(t *testing.T) {
+	request := buildIPPGetPrinterAttributes("ipp://192.0.2.1:631/ipp/print")
+	if binary.BigEndian.Uint16(request[2:4]) != 0x000b || request[len(request)-1] != 0x03 {
+		t.Fatalf("unexpected request %x", request)
+	}
+	attributes := parseIPPAttributes(request[8:])
+	if got := attributes["requested-attributes"]; !slices.Equal(got, ippRequestedAttributes) {
+		t.Errorf("got requested attributes %q", got)
+	}
+	if got := attributes["printer-uri"]; len(got) != 1 || got[0] != "ipp://192.0.2.1:631/ipp/print" {
+		t.Errorf("got printer-uri %q", got)
+	}
+}
+
+func TestDetectJetDirect(t *testing.T) {
+	ip, port := serveTCP(t, func(conn net.Conn) {
+		request := make([]byte, 256)
+		n, _ := conn.Read(request)
+		if !strings.Contains(string(request[:n]), "@PJL INFO ID") {
+			return
+		}
+		conn.Write([]byte("@PJL INFO ID\r\n\"HP LaserJet 4250\"\r\n\f"))
+	})
+	ports := jetdirectPorts
+	jetdirectPorts = []int{port}
+	t.Cleanup(func() { jetdirectPorts = ports })
+
+	detection, err := detectJetDirect(ip, port, testConfig())
+	if err != nil || detection.Product != "HP LaserJet 4250" {
+		t.Errorf("got %+v, error %v", detection, err)
+	}
+
+	// Принтер без PJL печатает запрос и ничего не отвечает
+	ip, port = serveTCP(t, func(conn net.Conn) { conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n")) })
+	jetdirectPorts = []int{port}
+	if _, err := detectJetDirect(ip, port, testConfig()); err == nil {
+		t.Error("expected error for a non-pjl reply")
+	}
+	if _, err := detectJetDirect(ip, 8080, testConfig()); err == nil {
+		t.Error("probe sent outside printer ports")
+	}
+}
+
+// Камера отвечает на OPTIONS без авторизации, а DESCRIBE требует Digest
+func fakeRTSPCamera(optionsServer string, describeServer string) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		reader := textproto.NewReader(bufio.NewReader(conn))
+		for {
+			line, err := reader.ReadLine()
+			if err != nil {
+				return
+			}
+			header, err := reader.ReadMIMEHeader()
+			if err != nil {
+				return
+			}
+			response := "RTSP/1.0 200 OK\r\nCSeq: " + header.Get("Cseq") + "\r\n"
+			if strings.HasPrefix(line, "OPTIONS") {
+				response += "Public: OPTIONS, DESCRIBE, SETUP, PLAY, TEARDOWN\r\n"
+				if optionsServer != "" {
+					response += "Server: " + optionsServer + "\r\n"
+				}
+			} else {
+				response = "RTSP/1.0 401 Unauthorized\r\nCSeq: " + header.Get("Cseq") + "\r\n" +
+					"WWW-Authenticate: Digest realm=\"IP Camera\", nonce=\"3f1c\"\r\n"
+				if describeServer != "" {
+					response += "Server: " + describeServer + "\r\n"
+				}
+			}
+			conn.Write([]byte(response + "\r\n"))
+		}
+	}
+}
+
+func TestDetectRTSP(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  string
+		describe string
+		product  string
+	}{
+		{"server in options", "GStreamer RTSP server", "", "GStreamer RTSP server"},
+		{"server only in describe", "", "Hikvision-Webs", "Hikvision-Webs"},
+		{"no server header", "", "", ""},
+	}
+	for _, test := range tests {
+		ip, port := serveTCP(t, fakeRTSPCamera(test.options, test.describe))
+		detection, err := detectRTSP(ip, port, testConfig())
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		want := []string{"methods: OPTIONS, DESCRIBE, SETUP, PLAY, TEARDOWN", `auth: Digest realm="IP Camera", nonce="3f1c"`}
+		if detection.Product != test.product || !slices.Equal(detection.Info, want) || len(detection.Findings) != 0 {
+			t.Errorf("%s: got %q %q %v", test.name, detection.Product, detection.Info, detection.Findings)
+		}
+	}
+
+	ip, port := serveTCP(t, func(conn net.Conn) { conn.Write([]byte("HTTP/1.1 200 OK\r\nServer: nginx\r\n\r\n")) })
+	if _, err := detectRTSP(ip, port, testConfig()); err == nil {
+		t.Error("expected error for an http reply")
+	}
+}
+
+func TestCoAPPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		message []byte
+		payload string
+	}{
+		// ACK 2.05 с токеном из двух байт и Content-Format 40 (link-format)
+		{"link format", append([]byte{0x62, 0x45, 0x12, 0x34, 0xab, 0xcd, 0xc1, 0x28, 0xff}, `</sensors/temp>;rt="temperature"`...), `</sensors/temp>;rt="temperature"`},
+		// Опция с расширенной дельтой: Size2 (28) = 13 + 15
+		{"extended delta", append([]byte{0x60, 0x45, 0x00, 0x01, 0xd1, 0x0f, 0x10, 0xff}, "ok"...), "ok"},
+		{"no payload", []byte{0x60, 0x45, 0x00, 0x01, 0xc1, 0x28}, ""},
+		{"truncated extended length", []byte{0x60, 0x45, 0x00, 0x01, 0x1e, 0x01}, ""},
+		{"token longer than message", []byte{0x68, 0x45, 0x00, 0x01, 0xff}, ""},
+	}
+	for _, test := range tests {
+		if got := string(coapPayload(test.message)); got != test.payload {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.payload)
+		}
+	}
+}
+
+func TestDetectCoAP(t *testing.T) {
+	links := `</.well-known/core>;ct=40,</sensors/temp>;rt="temperature";if="sensor",</firmware>;rt="firmware"`
+	ip, port := serveUDP(t, func(request []byte) []byte {
+		if len(request) < 4 || request[0] != 0x40 || request[1] != 0x01 {
+			return nil
+		}
+		// Ответ ACK с тем же ID сообщения
+		response := []byte{0x60, 0x45, request[2], request[3], 0xc1, 0x28, 0xff}
+		return append(response, links...)
+	})
+	detection, err := detectCoAP(ip, port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"code: 2.05", "resources: /.well-known/core /sensors/temp /firmware"}
+	if !slices.Equal(detection.Info, want) {
+		t.Errorf("got %q", detection.Info)
+	}
+}
+
+func TestStunXorAddress(t *testing.T) {
+	transaction := []byte{0xb7, 0xe7, 0xa7, 0x01, 0xbc, 0x34, 0xd6, 0x86, 0xfa, 0x87, 0xdf, 0xae}
+	// Пример из RFC 5769, 2.2: 192.0.2.1:32853
+	ipv4 := []byte{0x00, 0x01, 0xa1, 0x47, 0xe1, 0x12, 0xa6, 0x43}
+	if got := stunXorAddress(ipv4, transaction); got != "192.0.2.1:32853" {
+		t.Errorf("IPv4: got %q", got)
+	}
+	// Пример из RFC 5769, 2.3: [2001:db8:1234:5678:11:2233:4455:6677]:32853
+	ipv6 := []byte{
+		0x00, 0x02, 0xa1, 0x47, 0x01, 0x13, 0xa9, 0xfa, 0xa5, 0xd3, 0xf1, 0x79,
+		0xbc, 0x25, 0xf4, 0xb5, 0xbe, 0xd2, 0xb9, 0xd9,
+	}
+	if got := stunXorAddress(ipv6, transaction); got != "[2001:db8:1234:5678:11:2233:4455:6677]:32853" {
+		t.Errorf("IPv6: got %q", got)
+	}
+	if got := stunXorAddress(ipv4[:6], transaction); got != "" {
+		t.Errorf("truncated: got %q", got)
+	}
+	if got := stunXorAddress(ipv6[:12], transaction); got != "" {
+		t.Errorf("truncated IPv6: got %q", got)
+	}
+}
+
+func TestDetectSTUN(t *testing.T) {
+	ip, port := serveUDP(t, func(request []byte) []byte {
+		if len(request) != 20 {
+			return nil
+		}
+		response := append([]byte{0x01, 0x01, 0x00, 0x00}, request[4:20]...)
+		// SOFTWARE с выравниванием, затем XOR-MAPPED-ADDRESS для 127.0.0.1:40000
+		response = append(response, 0x80, 0x22, 0x00, 0x0a)
+		response = append(response, "coturn-4.6\x00\x00"...)
+		mapped := []byte{0x00, 0x01, 0, 0, 127, 0, 0, 1}
+		binary.BigEndian.PutUint16(mapped[2:4], 40000^uint16(stunMagicCookie>>16))
+		binary.BigEndian.PutUint32(mapped[4:8], binary.BigEndian.Uint32(mapped[4:8])^stunMagicCookie)
+		response = append(response, 0x00, 0x20, 0x00, 0x08)
+		response = append(response, mapped...)
+		binary.BigEndian.PutUint16(response[2:4], uint16(len(response)-20))
+		return response
+	})
+	detection, err := detectSTUN(ip, port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detection.Product != "coturn-4.6" || !slices.Equal(detection.Info, []string{"mapped address: 127.0.0.1:40000"}) {
+		t.Errorf("got %q %q", detection.Product, detection.Info)
+	}
+
+	// Ответ с чужой транзакцией не принимается
+	ip, port = serveUDP(t, func(request []byte) []byte {
+		response := append([]byte{}, request...)
+		response[19] ^= 0xff
+		response[1] = 0x01
+		return response
+	})
+	if _, err := detectSTUN(ip, port, testConfig()); err == nil {
+		t.Error("expected error for a foreign transaction")
+	}
+}
+
+func TestDetectMQTTSN(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply []byte
+		info  []string
+		ok    bool
+	}{
+		{"gwinfo", []byte{0x03, 0x02, 0x07}, []string{"gateway: 7"}, true},
+		{"advertise", []byte{0x05, 0x00, 0x01, 0x03, 0x84}, []string{"gateway: 1, advertise every 15m0s"}, true},
+		{"wrong length", []byte{0x05, 0x02, 0x07}, nil, false},
+		{"other message", []byte{0x03, 0x05, 0x00}, nil, false},
+	}
+	for _, test := range tests {
+		ip, port := serveUDP(t, func(request []byte) []byte {
+			if string(request) != "\x03\x01\x00" {
+				return nil
+			}
+			return test.reply
+		})
+		detection, err := detectMQTTSN(ip, port, testConfig())
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if test.ok && !slices.Equal(detection.Info, test.info) {
+			t.Errorf("%s: got %q", test.name, detection.Info)
+		}
+	}
+}
@@ -0,0 +1,548 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/futig/PortScannerGo/application/dns"
+	"github.com/futig/PortScannerGo/domain"
+)
+
+const (
+	mdnsGroup  = "224.0.0.251:5353"
+	ssdpGroup  = "239.255.255.250:1900"
+	llmnrGroup = "224.0.0.252:5355"
+	wsdGroup   = "239.255.255.250:3702"
+
+	mdnsServices = "_services._dns-sd._udp.local"
+)
+
+var discoverers = map[string]func(cfg *domain.DiscoveryConfig) ([]domain.DiscoveryResult, error){
+	"mdns":  discoverMDNS,
+	"ssdp":  discoverSSDP,
+	"llmnr": discoverLLMNR,
+	"wsd":   discoverWSD,
+}
+
+func Discover(cfg *domain.DiscoveryConfig, writer func(domain.DiscoveryResult, *domain.DiscoveryConfig)) {
+	results := make(chan domain.DiscoveryResult)
+	var wg sync.WaitGroup
+	for _, protocol := range cfg.Protocols {
+		discover, ok := discoverers[protocol]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found, err := discover(cfg)
+			if err != nil {
+				return
+			}
+			for _, result := range found {
+				results <- result
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		writer(result, cfg)
+	}
+}
+
+// Рассылает запросы в группу и до истечения таймаута передаёт ответы в handle.
+// Запросы, которые вернёт handle, тоже отправляются в группу.
+func collectMulticast(group string, timeout time.Duration, requests [][]byte, handle func([]byte, *net.UDPAddr) [][]byte) error {
+	groupAddr, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, request := range requests {
+		_, err = conn.WriteToUDP(request, groupAddr)
+		if err != nil {
+			return err
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	buffer := make([]byte, 65536)
+	for {
+		n, from, err := conn.ReadFromUDP(buffer)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, request := range handle(buffer[:n], from) {
+			conn.WriteToUDP(request, groupAddr)
+		}
+	}
+}
+
+type mdnsInstance struct {
+	name    string
+	host    string
+	service string
+	port    int
+	target  string
+	txt     []string
+}
+
+// Собирает типы сервисов и их экземпляры из ответов mDNS
+type mdnsBrowser struct {
+	services  map[string]string
+	instances map[string]*mdnsInstance
+}
+
+func newMDNSBrowser() *mdnsBrowser {
+	return &mdnsBrowser{
+		services:  make(map[string]string),
+		instances: make(map[string]*mdnsInstance),
+	}
+}
+
+func discoverMDNS(cfg *domain.DiscoveryConfig) ([]domain.DiscoveryResult, error) {
+	query, err := mdnsQuery(mdnsServices)
+	if err != nil {
+		return nil, err
+	}
+	browser := newMDNSBrowser()
+	err = collectMulticast(mdnsGroup, cfg.Timeout, [][]byte{query}, browser.handle)
+	if err != nil {
+		return nil, err
+	}
+	return browser.results(), nil
+}
+
+func (b *mdnsBrowser) instance(name string, host string) *mdnsInstance {
+	instance, ok := b.instances[name]
+	if !ok {
+		instance = &mdnsInstance{host: host}
+		b.instances[name] = instance
+	}
+	return instance
+}
+
+// Разбирает ответ и возвращает запросы экземпляров для новых типов сервисов
+func (b *mdnsBrowser) handle(payload []byte, from *net.UDPAddr) [][]byte {
+	response, err := dns.ParseResponse(payload)
+	if err != nil || response.Header.QR == 0 {
+		return nil
+	}
+
+	host := from.IP.String()
+	queries := make([][]byte, 0)
+	records := append(response.Answers, response.Additionals...)
+	for _, record := range records {
+		name := strings.ToLower(dns.RecordToName(record.Name))
+		switch record.Type {
+		case dns.TypePTR:
+			target := dns.RecordToName(record.Data)
+			if name == mdnsServices {
+				// Новый тип сервиса: сразу спрашиваем его экземпляры
+				service := strings.ToLower(target)
+				if _, ok := b.services[service]; !ok {
+					b.services[service] = host
+					if query, err := mdnsQuery(service); err == nil {
+						queries = append(queries, query)
+					}
+				}
+				continue
+			}
+			instance := b.instance(strings.ToLower(target), host)
+			instance.name = target
+			instance.service = name
+			if _, ok := b.services[name]; !ok {
+				b.services[name] = host
+			}
+		case dns.TypeSRV:
+			port, target := dns.ParseSrvRecord(record.Data)
+			instance := b.instance(name, host)
+			instance.port = int(port)
+			instance.target = target
+		case dns.TypeTXT:
+			b.instance(name, host).txt = dns.ParseTxtRecord(record.Data)
+		}
+	}
+	return queries
+}
+
+func (b *mdnsBrowser) results() []domain.DiscoveryResult {
+	results := make([]domain.DiscoveryResult, 0)
+	announced := make(map[string]bool)
+	for name, instance := range b.instances {
+		if instance.service == "" {
+			continue
+		}
+		if instance.name != "" {
+			name = instance.name
+		}
+		announced[instance.service] = true
+		result := domain.DiscoveryResult{
+			Protocol: "mdns",
+			Host:     instance.host,
+			Service:  strings.TrimSuffix(instance.service, ".local"),
+			Name:     name[:max(0, len(name)-len(instance.service)-1)],
+		}
+		if instance.port != 0 {
+			result.Ports = []int{instance.port}
+		}
+		if instance.target != "" {
+			result.Info = append(result.Info, "target: "+instance.target)
+		}
+		if len(instance.txt) > 0 {
+			result.Info = append(result.Info, "txt: "+strings.Join(instance.txt, " "))
+		}
+		results = append(results, result)
+	}
+	for service, host := range b.services {
+		if announced[service] {
+			continue
+		}
+		results = append(results, domain.DiscoveryResult{
+			Protocol: "mdns",
+			Host:     host,
+			Service:  strings.TrimSuffix(service, ".local"),
+		})
+	}
+	return results
+}
+
+func mdnsQuery(name string) ([]byte, error) {
+	qname, err := dns.NameToRecord(name)
+	if err != nil {
+		return nil, err
+	}
+	request := dns.Request{
+		Header: dns.Header{QDCount: 1},
+		// Просим ответить напрямую, а не в группу
+		Question: dns.Question{QName: qname, QType: dns.TypePTR, QClass: dns.ClassIN | dns.ClassUnicastResponse},
+	}
+	return request.Encode(), nil
+}
+
+type ssdpDevice struct {
+	host     string
+	server   string
+	services []string
+}
+
+type upnpDescription struct {
+	Device struct {
+		DeviceType   string `xml:"deviceType"`
+		FriendlyName string `xml:"friendlyName"`
+		Manufacturer string `xml:"manufacturer"`
+		ModelName    string `xml:"modelName"`
+	} `xml:"device"`
+}
+
+func discoverSSDP(cfg *domain.DiscoveryConfig) ([]domain.DiscoveryResult, error) {
+	request := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpGroup + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: ssdp:all\r\n\r\n"
+
+	devices := make(map[string]*ssdpDevice)
+	err := collectMulticast(ssdpGroup, cfg.Timeout, [][]byte{[]byte(request)}, func(payload []byte, from *net.UDPAddr) [][]byte {
+		addSSDPReply(devices, payload, from)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client := newUPnPClient(cfg.Timeout)
+	results := make([]domain.DiscoveryResult, 0, len(devices))
+	for location, device := range devices {
+		result := domain.DiscoveryResult{
+			Protocol: "ssdp",
+			Host:     device.host,
+		}
+		if len(device.services) > 0 {
+			result.Service = device.services[0]
+		}
+		if device.server != "" {
+			result.Info = append(result.Info, "server: "+device.server)
+		}
+
+		// Описание запрашиваем только у самого ответившего устройства:
+		// иначе любой узел в сети направит сканер на произвольный адрес
+		if port := urlPort(location); port != 0 && locationOnHost(location, device.host) {
+			result.Ports = []int{port}
+			result.Info = append(result.Info, "location: "+location)
+			description, err := fetchUPnPDescription(client, location)
+			if err == nil {
+				result.Name = description.Device.FriendlyName
+				if description.Device.DeviceType != "" {
+					result.Service = description.Device.DeviceType
+				}
+				model := strings.TrimSpace(description.Device.Manufacturer + " " + description.Device.ModelName)
+				if model != "" {
+					result.Info = append(result.Info, "model: "+model)
+				}
+			}
+		}
+		if urlPort(location) != 0 && !locationOnHost(location, device.host) {
+			result.Info = append(result.Info, "foreign location: "+location)
+		}
+		if len(device.services) > 1 {
+			result.Info = append(result.Info, "services: "+strings.Join(device.services, ", "))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func addSSDPReply(devices map[string]*ssdpDevice, payload []byte, from *net.UDPAddr) {
+	response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(payload)), nil)
+	if err != nil {
+		return
+	}
+	response.Body.Close()
+
+	location := response.Header.Get("Location")
+	if location == "" {
+		location = from.IP.String()
+	}
+	device, ok := devices[location]
+	if !ok {
+		device = &ssdpDevice{host: from.IP.String(), server: response.Header.Get("Server")}
+		devices[location] = device
+	}
+	if st := response.Header.Get("St"); st != "" && !slices.Contains(device.services, st) {
+		device.services = append(device.services, st)
+	}
+}
+
+func locationOnHost(location string, host string) bool {
+	parsed, err := url.Parse(location)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	ip := net.ParseIP(parsed.Hostname())
+	return ip != nil && ip.Equal(net.ParseIP(host))
+}
+
+// Перенаправления не выполняются: описание должно лежать на самом устройстве
+func newUPnPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func fetchUPnPDescription(client *http.Client, location string) (*upnpDescription, error) {
+	response, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("description request returned %s", response.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	description := &upnpDescription{}
+	err = xml.Unmarshal(data, description)
+	if err != nil {
+		return nil, err
+	}
+	return description, nil
+}
+
+func discoverLLMNR(cfg *domain.DiscoveryConfig) ([]domain.DiscoveryResult, error) {
+	// Имени-приманки ни у кого нет, ответить на него может только отравитель
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	decoy := "host-" + hex.EncodeToString(suffix)
+	names := []string{"wpad", decoy}
+
+	requests := make([][]byte, 0, len(names))
+	for i, name := range names {
+		qname, err := dns.NameToRecord(name)
+		if err != nil {
+			return nil, err
+		}
+		request := dns.Request{
+			Header:   dns.Header{ID: uint16(i + 1), QDCount: 1},
+			Question: dns.Question{QName: qname, QType: dns.TypeA, QClass: dns.ClassIN},
+		}
+		requests = append(requests, request.Encode())
+	}
+
+	results := make([]domain.DiscoveryResult, 0)
+	seen := make(map[string]bool)
+	err := collectMulticast(llmnrGroup, cfg.Timeout, requests, func(payload []byte, from *net.UDPAddr) [][]byte {
+		result := parseLLMNRReply(payload, from, names, decoy)
+		if result == nil || seen[result.Host+" "+result.Name] {
+			return nil
+		}
+		seen[result.Host+" "+result.Name] = true
+		results = append(results, *result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Возвращает nil, если ответ не относится к отправленным запросам
+func parseLLMNRReply(payload []byte, from *net.UDPAddr, names []string, decoy string) *domain.DiscoveryResult {
+	response, err := dns.ParseResponse(payload)
+	if err != nil || response.Header.QR == 0 || len(response.Answers) == 0 {
+		return nil
+	}
+	name := dns.RecordToName(response.Question.QName)
+	if !slices.Contains(names, name) {
+		return nil
+	}
+
+	result := &domain.DiscoveryResult{
+		Protocol: "llmnr",
+		Host:     from.IP.String(),
+		Service:  "llmnr",
+		Name:     name,
+		Ports:    []int{5355},
+	}
+	for _, answer := range response.Answers {
+		if answer.Type == dns.TypeA && len(answer.Data) == 4 {
+			result.Info = append(result.Info, "address: "+net.IP(answer.Data).String())
+		}
+	}
+	if name == decoy {
+		result.Findings = append(result.Findings, domain.Finding{
+			Check:    "llmnr-spoofing",
+			Severity: domain.SeverityHigh,
+			Detail:   "host answers LLMNR queries for names it does not own",
+		})
+	}
+	return result
+}
+
+type wsdProbeMatches struct {
+	Matches []struct {
+		Address string `xml:"EndpointReference>Address"`
+		Types   string `xml:"Types"`
+		Scopes  string `xml:"Scopes"`
+		XAddrs  string `xml:"XAddrs"`
+	} `xml:"Body>ProbeMatches>ProbeMatch"`
+}
+
+func discoverWSD(cfg *domain.DiscoveryConfig) ([]domain.DiscoveryResult, error) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	probe := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>`+
+		`<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope" `+
+		`xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing" `+
+		`xmlns:wsd="http://schemas.xmlsoap.org/ws/2005/04/discovery">`+
+		`<soap:Header>`+
+		`<wsa:To>urn:schemas-xmlsoap-org:ws:2005:04:discovery</wsa:To>`+
+		`<wsa:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</wsa:Action>`+
+		`<wsa:MessageID>urn:uuid:%x-%x-%x-%x-%x</wsa:MessageID>`+
+		`</soap:Header>`+
+		`<soap:Body><wsd:Probe/></soap:Body>`+
+		`</soap:Envelope>`, id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+
+	results := make([]domain.DiscoveryResult, 0)
+	seen := make(map[string]bool)
+	err := collectMulticast(wsdGroup, cfg.Timeout, [][]byte{[]byte(probe)}, func(payload []byte, from *net.UDPAddr) [][]byte {
+		results = append(results, parseWSDReply(payload, from, seen)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Пропускает конечные точки, которые уже есть в seen
+func parseWSDReply(payload []byte, from *net.UDPAddr, seen map[string]bool) []domain.DiscoveryResult {
+	matches := &wsdProbeMatches{}
+	if xml.Unmarshal(payload, matches) != nil {
+		return nil
+	}
+	results := make([]domain.DiscoveryResult, 0, len(matches.Matches))
+	for _, match := range matches.Matches {
+		if seen[match.Address] {
+			continue
+		}
+		seen[match.Address] = true
+
+		result := domain.DiscoveryResult{
+			Protocol: "wsd",
+			Host:     from.IP.String(),
+			Service:  strings.Join(strings.Fields(match.Types), " "),
+		}
+		for _, scope := range strings.Fields(match.Scopes) {
+			// Камеры ONVIF передают имя и модель в областях
+			if value, ok := strings.CutPrefix(scope, "onvif://www.onvif.org/name/"); ok {
+				result.Name, _ = url.PathUnescape(value)
+			}
+			if value, ok := strings.CutPrefix(scope, "onvif://www.onvif.org/hardware/"); ok {
+				model, _ := url.PathUnescape(value)
+				result.Info = append(result.Info, "model: "+model)
+			}
+		}
+		for _, xaddr := range strings.Fields(match.XAddrs) {
+			if port := urlPort(xaddr); port != 0 && !slices.Contains(result.Ports, port) {
+				result.Ports = append(result.Ports, port)
+			}
+			result.Info = append(result.Info, "xaddr: "+xaddr)
+		}
+		if match.Address != "" {
+			result.Info = append(result.Info, "endpoint: "+match.Address)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func urlPort(rawURL string) int {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return 0
+	}
+	if port, err := strconv.Atoi(parsed.Port()); err == nil {
+		return port
+	}
+	switch parsed.Scheme {
+	case "http":
+		return 80
+	case "https":
+		return 443
+	}
+	return 0
+}
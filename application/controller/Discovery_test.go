@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/futig/PortScannerGo/application/dns"
+)
+
+var discoveryPeer = &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: 5353}
+
+// Ответ на запрос _services._dns-sd._udp.local: один тип сервиса _http._tcp.local
+var mdnsServicesResponse = []byte{
+	0x00, 0x00, 0x84, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+	0x09, '_', 's', 'e', 'r', 'v', 'i', 'c', 'e', 's', 0x07, '_', 'd', 'n', 's', '-', 's', 'd',
+	0x04, '_', 'u', 'd', 'p', 0x05, 'l', 'o', 'c', 'a', 'l', 0x00,
+	0x00, 0x0c, 0x00, 0x01, 0x00, 0x00, 0x11, 0x94, 0x00, 0x0d,
+	0x05, '_', 'h', 't', 't', 'p', 0x04, '_', 't', 'c', 'p', 0xc0, 0x23,
+}
+
+// Ответ с экземпляром сервиса: PTR, SRV и TXT, имена сжаты указателями
+var mdnsInstanceResponse = []byte{
+	0x00, 0x00, 0x84, 0x00, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00,
+	0x05, '_', 'h', 't', 't', 'p', 0x04, '_', 't', 'c', 'p', 0x05, 'l', 'o', 'c', 'a', 'l', 0x00,
+	0x00, 0x0c, 0x00, 0x01, 0x00, 0x00, 0x11, 0x94, 0x00, 0x0a,
+	0x07, 'p', 'r', 'i', 'n', 't', 'e', 'r', 0xc0, 0x0c,
+	0xc0, 0x28, 0x00, 0x21, 0x80, 0x01, 0x00, 0x00, 0x00, 0x78, 0x00, 0x10,
+	0x00, 0x00, 0x00, 0x00, 0x02, 0x77, 0x07, 'p', 'r', 'i', 'n', 't', 'e', 'r', 0xc0, 0x17,
+	0xc0, 0x28, 0x00, 0x10, 0x80, 0x01, 0x00, 0x00, 0x11, 0x94, 0x00, 0x17,
+	0x09, 't', 'x', 't', 'v', 'e', 'r', 's', '=', '1', 0x0c, 'r', 'p', '=', 'i', 'p', 'p', '/', 'p', 'r', 'i', 'n', 't',
+}
+
+// Имя в wire-формате для заведомо допустимых имён из тестов
+func dnsName(name string) []byte {
+	record, err := dns.NameToRecord(name)
+	if err != nil {
+		panic(err)
+	}
+	return record
+}
+
+func TestMDNSQuery(t *testing.T) {
+	query, err := mdnsQuery("_http._tcp.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := dns.ParseRequest(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	question := request.Question
+	if dns.RecordToName(question.QName) != "_http._tcp.local" || question.QType != dns.TypePTR || question.QClass != 0x8001 {
+		t.Errorf("unexpected question %v", question)
+	}
+}
+
+func TestMDNSBrowser(t *testing.T) {
+	browser := newMDNSBrowser()
+	queries := browser.handle(mdnsServicesResponse, discoveryPeer)
+	if len(queries) != 1 {
+		t.Fatalf("got %d follow-up queries, want 1", len(queries))
+	}
+	// Повторное объявление того же типа не порождает новых запросов
+	if queries = browser.handle(mdnsServicesResponse, discoveryPeer); len(queries) != 0 {
+		t.Errorf("got %d queries for a known service", len(queries))
+	}
+	if got := browser.results(); len(got) != 1 || got[0].Service != "_http._tcp" || got[0].Name != "" {
+		t.Errorf("got %+v before instances arrived", got)
+	}
+
+	browser.handle(mdnsInstanceResponse, discoveryPeer)
+	results := browser.results()
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	result := results[0]
+	if result.Host != "192.168.1.20" || result.Service != "_http._tcp" || result.Name != "printer" {
+		t.Errorf("got %+v", result)
+	}
+	want := []string{"target: printer.local", "txt: txtvers=1 rp=ipp/print"}
+	if !slices.Equal(result.Ports, []int{631}) || !slices.Equal(result.Info, want) {
+		t.Errorf("got ports %v, info %q", result.Ports, result.Info)
+	}
+
+	// Запросы и мусор не ломают состояние
+	query, _ := mdnsQuery("_http._tcp.local")
+	browser.handle(query, discoveryPeer)
+	browser.handle([]byte{0, 1, 2}, discoveryPeer)
+	if got := browser.results(); len(got) != 1 {
+		t.Errorf("got %d results after junk", len(got))
+	}
+}
+
+func TestAddSSDPReply(t *testing.T) {
+	devices := make(map[string]*ssdpDevice)
+	reply := func(st string) []byte {
+		return []byte("HTTP/1.1 200 OK\r\n" +
+			"CACHE-CONTROL: max-age=1800\r\n" +
+			"LOCATION: http://192.168.1.20:49152/description.xml\r\n" +
+			"SERVER: Linux/5.10 UPnP/1.0 MiniUPnPd/2.2\r\n" +
+			"ST: " + st + "\r\n" +
+			"USN: uuid:1234::" + st + "\r\n\r\n")
+	}
+	addSSDPReply(devices, reply("upnp:rootdevice"), discoveryPeer)
+	addSSDPReply(devices, reply("urn:schemas-upnp-org:device:InternetGatewayDevice:1"), discoveryPeer)
+	addSSDPReply(devices, reply("upnp:rootdevice"), discoveryPeer)
+	addSSDPReply(devices, []byte("M-SEARCH * HTTP/1.1\r\n\r\n"), discoveryPeer)
+
+	if len(devices) != 1 {
+		t.Fatalf("got %d devices, want 1", len(devices))
+	}
+	device := devices["http://192.168.1.20:49152/description.xml"]
+	if device == nil || device.host != "192.168.1.20" || device.server != "Linux/5.10 UPnP/1.0 MiniUPnPd/2.2" {
+		t.Fatalf("got %+v", device)
+	}
+	if len(device.services) != 2 || device.services[0] != "upnp:rootdevice" {
+		t.Errorf("got services %q", device.services)
+	}
+}
+
+func TestLocationOnHost(t *testing.T) {
+	tests := []struct {
+		location string
+		want     bool
+	}{
+		{"http://192.168.1.20:49152/description.xml", true},
+		{"https://192.168.1.20/rootDesc.xml", true},
+		{"http://192.168.1.21:49152/description.xml", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://router.local/description.xml", false},
+		{"file:///etc/passwd", false},
+		{"192.168.1.20", false},
+	}
+	for _, test := range tests {
+		if got := locationOnHost(test.location, "192.168.1.20"); got != test.want {
+			t.Errorf("%s: got %v", test.location, got)
+		}
+	}
+}
+
+func TestFetchUPnPDescriptionRefusesRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/description.xml" {
+			w.Write([]byte(`<root><device><deviceType>urn:schemas-upnp-org:device:MediaRenderer:1</deviceType>` +
+				`<friendlyName>Living Room TV</friendlyName><manufacturer>Samsung</manufacturer></device></root>`))
+			return
+		}
+		http.Redirect(w, r, "/description.xml", http.StatusFound)
+	}))
+	defer server.Close()
+	client := newUPnPClient(time.Second)
+
+	description, err := fetchUPnPDescription(client, server.URL+"/description.xml")
+	if err != nil || description.Device.FriendlyName != "Living Room TV" {
+		t.Errorf("got %+v, error %v", description, err)
+	}
+	if _, err := fetchUPnPDescription(client, server.URL+"/moved"); err == nil {
+		t.Error("redirect was followed")
+	}
+}
+
+// Ответ LLMNR на запрос A с одним адресом
+func llmnrReply(name string, address net.IP) []byte {
+	response := dns.Response{
+		Header:   dns.Header{ID: 1, QR: 1, QDCount: 1, ANCount: 1},
+		Question: dns.Question{QName: dnsName(name), QType: dns.TypeA, QClass: dns.ClassIN},
+		Answers: []*dns.ResponseData{{
+			Name: dnsName(name), Type: dns.TypeA, Class: dns.ClassIN, TTL: 30,
+			DataLength: 4, Data: address.To4(),
+		}},
+	}
+	return response.Encode()
+}
+
+func TestParseLLMNRReply(t *testing.T) {
+	names := []string{"wpad", "host-0123456789ab"}
+	result := parseLLMNRReply(llmnrReply("wpad", net.IPv4(192, 168, 1, 20)), discoveryPeer, names, names[1])
+	if result == nil || result.Name != "wpad" || len(result.Findings) != 0 {
+		t.Fatalf("got %+v", result)
+	}
+	if !slices.Equal(result.Info, []string{"address: 192.168.1.20"}) {
+		t.Errorf("got info %q", result.Info)
+	}
+
+	result = parseLLMNRReply(llmnrReply("host-0123456789ab", net.IPv4(192, 168, 1, 66)), discoveryPeer, names, names[1])
+	if result == nil || len(result.Findings) != 1 || result.Findings[0].Check != "llmnr-spoofing" {
+		t.Fatalf("decoy answer not reported: %+v", result)
+	}
+
+	if result := parseLLMNRReply(llmnrReply("fileserver", net.IPv4(192, 168, 1, 5)), discoveryPeer, names, names[1]); result != nil {
+		t.Errorf("answer for an unrelated name accepted: %+v", result)
+	}
+	query := dns.Request{
+		Header:   dns.Header{ID: 1, QDCount: 1},
+		Question: dns.Question{QName: dnsName("wpad"), QType: dns.TypeA, QClass: dns.ClassIN},
+	}
+	if result := parseLLMNRReply(query.Encode(), discoveryPeer, names, names[1]); result != nil {
+		t.Errorf("query accepted as reply: %+v", result)
+	}
+}
+
+// ProbeMatches от камеры ONVIF
+const wsdCameraReply = `<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://www.w3.org/2003/05/soap-envelope"
+ xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing"
+ xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery"
+ xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+<SOAP-ENV:Header><wsa:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/ProbeMatches</wsa:Action></SOAP-ENV:Header>
+<SOAP-ENV:Body><d:ProbeMatches><d:ProbeMatch>
+<wsa:EndpointReference><wsa:Address>urn:uuid:a1b2c3d4-0000-1000-8000-0012345678ab</wsa:Address></wsa:EndpointReference>
+<d:Types>dn:NetworkVideoTransmitter</d:Types>
+<d:Scopes>onvif://www.onvif.org/type/video_encoder onvif://www.onvif.org/name/Front%20Door onvif://www.onvif.org/hardware/DS-2CD2143G0-I</d:Scopes>
+<d:XAddrs>http://192.168.1.20/onvif/device_service http://192.168.1.20:8000/onvif/device_service</d:XAddrs>
+<d:MetadataVersion>1</d:MetadataVersion>
+</d:ProbeMatch></d:ProbeMatches></SOAP-ENV:Body></SOAP-ENV:Envelope>`
+
+func TestParseWSDReply(t *testing.T) {
+	seen := make(map[string]bool)
+	results := parseWSDReply([]byte(wsdCameraReply), discoveryPeer, seen)
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	result := results[0]
+	if result.Service != "dn:NetworkVideoTransmitter" || result.Name != "Front Door" {
+		t.Errorf("got service %q, name %q", result.Service, result.Name)
+	}
+	if !slices.Equal(result.Ports, []int{80, 8000}) {
+		t.Errorf("got ports %v", result.Ports)
+	}
+	if !slices.Contains(result.Info, "model: DS-2CD2143G0-I") ||
+		!slices.Contains(result.Info, "endpoint: urn:uuid:a1b2c3d4-0000-1000-8000-0012345678ab") {
+		t.Errorf("got info %q", result.Info)
+	}
+
+	// Повторный ответ той же конечной точки пропускается
+	if again := parseWSDReply([]byte(wsdCameraReply), discoveryPeer, seen); len(again) != 0 {
+		t.Errorf("got %d results for a known endpoint", len(again))
+	}
+	if junk := parseWSDReply([]byte("<html>"), discoveryPeer, seen); len(junk) != 0 {
+		t.Errorf("got %v from junk", junk)
+	}
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/futig/PortScannerGo/application/dns"
+	"github.com/futig/PortScannerGo/domain"
+)
+
+// Сколько случайных имён запрашивается, чтобы найти wildcard-записи зоны
+const wildcardProbes = 3
+
+// Перебирает поддомены из словаря и передаёт в writer имена с найденными адресами
+func EnumerateDNS(cfg *domain.DnsEnumConfig, writer func(domain.DnsEnumResult, *domain.DnsEnumConfig)) error {
+	server := cfg.Resolver
+	if server == "" {
+		server = dns.DefaultServer()
+	}
+	client := dns.NewClient(server, cfg.Timeout)
+
+	qtypes := []uint16{dns.TypeA}
+	if cfg.IPv6 {
+		qtypes = append(qtypes, dns.TypeAAAA)
+	}
+	wildcard, err := detectWildcard(client, cfg.Domain, qtypes)
+	if err != nil {
+		return fmt.Errorf("resolver %s does not answer: %w", client.Server, err)
+	}
+	if len(wildcard) > 0 {
+		writer(domain.DnsEnumResult{Name: "*." + cfg.Domain, Addresses: wildcard, Wildcard: true}, cfg)
+	}
+
+	names := make(chan string)
+	results := make(chan domain.DnsEnumResult)
+	var wg sync.WaitGroup
+	for range max(cfg.Threads, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				addresses := enumAddresses(lookupWithRetry(client, name, qtypes), wildcard, cfg.IPv6)
+				if len(addresses) > 0 {
+					results <- domain.DnsEnumResult{Name: name, Addresses: addresses}
+				}
+			}
+		}()
+	}
+	go func() {
+		for _, word := range cfg.Words {
+			names <- word + "." + cfg.Domain
+		}
+		close(names)
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		writer(result, cfg)
+	}
+	return nil
+}
+
+// Адреса, которые зона отдаёт на случайные несуществующие имена
+func detectWildcard(client *dns.Client, zone string, qtypes []uint16) ([]net.IP, error) {
+	wildcard := make([]net.IP, 0)
+	for range wildcardProbes {
+		label := make([]byte, 8)
+		rand.Read(label)
+		addresses, err := client.LookupIP("enum-"+hex.EncodeToString(label)+"."+zone, qtypes...)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range addresses {
+			if !slices.ContainsFunc(wildcard, ip.Equal) {
+				wildcard = append(wildcard, ip)
+			}
+		}
+	}
+	return wildcard, nil
+}
+
+// Адреса найденного имени без адресов wildcard-записи: они означают, что имени на самом
+// деле нет. IPv6-адреса остаются только по запросу, потому что portscan сканирует только IPv4
+func enumAddresses(addresses []net.IP, wildcard []net.IP, ipv6 bool) []net.IP {
+	return slices.DeleteFunc(addresses, func(ip net.IP) bool {
+		return slices.ContainsFunc(wildcard, ip.Equal) || (!ipv6 && ip.To4() == nil)
+	})
+}
+
+// При большом числе параллельных запросов UDP-ответы теряются, поэтому запрос повторяется один раз.
+// Если и повтор не удался, остаются адреса, полученные первым запросом до ошибки
+func lookupWithRetry(client *dns.Client, name string, qtypes []uint16) []net.IP {
+	addresses, err := client.LookupIP(name, qtypes...)
+	if err != nil {
+		if retried, err := client.LookupIP(name, qtypes...); err == nil {
+			return retried
+		}
+	}
+	return addresses
+}
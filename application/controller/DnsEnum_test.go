@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/futig/PortScannerGo/application/dns"
+	"github.com/futig/PortScannerGo/domain"
+)
+
+func TestEnumAddresses(t *testing.T) {
+	wildcard := []net.IP{net.ParseIP("192.0.2.99"), net.ParseIP("2001:db8::99")}
+	tests := []struct {
+		name      string
+		addresses []string
+		ipv6      bool
+		want      []string
+	}{
+		{"own addresses", []string{"192.0.2.1", "192.0.2.2"}, false, []string{"192.0.2.1", "192.0.2.2"}},
+		{"wildcard only", []string{"192.0.2.99"}, false, nil},
+		{"wildcard removed", []string{"192.0.2.99", "192.0.2.1"}, false, []string{"192.0.2.1"}},
+		{"ipv6 dropped", []string{"192.0.2.1", "2001:db8::1"}, false, []string{"192.0.2.1"}},
+		{"ipv6 kept", []string{"192.0.2.1", "2001:db8::1"}, true, []string{"192.0.2.1", "2001:db8::1"}},
+		{"ipv6 wildcard removed", []string{"2001:db8::99", "2001:db8::1"}, true, []string{"2001:db8::1"}},
+		{"ipv4 in 16 bytes", []string{"::ffff:192.0.2.1"}, false, []string{"192.0.2.1"}},
+	}
+	for _, test := range tests {
+		addresses := make([]net.IP, 0)
+		for _, address := range test.addresses {
+			addresses = append(addresses, net.ParseIP(address))
+		}
+		got := make([]string, 0)
+		for _, ip := range enumAddresses(addresses, wildcard, test.ipv6) {
+			got = append(got, ip.String())
+		}
+		if !slices.Equal(got, test.want) && !(len(got) == 0 && len(test.want) == 0) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// Резолвер для зоны с wildcard-записью: известные имена получают свои адреса,
+// любые другие — адрес wildcard
+func serveWildcardZone(t *testing.T, records map[string][]string) string {
+	ip, port := serveUDP(t, func(raw []byte) []byte {
+		request, err := dns.ParseRequest(raw)
+		if err != nil {
+			return nil
+		}
+		addresses, ok := records[dns.RecordToName(request.Question.QName)]
+		if !ok {
+			addresses = []string{"192.0.2.99"}
+		}
+		response := &dns.Response{
+			Header:   dns.Header{ID: request.Header.ID, QR: 1, RD: 1, RA: 1, QDCount: 1},
+			Question: request.Question,
+		}
+		for _, address := range addresses {
+			ip := net.ParseIP(address)
+			data := []byte(ip.To4())
+			if request.Question.QType == dns.TypeAAAA {
+				data = ip.To16()
+			}
+			if (request.Question.QType == dns.TypeA) == (ip.To4() != nil) {
+				response.Answers = append(response.Answers, &dns.ResponseData{
+					Name: request.Question.QName, Type: request.Question.QType, Class: dns.ClassIN, TTL: 60, Data: data,
+				})
+			}
+		}
+		response.Header.ANCount = uint16(len(response.Answers))
+		return response.Encode()
+	})
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
+
+func TestEnumerateDNS(t *testing.T) {
+	resolver := serveWildcardZone(t, map[string][]string{
+		"www.example.com":  {"192.0.2.1", "2001:db8::1"},
+		"mail.example.com": {"192.0.2.99", "192.0.2.2"},
+		"v6.example.com":   {"2001:db8::6"},
+	})
+	for _, ipv6 := range []bool{false, true} {
+		cfg := domain.NewDefaultDnsEnumConfig()
+		cfg.Timeout = time.Second
+		cfg.Resolver = resolver
+		cfg.Domain = "example.com"
+		cfg.Words = []string{"www", "mail", "v6", "missing"}
+		cfg.IPv6 = ipv6
+
+		var mu sync.Mutex
+		found := make(map[string]string)
+		err := EnumerateDNS(cfg, func(result domain.DnsEnumResult, _ *domain.DnsEnumConfig) {
+			addresses := make([]string, 0)
+			for _, ip := range result.Addresses {
+				addresses = append(addresses, ip.String())
+			}
+			mu.Lock()
+			found[result.Name] = strings.Join(addresses, ",")
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]string{
+			"*.example.com":    "192.0.2.99",
+			"www.example.com":  "192.0.2.1",
+			"mail.example.com": "192.0.2.2",
+		}
+		if ipv6 {
+			want["www.example.com"] = "192.0.2.1,2001:db8::1"
+			want["v6.example.com"] = "2001:db8::6"
+		}
+		if !maps.Equal(found, want) {
+			t.Errorf("ipv6 %v: got %v, want %v", ipv6, found, want)
+		}
+	}
+}
+
+func TestLookupWithRetry(t *testing.T) {
+	var mu sync.Mutex
+	queried := make([]uint16, 0)
+	// Резолвер отвечает на A-запросы и отказывает на AAAA
+	ip, port := serveUDP(t, func(raw []byte) []byte {
+		request, err := dns.ParseRequest(raw)
+		if err != nil {
+			return nil
+		}
+		mu.Lock()
+		queried = append(queried, request.Question.QType)
+		mu.Unlock()
+		response := &dns.Response{
+			Header:   dns.Header{ID: request.Header.ID, QR: 1, RD: 1, RA: 1, QDCount: 1},
+			Question: request.Question,
+		}
+		if request.Question.QType != dns.TypeA {
+			response.Header.RCode = 5
+			return response.Encode()
+		}
+		response.Answers = []*dns.ResponseData{{
+			Name: request.Question.QName, Type: dns.TypeA, Class: dns.ClassIN, TTL: 60, Data: []byte{192, 0, 2, 1},
+		}}
+		response.Header.ANCount = 1
+		return response.Encode()
+	})
+	client := dns.NewClient(net.JoinHostPort(ip.String(), strconv.Itoa(port)), time.Second)
+
+	tests := []struct {
+		qtypes  []uint16
+		queried []uint16
+	}{
+		{[]uint16{dns.TypeA}, []uint16{dns.TypeA}},
+		// Отказ на AAAA не отменяет уже найденный A-адрес
+		{[]uint16{dns.TypeA, dns.TypeAAAA}, []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeA, dns.TypeAAAA}},
+	}
+	for _, test := range tests {
+		queried = queried[:0]
+		addresses := lookupWithRetry(client, "www.example.com", test.qtypes)
+		if len(addresses) != 1 || !addresses[0].Equal(net.ParseIP("192.0.2.1")) {
+			t.Errorf("%v: got %v", test.qtypes, addresses)
+		}
+		mu.Lock()
+		if !slices.Equal(queried, test.queried) {
+			t.Errorf("%v: got queries %v", test.qtypes, queried)
+		}
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,615 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+var smbDialects = []struct {
+	code uint16
+	name string
+}{
+	{0x0202, "2.0.2"},
+	{0x0210, "2.1"},
+	{0x0300, "3.0"},
+	{0x0302, "3.0.2"},
+	{0x0311, "3.1.1"},
+}
+
+var kerberosErrors = map[int64]string{
+	6:  "KDC_ERR_C_PRINCIPAL_UNKNOWN",
+	7:  "KDC_ERR_S_PRINCIPAL_UNKNOWN",
+	12: "KDC_ERR_POLICY",
+	14: "KDC_ERR_ETYPE_NOSUPP",
+	18: "KDC_ERR_CLIENT_REVOKED",
+	24: "KDC_ERR_PREAUTH_FAILED",
+	25: "KDC_ERR_PREAUTH_REQUIRED",
+	60: "KRB_ERR_GENERIC",
+	68: "KDC_ERR_WRONG_REALM",
+}
+
+const ldapActiveDirectoryOID = "1.2.840.113556.1.4.800"
+
+const (
+	kerberosPort = 88
+	netbiosPort  = 137
+)
+
+func detectSMB(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	dialects := make([]string, 0)
+	var securityMode uint16
+	for _, dialect := range smbDialects {
+		mode, err := negotiateSMB2(targetIP, port, cfg.Timeout, dialect.code)
+		if err != nil {
+			continue
+		}
+		dialects = append(dialects, dialect.name)
+		securityMode = mode
+	}
+	smb2 := len(dialects) > 0
+	smb1 := negotiateSMB1(targetIP, port, cfg.Timeout) == nil
+
+	if !smb2 && !smb1 {
+		return nil, fmt.Errorf("not an smb server")
+	}
+
+	detection := &domain.Detection{Protocol: "SMB", Evidence: domain.EvidenceHandshake}
+	if smb1 {
+		dialects = append([]string{"NT LM 0.12"}, dialects...)
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "smb-v1-enabled",
+			Severity: domain.SeverityHigh,
+			Detail:   "server accepts the SMBv1 dialect",
+		})
+	}
+	detection.Info = append(detection.Info, "dialects: "+strings.Join(dialects, ","))
+
+	if smb2 {
+		switch {
+		case securityMode&0x02 != 0:
+			detection.Info = append(detection.Info, "signing: required")
+		case securityMode&0x01 != 0:
+			detection.Info = append(detection.Info, "signing: enabled, not required")
+		default:
+			detection.Info = append(detection.Info, "signing: disabled")
+		}
+		if securityMode&0x02 == 0 {
+			detection.Findings = append(detection.Findings, domain.Finding{
+				Check:    "smb-signing-not-required",
+				Severity: domain.SeverityMedium,
+				Detail:   "message signing is not required",
+			})
+		}
+	}
+	return detection, nil
+}
+
+// Предлагает серверу один диалект и возвращает SecurityMode, если тот согласился
+func negotiateSMB2(targetIP net.IP, port int, timeout time.Duration, dialect uint16) (uint16, error) {
+	conn, err := dialProbe("tcp", targetIP, port, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	header := make([]byte, 64)
+	copy(header[0:4], "\xfeSMB")
+	binary.LittleEndian.PutUint16(header[4:6], 64)
+	binary.LittleEndian.PutUint16(header[14:16], 1)
+
+	request := make([]byte, 36)
+	binary.LittleEndian.PutUint16(request[0:2], 36)
+	binary.LittleEndian.PutUint16(request[2:4], 1)
+	binary.LittleEndian.PutUint16(request[4:6], 0x01)
+	rand.Read(request[12:28])
+	request = binary.LittleEndian.AppendUint16(request, dialect)
+
+	// Для 3.1.1 обязателен контекст целостности до аутентификации
+	if dialect == 0x0311 {
+		request = append(request, 0x00, 0x00)
+		binary.LittleEndian.PutUint32(request[28:32], uint32(64+len(request)))
+		binary.LittleEndian.PutUint16(request[32:34], 1)
+
+		salt := make([]byte, 32)
+		rand.Read(salt)
+		context := []byte{0x01, 0x00, 0x26, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x20, 0x00, 0x01, 0x00}
+		context = append(context, salt...)
+		request = append(request, context...)
+	}
+
+	message := append(header, request...)
+	_, err = conn.Write(netbiosSession(message))
+	if err != nil {
+		return 0, err
+	}
+
+	response, err := readNetbiosSession(conn)
+	if err != nil {
+		return 0, err
+	}
+	if len(response) < 64+6 || !bytes.Equal(response[0:4], []byte("\xfeSMB")) {
+		return 0, fmt.Errorf("not an smb2 response")
+	}
+	if status := binary.LittleEndian.Uint32(response[8:12]); status != 0 {
+		return 0, fmt.Errorf("negotiate failed with status 0x%08x", status)
+	}
+	body := response[64:]
+	if binary.LittleEndian.Uint16(body[4:6]) != dialect {
+		return 0, fmt.Errorf("dialect 0x%04x is not supported", dialect)
+	}
+	return binary.LittleEndian.Uint16(body[2:4]), nil
+}
+
+func negotiateSMB1(targetIP net.IP, port int, timeout time.Duration) error {
+	conn, err := dialProbe("tcp", targetIP, port, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	header := make([]byte, 32)
+	copy(header[0:4], "\xffSMB")
+	header[4] = 0x72
+	header[9] = 0x18
+	binary.LittleEndian.PutUint16(header[10:12], 0xc853)
+	binary.LittleEndian.PutUint16(header[26:28], 0xfeff)
+
+	dialect := []byte("\x02NT LM 0.12\x00")
+	message := append(header, 0x00)
+	message = binary.LittleEndian.AppendUint16(message, uint16(len(dialect)))
+	message = append(message, dialect...)
+
+	_, err = conn.Write(netbiosSession(message))
+	if err != nil {
+		return err
+	}
+
+	response, err := readNetbiosSession(conn)
+	if err != nil {
+		return err
+	}
+	if len(response) < 35 || !bytes.Equal(response[0:4], []byte("\xffSMB")) {
+		return fmt.Errorf("not an smb1 response")
+	}
+	if status := binary.LittleEndian.Uint32(response[5:9]); status != 0 {
+		return fmt.Errorf("negotiate failed with status 0x%08x", status)
+	}
+	if response[32] == 0 || binary.LittleEndian.Uint16(response[33:35]) == 0xffff {
+		return fmt.Errorf("smb1 dialect rejected")
+	}
+	return nil
+}
+
+func netbiosSession(message []byte) []byte {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(message)))
+	return append(header, message...)
+}
+
+func readNetbiosSession(conn net.Conn) ([]byte, error) {
+	header := make([]byte, 4)
+	_, err := io.ReadFull(conn, header)
+	if err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint32(header) & 0x00ffffff)
+	if header[0] != 0 || length > 64*1024 {
+		return nil, fmt.Errorf("invalid netbios session message")
+	}
+	message := make([]byte, length)
+	_, err = io.ReadFull(conn, message)
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// NBSTAT-запрос для имени "*", закодированного по RFC 1002
+func buildNetBIOSStatus() []byte {
+	query := []byte{0x50, 0x53, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20}
+	query = append(query, "CK"+strings.Repeat("AA", 15)...)
+	return append(query, 0x00, 0x00, 0x21, 0x00, 0x01)
+}
+
+func detectNetBIOS(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("udp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	query := buildNetBIOSStatus()
+	_, err = conn.Write(query)
+	if err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, 1500)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return nil, err
+	}
+	response := buffer[:n]
+	if n < 12 || !bytes.Equal(response[0:2], query[0:2]) || response[2]&0x80 == 0 {
+		return nil, fmt.Errorf("not a netbios name service response")
+	}
+
+	// Имя в ответе не сжимается: длина, 32 байта и завершающий ноль
+	pos := 12 + 34 + 10
+	if pos+1 > n {
+		return nil, fmt.Errorf("nbstat response is truncated")
+	}
+	count := int(response[pos])
+	pos++
+	if pos+count*18 > n {
+		return nil, fmt.Errorf("nbstat response is truncated")
+	}
+
+	detection := &domain.Detection{Protocol: "NetBIOS", Evidence: domain.EvidenceHandshake}
+	for i := 0; i < count; i++ {
+		entry := response[pos+i*18 : pos+(i+1)*18]
+		name := strings.TrimSpace(string(entry[0:15]))
+		suffix := entry[15]
+		group := entry[16]&0x80 != 0
+		switch {
+		case suffix == 0x00 && !group:
+			detection.Info = append(detection.Info, "name: "+name)
+		case suffix == 0x00 && group:
+			detection.Info = append(detection.Info, "workgroup: "+name)
+		case suffix == 0x1c && group:
+			detection.Info = append(detection.Info, "domain controller for: "+name)
+		}
+	}
+	pos += count * 18
+	if pos+6 <= n {
+		mac := net.HardwareAddr(response[pos : pos+6])
+		detection.Info = append(detection.Info, "mac: "+mac.String())
+	}
+	return detection, nil
+}
+
+func detectLDAP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	attributes := []string{
+		"namingContexts", "defaultNamingContext", "supportedLDAPVersion",
+		"supportedCapabilities", "vendorName", "vendorVersion", "dnsHostName", "objectClass",
+	}
+	rootDSE, err := ldapSearch(conn, 1, "", 0, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	detection := &domain.Detection{Protocol: "LDAP", Evidence: domain.EvidenceHandshake}
+	switch {
+	case slices.Contains(rootDSE["supportedCapabilities"], ldapActiveDirectoryOID):
+		detection.Product = "Active Directory"
+	case len(rootDSE["vendorName"]) > 0:
+		detection.Product = rootDSE["vendorName"][0]
+	case slices.Contains(rootDSE["objectClass"], "OpenLDAProotDSE"):
+		detection.Product = "OpenLDAP"
+	}
+	if len(rootDSE["vendorVersion"]) > 0 {
+		detection.Version = rootDSE["vendorVersion"][0]
+	}
+	if len(rootDSE["dnsHostName"]) > 0 {
+		detection.Info = append(detection.Info, "host: "+rootDSE["dnsHostName"][0])
+	}
+	if len(rootDSE["namingContexts"]) > 0 {
+		detection.Info = append(detection.Info, "naming contexts: "+strings.Join(rootDSE["namingContexts"], "; "))
+	}
+	if len(rootDSE["supportedLDAPVersion"]) > 0 {
+		detection.Info = append(detection.Info, "ldap versions: "+strings.Join(rootDSE["supportedLDAPVersion"], ","))
+	}
+
+	// Проверяем, отдаёт ли сервер записи каталога без аутентификации
+	base := ""
+	if len(rootDSE["defaultNamingContext"]) > 0 {
+		base = rootDSE["defaultNamingContext"][0]
+	} else if len(rootDSE["namingContexts"]) > 0 {
+		base = rootDSE["namingContexts"][0]
+	}
+	if base != "" {
+		entry, err := ldapSearch(conn, 2, base, 1, []string{"1.1"})
+		if err == nil && entry != nil {
+			detection.Findings = append(detection.Findings, domain.Finding{
+				Check:    "ldap-anonymous-search",
+				Severity: domain.SeverityMedium,
+				Detail:   fmt.Sprintf("anonymous search below '%s' returned entries", base),
+			})
+		}
+	}
+	return detection, nil
+}
+
+// Выполняет поиск от имени анонимного пользователя и возвращает атрибуты первой найденной записи
+func ldapSearch(conn net.Conn, messageID int64, base string, scope int64, attributes []string) (map[string][]string, error) {
+	attrs := make([]byte, 0)
+	for _, attribute := range attributes {
+		attrs = append(attrs, berString(berOctetString, attribute)...)
+	}
+	request := berTLV(berSequence,
+		berInt(berInteger, messageID),
+		berTLV(0x63,
+			berString(berOctetString, base),
+			berInt(berEnumerated, scope),
+			berInt(berEnumerated, 0),
+			berInt(berInteger, 1),
+			berInt(berInteger, 0),
+			berTLV(berBoolean, []byte{0x00}),
+			berString(0x87, "objectClass"),
+			berTLV(berSequence, attrs),
+		),
+	)
+	_, err := conn.Write(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry map[string][]string
+	for {
+		message, err := readBERMessage(conn)
+		if err != nil {
+			return nil, err
+		}
+		_, content, _, err := berRead(message)
+		if err != nil {
+			return nil, err
+		}
+		_, _, rest, err := berRead(content)
+		if err != nil {
+			return nil, err
+		}
+		tag, op, _, err := berRead(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		switch tag {
+		case 0x64:
+			if entry == nil {
+				entry, err = parseLDAPEntry(op)
+				if err != nil {
+					return nil, err
+				}
+			}
+		case 0x65:
+			_, code, _, err := berRead(op)
+			if err != nil {
+				return nil, err
+			}
+			if resultCode := berReadInt(code); resultCode != 0 && resultCode != 4 && entry == nil {
+				return nil, fmt.Errorf("ldap search failed with code %d", resultCode)
+			}
+			return entry, nil
+		case 0x73:
+			// Ссылки на другие серверы не интересны
+		default:
+			return nil, fmt.Errorf("unexpected ldap operation 0x%02x", tag)
+		}
+	}
+}
+
+func parseLDAPEntry(op []byte) (map[string][]string, error) {
+	_, _, rest, err := berRead(op)
+	if err != nil {
+		return nil, err
+	}
+	_, list, _, err := berRead(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := make(map[string][]string)
+	for len(list) > 0 {
+		_, attribute, next, err := berRead(list)
+		if err != nil {
+			return nil, err
+		}
+		list = next
+
+		_, name, valuesSet, err := berRead(attribute)
+		if err != nil {
+			return nil, err
+		}
+		_, values, _, err := berRead(valuesSet)
+		if err != nil {
+			return nil, err
+		}
+		for len(values) > 0 {
+			_, value, next, err := berRead(values)
+			if err != nil {
+				return nil, err
+			}
+			entry[string(name)] = append(entry[string(name)], string(value))
+			values = next
+		}
+	}
+	return entry, nil
+}
+
+func readBERMessage(reader io.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return nil, err
+	}
+	if header[0] != berSequence {
+		return nil, fmt.Errorf("not a ber sequence")
+	}
+
+	lengthBytes := []byte{}
+	length := int(header[1])
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		if size == 0 || size > 3 {
+			return nil, fmt.Errorf("unsupported ber length")
+		}
+		lengthBytes = make([]byte, size)
+		_, err = io.ReadFull(reader, lengthBytes)
+		if err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, b := range lengthBytes {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > 1024*1024 {
+		return nil, fmt.Errorf("ber message is too large")
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(reader, body)
+	if err != nil {
+		return nil, err
+	}
+	message := append(header, lengthBytes...)
+	return append(message, body...), nil
+}
+
+func detectKerberos(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	return probeKerberos("tcp", targetIP, port, cfg)
+}
+
+func detectKerberosUDP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	return probeKerberos("udp", targetIP, port, cfg)
+}
+
+func probeKerberos(network string, targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe(network, targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	request := buildASRequest("PORTSCAN.INVALID", "portscan")
+	if network == "tcp" {
+		request = append(binary.BigEndian.AppendUint32(nil, uint32(len(request))), request...)
+	}
+	_, err = conn.Write(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var response []byte
+	if network == "tcp" {
+		header := make([]byte, 4)
+		_, err = io.ReadFull(conn, header)
+		if err != nil {
+			return nil, err
+		}
+		length := binary.BigEndian.Uint32(header)
+		if length > 64*1024 {
+			return nil, fmt.Errorf("kerberos message is too large")
+		}
+		response = make([]byte, length)
+		_, err = io.ReadFull(conn, response)
+	} else {
+		response = make([]byte, 4096)
+		var n int
+		n, err = conn.Read(response)
+		response = response[:n]
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tag, content, _, err := berRead(response)
+	if err != nil {
+		return nil, err
+	}
+	detection := &domain.Detection{Protocol: "Kerberos", Evidence: domain.EvidenceHandshake}
+	switch tag {
+	case 0x6b:
+		detection.Info = append(detection.Info, "as-rep returned without pre-authentication")
+		return detection, nil
+	case 0x7e:
+	default:
+		return nil, fmt.Errorf("not a kerberos message")
+	}
+
+	_, sequence, _, err := berRead(content)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := berChildren(sequence)
+	if err != nil {
+		return nil, err
+	}
+	codeField, ok := fields[0xa6]
+	if !ok {
+		return nil, fmt.Errorf("krb-error has no error code")
+	}
+	_, code, _, err := berRead(codeField)
+	if err != nil {
+		return nil, err
+	}
+	errorCode := berReadInt(code)
+	name, ok := kerberosErrors[errorCode]
+	if !ok {
+		name = fmt.Sprintf("error %d", errorCode)
+	}
+	detection.Info = append(detection.Info, "kdc error: "+name)
+
+	if realmField, ok := fields[0xa9]; ok {
+		_, realm, _, err := berRead(realmField)
+		if err == nil {
+			detection.Info = append(detection.Info, "realm: "+string(realm))
+		}
+	}
+	if textField, ok := fields[0xab]; ok {
+		_, text, _, err := berRead(textField)
+		if err == nil {
+			detection.Info = append(detection.Info, "text: "+string(text))
+		}
+	}
+	return detection, nil
+}
+
+func buildASRequest(realm, user string) []byte {
+	nonce := make([]byte, 4)
+	rand.Read(nonce)
+
+	principal := func(nameType int64, names ...string) []byte {
+		parts := make([]byte, 0)
+		for _, name := range names {
+			parts = append(parts, berString(0x1b, name)...)
+		}
+		return berTLV(berSequence,
+			berTLV(0xa0, berInt(berInteger, nameType)),
+			berTLV(0xa1, berTLV(berSequence, parts)),
+		)
+	}
+
+	body := berTLV(berSequence,
+		berTLV(0xa0, berTLV(berBitString, []byte{0x00, 0x50, 0x80, 0x00, 0x10})),
+		berTLV(0xa1, principal(1, user)),
+		berTLV(0xa2, berString(0x1b, realm)),
+		berTLV(0xa3, principal(2, "krbtgt", realm)),
+		berTLV(0xa5, berString(0x18, "20370913024805Z")),
+		berTLV(0xa7, berInt(berInteger, int64(binary.BigEndian.Uint32(nonce)>>1))),
+		berTLV(0xa8, berTLV(berSequence,
+			berInt(berInteger, 18),
+			berInt(berInteger, 17),
+			berInt(berInteger, 23),
+		)),
+	)
+	return berTLV(0x6a, berTLV(berSequence,
+		berTLV(0xa1, berInt(berInteger, 5)),
+		berTLV(0xa2, berInt(berInteger, 10)),
+		berTLV(0xa4, body),
+	))
+}
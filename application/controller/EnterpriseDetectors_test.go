@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Ответ NBSTAT от Windows-хоста: имя, рабочая группа, контроллер домена и MAC
+func nbstatResponse(id []byte) []byte {
+	response := append([]byte{}, id...)
+	response = append(response, 0x84, 0x00, 0, 0, 0, 1, 0, 0, 0, 0, 0x20)
+	response = append(response, "CK"+strings.Repeat("AA", 15)...)
+	response = append(response, 0, 0, 0x21, 0, 1, 0, 0, 0, 0, 0, 59, 4)
+	entry := func(name string, suffix byte, flags byte) []byte {
+		return append([]byte(name+strings.Repeat(" ", 15-len(name))), suffix, flags, 0x04)
+	}
+	response = append(response, entry("FILESRV01", 0x00, 0x04)...)
+	response = append(response, entry("CORP", 0x00, 0x84)...)
+	response = append(response, entry("CORP", 0x1c, 0x84)...)
+	response = append(response, entry("FILESRV01", 0x20, 0x04)...)
+	return append(response, 0x00, 0x15, 0x5d, 0x01, 0x02, 0x03)
+}
+
+func TestDetectNetBIOS(t *testing.T) {
+	ip, port := serveUDP(t, func(request []byte) []byte {
+		if !bytes.Equal(request[2:], buildNetBIOSStatus()[2:]) {
+			return nil
+		}
+		return nbstatResponse(request[0:2])
+	})
+	cfg := testConfig()
+	if open, _ := scanUDP(ip, port, cfg.Timeout, udpProbes(netbiosPort, cfg)); !open {
+		t.Error("netbios did not answer the probe for port 137")
+	}
+
+	detection, err := detectNetBIOS(ip, port, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"name: FILESRV01", "workgroup: CORP", "domain controller for: CORP", "mac: 00:15:5d:01:02:03"}
+	if !slices.Equal(detection.Info, want) {
+		t.Errorf("got %q, want %q", detection.Info, want)
+	}
+
+	ip, port = serveUDP(t, func(request []byte) []byte {
+		return nbstatResponse(request[0:2])[:70]
+	})
+	if _, err := detectNetBIOS(ip, port, cfg); err == nil {
+		t.Error("truncated nbstat response: expected error")
+	}
+}
+
+// KRB-ERROR, которым KDC отвечает на AS-REQ без предварительной аутентификации
+func krbError(code int64, realm string) []byte {
+	return berTLV(0x7e, berTLV(berSequence,
+		berTLV(0xa0, berInt(berInteger, 5)),
+		berTLV(0xa1, berInt(berInteger, 30)),
+		berTLV(0xa4, berString(0x18, "20240101000000Z")),
+		berTLV(0xa5, berInt(berInteger, 0)),
+		berTLV(0xa6, berInt(berInteger, code)),
+		berTLV(0xa9, berString(0x1b, realm)),
+		berTLV(0xab, berString(0x1b, "NEEDED_PREAUTH")),
+	))
+}
+
+func TestProbeKerberosUDP(t *testing.T) {
+	ip, port := serveUDP(t, func(request []byte) []byte {
+		if tag, _, _, err := berRead(request); err != nil || tag != 0x6a {
+			return nil
+		}
+		return krbError(25, "CORP.EXAMPLE")
+	})
+	cfg := testConfig()
+	if open, _ := scanUDP(ip, port, cfg.Timeout, udpProbes(kerberosPort, cfg)); !open {
+		t.Error("kdc did not answer the probe for port 88")
+	}
+
+	detection, err := detectKerberosUDP(ip, port, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"kdc error: KDC_ERR_PREAUTH_REQUIRED", "realm: CORP.EXAMPLE", "text: NEEDED_PREAUTH"}
+	if !slices.Equal(detection.Info, want) {
+		t.Errorf("got %q, want %q", detection.Info, want)
+	}
+}
+
+func TestLDAPSearch(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		if _, err := readBERMessage(server); err != nil {
+			return
+		}
+		attribute := func(name string, values ...string) []byte {
+			set := make([]byte, 0)
+			for _, value := range values {
+				set = append(set, berString(berOctetString, value)...)
+			}
+			return berTLV(berSequence, berString(berOctetString, name), berTLV(berSet, set))
+		}
+		entry := berTLV(berSequence, berInt(berInteger, 1), berTLV(0x64,
+			berString(berOctetString, ""),
+			berTLV(berSequence,
+				attribute("defaultNamingContext", "DC=corp,DC=example"),
+				attribute("supportedLDAPVersion", "3", "2"),
+			),
+		))
+		done := berTLV(berSequence, berInt(berInteger, 1), berTLV(0x65,
+			berInt(berEnumerated, 0), berString(berOctetString, ""), berString(berOctetString, ""),
+		))
+		server.Write(append(entry, done...))
+	}()
+
+	entry, err := ldapSearch(client, 1, "", 0, []string{"defaultNamingContext", "supportedLDAPVersion"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry["defaultNamingContext"][0] != "DC=corp,DC=example" || !slices.Equal(entry["supportedLDAPVersion"], []string{"3", "2"}) {
+		t.Errorf("got %v", entry)
+	}
+}
+
+func TestReadBERMessage(t *testing.T) {
+	message := berTLV(berSequence, make([]byte, 300))
+	got, err := readBERMessage(bytes.NewReader(append(message, 0xff)))
+	if err != nil || !bytes.Equal(got, message) {
+		t.Errorf("got %d bytes, error %v", len(got), err)
+	}
+	for _, bad := range [][]byte{
+		{0x04, 0x00},
+		{0x30, 0x84, 0, 0, 0, 1},
+		{0x30, 0x83, 0x20, 0, 0},
+		message[:100],
+	} {
+		if _, err := readBERMessage(bytes.NewReader(bad)); err == nil {
+			t.Errorf("%x: expected error", bad)
+		}
+	}
+}
+
+// SMB-сервер с заданными диалектами SMB2 и режимом подписи; smb1 включает NT LM 0.12
+func fakeSMB(dialects []uint16, securityMode uint16, smb1 bool) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		request, err := readNetbiosSession(conn)
+		if err != nil || len(request) < 32 {
+			return
+		}
+		if bytes.HasPrefix(request, []byte("\xffSMB")) {
+			if !smb1 {
+				return
+			}
+			// Ответ NT LM 0.12: WordCount 17, выбран диалект с индексом 0
+			response := append([]byte{}, request[0:32]...)
+			response[9] |= 0x80
+			response = append(response, 17, 0x00, 0x00)
+			response = append(response, make([]byte, 34)...)
+			conn.Write(netbiosSession(append(response, 0, 0)))
+			return
+		}
+
+		header := append([]byte{}, request[0:64]...)
+		header[16] |= 0x01
+		offered := binary.LittleEndian.Uint16(request[64+36 : 64+38])
+		if !slices.Contains(dialects, offered) {
+			// STATUS_NOT_SUPPORTED
+			binary.LittleEndian.PutUint32(header[8:12], 0xc00000bb)
+			conn.Write(netbiosSession(append(header, 9, 0, 0, 0, 0, 0, 0, 0, 0)))
+			return
+		}
+		body := make([]byte, 64)
+		binary.LittleEndian.PutUint16(body[0:2], 65)
+		binary.LittleEndian.PutUint16(body[2:4], securityMode)
+		binary.LittleEndian.PutUint16(body[4:6], offered)
+		conn.Write(netbiosSession(append(header, body...)))
+	}
+}
+
+func TestDetectSMB(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   func(conn net.Conn)
+		info     []string
+		findings []string
+	}{
+		{"windows server 2022", fakeSMB([]uint16{0x0202, 0x0210, 0x0300, 0x0302, 0x0311}, 0x03, false),
+			[]string{"dialects: 2.0.2,2.1,3.0,3.0.2,3.1.1", "signing: required"}, nil},
+		{"samba with smb1", fakeSMB([]uint16{0x0202, 0x0210, 0x0300, 0x0302, 0x0311}, 0x01, true),
+			[]string{"dialects: NT LM 0.12,2.0.2,2.1,3.0,3.0.2,3.1.1", "signing: enabled, not required"},
+			[]string{"smb-v1-enabled", "smb-signing-not-required"}},
+		{"windows 7", fakeSMB([]uint16{0x0202, 0x0210}, 0x00, true),
+			[]string{"dialects: NT LM 0.12,2.0.2,2.1", "signing: disabled"},
+			[]string{"smb-v1-enabled", "smb-signing-not-required"}},
+		{"smb1 only", fakeSMB(nil, 0, true), []string{"dialects: NT LM 0.12"}, []string{"smb-v1-enabled"}},
+	}
+	for _, test := range tests {
+		ip, port := serveTCP(t, test.server)
+		detection, err := detectSMB(ip, port, testConfig())
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var checks []string
+		for _, finding := range detection.Findings {
+			checks = append(checks, finding.Check)
+		}
+		if !slices.Equal(detection.Info, test.info) || !slices.Equal(checks, test.findings) {
+			t.Errorf("%s: got %q, findings %q", test.name, detection.Info, checks)
+		}
+	}
+
+	ip, port := serveTCP(t, fakeSMB(nil, 0, false))
+	if _, err := detectSMB(ip, port, testConfig()); err == nil {
+		t.Error("server without smb dialects: expected error")
+	}
+}
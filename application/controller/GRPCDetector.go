@@ -0,0 +1,537 @@
+package controller
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+const (
+	h2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+	h2FrameData         = 0x0
+	h2FrameHeaders      = 0x1
+	h2FrameRSTStream    = 0x3
+	h2FrameSettings     = 0x4
+	h2FramePing         = 0x6
+	h2FrameGoAway       = 0x7
+	h2FrameContinuation = 0x9
+
+	h2FlagEndStream  = 0x1
+	h2FlagAck        = 0x1
+	h2FlagEndHeaders = 0x4
+	h2FlagPadded     = 0x8
+	h2FlagPriority   = 0x20
+
+	// Размер кадра по умолчанию, пока мы не объявили другой
+	h2MaxFrameSize = 16384
+
+	grpcHealthPath = "/grpc.health.v1.Health/Check"
+
+	grpcStatusOK            = 0
+	grpcStatusUnimplemented = 12
+
+	// Ответы больше этого размера нам не нужны
+	h2MaxResponse = 1 << 16
+)
+
+// Сервис рефлексии сначала появился как v1alpha, новые серверы предоставляют v1
+var grpcReflectionPaths = []string{
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+var grpcStatusNames = map[int]string{
+	0:  "OK",
+	1:  "CANCELLED",
+	2:  "UNKNOWN",
+	5:  "NOT_FOUND",
+	7:  "PERMISSION_DENIED",
+	12: "UNIMPLEMENTED",
+	13: "INTERNAL",
+	14: "UNAVAILABLE",
+	16: "UNAUTHENTICATED",
+}
+
+var grpcHealthStatuses = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+type h2Conn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	decoder    *hpackDecoder
+	transport  string
+	scheme     string
+	authority  string
+	nextStream uint32
+}
+
+type h2Frame struct {
+	kind    byte
+	flags   byte
+	stream  uint32
+	payload []byte
+}
+
+type h2Response struct {
+	// Заголовки и трейлеры ответа вместе
+	headers map[string]string
+	body    []byte
+}
+
+func detectGRPC(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	client, err := dialH2(targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer client.close()
+
+	detection := &domain.Detection{
+		Protocol: "HTTP/2",
+		Evidence: domain.EvidenceHandshake,
+		Info:     []string{"transport: " + client.transport},
+	}
+
+	// Пустой HealthCheckRequest спрашивает о состоянии сервера целиком
+	health, err := client.call(grpcHealthPath, nil)
+	if err != nil {
+		return detection, nil
+	}
+	if !health.isGRPC() {
+		detection.Info = append(detection.Info, "status: "+health.headers[":status"])
+		if server := health.headers["server"]; server != "" {
+			detection.Product = server
+		}
+		return detection, nil
+	}
+
+	detection.Protocol = "gRPC"
+	status := health.grpcStatus()
+	switch status {
+	case grpcStatusOK:
+		detection.Info = append(detection.Info, "health: "+grpcHealthStatus(health.body))
+	case grpcStatusUnimplemented:
+		detection.Info = append(detection.Info, "health: not implemented")
+	default:
+		detection.Info = append(detection.Info, fmt.Sprintf("health: %s %s", grpcStatusName(status), health.headers["grpc-message"]))
+	}
+
+	if !cfg.GrpcReflection {
+		return detection, nil
+	}
+	services, err := client.listServices()
+	if err != nil {
+		detection.Info = append(detection.Info, "reflection: "+err.Error())
+		return detection, nil
+	}
+	detection.Info = append(detection.Info, "services: "+strings.Join(services, ", "))
+	detection.Findings = append(detection.Findings, domain.Finding{
+		Check:    "grpc-reflection-enabled",
+		Severity: domain.SeverityLow,
+		Detail:   fmt.Sprintf("server reflection lists %d services to unauthenticated clients", len(services)),
+	})
+	return detection, nil
+}
+
+// Сначала пробует TLS с ALPN h2, затем HTTP/2 без шифрования с предварительным знанием (h2c)
+func dialH2(targetIP net.IP, port int, timeout time.Duration) (*h2Conn, error) {
+	authority := net.JoinHostPort(targetIP.String(), strconv.Itoa(port))
+
+	conn, err := dialProbe("tcp", targetIP, port, timeout)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2"},
+	})
+	if tlsConn.Handshake() == nil && tlsConn.ConnectionState().NegotiatedProtocol == "h2" {
+		client := newH2Conn(tlsConn, "h2", "https", authority)
+		err = client.handshake()
+		if err != nil {
+			client.close()
+			return nil, err
+		}
+		return client, nil
+	}
+	conn.Close()
+
+	conn, err = dialProbe("tcp", targetIP, port, timeout)
+	if err != nil {
+		return nil, err
+	}
+	client := newH2Conn(conn, "h2c", "http", authority)
+	err = client.handshake()
+	if err != nil {
+		client.close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func newH2Conn(conn net.Conn, transport string, scheme string, authority string) *h2Conn {
+	return &h2Conn{
+		conn:       conn,
+		reader:     bufio.NewReader(conn),
+		decoder:    newHPACKDecoder(),
+		transport:  transport,
+		scheme:     scheme,
+		authority:  authority,
+		nextStream: 1,
+	}
+}
+
+func (c *h2Conn) close() {
+	c.conn.Close()
+}
+
+// Сервер HTTP/2 обязан начать соединение кадром SETTINGS
+func (c *h2Conn) handshake() error {
+	_, err := io.WriteString(c.conn, h2Preface)
+	if err != nil {
+		return err
+	}
+	err = c.writeFrame(h2FrameSettings, 0, 0, nil)
+	if err != nil {
+		return err
+	}
+	frame, err := c.readFrame()
+	if err != nil {
+		return fmt.Errorf("not an http/2 server: %v", err)
+	}
+	if frame.kind != h2FrameSettings || frame.flags&h2FlagAck != 0 || frame.stream != 0 || len(frame.payload)%6 != 0 {
+		return fmt.Errorf("not an http/2 server")
+	}
+	return c.writeFrame(h2FrameSettings, h2FlagAck, 0, nil)
+}
+
+func (c *h2Conn) writeFrame(kind byte, flags byte, stream uint32, payload []byte) error {
+	frame := make([]byte, 9, 9+len(payload))
+	frame[0] = byte(len(payload) >> 16)
+	frame[1] = byte(len(payload) >> 8)
+	frame[2] = byte(len(payload))
+	frame[3] = kind
+	frame[4] = flags
+	binary.BigEndian.PutUint32(frame[5:9], stream)
+	_, err := c.conn.Write(append(frame, payload...))
+	return err
+}
+
+func (c *h2Conn) readFrame() (*h2Frame, error) {
+	header := make([]byte, 9)
+	_, err := io.ReadFull(c.reader, header)
+	if err != nil {
+		return nil, err
+	}
+	length := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+	if length > h2MaxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the maximum size", length)
+	}
+	frame := &h2Frame{
+		kind:    header[3],
+		flags:   header[4],
+		stream:  binary.BigEndian.Uint32(header[5:9]) & 0x7fffffff,
+		payload: make([]byte, length),
+	}
+	_, err = io.ReadFull(c.reader, frame.payload)
+	if err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// Убирает дополнение и поля приоритета из кадров DATA и HEADERS
+func (f *h2Frame) data() ([]byte, error) {
+	payload := f.payload
+	padding := 0
+	if f.flags&h2FlagPadded != 0 {
+		if len(payload) == 0 {
+			return nil, fmt.Errorf("padded frame is empty")
+		}
+		padding = int(payload[0])
+		payload = payload[1:]
+	}
+	if f.kind == h2FrameHeaders && f.flags&h2FlagPriority != 0 {
+		if len(payload) < 5 {
+			return nil, fmt.Errorf("headers frame is truncated")
+		}
+		payload = payload[5:]
+	}
+	if padding > len(payload) {
+		return nil, fmt.Errorf("frame padding exceeds its payload")
+	}
+	return payload[:len(payload)-padding], nil
+}
+
+// Отправляет одно gRPC-сообщение и читает ответ до конца потока
+func (c *h2Conn) call(path string, message []byte) (*h2Response, error) {
+	streamID := c.nextStream
+	c.nextStream += 2
+
+	block := hpackEncode([][2]string{
+		{":method", "POST"},
+		{":scheme", c.scheme},
+		{":path", path},
+		{":authority", c.authority},
+		{"content-type", "application/grpc"},
+		{"te", "trailers"},
+	})
+	err := c.writeFrame(h2FrameHeaders, h2FlagEndHeaders, streamID, block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сообщение gRPC: флаг сжатия и четырёхбайтовая длина перед protobuf
+	data := []byte{0}
+	data = binary.BigEndian.AppendUint32(data, uint32(len(message)))
+	data = append(data, message...)
+	err = c.writeFrame(h2FrameData, h2FlagEndStream, streamID, data)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &h2Response{headers: make(map[string]string)}
+	var fragment []byte
+	endStream := false
+	for {
+		frame, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch frame.kind {
+		case h2FrameSettings:
+			if frame.flags&h2FlagAck == 0 {
+				err = c.writeFrame(h2FrameSettings, h2FlagAck, 0, nil)
+			}
+		case h2FramePing:
+			if frame.flags&h2FlagAck == 0 {
+				err = c.writeFrame(h2FramePing, h2FlagAck, 0, frame.payload)
+			}
+		case h2FrameGoAway:
+			return nil, fmt.Errorf("connection closed by server")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if frame.stream != streamID {
+			continue
+		}
+
+		switch frame.kind {
+		case h2FrameHeaders, h2FrameContinuation:
+			payload := frame.payload
+			if frame.kind == h2FrameHeaders {
+				endStream = frame.flags&h2FlagEndStream != 0
+				payload, err = frame.data()
+				if err != nil {
+					return nil, err
+				}
+			}
+			if len(fragment)+len(payload) > h2MaxResponse {
+				return nil, fmt.Errorf("response headers are too large")
+			}
+			fragment = append(fragment, payload...)
+			if frame.flags&h2FlagEndHeaders == 0 {
+				continue
+			}
+			fields, err := c.decoder.decode(fragment)
+			if err != nil {
+				return nil, err
+			}
+			fragment = nil
+			for _, field := range fields {
+				response.headers[field[0]] = field[1]
+			}
+		case h2FrameData:
+			endStream = frame.flags&h2FlagEndStream != 0
+			payload, err := frame.data()
+			if err != nil {
+				return nil, err
+			}
+			if len(response.body)+len(payload) > h2MaxResponse {
+				return nil, fmt.Errorf("response is too large")
+			}
+			response.body = append(response.body, payload...)
+		case h2FrameRSTStream:
+			return nil, fmt.Errorf("stream reset by server")
+		default:
+			continue
+		}
+		if endStream && fragment == nil {
+			return response, nil
+		}
+	}
+}
+
+// Запрашивает список сервисов через рефлексию: ServerReflectionRequest{list_services: ""}
+func (c *h2Conn) listServices() ([]string, error) {
+	request := []byte{7<<3 | 2, 0}
+	for _, path := range grpcReflectionPaths {
+		response, err := c.call(path, request)
+		if err != nil {
+			return nil, err
+		}
+		status := response.grpcStatus()
+		if status == grpcStatusUnimplemented {
+			continue
+		}
+		if status != grpcStatusOK {
+			return nil, fmt.Errorf("%s %s", grpcStatusName(status), response.headers["grpc-message"])
+		}
+		message, err := grpcMessage(response.body)
+		if err != nil {
+			return nil, err
+		}
+		return parseReflectionServices(message)
+	}
+	return nil, fmt.Errorf("not supported")
+}
+
+func (r *h2Response) isGRPC() bool {
+	_, ok := r.headers["grpc-status"]
+	return ok || strings.HasPrefix(r.headers["content-type"], "application/grpc")
+}
+
+func (r *h2Response) grpcStatus() int {
+	status, err := strconv.Atoi(r.headers["grpc-status"])
+	if err != nil {
+		return -1
+	}
+	return status
+}
+
+func grpcStatusName(status int) string {
+	name, ok := grpcStatusNames[status]
+	if !ok {
+		return strconv.Itoa(status)
+	}
+	return name
+}
+
+// Первое сообщение из тела ответа gRPC
+func grpcMessage(body []byte) ([]byte, error) {
+	if len(body) < 5 {
+		return nil, fmt.Errorf("grpc message is too short")
+	}
+	if body[0] != 0 {
+		return nil, fmt.Errorf("compressed grpc messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(body[1:5])
+	if uint32(len(body)-5) < length {
+		return nil, fmt.Errorf("grpc message is truncated")
+	}
+	return body[5 : 5+length], nil
+}
+
+// HealthCheckResponse: поле 1 — перечисление ServingStatus
+func grpcHealthStatus(body []byte) string {
+	message, err := grpcMessage(body)
+	if err != nil {
+		return "unknown"
+	}
+	status := uint64(0)
+	for len(message) > 0 {
+		field, value, _, rest, err := readProtoField(message)
+		if err != nil {
+			return "unknown"
+		}
+		if field == 1 {
+			status = value
+		}
+		message = rest
+	}
+	name, ok := grpcHealthStatuses[status]
+	if !ok {
+		return strconv.FormatUint(status, 10)
+	}
+	return name
+}
+
+// ServerReflectionResponse: поле 6 — ListServiceResponse с повторяющимся
+// ServiceResponse в поле 1, у которого имя лежит в поле 1; поле 7 — ошибка
+func parseReflectionServices(message []byte) ([]string, error) {
+	services := make([]string, 0)
+	for len(message) > 0 {
+		field, _, payload, rest, err := readProtoField(message)
+		if err != nil {
+			return nil, err
+		}
+		message = rest
+		switch field {
+		case 6:
+			for len(payload) > 0 {
+				serviceField, _, service, next, err := readProtoField(payload)
+				if err != nil {
+					return nil, err
+				}
+				payload = next
+				if serviceField != 1 {
+					continue
+				}
+				for len(service) > 0 {
+					nameField, _, name, after, err := readProtoField(service)
+					if err != nil {
+						return nil, err
+					}
+					service = after
+					if nameField == 1 {
+						services = append(services, string(name))
+					}
+				}
+			}
+		case 7:
+			return nil, fmt.Errorf("reflection error")
+		}
+	}
+	return services, nil
+}
+
+// Читает одно поле protobuf. Для varint и fixed-полей значение возвращается
+// числом, для полей с длиной — срезом
+func readProtoField(data []byte) (int, uint64, []byte, []byte, error) {
+	tag, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, 0, nil, nil, fmt.Errorf("invalid protobuf tag")
+	}
+	data = data[n:]
+	field := int(tag >> 3)
+
+	switch tag & 7 {
+	case 0:
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, 0, nil, nil, fmt.Errorf("invalid protobuf varint")
+		}
+		return field, value, nil, data[n:], nil
+	case 1:
+		if len(data) < 8 {
+			return 0, 0, nil, nil, fmt.Errorf("protobuf field is truncated")
+		}
+		return field, binary.LittleEndian.Uint64(data), nil, data[8:], nil
+	case 2:
+		length, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < length {
+			return 0, 0, nil, nil, fmt.Errorf("protobuf field is truncated")
+		}
+		data = data[n:]
+		return field, 0, data[:length], data[length:], nil
+	case 5:
+		if len(data) < 4 {
+			return 0, 0, nil, nil, fmt.Errorf("protobuf field is truncated")
+		}
+		return field, uint64(binary.LittleEndian.Uint32(data)), nil, data[4:], nil
+	}
+	return 0, 0, nil, nil, fmt.Errorf("unsupported protobuf wire type %d", tag&7)
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// Поле protobuf с длиной: тег, длина и содержимое
+func protoField(field int, payload []byte) []byte {
+	data := binary.AppendUvarint(nil, uint64(field<<3|2))
+	data = binary.AppendUvarint(data, uint64(len(payload)))
+	return append(data, payload...)
+}
+
+// gRPC-сообщение без сжатия с пятибайтовым префиксом
+func grpcFrame(message []byte) []byte {
+	return append(binary.BigEndian.AppendUint32([]byte{0}, uint32(len(message))), message...)
+}
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		kind    byte
+		flags   byte
+		stream  uint32
+		payload string
+		ok      bool
+	}{
+		{"settings", "000006 04 00 00000000 000300000064", h2FrameSettings, 0, 0, "000300000064", true},
+		{"settings ack", "000000 04 01 00000000", h2FrameSettings, h2FlagAck, 0, "", true},
+		{"reserved bit", "000002 00 01 80000003 0102", h2FrameData, h2FlagEndStream, 3, "0102", true},
+		{"empty", "", 0, 0, 0, "", false},
+		{"truncated header", "000006 04 00 0000", 0, 0, 0, "", false},
+		{"truncated payload", "000006 04 00 00000000 0003", 0, 0, 0, "", false},
+		{"too large", "004001 00 00 00000001", 0, 0, 0, "", false},
+	}
+	for _, test := range tests {
+		conn := &h2Conn{reader: bufio.NewReader(bytes.NewReader(hpackBlock(test.raw)))}
+		frame, err := conn.readFrame()
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%s: expected error, got %+v", test.name, frame)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if frame.kind != test.kind || frame.flags != test.flags || frame.stream != test.stream ||
+			!bytes.Equal(frame.payload, hpackBlock(test.payload)) {
+			t.Errorf("%s: got %+v", test.name, frame)
+		}
+	}
+}
+
+func TestFrameData(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame h2Frame
+		data  string
+		ok    bool
+	}{
+		{"plain", h2Frame{kind: h2FrameData, payload: hpackBlock("0102")}, "0102", true},
+		{"padded", h2Frame{kind: h2FrameData, flags: h2FlagPadded, payload: hpackBlock("02 0102 0000")}, "0102", true},
+		{"priority", h2Frame{kind: h2FrameHeaders, flags: h2FlagPriority, payload: hpackBlock("00000000 10 8286")}, "8286", true},
+		{"padded priority", h2Frame{kind: h2FrameHeaders, flags: h2FlagPadded | h2FlagPriority, payload: hpackBlock("01 00000000 10 8286 00")}, "8286", true},
+		{"empty padded", h2Frame{kind: h2FrameData, flags: h2FlagPadded}, "", false},
+		{"padding too long", h2Frame{kind: h2FrameData, flags: h2FlagPadded, payload: hpackBlock("05 0102")}, "", false},
+		{"truncated priority", h2Frame{kind: h2FrameHeaders, flags: h2FlagPriority, payload: hpackBlock("000000")}, "", false},
+	}
+	for _, test := range tests {
+		data, err := test.frame.data()
+		if (err == nil) != test.ok || !bytes.Equal(data, hpackBlock(test.data)) {
+			t.Errorf("%s: got %x, error %v", test.name, data, err)
+		}
+	}
+}
+
+func TestGRPCMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		message string
+		ok      bool
+	}{
+		{"message", "00 00000002 0801", "0801", true},
+		{"empty message", "00 00000000", "", true},
+		{"trailing bytes", "00 00000001 08 01", "08", true},
+		{"short prefix", "00 000000", "", false},
+		{"compressed", "01 00000002 0801", "", false},
+		{"truncated", "00 00000005 0801", "", false},
+	}
+	for _, test := range tests {
+		message, err := grpcMessage(hpackBlock(test.body))
+		if (err == nil) != test.ok || !bytes.Equal(message, hpackBlock(test.message)) {
+			t.Errorf("%s: got %x, error %v", test.name, message, err)
+		}
+	}
+}
+
+func TestGRPCHealthStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   []byte
+		status string
+	}{
+		{"serving", grpcFrame([]byte{0x08, 0x01}), "SERVING"},
+		{"not serving", grpcFrame([]byte{0x08, 0x02}), "NOT_SERVING"},
+		{"default value", grpcFrame(nil), "UNKNOWN"},
+		{"unknown field skipped", grpcFrame(append(protoField(2, []byte("x")), 0x08, 0x01)), "SERVING"},
+		{"unknown status", grpcFrame([]byte{0x08, 0x07}), "7"},
+		{"truncated varint", grpcFrame([]byte{0x08, 0x81}), "unknown"},
+		{"truncated message", grpcFrame([]byte{0x08, 0x01})[:6], "unknown"},
+		{"empty body", nil, "unknown"},
+	}
+	for _, test := range tests {
+		if status := grpcHealthStatus(test.body); status != test.status {
+			t.Errorf("%s: got %q, want %q", test.name, status, test.status)
+		}
+	}
+}
+
+func TestParseReflectionServices(t *testing.T) {
+	service := func(name string) []byte {
+		return protoField(1, protoField(1, []byte(name)))
+	}
+	list := append(service("grpc.health.v1.Health"), service("grpc.reflection.v1.ServerReflection")...)
+	response := append(protoField(1, []byte("localhost:50051")), protoField(6, list)...)
+
+	tests := []struct {
+		name     string
+		message  []byte
+		services []string
+		ok       bool
+	}{
+		{"services", response, []string{"grpc.health.v1.Health", "grpc.reflection.v1.ServerReflection"}, true},
+		{"no services", protoField(6, nil), []string{}, true},
+		{"other service fields", protoField(6, protoField(1, append(protoField(2, []byte("x")), protoField(1, []byte("a.B"))...))), []string{"a.B"}, true},
+		{"error response", protoField(7, append([]byte{0x08, 0x0c}, protoField(2, []byte("unimplemented"))...)), nil, false},
+		{"truncated list", response[:len(response)-3], nil, false},
+		{"truncated service", protoField(6, protoField(1, []byte{0x0a, 0x05, 'a'})), nil, false},
+		{"truncated tag", []byte{0x80}, nil, false},
+	}
+	for _, test := range tests {
+		services, err := parseReflectionServices(test.message)
+		if (err == nil) != test.ok || (test.ok && !slices.Equal(services, test.services)) {
+			t.Errorf("%s: got %q, error %v", test.name, services, err)
+		}
+	}
+}
+
+func TestReadProtoField(t *testing.T) {
+	tests := []struct {
+		data    string
+		field   int
+		value   uint64
+		payload string
+		rest    string
+		ok      bool
+	}{
+		{"08 9601 10", 1, 150, "", "10", true},
+		{"11 0100000000000000", 2, 1, "", "", true},
+		{"1a 03 616263 08", 3, 0, "616263", "08", true},
+		{"25 01000000", 4, 1, "", "", true},
+		// Номер поля больше 15 занимает два байта тега
+		{"a001 01", 20, 1, "", "", true},
+		{"", 0, 0, "", "", false},
+		{"80", 0, 0, "", "", false},
+		{"08", 0, 0, "", "", false},
+		{"08 96", 0, 0, "", "", false},
+		{"11 01000000", 0, 0, "", "", false},
+		{"1a 05 6162", 0, 0, "", "", false},
+		{"1a 80", 0, 0, "", "", false},
+		{"25 0100", 0, 0, "", "", false},
+		{"1b", 0, 0, "", "", false},
+	}
+	for _, test := range tests {
+		field, value, payload, rest, err := readProtoField(hpackBlock(test.data))
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%q: expected error", test.data)
+			}
+			continue
+		}
+		if err != nil || field != test.field || value != test.value ||
+			!bytes.Equal(payload, hpackBlock(test.payload)) || !bytes.Equal(rest, hpackBlock(test.rest)) {
+			t.Errorf("%q: got field %d, value %d, payload %x, rest %x, error %v", test.data, field, value, payload, rest, err)
+		}
+	}
+}
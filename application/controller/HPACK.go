@@ -0,0 +1,357 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Минимальная реализация HPACK (RFC 7541): кодируем заголовки литералами без
+// индексирования и Хаффмана, а разбираем все представления, которые может прислать сервер
+
+const hpackDefaultTableSize = 4096
+
+// Статическая таблица, приложение A
+var hpackStaticTable = [][2]string{
+	{":authority", ""},
+	{":method", "GET"},
+	{":method", "POST"},
+	{":path", "/"},
+	{":path", "/index.html"},
+	{":scheme", "http"},
+	{":scheme", "https"},
+	{":status", "200"},
+	{":status", "204"},
+	{":status", "206"},
+	{":status", "304"},
+	{":status", "400"},
+	{":status", "404"},
+	{":status", "500"},
+	{"accept-charset", ""},
+	{"accept-encoding", "gzip, deflate"},
+	{"accept-language", ""},
+	{"accept-ranges", ""},
+	{"accept", ""},
+	{"access-control-allow-origin", ""},
+	{"age", ""},
+	{"allow", ""},
+	{"authorization", ""},
+	{"cache-control", ""},
+	{"content-disposition", ""},
+	{"content-encoding", ""},
+	{"content-language", ""},
+	{"content-length", ""},
+	{"content-location", ""},
+	{"content-range", ""},
+	{"content-type", ""},
+	{"cookie", ""},
+	{"date", ""},
+	{"etag", ""},
+	{"expect", ""},
+	{"expires", ""},
+	{"from", ""},
+	{"host", ""},
+	{"if-match", ""},
+	{"if-modified-since", ""},
+	{"if-none-match", ""},
+	{"if-range", ""},
+	{"if-unmodified-since", ""},
+	{"last-modified", ""},
+	{"link", ""},
+	{"location", ""},
+	{"max-forwards", ""},
+	{"proxy-authenticate", ""},
+	{"proxy-authorization", ""},
+	{"range", ""},
+	{"referer", ""},
+	{"refresh", ""},
+	{"retry-after", ""},
+	{"server", ""},
+	{"set-cookie", ""},
+	{"strict-transport-security", ""},
+	{"transfer-encoding", ""},
+	{"user-agent", ""},
+	{"vary", ""},
+	{"via", ""},
+	{"www-authenticate", ""},
+}
+
+// Коды Хаффмана для байтов 0–255, приложение B. Код EOS в данных не встречается
+var hpackHuffmanCodes = [256]uint32{
+	0x1ff8, 0x7fffd8, 0xfffffe2, 0xfffffe3, 0xfffffe4, 0xfffffe5, 0xfffffe6, 0xfffffe7,
+	0xfffffe8, 0xffffea, 0x3ffffffc, 0xfffffe9, 0xfffffea, 0x3ffffffd, 0xfffffeb, 0xfffffec,
+	0xfffffed, 0xfffffee, 0xfffffef, 0xffffff0, 0xffffff1, 0xffffff2, 0x3ffffffe, 0xffffff3,
+	0xffffff4, 0xffffff5, 0xffffff6, 0xffffff7, 0xffffff8, 0xffffff9, 0xffffffa, 0xffffffb,
+	0x14, 0x3f8, 0x3f9, 0xffa, 0x1ff9, 0x15, 0xf8, 0x7fa,
+	0x3fa, 0x3fb, 0xf9, 0x7fb, 0xfa, 0x16, 0x17, 0x18,
+	0x0, 0x1, 0x2, 0x19, 0x1a, 0x1b, 0x1c, 0x1d,
+	0x1e, 0x1f, 0x5c, 0xfb, 0x7ffc, 0x20, 0xffb, 0x3fc,
+	0x1ffa, 0x21, 0x5d, 0x5e, 0x5f, 0x60, 0x61, 0x62,
+	0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6a,
+	0x6b, 0x6c, 0x6d, 0x6e, 0x6f, 0x70, 0x71, 0x72,
+	0xfc, 0x73, 0xfd, 0x1ffb, 0x7fff0, 0x1ffc, 0x3ffc, 0x22,
+	0x7ffd, 0x3, 0x23, 0x4, 0x24, 0x5, 0x25, 0x26,
+	0x27, 0x6, 0x74, 0x75, 0x28, 0x29, 0x2a, 0x7,
+	0x2b, 0x76, 0x2c, 0x8, 0x9, 0x2d, 0x77, 0x78,
+	0x79, 0x7a, 0x7b, 0x7ffe, 0x7fc, 0x3ffd, 0x1ffd, 0xffffffc,
+	0xfffe6, 0x3fffd2, 0xfffe7, 0xfffe8, 0x3fffd3, 0x3fffd4, 0x3fffd5, 0x7fffd9,
+	0x3fffd6, 0x7fffda, 0x7fffdb, 0x7fffdc, 0x7fffdd, 0x7fffde, 0xffffeb, 0x7fffdf,
+	0xffffec, 0xffffed, 0x3fffd7, 0x7fffe0, 0xffffee, 0x7fffe1, 0x7fffe2, 0x7fffe3,
+	0x7fffe4, 0x1fffdc, 0x3fffd8, 0x7fffe5, 0x3fffd9, 0x7fffe6, 0x7fffe7, 0xffffef,
+	0x3fffda, 0x1fffdd, 0xfffe9, 0x3fffdb, 0x3fffdc, 0x7fffe8, 0x7fffe9, 0x1fffde,
+	0x7fffea, 0x3fffdd, 0x3fffde, 0xfffff0, 0x1fffdf, 0x3fffdf, 0x7fffeb, 0x7fffec,
+	0x1fffe0, 0x1fffe1, 0x3fffe0, 0x1fffe2, 0x7fffed, 0x3fffe1, 0x7fffee, 0x7fffef,
+	0xfffea, 0x3fffe2, 0x3fffe3, 0x3fffe4, 0x7ffff0, 0x3fffe5, 0x3fffe6, 0x7ffff1,
+	0x3ffffe0, 0x3ffffe1, 0xfffeb, 0x7fff1, 0x3fffe7, 0x7ffff2, 0x3fffe8, 0x1ffffec,
+	0x3ffffe2, 0x3ffffe3, 0x3ffffe4, 0x7ffffde, 0x7ffffdf, 0x3ffffe5, 0xfffff1, 0x1ffffed,
+	0x7fff2, 0x1fffe3, 0x3ffffe6, 0x7ffffe0, 0x7ffffe1, 0x3ffffe7, 0x7ffffe2, 0xfffff2,
+	0x1fffe4, 0x1fffe5, 0x3ffffe8, 0x3ffffe9, 0xffffffd, 0x7ffffe3, 0x7ffffe4, 0x7ffffe5,
+	0xfffec, 0xfffff3, 0xfffed, 0x1fffe6, 0x3fffe9, 0x1fffe7, 0x1fffe8, 0x7ffff3,
+	0x3fffea, 0x3fffeb, 0x1ffffee, 0x1ffffef, 0xfffff4, 0xfffff5, 0x3ffffea, 0x7ffff4,
+	0x3ffffeb, 0x7ffffe6, 0x3ffffec, 0x3ffffed, 0x7ffffe7, 0x7ffffe8, 0x7ffffe9, 0x7ffffea,
+	0x7ffffeb, 0xffffffe, 0x7ffffec, 0x7ffffed, 0x7ffffee, 0x7ffffef, 0x7fffff0, 0x3ffffee,
+}
+
+var hpackHuffmanLengths = [256]uint8{
+	13, 23, 28, 28, 28, 28, 28, 28, 28, 24, 30, 28, 28, 30, 28, 28,
+	28, 28, 28, 28, 28, 28, 30, 28, 28, 28, 28, 28, 28, 28, 28, 28,
+	6, 10, 10, 12, 13, 6, 8, 11, 10, 10, 8, 11, 8, 6, 6, 6,
+	5, 5, 5, 6, 6, 6, 6, 6, 6, 6, 7, 8, 15, 6, 12, 10,
+	13, 6, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+	7, 7, 7, 7, 7, 7, 7, 7, 8, 7, 8, 13, 19, 13, 14, 6,
+	15, 5, 6, 5, 6, 5, 6, 6, 6, 5, 7, 7, 6, 6, 6, 5,
+	6, 7, 6, 5, 5, 6, 7, 7, 7, 7, 7, 15, 11, 14, 13, 28,
+	20, 22, 20, 20, 22, 22, 22, 23, 22, 23, 23, 23, 23, 23, 24, 23,
+	24, 24, 22, 23, 24, 23, 23, 23, 23, 21, 22, 23, 22, 23, 23, 24,
+	22, 21, 20, 22, 22, 23, 23, 21, 23, 22, 22, 24, 21, 22, 23, 23,
+	21, 21, 22, 21, 23, 22, 23, 23, 20, 22, 22, 22, 23, 22, 22, 23,
+	26, 26, 20, 19, 22, 23, 22, 25, 26, 26, 26, 27, 27, 26, 24, 25,
+	19, 21, 26, 27, 27, 26, 27, 24, 21, 21, 26, 26, 28, 27, 27, 27,
+	20, 24, 20, 21, 22, 21, 21, 23, 22, 22, 25, 25, 24, 24, 26, 23,
+	26, 27, 26, 26, 27, 27, 27, 27, 27, 28, 27, 27, 27, 27, 27, 26,
+}
+
+type hpackDecoder struct {
+	// Динамическая таблица, самая новая запись первая
+	dynamic [][2]string
+	size    int
+	maxSize int
+}
+
+// Символы по длине и значению кода
+var hpackHuffmanSymbols = hpackHuffmanIndex()
+
+func newHPACKDecoder() *hpackDecoder {
+	return &hpackDecoder{maxSize: hpackDefaultTableSize}
+}
+
+// Кодирует заголовки литералами без индексирования с новым именем
+func hpackEncode(fields [][2]string) []byte {
+	block := make([]byte, 0)
+	for _, field := range fields {
+		block = append(block, 0)
+		block = hpackAppendString(block, field[0])
+		block = hpackAppendString(block, field[1])
+	}
+	return block
+}
+
+func hpackAppendString(block []byte, value string) []byte {
+	block = hpackAppendInteger(block, 0, 7, uint64(len(value)))
+	return append(block, value...)
+}
+
+func hpackAppendInteger(block []byte, flags byte, prefix uint, value uint64) []byte {
+	limit := uint64(1)<<prefix - 1
+	if value < limit {
+		return append(block, flags|byte(value))
+	}
+	block = append(block, flags|byte(limit))
+	value -= limit
+	for value >= 128 {
+		block = append(block, byte(value%128)|0x80)
+		value /= 128
+	}
+	return append(block, byte(value))
+}
+
+func (d *hpackDecoder) decode(block []byte) ([][2]string, error) {
+	fields := make([][2]string, 0)
+	for len(block) > 0 {
+		first := block[0]
+		switch {
+		case first&0x80 != 0:
+			index, rest, err := hpackReadInteger(block, 7)
+			if err != nil {
+				return nil, err
+			}
+			field, err := d.lookup(index)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+			block = rest
+
+		case first&0xe0 == 0x20:
+			size, rest, err := hpackReadInteger(block, 5)
+			if err != nil {
+				return nil, err
+			}
+			if size > hpackDefaultTableSize {
+				return nil, fmt.Errorf("hpack table size %d is too large", size)
+			}
+			d.maxSize = int(size)
+			d.evict()
+			block = rest
+
+		default:
+			// С инкрементальным индексированием (01) или без него (0000, 0001)
+			indexed := first&0xc0 == 0x40
+			prefix := uint(4)
+			if indexed {
+				prefix = 6
+			}
+			field, rest, err := d.readLiteral(block, prefix)
+			if err != nil {
+				return nil, err
+			}
+			if indexed {
+				d.add(field)
+			}
+			fields = append(fields, field)
+			block = rest
+		}
+	}
+	return fields, nil
+}
+
+func (d *hpackDecoder) readLiteral(block []byte, prefix uint) ([2]string, []byte, error) {
+	var field [2]string
+	index, rest, err := hpackReadInteger(block, prefix)
+	if err != nil {
+		return field, nil, err
+	}
+	if index == 0 {
+		field[0], rest, err = hpackReadString(rest)
+		if err != nil {
+			return field, nil, err
+		}
+	} else {
+		named, err := d.lookup(index)
+		if err != nil {
+			return field, nil, err
+		}
+		field[0] = named[0]
+	}
+	field[1], rest, err = hpackReadString(rest)
+	if err != nil {
+		return field, nil, err
+	}
+	return field, rest, nil
+}
+
+func (d *hpackDecoder) lookup(index uint64) ([2]string, error) {
+	if index == 0 {
+		return [2]string{}, fmt.Errorf("hpack index 0 is invalid")
+	}
+	if index <= uint64(len(hpackStaticTable)) {
+		return hpackStaticTable[index-1], nil
+	}
+	index -= uint64(len(hpackStaticTable)) + 1
+	if index >= uint64(len(d.dynamic)) {
+		return [2]string{}, fmt.Errorf("hpack index is out of range")
+	}
+	return d.dynamic[index], nil
+}
+
+// Размер записи считается как длины имени и значения плюс 32 байта (раздел 4.1)
+func (d *hpackDecoder) add(field [2]string) {
+	d.dynamic = append([][2]string{field}, d.dynamic...)
+	d.size += len(field[0]) + len(field[1]) + 32
+	d.evict()
+}
+
+func (d *hpackDecoder) evict() {
+	for d.size > d.maxSize && len(d.dynamic) > 0 {
+		last := d.dynamic[len(d.dynamic)-1]
+		d.size -= len(last[0]) + len(last[1]) + 32
+		d.dynamic = d.dynamic[:len(d.dynamic)-1]
+	}
+}
+
+func hpackReadInteger(block []byte, prefix uint) (uint64, []byte, error) {
+	if len(block) == 0 {
+		return 0, nil, fmt.Errorf("hpack integer is truncated")
+	}
+	limit := uint64(1)<<prefix - 1
+	value := uint64(block[0]) & limit
+	block = block[1:]
+	if value < limit {
+		return value, block, nil
+	}
+	for shift := uint(0); len(block) > 0 && shift < 63; shift += 7 {
+		b := block[0]
+		block = block[1:]
+		value += uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value, block, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("hpack integer is truncated")
+}
+
+func hpackReadString(block []byte) (string, []byte, error) {
+	if len(block) == 0 {
+		return "", nil, fmt.Errorf("hpack string is truncated")
+	}
+	huffman := block[0]&0x80 != 0
+	length, rest, err := hpackReadInteger(block, 7)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint64(len(rest)) < length {
+		return "", nil, fmt.Errorf("hpack string is truncated")
+	}
+	data := rest[:length]
+	rest = rest[length:]
+	if !huffman {
+		return string(data), rest, nil
+	}
+	value, err := hpackHuffmanDecode(data)
+	if err != nil {
+		return "", nil, err
+	}
+	return value, rest, nil
+}
+
+func hpackHuffmanIndex() map[uint64]byte {
+	symbols := make(map[uint64]byte, len(hpackHuffmanCodes))
+	for symbol, code := range hpackHuffmanCodes {
+		symbols[uint64(hpackHuffmanLengths[symbol])<<32|uint64(code)] = byte(symbol)
+	}
+	return symbols
+}
+
+// Заголовки короткие, поэтому декодируем побитово, сверяясь с таблицей кодов
+func hpackHuffmanDecode(data []byte) (string, error) {
+	var value strings.Builder
+	code := uint64(0)
+	length := 0
+	for _, b := range data {
+		for bit := 7; bit >= 0; bit-- {
+			code = code<<1 | uint64(b>>bit&1)
+			length++
+			if symbol, ok := hpackHuffmanSymbols[uint64(length)<<32|code]; ok {
+				value.WriteByte(symbol)
+				code = 0
+				length = 0
+			} else if length > 30 {
+				return "", fmt.Errorf("invalid hpack huffman code")
+			}
+		}
+	}
+	// Остаток — это дополнение старшими битами кода EOS, то есть единицами
+	if length > 7 || code != uint64(1)<<length-1 {
+		return "", fmt.Errorf("invalid hpack huffman padding")
+	}
+	return value.String(), nil
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"encoding/hex"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func hpackBlock(s string) []byte {
+	return unhex(strings.ReplaceAll(s, " ", ""))
+}
+
+func TestHPACKInteger(t *testing.T) {
+	// Примеры из RFC 7541, C.1
+	tests := []struct {
+		value   uint64
+		prefix  uint
+		encoded string
+	}{
+		{10, 5, "0a"},
+		{1337, 5, "1f9a0a"},
+		{42, 8, "2a"},
+		{31, 5, "1f00"},
+	}
+	for _, test := range tests {
+		encoded := hpackAppendInteger(nil, 0, test.prefix, test.value)
+		if got := hex.EncodeToString(encoded); got != test.encoded {
+			t.Errorf("%d/%d: encoded as %s, want %s", test.value, test.prefix, got, test.encoded)
+		}
+		value, rest, err := hpackReadInteger(encoded, test.prefix)
+		if err != nil || value != test.value || len(rest) != 0 {
+			t.Errorf("%s: got %d, %d left, error %v", test.encoded, value, len(rest), err)
+		}
+	}
+	for _, truncated := range []string{"", "1f", "1f9a", "1fffffffffffffffffffff"} {
+		if _, _, err := hpackReadInteger(hpackBlock(truncated), 5); err == nil {
+			t.Errorf("%q: expected error", truncated)
+		}
+	}
+}
+
+// Последовательности заголовков из RFC 7541, C.3–C.5: каждая следующая опирается
+// на динамическую таблицу, заполненную предыдущими
+func TestHPACKDecodeRFCExamples(t *testing.T) {
+	request1 := [][2]string{{":method", "GET"}, {":scheme", "http"}, {":path", "/"}, {":authority", "www.example.com"}}
+	request2 := append(slices.Clone(request1), [2]string{"cache-control", "no-cache"})
+	request3 := [][2]string{{":method", "GET"}, {":scheme", "https"}, {":path", "/index.html"}, {":authority", "www.example.com"}, {"custom-key", "custom-value"}}
+	response1 := [][2]string{{":status", "302"}, {"cache-control", "private"}, {"date", "Mon, 21 Oct 2013 20:13:21 GMT"}, {"location", "https://www.example.com"}}
+	response2 := slices.Clone(response1)
+	response2[0][1] = "307"
+	response3 := [][2]string{
+		{":status", "200"}, {"cache-control", "private"}, {"date", "Mon, 21 Oct 2013 20:13:22 GMT"}, {"location", "https://www.example.com"},
+		{"content-encoding", "gzip"}, {"set-cookie", "foo=ASDJKHQKBZXOQWEOPIUAXQWEOIU; max-age=3600; version=1"},
+	}
+
+	sequences := []struct {
+		name      string
+		tableSize int
+		blocks    []string
+		fields    [][][2]string
+		sizes     []int
+	}{
+		{"requests without huffman", hpackDefaultTableSize, []string{
+			"8286 8441 0f77 7777 2e65 7861 6d70 6c65 2e63 6f6d",
+			"8286 84be 5808 6e6f 2d63 6163 6865",
+			"8287 85bf 400a 6375 7374 6f6d 2d6b 6579 0c63 7573 746f 6d2d 7661 6c75 65",
+		}, [][][2]string{request1, request2, request3}, []int{57, 110, 164}},
+		{"requests with huffman", hpackDefaultTableSize, []string{
+			"8286 8441 8cf1 e3c2 e5f2 3a6b a0ab 90f4 ff",
+			"8286 84be 5886 a8eb 1064 9cbf",
+			"8287 85bf 4088 25a8 49e9 5ba9 7d7f 8925 a849 e95b b8e8 b4bf",
+		}, [][][2]string{request1, request2, request3}, []int{57, 110, 164}},
+		{"responses with eviction", 256, []string{
+			"4803 3330 3258 0770 7269 7661 7465 611d 4d6f 6e2c 2032 3120 4f63 7420 3230 3133 2032 303a 3133 3a32 3120 474d 546e 1768 7474 7073 3a2f 2f77 7777 2e65 7861 6d70 6c65 2e63 6f6d",
+			"4803 3330 37c1 c0bf",
+			"88c1 611d 4d6f 6e2c 2032 3120 4f63 7420 3230 3133 2032 303a 3133 3a32 3220 474d 54c0 5a04 677a 6970 7738 666f 6f3d 4153 444a 4b48 514b 425a 584f 5157 454f 5049 5541 5851 5745 4f49 553b 206d 6178 2d61 6765 3d33 3630 303b 2076 6572 7369 6f6e 3d31",
+		}, [][][2]string{response1, response2, response3}, []int{222, 222, 215}},
+	}
+	for _, sequence := range sequences {
+		decoder := newHPACKDecoder()
+		decoder.maxSize = sequence.tableSize
+		for i, block := range sequence.blocks {
+			fields, err := decoder.decode(hpackBlock(block))
+			if err != nil {
+				t.Errorf("%s #%d: %v", sequence.name, i+1, err)
+				break
+			}
+			if !slices.Equal(fields, sequence.fields[i]) {
+				t.Errorf("%s #%d: got %q", sequence.name, i+1, fields)
+			}
+			if decoder.size != sequence.sizes[i] {
+				t.Errorf("%s #%d: table size %d, want %d", sequence.name, i+1, decoder.size, sequence.sizes[i])
+			}
+		}
+	}
+}
+
+func TestHPACKDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		block string
+	}{
+		{"index 0", "80"},
+		{"index past dynamic table", "be"},
+		{"literal name truncated", "400a 6375 7374"},
+		{"table size above limit", "3fe2 1f"},
+		{"huffman eos padding too long", "0085 f1e3 c2e5 ffff"},
+		{"huffman padding with zeros", "0081 00"},
+	}
+	for _, test := range tests {
+		if fields, err := newHPACKDecoder().decode(hpackBlock(test.block)); err == nil {
+			t.Errorf("%s: got %q, expected error", test.name, fields)
+		}
+	}
+}
+
+func TestHPACKEncodeRoundTrip(t *testing.T) {
+	fields := [][2]string{
+		{":method", "POST"},
+		{":path", "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"},
+		{"content-type", "application/grpc"},
+		{"te", "trailers"},
+		{"x-long", strings.Repeat("a", 200)},
+	}
+	decoded, err := newHPACKDecoder().decode(hpackEncode(fields))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(decoded, fields) {
+		t.Errorf("got %q", decoded)
+	}
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+func AuditHTTP(ip net.IP, port int, useTLS bool, rules []domain.HttpAuditRule, timeout time.Duration) ([]domain.Finding, error) {
+	header, err := fetchHTTPHeaders(ip, port, useTLS, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := make([]domain.Finding, 0)
+	for _, rule := range rules {
+		if rule.TLSOnly && !useTLS {
+			continue
+		}
+		found, err := evaluateHttpAuditRule(rule, header)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, found...)
+	}
+	return findings, nil
+}
+
+func fetchHTTPHeaders(ip net.IP, port int, useTLS bool, timeout time.Duration) (http.Header, error) {
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	address := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		// Аудит проводится для ответа самого сервиса, а не цели редиректа
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(fmt.Sprintf("%s://%s/", scheme, address))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return resp.Header, nil
+}
+
+func evaluateHttpAuditRule(rule domain.HttpAuditRule, header http.Header) ([]domain.Finding, error) {
+	values := header.Values(rule.Header)
+	finding := domain.Finding{
+		Check:    rule.Name,
+		Severity: rule.Severity,
+	}
+
+	switch rule.Check {
+	case domain.AuditCheckPresent:
+		if len(values) == 0 {
+			finding.Detail = fmt.Sprintf("header '%s' is missing", rule.Header)
+			return []domain.Finding{finding}, nil
+		}
+
+	case domain.AuditCheckAbsent:
+		if len(values) != 0 {
+			finding.Detail = fmt.Sprintf("header '%s' is present: %s", rule.Header, strings.Join(values, ", "))
+			return []domain.Finding{finding}, nil
+		}
+
+	case domain.AuditCheckMatch:
+		re, err := regexp.Compile(rule.Value)
+		if err != nil {
+			return nil, fmt.Errorf("rule '%s': %w", rule.Name, err)
+		}
+		for _, value := range values {
+			if re.MatchString(value) {
+				finding.Detail = fmt.Sprintf("header '%s' discloses '%s'", rule.Header, value)
+				return []domain.Finding{finding}, nil
+			}
+		}
+
+	case domain.AuditCheckCookieFlag:
+		findings := make([]domain.Finding, 0)
+		for _, cookie := range values {
+			if hasCookieAttribute(cookie, rule.Value) {
+				continue
+			}
+			name, _, _ := strings.Cut(cookie, "=")
+			cookieFinding := finding
+			cookieFinding.Detail = fmt.Sprintf("cookie '%s' has no %s attribute", strings.TrimSpace(name), rule.Value)
+			findings = append(findings, cookieFinding)
+		}
+		return findings, nil
+
+	default:
+		return nil, fmt.Errorf("rule '%s': unknown check '%s'", rule.Name, rule.Check)
+	}
+
+	return nil, nil
+}
+
+func hasCookieAttribute(cookie, attribute string) bool {
+	parts := strings.Split(cookie, ";")
+	for _, part := range parts[1:] {
+		name, _, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if strings.EqualFold(name, attribute) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+func TestEvaluateHttpAuditRule(t *testing.T) {
+	header := http.Header{}
+	header.Set("Server", "nginx/1.25.3")
+	header.Set("X-Frame-Options", "DENY")
+	header.Add("Set-Cookie", "session=abc; Path=/; HttpOnly; Secure")
+	header.Add("Set-Cookie", "theme=dark; Path=/")
+
+	tests := []struct {
+		name string
+		rule domain.HttpAuditRule
+		want []string
+	}{
+		{"present ok", domain.HttpAuditRule{Header: "X-Frame-Options", Check: domain.AuditCheckPresent}, nil},
+		{"present missing", domain.HttpAuditRule{Header: "Content-Security-Policy", Check: domain.AuditCheckPresent},
+			[]string{"header 'Content-Security-Policy' is missing"}},
+		{"absent ok", domain.HttpAuditRule{Header: "X-Powered-By", Check: domain.AuditCheckAbsent}, nil},
+		{"absent present", domain.HttpAuditRule{Header: "Server", Check: domain.AuditCheckAbsent},
+			[]string{"header 'Server' is present: nginx/1.25.3"}},
+		{"match", domain.HttpAuditRule{Header: "Server", Check: domain.AuditCheckMatch, Value: `[0-9]+\.[0-9]+`},
+			[]string{"header 'Server' discloses 'nginx/1.25.3'"}},
+		{"no match", domain.HttpAuditRule{Header: "Server", Check: domain.AuditCheckMatch, Value: `apache`}, nil},
+		{"cookie flag", domain.HttpAuditRule{Header: "Set-Cookie", Check: domain.AuditCheckCookieFlag, Value: "Secure"},
+			[]string{"cookie 'theme' has no Secure attribute"}},
+		{"cookie flag case", domain.HttpAuditRule{Header: "Set-Cookie", Check: domain.AuditCheckCookieFlag, Value: "httponly"},
+			[]string{"cookie 'theme' has no httponly attribute"}},
+	}
+	for _, test := range tests {
+		findings, err := evaluateHttpAuditRule(test.rule, header)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var got []string
+		for _, finding := range findings {
+			got = append(got, finding.Detail)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got %q, want %q", test.name, got[i], test.want[i])
+			}
+		}
+	}
+
+	for _, rule := range []domain.HttpAuditRule{
+		{Name: "bad-pattern", Header: "Server", Check: domain.AuditCheckMatch, Value: "("},
+		{Name: "bad-check", Header: "Server", Check: "equals"},
+	} {
+		if _, err := evaluateHttpAuditRule(rule, header); err == nil {
+			t.Errorf("%s: expected error", rule.Name)
+		}
+	}
+}
+
+func TestHasCookieAttribute(t *testing.T) {
+	tests := []struct {
+		cookie    string
+		attribute string
+		want      bool
+	}{
+		{"id=1; Secure", "Secure", true},
+		{"id=1;secure", "Secure", true},
+		{"id=1; SameSite=Lax", "SameSite", true},
+		{"id=1; Path=/", "Secure", false},
+		// Имя самой cookie атрибутом не считается
+		{"Secure=1; Path=/", "Secure", false},
+		{"id=Secure", "Secure", false},
+		{"", "HttpOnly", false},
+	}
+	for _, test := range tests {
+		if got := hasCookieAttribute(test.cookie, test.attribute); got != test.want {
+			t.Errorf("hasCookieAttribute(%q, %q) = %v, want %v", test.cookie, test.attribute, got, test.want)
+		}
+	}
+}
+
+func TestDetectHTTPSOnAnyPort(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	address, _ := url.Parse(server.URL)
+	host, portText, _ := net.SplitHostPort(address.Host)
+	port, _ := strconv.Atoi(portText)
+
+	cfg := domain.NewDefaultScannerConfig()
+	cfg.Timeout = 2 * time.Second
+	detection, err := detectHTTPS(net.ParseIP(host), port, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detection.Protocol != "HTTPS" {
+		t.Errorf("got protocol %q, want HTTPS", detection.Protocol)
+	}
+
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	address, _ = url.Parse(plain.URL)
+	_, portText, _ = net.SplitHostPort(address.Host)
+	port, _ = strconv.Atoi(portText)
+	if _, err := detectHTTPS(net.ParseIP(host), port, cfg); err == nil {
+		t.Error("plain HTTP detected as HTTPS")
+	}
+}
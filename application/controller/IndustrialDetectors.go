@@ -0,0 +1,530 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+const (
+	bacnetPort = 47808
+	enipPort   = 44818
+
+	bacnetWildcardDevice           = 4194303
+	bacnetPropertyObjectIdentifier = 75
+)
+
+var modbusObjects = map[byte]string{
+	0: "vendor",
+	1: "product code",
+	2: "revision",
+	3: "vendor url",
+	4: "product name",
+	5: "model name",
+	6: "application name",
+}
+
+var modbusExceptions = map[byte]string{
+	1:  "illegal function",
+	2:  "illegal data address",
+	3:  "illegal data value",
+	4:  "server device failure",
+	10: "gateway path unavailable",
+	11: "gateway target failed to respond",
+}
+
+var bacnetProperties = []struct {
+	id   byte
+	name string
+}{
+	{121, "vendor"},
+	{70, "model"},
+	{44, "firmware"},
+	{12, "application"},
+	{77, "name"},
+	{58, "location"},
+}
+
+var enipDeviceTypes = map[uint16]string{
+	0x00: "Generic Device",
+	0x02: "AC Drive",
+	0x07: "General Purpose Discrete I/O",
+	0x0c: "Communications Adapter",
+	0x0e: "Programmable Logic Controller",
+}
+
+var enipVendors = map[uint16]string{
+	1: "Rockwell Automation/Allen-Bradley",
+}
+
+// Read Device Identification (функция 0x2B/0x0E): только чтение, одна транзакция
+func detectModbus(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	request := []byte{
+		0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 0x00,
+		0x2b, 0x0e, 0x01, 0x00,
+	}
+	_, err = conn.Write(request)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 7)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header[4:6]))
+	if !bytes.Equal(header[:4], request[:4]) || length < 3 || length > 260 {
+		return nil, fmt.Errorf("not a modbus response")
+	}
+	pdu := make([]byte, length-1)
+	_, err = io.ReadFull(conn, pdu)
+	if err != nil {
+		return nil, err
+	}
+
+	detection := &domain.Detection{Protocol: "Modbus", Evidence: domain.EvidenceHandshake}
+	switch {
+	case pdu[0] == 0xab:
+		name, ok := modbusExceptions[pdu[1]]
+		if !ok {
+			name = fmt.Sprintf("code %d", pdu[1])
+		}
+		detection.Info = append(detection.Info, "device identification: "+name)
+		return detection, nil
+	case pdu[0] != 0x2b || len(pdu) < 7 || pdu[1] != 0x0e:
+		return nil, fmt.Errorf("unexpected modbus function 0x%02x", pdu[0])
+	}
+
+	objects := make(map[byte]string)
+	pos := 7
+	for i := 0; i < int(pdu[6]) && pos+2 <= len(pdu); i++ {
+		id, size := pdu[pos], int(pdu[pos+1])
+		if pos+2+size > len(pdu) {
+			break
+		}
+		objects[id] = strings.TrimSpace(string(pdu[pos+2 : pos+2+size]))
+		pos += 2 + size
+	}
+
+	detection.Product = strings.TrimSpace(objects[0] + " " + objects[1])
+	detection.Version = objects[2]
+	for id := byte(3); id <= 6; id++ {
+		if value := objects[id]; value != "" {
+			detection.Info = append(detection.Info, modbusObjects[id]+": "+value)
+		}
+	}
+	return detection, nil
+}
+
+// Читает модуль S7 через COTP, Setup Communication и SZL 0x0011.
+// Второй TSAP и SZL 0x001C запрашиваются только с IndustrialDetails
+func detectS7(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	// TSAP 0x0102 (rack 0, slot 2) принимают S7-300/400, 0x0200 — S7-1200/1500
+	tsaps := []uint16{0x0102}
+	if cfg.IndustrialDetails {
+		tsaps = append(tsaps, 0x0200)
+	}
+	var conn net.Conn
+	var err error
+	for _, tsap := range tsaps {
+		conn, err = connectS7(targetIP, port, cfg.Timeout, tsap)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	setup := []byte{
+		0x03, 0x00, 0x00, 0x19, 0x02, 0xf0, 0x80,
+		0x32, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x08, 0x00, 0x00,
+		0xf0, 0x00, 0x00, 0x01, 0x00, 0x01, 0x01, 0xe0,
+	}
+	response, err := exchangeTPKT(conn, setup)
+	if err != nil {
+		return nil, err
+	}
+	if len(response) < 8 || response[7] != 0x32 {
+		return nil, fmt.Errorf("not an s7comm response")
+	}
+
+	detection := &domain.Detection{Protocol: "S7", Evidence: domain.EvidenceHandshake}
+	module, err := exchangeTPKT(conn, s7ReadSZL(0x0011))
+	if err == nil && len(module) > 43 && module[7] == 0x32 {
+		detection.Product = s7String(module, 43)
+		if hardware := s7String(module, 71); hardware != "" {
+			detection.Info = append(detection.Info, "hardware: "+hardware)
+		}
+		if len(module) > 124 {
+			detection.Version = fmt.Sprintf("%d.%d.%d", module[122], module[123], module[124])
+		}
+	}
+
+	if !cfg.IndustrialDetails {
+		return detection, nil
+	}
+	component, err := exchangeTPKT(conn, s7ReadSZL(0x001c))
+	if err == nil && len(component) > 39 && component[7] == 0x32 {
+		fields := []struct {
+			offset int
+			name   string
+		}{
+			{39, "system name"},
+			{73, "module type"},
+			{107, "plant"},
+			{175, "serial"},
+		}
+		for _, field := range fields {
+			if value := s7String(component, field.offset); value != "" {
+				detection.Info = append(detection.Info, field.name+": "+value)
+			}
+		}
+	}
+	return detection, nil
+}
+
+func connectS7(targetIP net.IP, port int, timeout time.Duration, tsap uint16) (net.Conn, error) {
+	conn, err := dialProbe("tcp", targetIP, port, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	request := []byte{
+		0x03, 0x00, 0x00, 0x16, 0x11, 0xe0, 0x00, 0x00, 0x00, 0x14, 0x00,
+		0xc1, 0x02, 0x01, 0x00,
+		0xc2, 0x02, 0x00, 0x00,
+		0xc0, 0x01, 0x0a,
+	}
+	binary.BigEndian.PutUint16(request[17:19], tsap)
+	response, err := exchangeTPKT(conn, request)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if len(response) < 6 || response[5] != 0xd0 {
+		conn.Close()
+		return nil, fmt.Errorf("cotp connection refused")
+	}
+	return conn, nil
+}
+
+func s7ReadSZL(id uint16) []byte {
+	request := []byte{
+		0x03, 0x00, 0x00, 0x21, 0x02, 0xf0, 0x80,
+		0x32, 0x07, 0x00, 0x00, 0x00, 0x00, 0x00, 0x08, 0x00, 0x08,
+		0x00, 0x01, 0x12, 0x04, 0x11, 0x44, 0x01, 0x00,
+		0xff, 0x09, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01,
+	}
+	binary.BigEndian.PutUint16(request[29:31], id)
+	return request
+}
+
+func s7String(buf []byte, offset int) string {
+	if offset >= len(buf) {
+		return ""
+	}
+	value := buf[offset:]
+	if end := bytes.IndexByte(value, 0); end >= 0 {
+		value = value[:end]
+	}
+	return strings.TrimSpace(string(value))
+}
+
+func exchangeTPKT(conn net.Conn, request []byte) ([]byte, error) {
+	_, err := conn.Write(request)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 4)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header[2:4]))
+	if header[0] != 0x03 || length < 7 {
+		return nil, fmt.Errorf("not a tpkt packet")
+	}
+	packet := make([]byte, length)
+	copy(packet, header)
+	_, err = io.ReadFull(conn, packet[4:])
+	if err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// По умолчанию отправляется одно чтение идентификатора устройства по шаблонному номеру.
+// С IndustrialDetails к нему добавляется Who-Is (I-Am часто уходит широковещательно,
+// а ответ на ReadProperty всегда приходит нам) и чтение свойств устройства
+func detectBACnet(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("udp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if cfg.IndustrialDetails {
+		whoIs := []byte{0x81, 0x0a, 0x00, 0x08, 0x01, 0x00, 0x10, 0x08}
+		_, err = conn.Write(whoIs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = conn.Write(bacnetReadProperty(bacnetWildcardDevice, bacnetPropertyObjectIdentifier, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	instance := -1
+	buffer := make([]byte, 1500)
+	for instance < 0 {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return nil, err
+		}
+		apdu, err := bacnetAPDU(buffer[:n])
+		if err != nil {
+			continue
+		}
+		switch {
+		case len(apdu) >= 7 && apdu[0] == 0x10 && apdu[1] == 0x00 && apdu[2] == 0xc4:
+			instance = int(binary.BigEndian.Uint32(apdu[3:7]) & 0x3fffff)
+		case len(apdu) >= 3 && apdu[0] == 0x30 && apdu[2] == 0x0c:
+			value, err := bacnetPropertyValue(apdu)
+			if err == nil && len(value) == 5 && value[0] == 0xc4 {
+				instance = int(binary.BigEndian.Uint32(value[1:5]) & 0x3fffff)
+			}
+		}
+	}
+
+	detection := &domain.Detection{
+		Protocol: "BACnet",
+		Evidence: domain.EvidenceHandshake,
+		Info:     []string{fmt.Sprintf("device: %d", instance)},
+	}
+	if !cfg.IndustrialDetails {
+		return detection, nil
+	}
+	values := make(map[string]string)
+	for i, property := range bacnetProperties {
+		invokeID := byte(i + 2)
+		_, err = conn.Write(bacnetReadProperty(instance, property.id, invokeID))
+		if err != nil {
+			break
+		}
+		n, err := conn.Read(buffer)
+		if err != nil {
+			break
+		}
+		apdu, err := bacnetAPDU(buffer[:n])
+		if err != nil || len(apdu) < 3 || apdu[0] != 0x30 || apdu[1] != invokeID {
+			continue
+		}
+		value, err := bacnetPropertyValue(apdu)
+		if err != nil {
+			continue
+		}
+		if text := bacnetString(value); text != "" {
+			values[property.name] = text
+		}
+	}
+
+	detection.Product = strings.TrimSpace(values["vendor"] + " " + values["model"])
+	detection.Version = values["firmware"]
+	for _, name := range []string{"application", "name", "location"} {
+		if value := values[name]; value != "" {
+			detection.Info = append(detection.Info, name+": "+value)
+		}
+	}
+	return detection, nil
+}
+
+func bacnetReadProperty(instance int, property byte, invokeID byte) []byte {
+	request := []byte{
+		0x81, 0x0a, 0x00, 0x11,
+		0x01, 0x04,
+		0x00, 0x05, invokeID, 0x0c,
+		0x0c, 0x00, 0x00, 0x00, 0x00,
+		0x19, property,
+	}
+	binary.BigEndian.PutUint32(request[11:15], uint32(8)<<22|uint32(instance))
+	return request
+}
+
+// Снимает заголовки BVLC и NPDU и возвращает APDU
+func bacnetAPDU(packet []byte) ([]byte, error) {
+	if len(packet) < 6 || packet[0] != 0x81 {
+		return nil, fmt.Errorf("not a bacnet/ip packet")
+	}
+	pos := 4
+	if packet[1] == 0x04 {
+		// Forwarded-NPDU содержит адрес исходного узла
+		pos += 6
+	}
+	if pos+2 > len(packet) {
+		return nil, fmt.Errorf("bacnet packet is truncated")
+	}
+	if packet[pos] != 0x01 {
+		return nil, fmt.Errorf("not a bacnet/ip packet")
+	}
+	control := packet[pos+1]
+	if control&0x80 != 0 {
+		return nil, fmt.Errorf("bacnet network layer message")
+	}
+	pos += 2
+	if control&0x20 != 0 {
+		if pos+3 > len(packet) {
+			return nil, fmt.Errorf("bacnet packet is truncated")
+		}
+		pos += 3 + int(packet[pos+2])
+	}
+	if control&0x08 != 0 {
+		if pos+3 > len(packet) {
+			return nil, fmt.Errorf("bacnet packet is truncated")
+		}
+		pos += 3 + int(packet[pos+2])
+	}
+	if control&0x20 != 0 {
+		pos++
+	}
+	if pos >= len(packet) {
+		return nil, fmt.Errorf("bacnet packet is truncated")
+	}
+	return packet[pos:], nil
+}
+
+// Возвращает значение между открывающим и закрывающим тегом 3 в ComplexACK
+func bacnetPropertyValue(apdu []byte) ([]byte, error) {
+	pos := 3
+	// Контекстные теги 0 (объект), 1 (свойство) и необязательный 2 (индекс массива)
+	for _, tag := range []byte{0, 1, 2} {
+		if pos < len(apdu) && apdu[pos]>>4 == tag && apdu[pos]&0x08 != 0 {
+			pos += 1 + int(apdu[pos]&0x07)
+		}
+	}
+	end := bytes.LastIndexByte(apdu, 0x3f)
+	if pos >= len(apdu) || apdu[pos] != 0x3e || end <= pos {
+		return nil, fmt.Errorf("bacnet property value is missing")
+	}
+	return apdu[pos+1 : end], nil
+}
+
+func bacnetString(value []byte) string {
+	if len(value) < 2 || value[0]>>4 != 7 {
+		return ""
+	}
+	length := int(value[0] & 0x07)
+	pos := 1
+	if length == 5 {
+		length = int(value[1])
+		pos = 2
+		if length == 254 && len(value) >= 4 {
+			length = int(binary.BigEndian.Uint16(value[2:4]))
+			pos = 4
+		}
+	}
+	if pos+length > len(value) || length < 1 {
+		return ""
+	}
+	// Первый байт содержимого — кодировка, 0 означает UTF-8
+	return strings.TrimSpace(string(value[pos+1 : pos+length]))
+}
+
+func detectENIP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	return probeENIP("tcp", targetIP, port, cfg.Timeout)
+}
+
+func detectENIPUDP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	return probeENIP("udp", targetIP, port, cfg.Timeout)
+}
+
+func enipListIdentity() []byte {
+	request := make([]byte, 24)
+	binary.LittleEndian.PutUint16(request[0:2], 0x0063)
+	return request
+}
+
+func probeENIP(network string, targetIP net.IP, port int, timeout time.Duration) (*domain.Detection, error) {
+	conn, err := dialProbe(network, targetIP, port, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(enipListIdentity())
+	if err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, 1500)
+	n, err := io.ReadAtLeast(conn, buffer, 24)
+	if err != nil {
+		return nil, err
+	}
+	response := buffer[:n]
+	if binary.LittleEndian.Uint16(response[0:2]) != 0x0063 {
+		return nil, fmt.Errorf("not an enip list identity response")
+	}
+	length := int(binary.LittleEndian.Uint16(response[2:4]))
+	for len(response) < 24+length && network == "tcp" {
+		m, err := conn.Read(buffer[len(response):])
+		if err != nil {
+			return nil, err
+		}
+		response = buffer[:len(response)+m]
+	}
+
+	// Элемент CIP Identity: тип, длина, версия и адрес сокета занимают 22 байта
+	item := response[24:]
+	if len(item) < 2+22+14 || binary.LittleEndian.Uint16(item[2:4]) != 0x0c {
+		return nil, fmt.Errorf("enip identity item is missing")
+	}
+	identity := item[24:]
+	vendorID := binary.LittleEndian.Uint16(identity[0:2])
+	deviceType := binary.LittleEndian.Uint16(identity[2:4])
+	productCode := binary.LittleEndian.Uint16(identity[4:6])
+	serial := binary.LittleEndian.Uint32(identity[10:14])
+
+	detection := &domain.Detection{
+		Protocol: "EtherNet/IP",
+		Evidence: domain.EvidenceHandshake,
+		Version:  fmt.Sprintf("%d.%d", identity[6], identity[7]),
+	}
+	if len(identity) > 14 {
+		size := int(identity[14])
+		if 15+size <= len(identity) {
+			detection.Product = string(identity[15 : 15+size])
+		}
+	}
+
+	vendor, ok := enipVendors[vendorID]
+	if !ok {
+		vendor = fmt.Sprintf("%d", vendorID)
+	}
+	deviceName, ok := enipDeviceTypes[deviceType]
+	if !ok {
+		deviceName = fmt.Sprintf("0x%02x", deviceType)
+	}
+	detection.Info = append(detection.Info,
+		"vendor: "+vendor,
+		"device type: "+deviceName,
+		fmt.Sprintf("product code: %d", productCode),
+		fmt.Sprintf("serial: 0x%08x", serial),
+	)
+	return detection, nil
+}
@@ -0,0 +1,320 @@
+package controller
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func fakeModbus(pdu []byte) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		request := make([]byte, 11)
+		if _, err := io.ReadFull(conn, request); err != nil || request[7] != 0x2b {
+			return
+		}
+		response := append([]byte{}, request[0:4]...)
+		response = binary.BigEndian.AppendUint16(response, uint16(1+len(pdu)))
+		response = append(response, request[6])
+		conn.Write(append(response, pdu...))
+	}
+}
+
+func TestDetectModbus(t *testing.T) {
+	// Ответ Read Device Identification от ПЛК Schneider M340: базовые объекты и URL
+	identification := []byte{0x2b, 0x0e, 0x01, 0x01, 0x00, 0x00, 0x04}
+	for _, object := range []struct {
+		id    byte
+		value string
+	}{
+		{0, "Schneider Electric"}, {1, "BMX P34 2020"}, {2, "v2.80"}, {3, "http://www.schneider-electric.com"},
+	} {
+		identification = append(identification, object.id, byte(len(object.value)))
+		identification = append(identification, object.value...)
+	}
+
+	tests := []struct {
+		name    string
+		pdu     []byte
+		product string
+		version string
+		info    []string
+		ok      bool
+	}{
+		{"identification", identification, "Schneider Electric BMX P34 2020", "v2.80",
+			[]string{"vendor url: http://www.schneider-electric.com"}, true},
+		{"object past end", identification[:len(identification)-5], "Schneider Electric BMX P34 2020", "v2.80", nil, true},
+		{"illegal function", []byte{0xab, 0x01}, "", "", []string{"device identification: illegal function"}, true},
+		{"gateway exception", []byte{0xab, 0x0b}, "", "", []string{"device identification: gateway target failed to respond"}, true},
+		{"other function", []byte{0x03, 0x02, 0x00, 0x00}, "", "", nil, false},
+	}
+	for _, test := range tests {
+		ip, port := serveTCP(t, fakeModbus(test.pdu))
+		detection, err := detectModbus(ip, port, testConfig())
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if test.ok && (detection.Product != test.product || detection.Version != test.version || !slices.Equal(detection.Info, test.info)) {
+			t.Errorf("%s: got %q %q %q", test.name, detection.Product, detection.Version, detection.Info)
+		}
+	}
+}
+
+// Ответ на чтение SZL: строки лежат по тем же смещениям, что разбирает s7-info из Nmap
+func s7SZLResponse(size int, fields map[int]string) []byte {
+	response := make([]byte, size)
+	copy(response, []byte{0x03, 0x00, 0x00, 0x00, 0x02, 0xf0, 0x80, 0x32, 0x07})
+	binary.BigEndian.PutUint16(response[2:4], uint16(size))
+	for offset, value := range fields {
+		copy(response[offset:], value)
+	}
+	return response
+}
+
+// ПЛК принимает соединение только на одном TSAP: 0x0102 у S7-300, 0x0200 у S7-1200
+func fakeS7(tsap uint16, szlReads *atomic.Int32) func(conn net.Conn) {
+	return func(conn net.Conn) { serveS7(conn, tsap, szlReads) }
+}
+
+func serveS7(conn net.Conn, tsap uint16, szlReads *atomic.Int32) {
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		request := make([]byte, binary.BigEndian.Uint16(header[2:4])-4)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		request = append(header, request...)
+		switch {
+		case request[5] == 0xe0:
+			if binary.BigEndian.Uint16(request[17:19]) != tsap {
+				return
+			}
+			conn.Write([]byte{0x03, 0x00, 0x00, 0x16, 0x11, 0xd0, 0x00, 0x14, 0x00, 0x01, 0x00,
+				0xc0, 0x01, 0x0a, 0xc1, 0x02, 0x01, 0x00, 0xc2, 0x02, 0x02, 0x00})
+		case request[8] == 0x01:
+			conn.Write([]byte{0x03, 0x00, 0x00, 0x1b, 0x02, 0xf0, 0x80, 0x32, 0x03, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x08, 0x00, 0x00, 0x00, 0x00, 0xf0, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0xf0})
+		case binary.BigEndian.Uint16(request[29:31]) == 0x0011:
+			szlReads.Add(1)
+			module := s7SZLResponse(125, map[int]string{43: "6ES7 212-1BE40-0XB0 ", 71: "6ES7 212-1BE40-0XB0 "})
+			copy(module[122:], []byte{4, 4, 1})
+			conn.Write(module)
+		case binary.BigEndian.Uint16(request[29:31]) == 0x001c:
+			szlReads.Add(1)
+			conn.Write(s7SZLResponse(210, map[int]string{39: "S71200/ET200MP station_1", 73: "PLC_1", 175: "S C-J4U123456"}))
+		}
+	}
+}
+
+func TestDetectS7(t *testing.T) {
+	// По умолчанию один TSAP и одно чтение SZL
+	var szlReads atomic.Int32
+	ip, port := serveTCP(t, fakeS7(0x0102, &szlReads))
+	detection, err := detectS7(ip, port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detection.Product != "6ES7 212-1BE40-0XB0" || detection.Version != "4.4.1" ||
+		!slices.Equal(detection.Info, []string{"hardware: 6ES7 212-1BE40-0XB0"}) {
+		t.Errorf("got %q %q %q", detection.Product, detection.Version, detection.Info)
+	}
+	if got := szlReads.Load(); got != 1 {
+		t.Errorf("got %d SZL reads, want 1", got)
+	}
+
+	ip, port = serveTCP(t, fakeS7(0x0200, &szlReads))
+	if _, err := detectS7(ip, port, testConfig()); err == nil {
+		t.Error("second TSAP tried without IndustrialDetails")
+	}
+
+	cfg := testConfig()
+	cfg.IndustrialDetails = true
+	detection, err = detectS7(ip, port, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"hardware: 6ES7 212-1BE40-0XB0", "system name: S71200/ET200MP station_1", "module type: PLC_1", "serial: S C-J4U123456"}
+	if detection.Product != "6ES7 212-1BE40-0XB0" || detection.Version != "4.4.1" || !slices.Equal(detection.Info, want) {
+		t.Errorf("got %q %q %q", detection.Product, detection.Version, detection.Info)
+	}
+
+	// COTP Disconnect Request на оба TSAP
+	ip, port = serveTCP(t, func(conn net.Conn) {
+		for {
+			if _, err := io.ReadFull(conn, make([]byte, 22)); err != nil {
+				return
+			}
+			conn.Write([]byte{0x03, 0x00, 0x00, 0x0b, 0x06, 0x80, 0x00, 0x00, 0x00, 0x01, 0x00})
+		}
+	})
+	if _, err := detectS7(ip, port, cfg); err == nil {
+		t.Error("refused cotp connection: expected error")
+	}
+}
+
+// ComplexACK на ReadProperty устройства 1234
+func bacnetAck(invokeID byte, property byte, value []byte) []byte {
+	packet := []byte{0x81, 0x0a, 0x00, 0x00, 0x01, 0x00, 0x30, invokeID, 0x0c, 0x0c, 0x02, 0x00, 0x04, 0xd2, 0x19, property, 0x3e}
+	packet = append(packet, value...)
+	packet = append(packet, 0x3f)
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(packet)))
+	return packet
+}
+
+func bacnetCharacterString(text string) []byte {
+	return append([]byte{0x75, byte(len(text) + 1), 0x00}, text...)
+}
+
+func TestDetectBACnet(t *testing.T) {
+	var requests atomic.Int32
+	ip, port := serveUDP(t, func(request []byte) []byte {
+		requests.Add(1)
+		// Who-Is остаётся без ответа: I-Am уходит широковещательно
+		if len(request) < 17 || request[9] != 0x0c {
+			return nil
+		}
+		invokeID, property := request[8], request[16]
+		switch property {
+		case bacnetPropertyObjectIdentifier:
+			return bacnetAck(invokeID, property, []byte{0xc4, 0x02, 0x00, 0x04, 0xd2})
+		case 121:
+			return bacnetAck(invokeID, property, bacnetCharacterString("Siemens"))
+		case 70:
+			return bacnetAck(invokeID, property, bacnetCharacterString("PXC Modular"))
+		case 44:
+			return bacnetAck(invokeID, property, bacnetCharacterString("3.2.1"))
+		}
+		// Остальные свойства не строковые
+		return bacnetAck(invokeID, property, []byte{0x21, 0x01})
+	})
+
+	detection, err := detectBACnet(ip, port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detection.Product != "" || !slices.Equal(detection.Info, []string{"device: 1234"}) {
+		t.Errorf("got %q %q", detection.Product, detection.Info)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+
+	requests.Store(0)
+	cfg := testConfig()
+	cfg.IndustrialDetails = true
+	detection, err = detectBACnet(ip, port, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detection.Product != "Siemens PXC Modular" || detection.Version != "3.2.1" {
+		t.Errorf("got %q %q", detection.Product, detection.Version)
+	}
+	if got := requests.Load(); got != int32(2+len(bacnetProperties)) {
+		t.Errorf("got %d requests, want %d", got, 2+len(bacnetProperties))
+	}
+}
+
+func TestBACnetAPDU(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		apdu   []byte
+		ok     bool
+	}{
+		{"unicast", []byte{0x81, 0x0a, 0x00, 0x09, 0x01, 0x00, 0x30, 0x01, 0x0c}, []byte{0x30, 0x01, 0x0c}, true},
+		{"forwarded", []byte{0x81, 0x04, 0x00, 0x0f, 192, 168, 1, 10, 0xba, 0xc0, 0x01, 0x00, 0x10, 0x00, 0xc4}, []byte{0x10, 0x00, 0xc4}, true},
+		// Ответ через маршрутизатор: SNET 5, SADR из одного байта
+		{"routed source", []byte{0x81, 0x0a, 0x00, 0x0d, 0x01, 0x08, 0x00, 0x05, 0x01, 0x2a, 0x30, 0x01, 0x0c}, []byte{0x30, 0x01, 0x0c}, true},
+		{"destination and hop count", []byte{0x81, 0x0a, 0x00, 0x0f, 0x01, 0x20, 0xff, 0xff, 0x00, 0xff, 0x10, 0x08, 0x00, 0x00}, []byte{0x10, 0x08, 0x00, 0x00}, true},
+		{"network message", []byte{0x81, 0x0a, 0x00, 0x07, 0x01, 0x80, 0x01}, nil, false},
+		{"not bvlc", []byte{0x82, 0x0a, 0x00, 0x07, 0x01, 0x00, 0x30}, nil, false},
+		{"routed truncated", []byte{0x81, 0x0a, 0x00, 0x08, 0x01, 0x08, 0x00, 0x05}, nil, false},
+	}
+	for _, test := range tests {
+		apdu, err := bacnetAPDU(test.packet)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if test.ok && !slices.Equal(apdu, test.apdu) {
+			t.Errorf("%s: got %x, want %x", test.name, apdu, test.apdu)
+		}
+	}
+}
+
+func TestBACnetPropertyValue(t *testing.T) {
+	tests := []struct {
+		name string
+		apdu []byte
+		text string
+		ok   bool
+	}{
+		// ComplexACK ReadProperty: объект device,1234, свойство model-name (70)
+		{"model name", append([]byte{0x30, 0x02, 0x0c, 0x0c, 0x02, 0x00, 0x04, 0xd2, 0x19, 0x46, 0x3e, 0x75, 0x0c, 0x00}, "PXC Modular\x3f"...), "PXC Modular", true},
+		{"array index", []byte{0x30, 0x02, 0x0c, 0x0c, 0x02, 0x00, 0x04, 0xd2, 0x19, 0x46, 0x29, 0x01, 0x3e, 0x73, 0x00, 'O', 'K', 0x3f}, "OK", true},
+		{"not a string", []byte{0x30, 0x02, 0x0c, 0x0c, 0x02, 0x00, 0x04, 0xd2, 0x19, 0x4b, 0x3e, 0xc4, 0x02, 0x00, 0x04, 0xd2, 0x3f}, "", true},
+		{"no opening tag", []byte{0x30, 0x02, 0x0c, 0x0c, 0x02, 0x00, 0x04, 0xd2, 0x19, 0x46}, "", false},
+	}
+	for _, test := range tests {
+		value, err := bacnetPropertyValue(test.apdu)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if text := bacnetString(value); text != test.text {
+			t.Errorf("%s: got %q, want %q", test.name, text, test.text)
+		}
+	}
+}
+
+// Ответ List Identity от ControlLogix 1756-L71
+func enipIdentityResponse() []byte {
+	identity := binary.LittleEndian.AppendUint16(nil, 1)
+	identity = binary.LittleEndian.AppendUint16(identity, 0x0e)
+	identity = binary.LittleEndian.AppendUint16(identity, 54)
+	identity = append(identity, 20, 11)
+	identity = binary.LittleEndian.AppendUint16(identity, 0x0030)
+	identity = binary.LittleEndian.AppendUint32(identity, 0x00c0ffee)
+	name := "1756-L71/B LOGIX5571"
+	identity = append(identity, byte(len(name)))
+	identity = append(identity, name...)
+	identity = append(identity, 0x03)
+
+	item := binary.LittleEndian.AppendUint16(nil, 1)
+	item = binary.LittleEndian.AppendUint16(item, 0x0c)
+	item = binary.LittleEndian.AppendUint16(item, uint16(18+len(identity)))
+	item = binary.LittleEndian.AppendUint16(item, 1)
+	item = append(item, make([]byte, 16)...)
+	item = append(item, identity...)
+
+	response := make([]byte, 24)
+	binary.LittleEndian.PutUint16(response[0:2], 0x0063)
+	binary.LittleEndian.PutUint16(response[2:4], uint16(len(item)))
+	return append(response, item...)
+}
+
+func TestDetectENIP(t *testing.T) {
+	ip, port := serveTCP(t, func(conn net.Conn) {
+		if _, err := io.ReadFull(conn, make([]byte, 24)); err != nil {
+			return
+		}
+		// Заголовок инкапсуляции и элемент приходят разными сегментами
+		response := enipIdentityResponse()
+		conn.Write(response[:30])
+		conn.Write(response[30:])
+	})
+	detection, err := detectENIP(ip, port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"vendor: Rockwell Automation/Allen-Bradley", "device type: Programmable Logic Controller", "product code: 54", "serial: 0x00c0ffee"}
+	if detection.Product != "1756-L71/B LOGIX5571" || detection.Version != "20.11" || !slices.Equal(detection.Info, want) {
+		t.Errorf("got %q %q %q", detection.Product, detection.Version, detection.Info)
+	}
+}
@@ -2,133 +2,496 @@ package controller
 
 import (
 	"bufio"
-	"encoding/hex"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/futig/PortScannerGo/application/dns"
 	"github.com/futig/PortScannerGo/domain"
 )
 
-func GuessProtocol( ip net.IP, port int, timeout time.Duration) (string, error) {
-    stdProtocol, ok := detectStandartPort(port)
-    if ok {
-        return stdProtocol, nil
-    }
+type detector struct {
+	// Транспорт, по которому работает детектор: "tcp" или "udp"
+	network  string
+	protocol string
+	// Порты, на которых детектор запускается даже при известном стандартном протоколе
+	ports []int
+	// Детекторы с этим условием запускаются только по явной опции
+	enabled func(cfg *domain.ScannerConfig) bool
+	// Промышленные устройства плохо переносят несколько соединений сразу,
+	// поэтому такие детекторы работают по одному и без других проб
+	serial bool
+	detect func(ip net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error)
+}
+
+var detectors = []detector{
+	{network: "tcp", protocol: "HTTP", detect: simpleDetector("HTTP", domain.EvidenceBanner, detectHTTP)},
+	{network: "tcp", protocol: "HTTPS", detect: detectHTTPS},
+	{network: "tcp", protocol: "gRPC", detect: detectGRPC},
+	{network: "tcp", protocol: "Docker", detect: detectDocker},
+	{network: "tcp", protocol: "Kubernetes", detect: detectKubernetes},
+	{network: "tcp", protocol: "kubelet", detect: detectKubelet},
+	{network: "tcp", protocol: "etcd", detect: detectEtcd},
+	{network: "tcp", protocol: "Consul", detect: detectConsul},
+	{network: "tcp", protocol: "Nomad", detect: detectNomad},
+	{network: "tcp", protocol: "SSH", detect: detectSSH},
+	{network: "tcp", protocol: "MySQL", detect: detectMySQL},
+	{network: "tcp", protocol: "PostgreSQL", detect: detectPostgreSQL},
+	{network: "tcp", protocol: "MSSQL", detect: detectMSSQL},
+	{network: "tcp", protocol: "MongoDB", detect: detectMongoDB},
+	{network: "tcp", protocol: "Redis", detect: detectRedis},
+	{network: "tcp", protocol: "NATS", detect: detectNATS},
+	{network: "tcp", protocol: "AMQP", detect: detectAMQP},
+	{network: "tcp", protocol: "MQTT", detect: detectMQTT},
+	{network: "tcp", protocol: "Kafka", detect: detectKafka},
+	{network: "tcp", protocol: "memcached", detect: detectMemcached},
+	{network: "udp", protocol: "memcached", detect: detectMemcachedUDP},
+	{network: "tcp", protocol: "RDP", detect: detectRDP},
+	{network: "tcp", protocol: "VNC", detect: detectVNC},
+	{network: "tcp", protocol: "Telnet", detect: detectTelnet},
+	{network: "tcp", protocol: "SMB", detect: detectSMB},
+	{network: "tcp", protocol: "LDAP", detect: detectLDAP},
+	{network: "tcp", protocol: "Kerberos", detect: detectKerberos},
+	{network: "udp", protocol: "Kerberos", detect: detectKerberosUDP},
+	{network: "udp", protocol: "NetBIOS", detect: detectNetBIOS},
+	{network: "udp", protocol: "NTP", detect: detectNTP},
+	{network: "udp", protocol: "SNMP", detect: detectSNMP},
+	{network: "udp", protocol: "TFTP", detect: detectTFTP},
+	{network: "udp", protocol: "SIP", detect: detectSIP},
+	{network: "udp", protocol: "IKE", detect: detectIKE},
+	{network: "udp", protocol: "QUIC", ports: quicPorts, detect: detectQUIC},
+	{network: "tcp", protocol: "IPP", detect: detectIPP},
+	{network: "tcp", protocol: "JetDirect", detect: detectJetDirect},
+	{network: "tcp", protocol: "RTSP", detect: detectRTSP},
+	{network: "udp", protocol: "CoAP", detect: detectCoAP},
+	{network: "udp", protocol: "STUN", detect: detectSTUN},
+	{network: "udp", protocol: "MQTT-SN", detect: detectMQTTSN},
+	{network: "tcp", protocol: "Modbus", enabled: industrialEnabled, serial: true, detect: detectModbus},
+	{network: "tcp", protocol: "S7", enabled: industrialEnabled, serial: true, detect: detectS7},
+	{network: "udp", protocol: "BACnet", enabled: industrialEnabled, serial: true, detect: detectBACnet},
+	{network: "tcp", protocol: "EtherNet/IP", enabled: industrialEnabled, serial: true, detect: detectENIP},
+	{network: "udp", protocol: "EtherNet/IP", enabled: industrialEnabled, serial: true, detect: detectENIPUDP},
+	{network: "tcp", protocol: "Finger", detect: detectFinger},
+	{network: "tcp", protocol: "Ident", detect: detectIdent},
+	// Один детектор на все сервисы RFC 863–868: протокол определяется по ответу
+	{network: "tcp", protocol: "Chargen", ports: simpleServicePorts, detect: detectSimpleServiceTCP},
+	{network: "udp", protocol: "Chargen", ports: simpleServicePorts, detect: detectSimpleServiceUDP},
+	{network: "tcp", protocol: "ECHO", detect: simpleDetector("ECHO", domain.EvidenceHandshake, detectEchoTCP)},
+	{network: "udp", protocol: "ECHO", detect: simpleDetector("ECHO", domain.EvidenceHandshake, detectEcho)},
+	{network: "tcp", protocol: "DNS", detect: detectDNSTCP},
+	{network: "udp", protocol: "DNS", detect: detectDNS},
+}
+
+// Сколько детекторов одного порта работают одновременно
+const guessWorkers = 8
+
+const (
+	confidenceHandshake   = 70
+	confidenceBannerRegex = 50
+	confidenceBanner      = 40
+	confidencePortHint    = 25
+)
+
+// Угадывает протокол открытого порта, запуская только детекторы того же транспорта,
+// что и сканирование. Возвращает самое вероятное определение и всех кандидатов по
+// убыванию уверенности. Сначала работают детекторы протокола, который обычно висит
+// на этом порту, и детекторы, привязанные к порту; остальные запускаются, только
+// если ни один из них не узнал сервис
+func GuessProtocol(ip net.IP, port int, network string, cfg *domain.ScannerConfig) (*domain.Detection, []domain.Candidate, error) {
+	available := enabledDetectors(cfg, network)
+	stdProtocol, hinted := detectStandartPort(port)
+
+	preferred, rest := splitDetectors(available, stdProtocol, port)
+	if hinted && !hasDetector(available, stdProtocol) {
+		// Для протокола без детектора полный перебор дал бы только лишние соединения
+		rest = nil
+	}
+	detections := detectGroup(preferred, ip, port, cfg)
+	if len(detections) == 0 {
+		detections = detectGroup(rest, ip, port, cfg)
+	}
+
+	candidates := make([]domain.Candidate, 0, len(detections)+1)
+	hintMatched := false
+	for _, detection := range detections {
+		matchesHint := hinted && detection.Protocol == stdProtocol
+		hintMatched = hintMatched || matchesHint
+		candidates = append(candidates, scoreCandidate(detection, matchesHint))
+	}
+
+	if hinted && !hintMatched {
+		detections = append(detections, &domain.Detection{Protocol: stdProtocol, Evidence: domain.EvidencePortHint})
+		candidates = append(candidates, domain.Candidate{
+			Protocol:   stdProtocol,
+			Confidence: confidencePortHint,
+			Evidence:   []string{domain.EvidencePortHint},
+		})
+	}
+	if len(candidates) == 0 {
+		return nil, nil, fmt.Errorf("failed to detect protocol")
+	}
 
-    isHttp, err := detectHTTP(ip, port, timeout)
-    if err == nil && isHttp {
-        return "HTTP", nil
-    }
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return candidates[b].Confidence - candidates[a].Confidence
+	})
+	ranked := make([]domain.Candidate, 0, len(candidates))
+	for _, i := range order {
+		ranked = append(ranked, candidates[i])
+	}
+	return detections[order[0]], ranked, nil
+}
 
-    isEcho, err := detectEcho(ip, port, timeout)
-    if err == nil && isEcho {
-        return "ECHO", nil
-    }
-    
-    isDns, err := detectDNS(ip, port, timeout)
-    if err == nil && isDns {
-        return "DNS", nil
-    }
+// Детекторы в группе разбираются в порядке приоритета, и перебор останавливается
+// на первом успешном рукопожатии, а совпадения только по баннеру не мешают
+// проверить остальные протоколы. Последовательные детекторы запускаются после
+// остальных, когда те уже закрыли свои соединения
+func detectGroup(group []detector, ip net.IP, port int, cfg *domain.ScannerConfig) []*domain.Detection {
+	var parallel, serial []detector
+	for _, d := range group {
+		if d.serial {
+			serial = append(serial, d)
+		} else {
+			parallel = append(parallel, d)
+		}
+	}
 
-    return "", fmt.Errorf("failed to detect protocol")
+	detections := make([]*domain.Detection, 0)
+	for _, batch := range []struct {
+		detectors []detector
+		workers   int
+	}{{parallel, guessWorkers}, {serial, 1}} {
+		results, stop := runDetectors(batch.detectors, ip, port, cfg, batch.workers)
+		for _, result := range results {
+			detection := <-result
+			if detection == nil {
+				continue
+			}
+			detections = append(detections, detection)
+			if detection.Evidence == domain.EvidenceHandshake {
+				stop()
+				return detections
+			}
+		}
+	}
+	return detections
 }
 
-func detectStandartPort(port int) (string, bool) {
-    value, ok := domain.StandartPorts[port]
-    return value, ok
+func scoreCandidate(detection *domain.Detection, matchesHint bool) domain.Candidate {
+	candidate := domain.Candidate{
+		Protocol: detection.Protocol,
+		Evidence: []string{detection.Evidence},
+	}
+	switch detection.Evidence {
+	case domain.EvidenceHandshake:
+		candidate.Confidence = confidenceHandshake
+	case domain.EvidenceBannerRegex:
+		candidate.Confidence = confidenceBannerRegex
+	case domain.EvidenceBanner:
+		candidate.Confidence = confidenceBanner
+	case domain.EvidencePortHint:
+		// Признак порта уже учтён в самом определении
+		candidate.Confidence = confidencePortHint
+		return candidate
+	}
+	if matchesHint {
+		candidate.Confidence += confidencePortHint
+		candidate.Evidence = append(candidate.Evidence, domain.EvidencePortHint)
+	}
+	return candidate
 }
 
+func enabledDetectors(cfg *domain.ScannerConfig, network string) []detector {
+	available := make([]detector, 0, len(detectors))
+	for _, d := range detectors {
+		if d.network != network {
+			continue
+		}
+		if d.enabled == nil || d.enabled(cfg) {
+			available = append(available, d)
+		}
+	}
+	return available
+}
+
+func industrialEnabled(cfg *domain.ScannerConfig) bool {
+	return cfg.Industrial
+}
+
+// Запускает детекторы параллельно, не больше workers за раз. Результат i-го
+// детектора приходит в i-й канал, поэтому вызывающий разбирает их в порядке
+// приоритета и не ждёт молчащий порт по таймауту на каждый протокол подряд.
+// После stop ещё не начатые детекторы не запускаются и отдают nil
+func runDetectors(selected []detector, ip net.IP, port int, cfg *domain.ScannerConfig, workers int) ([]chan *domain.Detection, func()) {
+	results := make([]chan *domain.Detection, len(selected))
+	for i := range results {
+		results[i] = make(chan *domain.Detection, 1)
+	}
+	var next atomic.Int64
+	var stopped atomic.Bool
+	for range min(workers, len(selected)) {
+		go func() {
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= len(selected) {
+					return
+				}
+				if stopped.Load() {
+					results[i] <- nil
+					continue
+				}
+				detection, err := selected[i].detect(ip, port, cfg)
+				if err != nil {
+					detection = nil
+				}
+				results[i] <- detection
+			}
+		}()
+	}
+	return results, func() { stopped.Store(true) }
+}
+
+func hasDetector(detectors []detector, protocol string) bool {
+	for _, d := range detectors {
+		if d.protocol == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// Делит детекторы на ожидаемые на этом порту и все остальные
+func splitDetectors(detectors []detector, hint string, port int) ([]detector, []detector) {
+	var preferred, rest []detector
+	for _, d := range detectors {
+		if d.protocol == hint || slices.Contains(d.ports, port) {
+			preferred = append(preferred, d)
+		} else {
+			rest = append(rest, d)
+		}
+	}
+	return preferred, rest
+}
+
+func dialProbe(network string, ip net.IP, port int, timeout time.Duration) (net.Conn, error) {
+	address := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	return conn, nil
+}
+
+func simpleDetector(protocol string, evidence string,
+	detect func(ip net.IP, port int, timeout time.Duration) (bool, error)) func(net.IP, int, *domain.ScannerConfig) (*domain.Detection, error) {
+	return func(ip net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+		ok, err := detect(ip, port, cfg.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("not %s", protocol)
+		}
+		return &domain.Detection{Protocol: protocol, Evidence: evidence}, nil
+	}
+}
+
+func detectStandartPort(port int) (string, bool) {
+	value, ok := domain.StandartPorts[port]
+	return value, ok
+}
 
 func detectHTTP(targetIP net.IP, port int, timeout time.Duration) (bool, error) {
-    address := fmt.Sprintf("%s:%d", targetIP.String(), port)
-    conn, err := net.DialTimeout("tcp", address, timeout)
-    if err != nil {
-        return false, err
-    }
-    defer conn.Close()
-
-    conn.SetDeadline(time.Now().Add(timeout))
-
-    request := "HEAD / HTTP/1.0\r\n\r\n"
-    _, err = conn.Write([]byte(request))
-    
-    if err != nil {
-        return false, err
-    }
-
-    reader := bufio.NewReader(conn)
-    line, err := reader.ReadString('\n')
-    if err != nil {
-        return false, err
-    }
-
-    if strings.Contains(line, "HTTP/") {
-        return true, nil
-    }
-    return false, nil
-}
-
-
-func detectDNS(targetIP net.IP, port int, timeout time.Duration) (bool, error) {
-    address := fmt.Sprintf("%s:%d", targetIP.String(), port)
-    conn, err := net.DialTimeout("udp", address, timeout)
-    if err != nil {
-        return false, err
-    }
-    defer conn.Close()
-
-    conn.SetDeadline(time.Now().Add(timeout))
-    // habrahabr.ru A
-    hexStr := "9bce0100000100000000000109686162726168616272027275000001000100002904d000000000000c000a00085de710734d259aec"
-    bytes, _ := hex.DecodeString(hexStr)
-	_, err = conn.Write(bytes)
+	address := net.JoinHostPort(targetIP.String(), strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", address, timeout)
 	if err != nil {
 		return false, err
 	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	request := "HEAD / HTTP/1.0\r\n\r\n"
+	_, err = conn.Write([]byte(request))
 
-	buffer := make([]byte, 1024)
-	n, err := conn.Read(buffer)
-    
 	if err != nil {
 		return false, err
 	}
 
-    _, err = dns.ParseResponse(buffer[:n])
-    if err != nil {
-        return false, err
-    }
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return false, err
+	}
 
-    return true, nil
+	if strings.Contains(line, "HTTP/") {
+		return true, nil
+	}
+	return false, nil
 }
 
+// HTTP поверх TLS на любом порту, чтобы аудит заголовков не зависел от порта 443
+func detectHTTPS(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"http/1.1"},
+	})
+	defer tlsConn.Close()
+
+	err = tlsConn.Handshake()
+	if err != nil {
+		return nil, err
+	}
+	_, err = tlsConn.Write([]byte("HEAD / HTTP/1.0\r\n\r\n"))
+	if err != nil {
+		return nil, err
+	}
+	line, err := bufio.NewReader(tlsConn).ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "HTTP/") {
+		return nil, fmt.Errorf("not https")
+	}
+	return &domain.Detection{
+		Protocol: "HTTPS",
+		Evidence: domain.EvidenceHandshake,
+		Info:     []string{"tls: " + tls.VersionName(tlsConn.ConnectionState().Version)},
+	}, nil
+}
+
+func detectDNS(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	return probeDNS("udp", targetIP, port, cfg)
+}
+
+func detectDNSTCP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	detection, err := probeDNS("tcp", targetIP, port, cfg)
+	if err != nil || !cfg.Axfr {
+		return detection, err
+	}
+	client := dns.NewClient(net.JoinHostPort(targetIP.String(), strconv.Itoa(port)), cfg.Timeout)
+	auditZoneTransfer(detection, client, targetIP, cfg)
+	return detection, nil
+}
+
+func probeDNS(network string, targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe(network, targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Корневые NS знает любой резолвер, а авторитетный сервер хотя бы откажет
+	query, err := dns.NewQuery(".", dns.TypeNS, dns.ClassIN)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := exchangeDNS(conn, network, query.WithEDNS(dns.DefaultUDPSize).Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := dns.ParseResponse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if response.Header.ID != query.Header.ID || response.Header.QR != 1 {
+		return nil, fmt.Errorf("not a dns server")
+	}
+
+	detection := &domain.Detection{
+		Protocol: "DNS",
+		Evidence: domain.EvidenceHandshake,
+		Info: []string{
+			"status: " + dns.RCodeName(response.RCode()),
+			"flags: " + strings.Join(response.Header.Flags(), " "),
+		},
+	}
+	if response.EDNS != nil {
+		detection.Info = append(detection.Info, fmt.Sprintf("edns: version %d, udp %d", response.EDNS.Version, response.EDNS.UDPSize))
+	}
+	if len(response.Answers) > 0 {
+		detection.Info = append(detection.Info, "answer: "+strings.ReplaceAll(response.Answers[0].ZoneString(), "\t", " "))
+	}
+	client := dns.NewClient(net.JoinHostPort(targetIP.String(), strconv.Itoa(port)), cfg.Timeout)
+	if cfg.DnsFingerprint {
+		fingerprintDNSServer(detection, network, client)
+	}
+	if cfg.DnsAudit {
+		auditDNSServer(detection, network, client)
+	}
+	return detection, nil
+}
+
+func exchangeDNS(conn net.Conn, network string, query []byte) ([]byte, error) {
+	if network == "tcp" {
+		err := dns.WriteTCPMessage(conn, query)
+		if err != nil {
+			return nil, err
+		}
+		return dns.ReadTCPMessage(conn)
+	}
+
+	_, err := conn.Write(query)
+	if err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, 4096)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer[:n], nil
+}
 
 func detectEcho(targetIP net.IP, port int, timeout time.Duration) (bool, error) {
-    address := fmt.Sprintf("%s:%d", targetIP.String(), port)
-    conn, err := net.DialTimeout("udp", address, timeout)
-    if err != nil {
-        return false, err
-    }
-    defer conn.Close()
-
-    conn.SetDeadline(time.Now().Add(timeout))
-
-    message := "Echo test message"
-    _, err = conn.Write([]byte(message))
-    if err != nil {
-        return false, err
-    }
-
-    buf := make([]byte, len(message))
-    _, err = conn.Read(buf)
-    if err != nil {
-        return false, err
-    }
-
-    if string(buf) == message {
-        return true, nil
-    }
-    return false, nil
+	return probeEcho("udp", targetIP, port, timeout)
+}
+
+func detectEchoTCP(targetIP net.IP, port int, timeout time.Duration) (bool, error) {
+	return probeEcho("tcp", targetIP, port, timeout)
+}
+
+func probeEcho(network string, targetIP net.IP, port int, timeout time.Duration) (bool, error) {
+	conn, err := dialProbe(network, targetIP, port, timeout)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	message := "Echo test message"
+	_, err = conn.Write([]byte(message))
+	if err != nil {
+		return false, err
+	}
+
+	// TCP может вернуть ответ по частям, поэтому дочитываем всё сообщение
+	buf := make([]byte, len(message))
+	if network == "tcp" {
+		_, err = io.ReadFull(conn, buf)
+	} else {
+		_, err = conn.Read(buf)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if string(buf) == message {
+		return true, nil
+	}
+	return false, nil
 }
@@ -0,0 +1,318 @@
+package controller
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/futig/PortScannerGo/application/dns"
+	"github.com/futig/PortScannerGo/domain"
+)
+
+func fakeDetector(protocol string, delay time.Duration, evidence string, calls *atomic.Int32) detector {
+	return detector{network: "tcp", protocol: protocol, detect: func(net.IP, int, *domain.ScannerConfig) (*domain.Detection, error) {
+		calls.Add(1)
+		time.Sleep(delay)
+		if evidence == "" {
+			return nil, errors.New("no match")
+		}
+		return &domain.Detection{Protocol: protocol, Evidence: evidence}, nil
+	}}
+}
+
+func TestRunDetectorsKeepsOrder(t *testing.T) {
+	var calls atomic.Int32
+	selected := []detector{
+		fakeDetector("slow", 100*time.Millisecond, domain.EvidenceBanner, &calls),
+		fakeDetector("silent", 0, "", &calls),
+		fakeDetector("fast", 0, domain.EvidenceHandshake, &calls),
+	}
+	results, stop := runDetectors(selected, nil, 0, testConfig(), guessWorkers)
+	defer stop()
+
+	want := []string{"slow", "", "fast"}
+	for i, result := range results {
+		got := ""
+		if detection := <-result; detection != nil {
+			got = detection.Protocol
+		}
+		if got != want[i] {
+			t.Errorf("result %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestRunDetectorsStop(t *testing.T) {
+	var calls atomic.Int32
+	selected := make([]detector, 3*guessWorkers)
+	for i := range selected {
+		selected[i] = fakeDetector("slow", 50*time.Millisecond, "", &calls)
+	}
+	results, stop := runDetectors(selected, nil, 0, testConfig(), guessWorkers)
+	<-results[0]
+	stop()
+	for _, result := range results[1:] {
+		if detection := <-result; detection != nil {
+			t.Errorf("unexpected detection %v", detection)
+		}
+	}
+	if n := int(calls.Load()); n >= len(selected) {
+		t.Errorf("%d of %d detectors ran after stop", n, len(selected))
+	}
+}
+
+func TestScoreCandidate(t *testing.T) {
+	tests := []struct {
+		evidence    string
+		matchesHint bool
+		confidence  int
+		reasons     []string
+	}{
+		{domain.EvidenceHandshake, false, 70, []string{domain.EvidenceHandshake}},
+		{domain.EvidenceHandshake, true, 95, []string{domain.EvidenceHandshake, domain.EvidencePortHint}},
+		{domain.EvidenceBannerRegex, false, 50, []string{domain.EvidenceBannerRegex}},
+		{domain.EvidenceBannerRegex, true, 75, []string{domain.EvidenceBannerRegex, domain.EvidencePortHint}},
+		{domain.EvidenceBanner, false, 40, []string{domain.EvidenceBanner}},
+		{domain.EvidenceBanner, true, 65, []string{domain.EvidenceBanner, domain.EvidencePortHint}},
+		{domain.EvidencePortHint, true, 25, []string{domain.EvidencePortHint}},
+	}
+	for _, test := range tests {
+		candidate := scoreCandidate(&domain.Detection{Protocol: "X", Evidence: test.evidence}, test.matchesHint)
+		if candidate.Protocol != "X" || candidate.Confidence != test.confidence || !slices.Equal(candidate.Evidence, test.reasons) {
+			t.Errorf("%s, hint %v: got %+v", test.evidence, test.matchesHint, candidate)
+		}
+	}
+
+	// Совпадение по баннеру на своём порту не должно обгонять рукопожатие на чужом
+	banner := scoreCandidate(&domain.Detection{Evidence: domain.EvidenceBanner}, true)
+	if handshake := scoreCandidate(&domain.Detection{Evidence: domain.EvidenceHandshake}, false); banner.Confidence >= handshake.Confidence {
+		t.Errorf("banner scored %d, handshake %d", banner.Confidence, handshake.Confidence)
+	}
+}
+
+// Подменяет реестр детекторов и стандартный протокол порта на время теста
+func withDetectors(t *testing.T, port int, hint string, fakes ...detector) {
+	saved := detectors
+	detectors = fakes
+	protocol, ok := domain.StandartPorts[port]
+	domain.StandartPorts[port] = hint
+	t.Cleanup(func() {
+		detectors = saved
+		if ok {
+			domain.StandartPorts[port] = protocol
+		} else {
+			delete(domain.StandartPorts, port)
+		}
+	})
+}
+
+func TestGuessProtocolPortHint(t *testing.T) {
+	const port = 40999
+	var hintCalls, restCalls atomic.Int32
+	withDetectors(t, port, "hinted",
+		fakeDetector("other", 0, domain.EvidenceHandshake, &restCalls),
+		fakeDetector("hinted", 0, domain.EvidenceHandshake, &hintCalls),
+	)
+
+	detection, candidates, err := GuessProtocol(nil, port, "tcp", testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detection.Protocol != "hinted" || len(candidates) != 1 || candidates[0].Confidence != 95 {
+		t.Errorf("got %+v, candidates %+v", detection, candidates)
+	}
+	if hintCalls.Load() != 1 || restCalls.Load() != 0 {
+		t.Errorf("hinted ran %d times, others %d times", hintCalls.Load(), restCalls.Load())
+	}
+}
+
+func TestGuessProtocolFallback(t *testing.T) {
+	const port = 40999
+	var calls atomic.Int32
+	withDetectors(t, port, "hinted",
+		fakeDetector("hinted", 0, "", &calls),
+		fakeDetector("banner", 0, domain.EvidenceBanner, &calls),
+		fakeDetector("other", 0, domain.EvidenceHandshake, &calls),
+	)
+
+	detection, candidates, err := GuessProtocol(nil, port, "tcp", testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, candidate := range candidates {
+		got = append(got, candidate.Protocol)
+	}
+	want := []string{"other", "banner", "hinted"}
+	if detection.Protocol != "other" || !slices.Equal(got, want) || calls.Load() != 3 {
+		t.Errorf("got %+v, candidates %q, %d calls", detection, got, calls.Load())
+	}
+	if hint := candidates[2]; hint.Confidence != confidencePortHint || !slices.Equal(hint.Evidence, []string{domain.EvidencePortHint}) {
+		t.Errorf("got port hint candidate %+v", hint)
+	}
+}
+
+// Протокол без детектора: работают только детекторы, привязанные к порту
+func TestGuessProtocolHintWithoutDetector(t *testing.T) {
+	const port = 40999
+	var portCalls, restCalls atomic.Int32
+	bound := fakeDetector("bound", 0, "", &portCalls)
+	bound.ports = []int{port}
+	withDetectors(t, port, "SMTP", bound, fakeDetector("other", 0, domain.EvidenceHandshake, &restCalls))
+
+	detection, candidates, err := GuessProtocol(nil, port, "tcp", testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detection.Protocol != "SMTP" || detection.Evidence != domain.EvidencePortHint || len(candidates) != 1 {
+		t.Errorf("got %+v, candidates %+v", detection, candidates)
+	}
+	if portCalls.Load() != 1 || restCalls.Load() != 0 {
+		t.Errorf("port-bound ran %d times, others %d times", portCalls.Load(), restCalls.Load())
+	}
+}
+
+func TestDetectGroupSerial(t *testing.T) {
+	var active, overlaps atomic.Int32
+	probe := func(protocol string, serial bool) detector {
+		return detector{network: "tcp", protocol: protocol, serial: serial, detect: func(net.IP, int, *domain.ScannerConfig) (*domain.Detection, error) {
+			if n := active.Add(1); serial && n > 1 {
+				overlaps.Add(1)
+			}
+			time.Sleep(20 * time.Millisecond)
+			active.Add(-1)
+			return nil, errors.New("no match")
+		}}
+	}
+	group := []detector{probe("modbus", true), probe("http", false), probe("s7", true), probe("ssh", false), probe("mysql", false)}
+	if detections := detectGroup(group, nil, 0, testConfig()); len(detections) != 0 {
+		t.Errorf("got %+v", detections)
+	}
+	if overlaps.Load() != 0 {
+		t.Errorf("serial detectors overlapped %d times", overlaps.Load())
+	}
+}
+
+// Порт, который принимает соединение и молчит, не должен стоить таймаут
+// на каждый детектор по очереди
+func TestGuessProtocolSilentPort(t *testing.T) {
+	ip, port := serveTCP(t, func(conn net.Conn) {
+		io.Copy(io.Discard, conn)
+	})
+	cfg := testConfig()
+	cfg.Timeout = 200 * time.Millisecond
+
+	start := time.Now()
+	_, _, err := GuessProtocol(ip, port, "tcp", cfg)
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Error("expected no detection on a silent port")
+	}
+	sequential := time.Duration(len(enabledDetectors(cfg, "tcp"))) * cfg.Timeout
+	if elapsed > sequential/2 {
+		t.Errorf("took %v, sequential run is about %v", elapsed, sequential)
+	}
+}
+
+// DNS по TCP: длина и сообщение приходят отдельными сегментами
+func serveDNSTCP(t *testing.T, queries *atomic.Int32, id func(uint16) uint16) (net.IP, int) {
+	return serveTCP(t, func(conn net.Conn) {
+		for {
+			raw, err := dns.ReadTCPMessage(conn)
+			if err != nil {
+				return
+			}
+			queries.Add(1)
+			query, err := dns.ParseResponse(raw)
+			if err != nil || query.EDNS == nil {
+				return
+			}
+			response := (&dns.Response{
+				Header:   dns.Header{ID: id(query.Header.ID), QR: 1, RD: query.Header.RD, RCode: 5, QDCount: 1},
+				Question: query.Question,
+			}).Encode()
+			conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(response))))
+			time.Sleep(10 * time.Millisecond)
+			conn.Write(response)
+		}
+	})
+}
+
+func TestDetectDNSTCP(t *testing.T) {
+	var queries atomic.Int32
+	ip, port := serveDNSTCP(t, &queries, func(id uint16) uint16 { return id })
+	detection, err := detectDNSTCP(ip, port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"status: REFUSED", "flags: qr rd"}
+	if detection.Protocol != "DNS" || !slices.Equal(detection.Info, want) {
+		t.Errorf("got %+v", detection)
+	}
+	// Без --axfr детектор ограничивается одним запросом
+	if n := queries.Load(); n != 1 {
+		t.Errorf("got %d queries", n)
+	}
+
+	ip, port = serveDNSTCP(t, &queries, func(id uint16) uint16 { return id + 1 })
+	if detection, err := detectDNSTCP(ip, port, testConfig()); err == nil {
+		t.Errorf("accepted a reply with another id: %+v", detection)
+	}
+
+	ip, port = serveTCP(t, func(conn net.Conn) {
+		conn.Write([]byte("SSH-2.0-OpenSSH_9.2p1\r\n"))
+	})
+	if detection, err := detectDNSTCP(ip, port, testConfig()); err == nil {
+		t.Errorf("ssh banner taken for dns: %+v", detection)
+	}
+}
+
+func TestDetectEchoTCP(t *testing.T) {
+	tests := []struct {
+		name   string
+		handle func(net.Conn)
+		want   bool
+		ok     bool
+	}{
+		{
+			name: "echo by bytes",
+			handle: func(conn net.Conn) {
+				buffer := make([]byte, 1)
+				for {
+					if _, err := conn.Read(buffer); err != nil {
+						return
+					}
+					conn.Write(buffer)
+				}
+			},
+			want: true,
+			ok:   true,
+		},
+		{
+			name: "greeting",
+			handle: func(conn net.Conn) {
+				conn.Write([]byte("220 mail.example.com ESMTP\r\n"))
+				io.Copy(io.Discard, conn)
+			},
+			ok: true,
+		},
+		{
+			name: "short reply",
+			handle: func(conn net.Conn) {
+				conn.Write([]byte("Echo"))
+			},
+		},
+	}
+	for _, test := range tests {
+		ip, port := serveTCP(t, test.handle)
+		got, err := detectEchoTCP(ip, port, time.Second)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("%s: got %v, error %v", test.name, got, err)
+		}
+	}
+}
@@ -10,6 +10,9 @@ import (
 
 
 func ScanPorts(cfg *domain.ScannerConfig, writer func(domain.ScanResult, *domain.ScannerConfig)) {
+	if cfg.Resolve {
+		writer = withHostnames(cfg, writer)
+	}
 	if cfg.Threads == 0 {
 		syncScan(cfg, writer)
 	} else {
@@ -79,7 +82,8 @@ func scanPort(protocol string, dstPort int, cfg *domain.ScannerConfig ) (domain.
 	var open bool
 	var duration time.Duration
 	var err error
-	var protocolDetected string
+	var detection domain.Detection
+	var candidates []domain.Candidate
 	var result domain.ScanResult
 
 	if protocol == "tcp" {
@@ -89,7 +93,7 @@ func scanPort(protocol string, dstPort int, cfg *domain.ScannerConfig ) (domain.
 			return result, false
 		}
 	} else if protocol == "udp" {
-		open, err = scanUDP(cfg.Ip, dstPort, cfg.Timeout)
+		open, err = scanUDP(cfg.Ip, dstPort, cfg.Timeout, udpProbes(dstPort, cfg))
 		if err != nil {
 			return result, false
 		}
@@ -102,17 +106,30 @@ func scanPort(protocol string, dstPort int, cfg *domain.ScannerConfig ) (domain.
 	}
 
 	if cfg.Guess {
-		guessedProtocol, err := GuessProtocol(cfg.Ip, dstPort, cfg.Timeout)
+		guessed, found, err := GuessProtocol(cfg.Ip, dstPort, protocol, cfg)
+		if err == nil {
+			detection = *guessed
+			candidates = found
+		}
+	}
+
+	if cfg.HttpAudit && (detection.Protocol == "HTTP" || detection.Protocol == "HTTPS") {
+		audit, err := AuditHTTP(cfg.Ip, dstPort, detection.Protocol == "HTTPS", cfg.HttpAuditRules, cfg.Timeout)
 		if err == nil {
-			protocolDetected = guessedProtocol
+			detection.Findings = append(detection.Findings, audit...)
 		}
 	}
 
 	result = domain.ScanResult{
-		Port:     dstPort,
-		Protocol: protocol,
-		Guess:    protocolDetected,
-		Duration: duration,
+		Port:       dstPort,
+		Protocol:   protocol,
+		Guess:      detection.Protocol,
+		Product:    detection.Product,
+		Version:    detection.Version,
+		Info:       detection.Info,
+		Duration:   duration,
+		Findings:   detection.Findings,
+		Candidates: candidates,
 	}
 	return result, true
 }
\ No newline at end of file
@@ -0,0 +1,724 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+const (
+	quicVersion1        = 0x00000001
+	quicMinDatagram     = 1200
+	quicPacketInitial   = 0x00
+	quicPacketHandshake = 0x02
+	quicPacketRetry     = 0x03
+)
+
+var quicPorts = []int{443, 784, 853, 4433, 8443}
+
+var quicInitialSalt = []byte{
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+	0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+var quicVersionNames = map[uint32]string{
+	0x00000001: "v1",
+	0x6b3343cf: "v2",
+	0xff00001d: "draft-29",
+	0xff00001c: "draft-28",
+	0xff00001b: "draft-27",
+	0x51303433: "Q043",
+	0x51303436: "Q046",
+	0x51303530: "Q050",
+	0x54303530: "T050",
+	0x54303531: "T051",
+	0xfaceb001: "mvfst-draft-22",
+	0xfaceb002: "mvfst-draft-27",
+}
+
+func detectQUIC(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("udp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	probe, scid := buildQUICVersionProbe()
+	_, err = conn.Write(probe)
+	if err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, 1500)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := parseQUICVersionNegotiation(buffer[:n], scid)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(versions))
+	for _, version := range versions {
+		// Версии вида 0x?a?a?a?a зарезервированы для проверки согласования
+		if version&0x0f0f0f0f == 0x0a0a0a0a {
+			continue
+		}
+		name, ok := quicVersionNames[version]
+		if !ok {
+			name = fmt.Sprintf("0x%08x", version)
+		}
+		names = append(names, name)
+	}
+	detection := &domain.Detection{
+		Protocol: "QUIC",
+		Evidence: domain.EvidenceHandshake,
+		Info:     []string{"versions: " + strings.Join(names, ",")},
+	}
+
+	if cfg.QuicHandshake && slices.Contains(versions, quicVersion1) {
+		state, err := quicHandshake(targetIP, port, cfg.Timeout)
+		if err != nil {
+			detection.Info = append(detection.Info, "handshake: "+err.Error())
+			return detection, nil
+		}
+		if state.NegotiatedProtocol != "" {
+			detection.Info = append(detection.Info, "alpn: "+state.NegotiatedProtocol)
+			if strings.HasPrefix(state.NegotiatedProtocol, "h3") {
+				detection.Protocol = "HTTP/3"
+			}
+		}
+		if len(state.PeerCertificates) > 0 {
+			cert := state.PeerCertificates[0]
+			detection.Info = append(detection.Info,
+				"certificate: "+cert.Subject.String(),
+				"issuer: "+cert.Issuer.String(),
+				"expires: "+cert.NotAfter.Format(time.DateOnly),
+			)
+			if len(cert.DNSNames) > 0 {
+				detection.Info = append(detection.Info, "san: "+strings.Join(cert.DNSNames, ","))
+			}
+		}
+	}
+	return detection, nil
+}
+
+// Пакет Initial с зарезервированной версией: сервер обязан ответить Version Negotiation
+func buildQUICVersionProbe() ([]byte, []byte) {
+	dcid := make([]byte, 8)
+	scid := make([]byte, 8)
+	rand.Read(dcid)
+	rand.Read(scid)
+
+	packet := []byte{0xc0}
+	packet = binary.BigEndian.AppendUint32(packet, 0x1a2a3a4a)
+	packet = append(packet, byte(len(dcid)))
+	packet = append(packet, dcid...)
+	packet = append(packet, byte(len(scid)))
+	packet = append(packet, scid...)
+	packet = append(packet, make([]byte, quicMinDatagram-len(packet))...)
+	return packet, scid
+}
+
+func parseQUICVersionNegotiation(packet []byte, scid []byte) ([]uint32, error) {
+	if len(packet) < 7 || packet[0]&0x80 == 0 || binary.BigEndian.Uint32(packet[1:5]) != 0 {
+		return nil, fmt.Errorf("not a quic version negotiation packet")
+	}
+	pos := 5
+	dcidLength := int(packet[pos])
+	if pos+1+dcidLength >= len(packet) {
+		return nil, fmt.Errorf("version negotiation is truncated")
+	}
+	if !bytes.Equal(packet[pos+1:pos+1+dcidLength], scid) {
+		return nil, fmt.Errorf("version negotiation is for another connection")
+	}
+	pos += 1 + dcidLength
+	pos += 1 + int(packet[pos])
+	if pos > len(packet) || (len(packet)-pos)%4 != 0 {
+		return nil, fmt.Errorf("version negotiation is truncated")
+	}
+
+	versions := make([]uint32, 0)
+	for ; pos < len(packet); pos += 4 {
+		versions = append(versions, binary.BigEndian.Uint32(packet[pos:pos+4]))
+	}
+	return versions, nil
+}
+
+type quicKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+type quicLevel struct {
+	read     *quicKeys
+	write    *quicKeys
+	outgoing []byte
+	sent     int
+	received []uint64
+	incoming map[uint64][]byte
+	consumed uint64
+	nextPN   uint32
+}
+
+type quicLongPacket struct {
+	kind     byte
+	scid     []byte
+	token    []byte
+	pnOffset int
+	end      int
+}
+
+func quicHandshake(targetIP net.IP, port int, timeout time.Duration) (*tls.ConnectionState, error) {
+	conn, err := dialProbe("udp", targetIP, port, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	dcid := make([]byte, 8)
+	scid := make([]byte, 8)
+	rand.Read(dcid)
+	rand.Read(scid)
+
+	qc := tls.QUICClient(&tls.QUICConfig{TLSConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h3"},
+		MinVersion:         tls.VersionTLS13,
+	}})
+	// initial_source_connection_id обязателен для клиента
+	params := appendQUICVarint(nil, 0x0f)
+	params = appendQUICVarint(params, uint64(len(scid)))
+	params = append(params, scid...)
+	qc.SetTransportParameters(params)
+
+	err = qc.Start(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer qc.Close()
+
+	levels := map[tls.QUICEncryptionLevel]*quicLevel{
+		tls.QUICEncryptionLevelInitial:   {incoming: make(map[uint64][]byte)},
+		tls.QUICEncryptionLevelHandshake: {incoming: make(map[uint64][]byte)},
+	}
+	levels[tls.QUICEncryptionLevelInitial].write, levels[tls.QUICEncryptionLevelInitial].read = quicInitialKeys(dcid)
+
+	done := false
+	drainEvents := func() error {
+		for {
+			event := qc.NextEvent()
+			switch event.Kind {
+			case tls.QUICNoEvent:
+				return nil
+			case tls.QUICWriteData:
+				if level, ok := levels[event.Level]; ok {
+					level.outgoing = append(level.outgoing, event.Data...)
+				}
+			case tls.QUICSetReadSecret, tls.QUICSetWriteSecret:
+				level, ok := levels[event.Level]
+				if !ok {
+					continue
+				}
+				keys, err := newQUICKeys(event.Suite, event.Data)
+				if err != nil {
+					return err
+				}
+				if event.Kind == tls.QUICSetReadSecret {
+					level.read = keys
+				} else {
+					level.write = keys
+				}
+			case tls.QUICHandshakeDone:
+				done = true
+			}
+		}
+	}
+
+	err = drainEvents()
+	if err != nil {
+		return nil, err
+	}
+
+	var token []byte
+	retried := false
+	serverCID := false
+	buffer := make([]byte, 65536)
+	for !done {
+		_, err = conn.Write(buildQUICDatagram(levels, dcid, scid, token))
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return nil, err
+		}
+		datagram := buffer[:n]
+
+		for len(datagram) > 0 && datagram[0]&0x80 != 0 {
+			packet, err := parseQUICLongHeader(datagram)
+			if err != nil {
+				return nil, err
+			}
+			raw := datagram[:packet.end]
+			datagram = datagram[packet.end:]
+
+			if packet.kind == quicPacketRetry {
+				if retried {
+					return nil, fmt.Errorf("server sent a second retry")
+				}
+				retried = true
+				token = packet.token
+				dcid = append([]byte{}, packet.scid...)
+				initial := levels[tls.QUICEncryptionLevelInitial]
+				initial.write, initial.read = quicInitialKeys(dcid)
+				initial.sent = 0
+				break
+			}
+
+			var level *quicLevel
+			var encLevel tls.QUICEncryptionLevel
+			switch packet.kind {
+			case quicPacketInitial:
+				encLevel = tls.QUICEncryptionLevelInitial
+			case quicPacketHandshake:
+				encLevel = tls.QUICEncryptionLevelHandshake
+			default:
+				continue
+			}
+			level = levels[encLevel]
+			if level.read == nil {
+				continue
+			}
+
+			payload, pn, err := level.read.open(raw, packet.pnOffset)
+			if err != nil {
+				continue
+			}
+			if !serverCID {
+				dcid = append([]byte{}, packet.scid...)
+				serverCID = true
+			}
+			level.received = append(level.received, pn)
+
+			reason, err := readQUICFrames(payload, level)
+			if err != nil {
+				return nil, err
+			}
+			if reason != "" {
+				return nil, fmt.Errorf("connection closed: %s", reason)
+			}
+
+			data := level.contiguous()
+			if len(data) > 0 {
+				err = qc.HandleData(encLevel, data)
+				if err != nil {
+					return nil, err
+				}
+				err = drainEvents()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// Отправляем Finished клиента и сразу закрываем соединение
+	handshake := levels[tls.QUICEncryptionLevelHandshake]
+	closeFrame := []byte{0x1c, 0x00, 0x00, 0x00}
+	handshake.outgoing = append(handshake.outgoing, closeFrame...)
+	conn.Write(buildQUICDatagram(levels, dcid, scid, token))
+
+	state := qc.ConnectionState()
+	return &state, nil
+}
+
+func quicInitialKeys(dcid []byte) (*quicKeys, *quicKeys) {
+	secret := hkdfExtract(sha256.New, quicInitialSalt, dcid)
+	client := hkdfExpandLabel(sha256.New, secret, "client in", sha256.Size)
+	server := hkdfExpandLabel(sha256.New, secret, "server in", sha256.Size)
+	clientKeys, _ := newQUICKeys(tls.TLS_AES_128_GCM_SHA256, client)
+	serverKeys, _ := newQUICKeys(tls.TLS_AES_128_GCM_SHA256, server)
+	return clientKeys, serverKeys
+}
+
+func newQUICKeys(suite uint16, secret []byte) (*quicKeys, error) {
+	var hashFunc func() hash.Hash
+	var keyLength int
+	switch suite {
+	case tls.TLS_AES_128_GCM_SHA256:
+		hashFunc, keyLength = sha256.New, 16
+	case tls.TLS_AES_256_GCM_SHA384:
+		hashFunc, keyLength = sha512.New384, 32
+	default:
+		return nil, fmt.Errorf("cipher suite 0x%04x is not supported", suite)
+	}
+
+	block, err := aes.NewCipher(hkdfExpandLabel(hashFunc, secret, "quic key", keyLength))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	hp, err := aes.NewCipher(hkdfExpandLabel(hashFunc, secret, "quic hp", keyLength))
+	if err != nil {
+		return nil, err
+	}
+	return &quicKeys{
+		aead: aead,
+		iv:   hkdfExpandLabel(hashFunc, secret, "quic iv", 12),
+		hp:   hp,
+	}, nil
+}
+
+func (k *quicKeys) nonce(pn uint64) []byte {
+	nonce := append([]byte{}, k.iv...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	return nonce
+}
+
+func (k *quicKeys) mask(sample []byte) []byte {
+	mask := make([]byte, aes.BlockSize)
+	k.hp.Encrypt(mask, sample)
+	return mask
+}
+
+func (k *quicKeys) seal(header []byte, pnOffset int, pn uint32, payload []byte) []byte {
+	packet := k.aead.Seal(header, k.nonce(uint64(pn)), payload, header)
+	mask := k.mask(packet[pnOffset+4 : pnOffset+4+aes.BlockSize])
+	packet[0] ^= mask[0] & 0x0f
+	for i := 0; i < 4; i++ {
+		packet[pnOffset+i] ^= mask[1+i]
+	}
+	return packet
+}
+
+func (k *quicKeys) open(packet []byte, pnOffset int) ([]byte, uint64, error) {
+	if pnOffset+4+aes.BlockSize > len(packet) {
+		return nil, 0, fmt.Errorf("quic packet is too short")
+	}
+	mask := k.mask(packet[pnOffset+4 : pnOffset+4+aes.BlockSize])
+	header := append([]byte{}, packet[:pnOffset+4]...)
+	header[0] ^= mask[0] & 0x0f
+	pnLength := int(header[0]&0x03) + 1
+	header = header[:pnOffset+pnLength]
+
+	var pn uint64
+	for i := 0; i < pnLength; i++ {
+		header[pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(header[pnOffset+i])
+	}
+	payload, err := k.aead.Open(nil, k.nonce(pn), packet[pnOffset+pnLength:], header)
+	if err != nil {
+		return nil, 0, err
+	}
+	return payload, pn, nil
+}
+
+func parseQUICLongHeader(data []byte) (*quicLongPacket, error) {
+	if len(data) < 7 {
+		return nil, fmt.Errorf("quic packet is truncated")
+	}
+	version := binary.BigEndian.Uint32(data[1:5])
+	if version == 0 {
+		return nil, fmt.Errorf("server does not support quic v1")
+	}
+	if version != quicVersion1 {
+		return nil, fmt.Errorf("unexpected quic version 0x%08x", version)
+	}
+
+	packet := &quicLongPacket{kind: (data[0] >> 4) & 0x03}
+	pos := 5
+	dcidLength := int(data[pos])
+	pos += 1 + dcidLength
+	if pos >= len(data) {
+		return nil, fmt.Errorf("quic packet is truncated")
+	}
+	scidLength := int(data[pos])
+	if pos+1+scidLength > len(data) {
+		return nil, fmt.Errorf("quic packet is truncated")
+	}
+	packet.scid = data[pos+1 : pos+1+scidLength]
+	pos += 1 + scidLength
+
+	if packet.kind == quicPacketRetry {
+		if len(data)-pos < 16 {
+			return nil, fmt.Errorf("retry packet is truncated")
+		}
+		packet.token = append([]byte{}, data[pos:len(data)-16]...)
+		packet.end = len(data)
+		return packet, nil
+	}
+
+	if packet.kind == quicPacketInitial {
+		tokenLength, next, err := readQUICVarint(data, pos)
+		if err != nil {
+			return nil, err
+		}
+		pos = next + int(tokenLength)
+	}
+	length, next, err := readQUICVarint(data, pos)
+	if err != nil {
+		return nil, err
+	}
+	packet.pnOffset = next
+	packet.end = next + int(length)
+	if packet.end > len(data) || int(length) < 0 {
+		return nil, fmt.Errorf("quic packet is truncated")
+	}
+	return packet, nil
+}
+
+func readQUICFrames(payload []byte, level *quicLevel) (string, error) {
+	pos := 0
+	for pos < len(payload) {
+		kind := payload[pos]
+		pos++
+		switch kind {
+		case 0x00, 0x01:
+		case 0x02, 0x03:
+			values := 4
+			var err error
+			var count uint64
+			for i := 0; i < values; i++ {
+				var value uint64
+				value, pos, err = readQUICVarint(payload, pos)
+				if err != nil {
+					return "", err
+				}
+				if i == 2 {
+					count = value
+					values += int(min(count, 1024)) * 2
+				}
+			}
+			if kind == 0x03 {
+				for i := 0; i < 3; i++ {
+					_, pos, err = readQUICVarint(payload, pos)
+					if err != nil {
+						return "", err
+					}
+				}
+			}
+		case 0x06:
+			offset, next, err := readQUICVarint(payload, pos)
+			if err != nil {
+				return "", err
+			}
+			length, next, err := readQUICVarint(payload, next)
+			if err != nil {
+				return "", err
+			}
+			if next+int(length) > len(payload) {
+				return "", fmt.Errorf("crypto frame is truncated")
+			}
+			level.incoming[offset] = payload[next : next+int(length)]
+			pos = next + int(length)
+		case 0x1c, 0x1d:
+			code, next, err := readQUICVarint(payload, pos)
+			if err != nil {
+				return "", err
+			}
+			if kind == 0x1c {
+				_, next, err = readQUICVarint(payload, next)
+				if err != nil {
+					return "", err
+				}
+			}
+			length, next, err := readQUICVarint(payload, next)
+			if err != nil || next+int(length) > len(payload) {
+				return fmt.Sprintf("error 0x%x", code), nil
+			}
+			return fmt.Sprintf("error 0x%x %s", code, payload[next:next+int(length)]), nil
+		default:
+			return "", fmt.Errorf("unexpected quic frame 0x%02x", kind)
+		}
+	}
+	return "", nil
+}
+
+// Возвращает новые данные CRYPTO, идущие подряд за уже переданными в TLS
+func (l *quicLevel) contiguous() []byte {
+	result := make([]byte, 0)
+	for {
+		progressed := false
+		for offset, data := range l.incoming {
+			end := offset + uint64(len(data))
+			if offset <= l.consumed && end > l.consumed {
+				result = append(result, data[l.consumed-offset:]...)
+				l.consumed = end
+				progressed = true
+			}
+			if end <= l.consumed {
+				delete(l.incoming, offset)
+			}
+		}
+		if !progressed {
+			return result
+		}
+	}
+}
+
+func (l *quicLevel) ackFrame() []byte {
+	if len(l.received) == 0 {
+		return nil
+	}
+	pns := slices.Clone(l.received)
+	slices.Sort(pns)
+	pns = slices.Compact(pns)
+	slices.Reverse(pns)
+
+	type ackRange struct{ high, low uint64 }
+	ranges := []ackRange{{pns[0], pns[0]}}
+	for _, pn := range pns[1:] {
+		last := &ranges[len(ranges)-1]
+		if pn+1 == last.low {
+			last.low = pn
+		} else {
+			ranges = append(ranges, ackRange{pn, pn})
+		}
+	}
+
+	frame := []byte{0x02}
+	frame = appendQUICVarint(frame, ranges[0].high)
+	frame = appendQUICVarint(frame, 0)
+	frame = appendQUICVarint(frame, uint64(len(ranges)-1))
+	frame = appendQUICVarint(frame, ranges[0].high-ranges[0].low)
+	for i := 1; i < len(ranges); i++ {
+		frame = appendQUICVarint(frame, ranges[i-1].low-ranges[i].high-2)
+		frame = appendQUICVarint(frame, ranges[i].high-ranges[i].low)
+	}
+	return frame
+}
+
+func (l *quicLevel) framesToSend() []byte {
+	frames := l.ackFrame()
+	if l.sent < len(l.outgoing) {
+		data := l.outgoing[l.sent:]
+		frames = append(frames, 0x06)
+		frames = appendQUICVarint(frames, uint64(l.sent))
+		frames = appendQUICVarint(frames, uint64(len(data)))
+		frames = append(frames, data...)
+		l.sent = len(l.outgoing)
+	}
+	return frames
+}
+
+// Собирает датаграмму из пакетов Initial и Handshake, дополняя её до 1200 байт
+func buildQUICDatagram(levels map[tls.QUICEncryptionLevel]*quicLevel, dcid, scid, token []byte) []byte {
+	var handshakePacket []byte
+	handshake := levels[tls.QUICEncryptionLevelHandshake]
+	if handshake.write != nil {
+		frames := handshake.framesToSend()
+		if len(frames) > 0 {
+			handshakePacket = buildQUICLongPacket(handshake, quicPacketHandshake, dcid, scid, nil, frames)
+		}
+	}
+
+	initial := levels[tls.QUICEncryptionLevelInitial]
+	frames := initial.framesToSend()
+	if len(frames) == 0 {
+		frames = []byte{0x01}
+	}
+	overhead := 1 + 4 + 1 + len(dcid) + 1 + len(scid) + len(appendQUICVarint(nil, uint64(len(token)))) + len(token) + 2 + 4 + 16
+	if padding := quicMinDatagram - overhead - len(frames) - len(handshakePacket); padding > 0 {
+		frames = append(frames, make([]byte, padding)...)
+	}
+	datagram := buildQUICLongPacket(initial, quicPacketInitial, dcid, scid, token, frames)
+	return append(datagram, handshakePacket...)
+}
+
+func buildQUICLongPacket(level *quicLevel, kind byte, dcid, scid, token, payload []byte) []byte {
+	header := []byte{0xc0 | kind<<4 | 0x03}
+	header = binary.BigEndian.AppendUint32(header, quicVersion1)
+	header = append(header, byte(len(dcid)))
+	header = append(header, dcid...)
+	header = append(header, byte(len(scid)))
+	header = append(header, scid...)
+	if kind == quicPacketInitial {
+		header = appendQUICVarint(header, uint64(len(token)))
+		header = append(header, token...)
+	}
+	// Длина всегда кодируется двумя байтами, чтобы не зависеть от заполнения
+	length := 4 + len(payload) + 16
+	header = binary.BigEndian.AppendUint16(header, 0x4000|uint16(length))
+	pnOffset := len(header)
+	header = binary.BigEndian.AppendUint32(header, level.nextPN)
+
+	packet := level.write.seal(header, pnOffset, level.nextPN, payload)
+	level.nextPN++
+	return packet
+}
+
+func readQUICVarint(buf []byte, pos int) (uint64, int, error) {
+	if pos >= len(buf) {
+		return 0, 0, fmt.Errorf("quic varint is truncated")
+	}
+	length := 1 << (buf[pos] >> 6)
+	if pos+length > len(buf) {
+		return 0, 0, fmt.Errorf("quic varint is truncated")
+	}
+	value := uint64(buf[pos] & 0x3f)
+	for i := 1; i < length; i++ {
+		value = value<<8 | uint64(buf[pos+i])
+	}
+	return value, pos + length, nil
+}
+
+func appendQUICVarint(buf []byte, value uint64) []byte {
+	switch {
+	case value < 1<<6:
+		return append(buf, byte(value))
+	case value < 1<<14:
+		return binary.BigEndian.AppendUint16(buf, 0x4000|uint16(value))
+	case value < 1<<30:
+		return binary.BigEndian.AppendUint32(buf, 0x80000000|uint32(value))
+	}
+	return binary.BigEndian.AppendUint64(buf, 0xc000000000000000|value)
+}
+
+func hkdfExtract(hashFunc func() hash.Hash, salt, secret []byte) []byte {
+	mac := hmac.New(hashFunc, salt)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+func hkdfExpandLabel(hashFunc func() hash.Hash, secret []byte, label string, length int) []byte {
+	fullLabel := "tls13 " + label
+	info := binary.BigEndian.AppendUint16(nil, uint16(length))
+	info = append(info, byte(len(fullLabel)))
+	info = append(info, fullLabel...)
+	info = append(info, 0)
+
+	result := make([]byte, 0, length)
+	var previous []byte
+	for counter := byte(1); len(result) < length; counter++ {
+		mac := hmac.New(hashFunc, secret)
+		mac.Write(previous)
+		mac.Write(info)
+		mac.Write([]byte{counter})
+		previous = mac.Sum(nil)
+		result = append(result, previous...)
+	}
+	return result[:length]
+}
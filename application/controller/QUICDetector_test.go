@@ -0,0 +1,242 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"slices"
+	"testing"
+)
+
+// Векторы из RFC 9001, приложение A
+var rfc9001DCID = unhex("8394c8f03e515708")
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestQUICInitialSecrets(t *testing.T) {
+	initial := hkdfExtract(sha256.New, quicInitialSalt, rfc9001DCID)
+	tests := []struct {
+		label  string
+		secret string
+		key    string
+		iv     string
+		hp     string
+	}{
+		{"client in", "c00cf151ca5be075ed0ebfb5c80323c42d6b7db67881289af4008f1f6c357aea",
+			"1f369613dd76d5467730efcbe3b1a22d", "fa044b2f42a3fd3b46fb255c", "9f50449e04a0e810283a1e9933adedd2"},
+		{"server in", "3c199828fd139efd216c155ad844cc81fb82fa8d7446fa7d78be803acdda951b",
+			"cf3a5331653c364c88f0f379b6067e37", "0ac1493ca1905853b0bba03e", "c206b8d9b9f0f37644430b490eeaa314"},
+	}
+	for _, test := range tests {
+		secret := hkdfExpandLabel(sha256.New, initial, test.label, sha256.Size)
+		if got := hex.EncodeToString(secret); got != test.secret {
+			t.Errorf("%s secret: got %s, want %s", test.label, got, test.secret)
+		}
+		values := []struct{ label, want string }{
+			{"quic key", test.key}, {"quic iv", test.iv}, {"quic hp", test.hp},
+		}
+		for _, value := range values {
+			got := hex.EncodeToString(hkdfExpandLabel(sha256.New, secret, value.label, len(value.want)/2))
+			if got != value.want {
+				t.Errorf("%s %s: got %s, want %s", test.label, value.label, got, value.want)
+			}
+		}
+	}
+
+	client, server := quicInitialKeys(rfc9001DCID)
+	if !bytes.Equal(client.iv, unhex("fa044b2f42a3fd3b46fb255c")) || !bytes.Equal(server.iv, unhex("0ac1493ca1905853b0bba03e")) {
+		t.Errorf("got iv %x and %x", client.iv, server.iv)
+	}
+}
+
+func TestQUICHeaderProtectionMask(t *testing.T) {
+	client, server := quicInitialKeys(rfc9001DCID)
+	tests := []struct {
+		name   string
+		keys   *quicKeys
+		sample string
+		mask   string
+	}{
+		{"client initial", client, "d1b1c98dd7689fb8ec11d242b123dc9b", "437b9aec36"},
+		{"server initial", server, "2cd0991cd25b0aac406a5816b6394100", "2ec0d8356a"},
+	}
+	for _, test := range tests {
+		if got := hex.EncodeToString(test.keys.mask(unhex(test.sample))[:5]); got != test.mask {
+			t.Errorf("%s: got mask %s, want %s", test.name, got, test.mask)
+		}
+	}
+}
+
+// Защищённый Initial клиента из RFC 9001, A.2: номер пакета 2, CRYPTO с ClientHello и PADDING
+func TestQUICClientInitialVector(t *testing.T) {
+	protected, err := os.ReadFile("testdata/rfc9001-client-initial.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, err := parseQUICLongHeader(protected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.kind != quicPacketInitial || packet.pnOffset != 18 || packet.end != len(protected) || len(packet.scid) != 0 {
+		t.Fatalf("got header %+v", packet)
+	}
+
+	client, _ := quicInitialKeys(rfc9001DCID)
+	payload, pn, err := client.open(protected, packet.pnOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pn != 2 || len(payload) != 1162 {
+		t.Errorf("got packet number %d and %d bytes of payload", pn, len(payload))
+	}
+
+	level := &quicLevel{incoming: make(map[uint64][]byte)}
+	if closed, err := readQUICFrames(payload, level); err != nil || closed != "" {
+		t.Fatalf("got %q, error %v", closed, err)
+	}
+	hello := level.contiguous()
+	if len(hello) != 241 || hello[0] != 0x01 {
+		t.Errorf("got %d bytes of crypto data starting with %02x", len(hello), hello[0])
+	}
+
+	// Обратное преобразование должно дать тот же пакет байт в байт
+	header := unhex("c300000001088394c8f03e5157080000449e00000002")
+	if sealed := client.seal(header, packet.pnOffset, 2, payload); !bytes.Equal(sealed, protected) {
+		t.Error("sealed packet differs from the RFC 9001 vector")
+	}
+
+	tampered := slices.Clone(protected)
+	tampered[100] ^= 0x01
+	if _, _, err := client.open(tampered, packet.pnOffset); err == nil {
+		t.Error("tampered packet was opened")
+	}
+	if _, _, err := client.open(protected[:30], packet.pnOffset); err == nil {
+		t.Error("short packet was opened")
+	}
+}
+
+func TestParseQUICLongHeader(t *testing.T) {
+	retry := append(unhex("f000000001000812345678"+"9abcdef0"), "token"...)
+	retry = append(retry, make([]byte, 16)...)
+	tests := []struct {
+		name   string
+		packet []byte
+		kind   byte
+		token  string
+		ok     bool
+	}{
+		{"handshake", append(unhex("e0000000010004010203040003000000"), 0, 0, 0), quicPacketHandshake, "", true},
+		{"retry", retry, quicPacketRetry, "token", true},
+		{"version negotiation", unhex("c000000000000400000001"), 0, "", false},
+		{"quic v2", unhex("d06b3343cf0000004000"), 0, "", false},
+		{"short", unhex("c0000000"), 0, "", false},
+		{"scid past end", unhex("c0000000010010aabb"), 0, "", false},
+		{"length past end", unhex("e00000000100000440"), 0, "", false},
+		{"retry without tag", unhex("f000000001000008"), 0, "", false},
+	}
+	for _, test := range tests {
+		packet, err := parseQUICLongHeader(test.packet)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if test.ok && (packet.kind != test.kind || string(packet.token) != test.token) {
+			t.Errorf("%s: got %+v", test.name, packet)
+		}
+	}
+}
+
+func TestParseQUICVersionNegotiation(t *testing.T) {
+	scid := unhex("0102030405060708")
+	tests := []struct {
+		name     string
+		packet   string
+		versions []uint32
+		ok       bool
+	}{
+		{"two versions", "c000000000080102030405060708" + "04aabbccdd" + "00000001" + "6b3343cf", []uint32{quicVersion1, 0x6b3343cf}, true},
+		{"no versions", "800000000008010203040506070800", []uint32{}, true},
+		{"other connection", "c000000000080102030405060709" + "00" + "00000001", nil, false},
+		{"not negotiation", "c000000001080102030405060708" + "00" + "00000001", nil, false},
+		{"partial version", "c000000000080102030405060708" + "00" + "000001", nil, false},
+		{"truncated dcid", "c0000000000801020304", nil, false},
+		{"short header", "40000000000801020304050607080000", nil, false},
+	}
+	for _, test := range tests {
+		versions, err := parseQUICVersionNegotiation(unhex(test.packet), scid)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if test.ok && !slices.Equal(versions, test.versions) {
+			t.Errorf("%s: got %x, want %x", test.name, versions, test.versions)
+		}
+	}
+}
+
+func TestQUICVarint(t *testing.T) {
+	// Примеры из RFC 9000, приложение A.1
+	tests := []struct {
+		encoded string
+		value   uint64
+	}{
+		{"c2197c5eff14e88c", 151288809941952652},
+		{"9d7f3e7d", 494878333},
+		{"7bbd", 15293},
+		{"25", 37},
+	}
+	for _, test := range tests {
+		value, next, err := readQUICVarint(unhex(test.encoded), 0)
+		if err != nil || value != test.value || next != len(test.encoded)/2 {
+			t.Errorf("%s: got %d, next %d, error %v", test.encoded, value, next, err)
+		}
+		if got := hex.EncodeToString(appendQUICVarint(nil, test.value)); got != test.encoded {
+			t.Errorf("%d: encoded as %s, want %s", test.value, got, test.encoded)
+		}
+	}
+	// Двухбайтовая запись числа 37 тоже допустима
+	if value, _, err := readQUICVarint(unhex("4025"), 0); err != nil || value != 37 {
+		t.Errorf("4025: got %d, error %v", value, err)
+	}
+	for _, truncated := range []string{"", "40", "9d7f3e", "c2197c5eff14e8"} {
+		if _, _, err := readQUICVarint(unhex(truncated), 0); err == nil {
+			t.Errorf("%q: expected error", truncated)
+		}
+	}
+}
+
+func TestReadQUICFrames(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		closed  string
+		ok      bool
+	}{
+		{"padding and ping", "000001", "", true},
+		{"ack with range", "02" + "0a" + "00" + "01" + "02" + "01" + "03", "", true},
+		{"ack ecn", "03" + "05" + "00" + "00" + "00" + "01" + "02" + "03", "", true},
+		{"connection close", "1c" + "4128" + "06" + "0b" + "6e6f20616c706e206f6b21", "error 0x128 no alpn ok!", true},
+		{"application close", "1d" + "00" + "00", "error 0x0 ", true},
+		{"crypto past end", "06" + "00" + "10" + "0102", "", false},
+		{"unknown frame", "08", "", false},
+		{"truncated ack", "02" + "0a", "", false},
+	}
+	for _, test := range tests {
+		level := &quicLevel{incoming: make(map[uint64][]byte)}
+		closed, err := readQUICFrames(unhex(test.payload), level)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if closed != test.closed {
+			t.Errorf("%s: got %q, want %q", test.name, closed, test.closed)
+		}
+	}
+}
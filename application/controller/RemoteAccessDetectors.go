@@ -0,0 +1,346 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+const (
+	rdpProtocolRDP      = 0x00
+	rdpProtocolSSL      = 0x01
+	rdpProtocolHybrid   = 0x02
+	rdpProtocolHybridEx = 0x08
+)
+
+var rdpProtocols = []struct {
+	flag uint32
+	name string
+}{
+	{rdpProtocolRDP, "RDP"},
+	{rdpProtocolSSL, "TLS"},
+	{rdpProtocolHybrid, "NLA"},
+	{rdpProtocolHybridEx, "NLA-EX"},
+}
+
+var vncSecurityTypes = map[byte]string{
+	1:   "None",
+	2:   "VNC Authentication",
+	5:   "RA2",
+	6:   "RA2ne",
+	16:  "Tight",
+	17:  "Ultra",
+	18:  "TLS",
+	19:  "VeNCrypt",
+	22:  "XVP",
+	30:  "Apple Remote Desktop",
+	35:  "Apple Remote Desktop",
+	113: "MSLogonII",
+}
+
+var telnetOptions = map[byte]string{
+	0:  "BINARY",
+	1:  "ECHO",
+	3:  "SUPPRESS-GO-AHEAD",
+	5:  "STATUS",
+	6:  "TIMING-MARK",
+	24: "TERMINAL-TYPE",
+	31: "NAWS",
+	32: "TERMINAL-SPEED",
+	33: "LFLOW",
+	34: "LINEMODE",
+	35: "X-DISPLAY-LOCATION",
+	36: "OLD-ENVIRON",
+	37: "AUTHENTICATION",
+	38: "ENCRYPT",
+	39: "NEW-ENVIRON",
+}
+
+var telnetPrompt = regexp.MustCompile(`(?i)(login|username|user name|password)\s*:\s*$`)
+
+func detectRDP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	supported := make([]string, 0)
+	identified := false
+	for _, protocol := range rdpProtocols {
+		selected, err := negotiateRDP(targetIP, port, cfg.Timeout, protocol.flag)
+		if err != nil {
+			if identified {
+				continue
+			}
+			return nil, err
+		}
+		identified = true
+		if selected == protocol.flag {
+			supported = append(supported, protocol.name)
+		}
+	}
+
+	detection := &domain.Detection{
+		Protocol: "RDP",
+		Evidence: domain.EvidenceHandshake,
+		Info:     []string{"security: " + strings.Join(supported, ",")},
+	}
+	if !slices.Contains(supported, "NLA") && !slices.Contains(supported, "NLA-EX") {
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "rdp-nla-disabled",
+			Severity: domain.SeverityMedium,
+			Detail:   "server does not require Network Level Authentication",
+		})
+	}
+	if slices.Contains(supported, "RDP") {
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "rdp-standard-security",
+			Severity: domain.SeverityMedium,
+			Detail:   "server accepts legacy RDP security without TLS",
+		})
+	}
+	return detection, nil
+}
+
+var errRDPNegotiationFailed = errors.New("rdp negotiation failed")
+
+// Возвращает протокол, выбранный сервером, или ошибку, если он отказал
+func negotiateRDP(targetIP net.IP, port int, timeout time.Duration, requested uint32) (uint32, error) {
+	conn, err := dialProbe("tcp", targetIP, port, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	request := []byte{
+		0x03, 0x00, 0x00, 0x13,
+		0x0e, 0xe0, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x00, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	binary.LittleEndian.PutUint32(request[15:19], requested)
+	_, err = conn.Write(request)
+	if err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, 4)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return 0, err
+	}
+	length := int(binary.BigEndian.Uint16(header[2:4]))
+	if header[0] != 0x03 || length < 11 || length > 1024 {
+		return 0, fmt.Errorf("not a tpkt packet")
+	}
+	body := make([]byte, length-4)
+	_, err = io.ReadFull(conn, body)
+	if err != nil {
+		return 0, err
+	}
+	if body[1]&0xf0 != 0xd0 {
+		return 0, fmt.Errorf("not an x.224 connection confirm")
+	}
+
+	// Старые серверы не поддерживают согласование и отвечают без RDP_NEG_RSP
+	if len(body) < 15 {
+		if requested == rdpProtocolRDP {
+			return rdpProtocolRDP, nil
+		}
+		return 0, errRDPNegotiationFailed
+	}
+	switch body[7] {
+	case 0x02:
+		return binary.LittleEndian.Uint32(body[11:15]), nil
+	case 0x03:
+		return 0xffffffff, nil
+	}
+	return 0, fmt.Errorf("unknown rdp negotiation response %d", body[7])
+}
+
+func detectVNC(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	banner := make([]byte, 12)
+	_, err = io.ReadFull(conn, banner)
+	if err != nil {
+		return nil, err
+	}
+	var major, minor int
+	_, err = fmt.Sscanf(string(banner), "RFB %03d.%03d\n", &major, &minor)
+	if err != nil {
+		return nil, fmt.Errorf("not an rfb banner")
+	}
+
+	detection := &domain.Detection{
+		Protocol: "VNC",
+		Evidence: domain.EvidenceHandshake,
+		Version:  fmt.Sprintf("RFB %d.%d", major, minor),
+	}
+
+	// Отвечаем той же версией, но не новее 3.8
+	if major > 3 || minor > 8 {
+		major, minor = 3, 8
+	}
+	_, err = conn.Write([]byte(fmt.Sprintf("RFB %03d.%03d\n", major, minor)))
+	if err != nil {
+		return detection, nil
+	}
+
+	var types []byte
+	if major == 3 && minor < 7 {
+		value := make([]byte, 4)
+		_, err = io.ReadFull(conn, value)
+		if err != nil {
+			return detection, nil
+		}
+		types = []byte{byte(binary.BigEndian.Uint32(value))}
+	} else {
+		count := make([]byte, 1)
+		_, err = io.ReadFull(conn, count)
+		if err != nil {
+			return detection, nil
+		}
+		types = make([]byte, count[0])
+		_, err = io.ReadFull(conn, types)
+		if err != nil {
+			return detection, nil
+		}
+	}
+
+	names := make([]string, 0, len(types))
+	for _, t := range types {
+		name, ok := vncSecurityTypes[t]
+		if !ok {
+			name = fmt.Sprintf("%d", t)
+		}
+		names = append(names, name)
+		if t == 1 {
+			detection.Findings = append(detection.Findings, domain.Finding{
+				Check:    "vnc-no-auth",
+				Severity: domain.SeverityHigh,
+				Detail:   "server offers the None security type",
+			})
+		}
+	}
+	if len(names) == 0 || types[0] == 0 {
+		names = []string{"connection refused"}
+	}
+	detection.Info = append(detection.Info, "security: "+strings.Join(names, ","))
+	return detection, nil
+}
+
+func detectTelnet(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	negotiated := make([]string, 0)
+	var text strings.Builder
+loop:
+	for !telnetPrompt.MatchString(text.String()) && text.Len() < 4096 {
+		b, err := reader.ReadByte()
+		if err != nil {
+			break
+		}
+		if b != 255 {
+			text.WriteByte(b)
+			continue
+		}
+
+		command, err := reader.ReadByte()
+		if err != nil {
+			break
+		}
+		switch command {
+		case 251, 252, 253, 254:
+			option, err := reader.ReadByte()
+			if err != nil {
+				break loop
+			}
+			negotiated = append(negotiated, telnetCommandName(command)+" "+telnetOptionName(option))
+			// Отказываемся от всех опций, чтобы сервер перешёл к приглашению входа
+			switch command {
+			case 253:
+				conn.Write([]byte{255, 252, option})
+			case 251:
+				conn.Write([]byte{255, 254, option})
+			}
+		case 250:
+			_, err = reader.ReadBytes(240)
+			if err != nil {
+				break loop
+			}
+		}
+	}
+
+	prompt := lastTelnetLine(text.String())
+	if len(negotiated) == 0 && !telnetPrompt.MatchString(prompt) {
+		return nil, fmt.Errorf("not a telnet server")
+	}
+
+	detection := &domain.Detection{
+		Protocol: "Telnet",
+		Evidence: domain.EvidenceHandshake,
+		Findings: []domain.Finding{{
+			Check:    "telnet-cleartext",
+			Severity: domain.SeverityMedium,
+			Detail:   "credentials are sent in cleartext",
+		}},
+	}
+	if len(negotiated) > 0 {
+		detection.Info = append(detection.Info, "options: "+strings.Join(negotiated, ", "))
+	} else {
+		// Без согласования опций Telnet узнан только по приглашению входа
+		detection.Evidence = domain.EvidenceBannerRegex
+	}
+	if prompt != "" {
+		detection.Info = append(detection.Info, "prompt: "+prompt)
+	}
+	return detection, nil
+}
+
+func telnetCommandName(command byte) string {
+	switch command {
+	case 251:
+		return "WILL"
+	case 252:
+		return "WONT"
+	case 253:
+		return "DO"
+	}
+	return "DONT"
+}
+
+func telnetOptionName(option byte) string {
+	if name, ok := telnetOptions[option]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", option)
+}
+
+func lastTelnetLine(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r", ""), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(strings.Map(func(r rune) rune {
+			if r < 32 || r == 127 {
+				return -1
+			}
+			return r
+		}, lines[i]))
+		if line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+// RDP-сервер, который выбирает запрошенный протокол из supported,
+// а на остальные отвечает RDP_NEG_FAILURE. Без supported ведёт себя как сервер до RDP 5.2
+func fakeRDP(supported ...uint32) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		request := make([]byte, 19)
+		if _, err := io.ReadFull(conn, request); err != nil || request[5] != 0xe0 {
+			return
+		}
+		if supported == nil {
+			conn.Write([]byte{0x03, 0x00, 0x00, 0x0b, 0x06, 0xd0, 0x00, 0x00, 0x12, 0x34, 0x00})
+			return
+		}
+		requested := binary.LittleEndian.Uint32(request[15:19])
+		response := []byte{0x03, 0x00, 0x00, 0x13, 0x0e, 0xd0, 0x00, 0x00, 0x12, 0x34, 0x00, 0x02, 0x1f, 0x08, 0x00}
+		if slices.Contains(supported, requested) {
+			response = binary.LittleEndian.AppendUint32(response, requested)
+		} else {
+			// SSL_REQUIRED_BY_SERVER или HYBRID_REQUIRED_BY_SERVER
+			response[11], response[12] = 0x03, 0x00
+			response = binary.LittleEndian.AppendUint32(response, 0x05)
+		}
+		conn.Write(response)
+	}
+}
+
+func TestDetectRDP(t *testing.T) {
+	tests := []struct {
+		name      string
+		supported []uint32
+		security  string
+		findings  []string
+	}{
+		{"windows server with nla", []uint32{rdpProtocolSSL, rdpProtocolHybrid, rdpProtocolHybridEx}, "security: TLS,NLA,NLA-EX", nil},
+		{"xrdp", []uint32{rdpProtocolRDP, rdpProtocolSSL}, "security: RDP,TLS", []string{"rdp-nla-disabled", "rdp-standard-security"}},
+		{"pre-negotiation server", nil, "security: RDP", []string{"rdp-nla-disabled", "rdp-standard-security"}},
+	}
+	for _, test := range tests {
+		ip, port := serveTCP(t, fakeRDP(test.supported...))
+		detection, err := detectRDP(ip, port, testConfig())
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var checks []string
+		for _, finding := range detection.Findings {
+			checks = append(checks, finding.Check)
+		}
+		if detection.Info[0] != test.security || !slices.Equal(checks, test.findings) {
+			t.Errorf("%s: got %q, findings %q", test.name, detection.Info, checks)
+		}
+	}
+
+	// Ответ TPKT с другим типом X.224 — не подтверждение соединения
+	ip, port := serveTCP(t, func(conn net.Conn) {
+		io.ReadFull(conn, make([]byte, 19))
+		conn.Write([]byte{0x03, 0x00, 0x00, 0x0b, 0x06, 0x80, 0x00, 0x00, 0x12, 0x34, 0x00})
+	})
+	if _, err := detectRDP(ip, port, testConfig()); err == nil {
+		t.Error("disconnect request detected as rdp")
+	}
+}
+
+func TestDetectVNC(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   []byte
+		version  string
+		security string
+		noAuth   bool
+	}{
+		{"tigervnc", []byte("RFB 003.008\n\x02\x02\x13"), "RFB 3.8", "security: VNC Authentication,VeNCrypt", false},
+		{"open x11vnc", []byte("RFB 003.008\n\x01\x01"), "RFB 3.8", "security: None", true},
+		{"rfb 3.3", []byte("RFB 003.003\n\x00\x00\x00\x02"), "RFB 3.3", "security: VNC Authentication", false},
+		{"apple", []byte("RFB 003.889\n\x02\x1e\x02"), "RFB 3.889", "security: Apple Remote Desktop,VNC Authentication", false},
+		{"refused", []byte("RFB 003.008\n\x00"), "RFB 3.8", "security: connection refused", false},
+	}
+	for _, test := range tests {
+		ip, port := serveTCP(t, func(conn net.Conn) {
+			conn.Write(test.server[:12])
+			io.ReadFull(conn, make([]byte, 12))
+			conn.Write(test.server[12:])
+		})
+		detection, err := detectVNC(ip, port, testConfig())
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if detection.Version != test.version || len(detection.Info) != 1 || detection.Info[0] != test.security {
+			t.Errorf("%s: got %q %q", test.name, detection.Version, detection.Info)
+		}
+		if (len(detection.Findings) == 1) != test.noAuth {
+			t.Errorf("%s: got findings %v", test.name, detection.Findings)
+		}
+	}
+}
+
+func TestDetectTelnet(t *testing.T) {
+	ip, port := serveTCP(t, func(conn net.Conn) {
+		// DO TERMINAL-TYPE, WILL ECHO, подсогласование и приглашение
+		conn.Write([]byte{255, 253, 24, 255, 251, 1, 255, 250, 24, 1, 255, 240})
+		conn.Write([]byte("\r\nUbuntu 22.04.4 LTS\r\nrouter login: "))
+		io.ReadAll(conn)
+	})
+	detection, err := detectTelnet(ip, port, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"options: DO TERMINAL-TYPE, WILL ECHO", "prompt: router login:"}
+	if !slices.Equal(detection.Info, want) || detection.Evidence != domain.EvidenceHandshake {
+		t.Errorf("got %q, evidence %q", detection.Info, detection.Evidence)
+	}
+
+	// Busybox telnetd без согласования опций узнаётся только по приглашению
+	ip, port = serveTCP(t, func(conn net.Conn) { conn.Write([]byte("\r\n\x1b[0mLogin: ")) })
+	detection, err = detectTelnet(ip, port, testConfig())
+	if err != nil || detection.Info[0] != "prompt: [0mLogin:" || detection.Evidence != domain.EvidenceBannerRegex {
+		t.Fatalf("got %v, error %v", detection, err)
+	}
+
+	ip, port = serveTCP(t, func(conn net.Conn) { conn.Write([]byte("220 ftp.example.com FTP server ready\r\n")) })
+	if _, err := detectTelnet(ip, port, testConfig()); err == nil {
+		t.Error("ftp banner detected as telnet")
+	}
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"net"
+	"sync"
+
+	"github.com/futig/PortScannerGo/application/dns"
+	"github.com/futig/PortScannerGo/domain"
+)
+
+// Кэш обратных запросов: результатов по одному хосту много, а запрос нужен один
+type hostnameCache struct {
+	mu      sync.Mutex
+	lookups map[string]*hostnameLookup
+}
+
+type hostnameLookup struct {
+	done  chan struct{}
+	names []string
+}
+
+var hostnames = &hostnameCache{lookups: make(map[string]*hostnameLookup)}
+
+// Запускает PTR-запрос в фоне; повторные вызовы для того же адреса получают тот же запрос
+func (c *hostnameCache) lookup(client *dns.Client, ip net.IP) *hostnameLookup {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := ip.String()
+	if lookup, ok := c.lookups[key]; ok {
+		return lookup
+	}
+
+	lookup := &hostnameLookup{done: make(chan struct{})}
+	c.lookups[key] = lookup
+	go func() {
+		names, err := client.LookupPTR(ip)
+		if err == nil {
+			lookup.names = names
+		}
+		close(lookup.done)
+	}()
+	return lookup
+}
+
+func (l *hostnameLookup) wait() []string {
+	<-l.done
+	return l.names
+}
+
+func resolverClient(cfg *domain.ScannerConfig) *dns.Client {
+	server := cfg.Resolver
+	if server == "" {
+		server = dns.DefaultServer()
+	}
+	return dns.NewClient(server, cfg.Timeout)
+}
+
+// Запрос уходит до начала сканирования и выполняется параллельно с ним, а имена
+// берутся из кэша по адресу хоста для каждого результата перед выводом
+func withHostnames(cfg *domain.ScannerConfig,
+	writer func(domain.ScanResult, *domain.ScannerConfig)) func(domain.ScanResult, *domain.ScannerConfig) {
+	client := resolverClient(cfg)
+	hostnames.lookup(client, cfg.Ip)
+	return func(result domain.ScanResult, cfg *domain.ScannerConfig) {
+		result.Hostnames = hostnames.lookup(client, cfg.Ip).wait()
+		writer(result, cfg)
+	}
+}
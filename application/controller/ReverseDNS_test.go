@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/futig/PortScannerGo/application/dns"
+	"github.com/futig/PortScannerGo/domain"
+)
+
+// Резолвер, который на PTR-запрос для любого адреса отвечает именем host.example.com
+func servePTR(t *testing.T, queries *atomic.Int32) string {
+	ip, port := serveUDP(t, func(request []byte) []byte {
+		query, err := dns.ParseRequest(request)
+		if err != nil || query.Question.QType != dns.TypePTR {
+			return nil
+		}
+		queries.Add(1)
+		response := &dns.Response{
+			Header:   dns.Header{ID: query.Header.ID, QR: 1, RD: 1, RA: 1, QDCount: 1, ANCount: 1},
+			Question: query.Question,
+			Answers: []*dns.ResponseData{{
+				Name: query.Question.QName, Type: dns.TypePTR, Class: dns.ClassIN, TTL: 60, Data: dnsName("host.example.com"),
+			}},
+		}
+		return response.Encode()
+	})
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
+
+func TestHostnameCache(t *testing.T) {
+	var queries atomic.Int32
+	client := dns.NewClient(servePTR(t, &queries), testConfig().Timeout)
+	cache := &hostnameCache{lookups: make(map[string]*hostnameLookup)}
+
+	var wg sync.WaitGroup
+	lookups := make([]*hostnameLookup, 8)
+	for i := range lookups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lookups[i] = cache.lookup(client, net.IPv4(192, 0, 2, 1))
+		}()
+	}
+	wg.Wait()
+	for _, lookup := range lookups {
+		if lookup != lookups[0] {
+			t.Fatal("concurrent lookups of one address started separate queries")
+		}
+	}
+	if names := lookups[0].wait(); !slices.Equal(names, []string{"host.example.com."}) {
+		t.Errorf("got %q", names)
+	}
+
+	// Тот же адрес в другой записи берётся из кэша, другой адрес запрашивается отдельно
+	cache.lookup(client, net.ParseIP("192.0.2.1")).wait()
+	cache.lookup(client, net.IPv4(192, 0, 2, 2)).wait()
+	if n := queries.Load(); n != 2 {
+		t.Errorf("got %d queries for two addresses", n)
+	}
+}
+
+func TestWithHostnames(t *testing.T) {
+	var queries atomic.Int32
+	cfg := testConfig()
+	cfg.Resolver = servePTR(t, &queries)
+	cfg.Ip = net.IPv4(192, 0, 2, 10)
+
+	var got [][]string
+	writer := withHostnames(cfg, func(result domain.ScanResult, cfg *domain.ScannerConfig) {
+		got = append(got, result.Hostnames)
+	})
+	writer(domain.ScanResult{Port: 22}, cfg)
+	writer(domain.ScanResult{Port: 80}, cfg)
+	if len(got) != 2 || !slices.Equal(got[0], []string{"host.example.com."}) || !slices.Equal(got[1], got[0]) {
+		t.Errorf("got %q", got)
+	}
+	if n := queries.Load(); n != 1 {
+		t.Errorf("got %d queries for one host", n)
+	}
+}
@@ -0,0 +1,495 @@
+package controller
+
+import (
+	"bufio"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+const (
+	sshMsgDisconnect = 1
+	sshMsgKexInit    = 20
+	sshMsgKexDHInit  = 30
+	sshMsgKexDHReply = 31
+
+	// RFC 4419, обмен с выбором группы сервером
+	sshMsgKexGexGroup   = 31
+	sshMsgKexGexInit    = 32
+	sshMsgKexGexReply   = 33
+	sshMsgKexGexRequest = 34
+
+	sshClientIdent   = "SSH-2.0-PortScannerGo"
+	sshMaxIdentLine  = 255
+	sshMaxPacketSize = 256 * 1024
+)
+
+// RFC 3526, группа 14
+const sshGroup14Prime = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
+	"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+	"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
+	"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+	"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
+	"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+	"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
+	"670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+	"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9" +
+	"DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+	"15728E5A8AACAA68FFFFFFFFFFFFFFFF"
+
+// RFC 3526, группа 16
+const sshGroup16Prime = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
+	"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+	"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
+	"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+	"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
+	"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+	"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
+	"670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+	"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9" +
+	"DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+	"15728E5A8AAAC42DAD33170D04507A33A85521ABDF1CBA64" +
+	"ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7" +
+	"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6B" +
+	"F12FFA06D98A0864D87602733EC86A64521F2B18177B200C" +
+	"BBE117577A615D6C770988C0BAD946E208E24FA074E5AB31" +
+	"43DB5BFCE0FD108E4B82D120A92108011A723C12A787E6D7" +
+	"88719A10BDBA5B2699C327186AF4E23C1A946834B6150BDA" +
+	"2583E9CA2AD44CE8DBBBC2DB04DE8EF92E8EFC141FBECAA6" +
+	"287C59474E6BC05D99B2964FA090C3A2233BA186515BE7ED" +
+	"1F612970CEE2D7AFB81BDD762170481CD0069127D5B05AA9" +
+	"93B4EA988D8FDDC186FFB7DC90A6C08F4DF435C934063199" +
+	"FFFFFFFFFFFFFFFF"
+
+var sshKexPreference = []string{
+	"curve25519-sha256",
+	"curve25519-sha256@libssh.org",
+	"ecdh-sha2-nistp256",
+	"ecdh-sha2-nistp384",
+	"ecdh-sha2-nistp521",
+	"diffie-hellman-group-exchange-sha256",
+	"diffie-hellman-group16-sha512",
+	"diffie-hellman-group14-sha256",
+	"diffie-hellman-group14-sha1",
+}
+
+type sshKexInit struct {
+	kex         []string
+	hostKey     []string
+	ciphersC2S  []string
+	ciphersS2C  []string
+	macsC2S     []string
+	macsS2C     []string
+	compressC2S []string
+	compressS2C []string
+}
+
+func detectSSH(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	ident, err := readSSHIdentification(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	detection := &domain.Detection{
+		Protocol: "SSH",
+		Evidence: domain.EvidenceHandshake,
+		Info:     []string{"banner: " + ident},
+	}
+	detection.Product, detection.Version = parseSSHSoftware(ident)
+
+	protoVersion := strings.SplitN(strings.TrimPrefix(ident, "SSH-"), "-", 2)[0]
+	if protoVersion != "2.0" {
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "ssh-protocol-v1",
+			Severity: domain.SeverityHigh,
+			Detail:   fmt.Sprintf("server accepts SSH protocol %s", protoVersion),
+		})
+		if protoVersion != "1.99" {
+			return detection, nil
+		}
+	}
+
+	// Дальнейший обмен не обязателен: баннера достаточно, чтобы опознать SSH
+	_, err = conn.Write([]byte(sshClientIdent + "\r\n"))
+	if err != nil {
+		return detection, nil
+	}
+
+	payload, err := readSSHPacket(reader)
+	if err != nil || len(payload) == 0 || payload[0] != sshMsgKexInit {
+		return detection, nil
+	}
+	serverKex, err := parseSSHKexInit(payload)
+	if err != nil {
+		return detection, nil
+	}
+
+	detection.Info = append(detection.Info,
+		"kex: "+strings.Join(serverKex.kex, ","),
+		"hostkey: "+strings.Join(serverKex.hostKey, ","),
+		"ciphers: "+strings.Join(unionNames(serverKex.ciphersC2S, serverKex.ciphersS2C), ","),
+		"macs: "+strings.Join(unionNames(serverKex.macsC2S, serverKex.macsS2C), ","),
+	)
+	detection.Findings = append(detection.Findings, weakSSHAlgorithms(serverKex)...)
+
+	keyType, fingerprint, err := fetchSSHHostKey(conn, reader, serverKex)
+	if err == nil {
+		detection.Info = append(detection.Info, fmt.Sprintf("fingerprint: %s %s", keyType, fingerprint))
+	}
+
+	return detection, nil
+}
+
+func readSSHIdentification(reader *bufio.Reader) (string, error) {
+	// До строки идентификации сервер может прислать несколько произвольных строк
+	for i := 0; i < 16; i++ {
+		line, err := readSSHLine(reader)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(line, "SSH-") {
+			return line, nil
+		}
+	}
+	return "", fmt.Errorf("ssh identification string not found")
+}
+
+// RFC 4253 ограничивает строку 255 байтами вместе с CR LF
+func readSSHLine(reader *bufio.Reader) (string, error) {
+	line := make([]byte, 0, 64)
+	for len(line) < sshMaxIdentLine {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			return strings.TrimRight(string(line), "\r\n"), nil
+		}
+	}
+	return "", fmt.Errorf("ssh identification line is too long")
+}
+
+func parseSSHSoftware(ident string) (string, string) {
+	parts := strings.SplitN(ident, "-", 3)
+	if len(parts) < 3 {
+		return "", ""
+	}
+	fields := strings.Fields(parts[2])
+	if len(fields) == 0 {
+		return "", ""
+	}
+	software := fields[0]
+	product, version, ok := strings.Cut(software, "_")
+	if !ok {
+		return software, ""
+	}
+	return product, version
+}
+
+func readSSHPacket(reader io.Reader) ([]byte, error) {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	padding := uint32(header[4])
+	if length < padding+1 || length > sshMaxPacketSize {
+		return nil, fmt.Errorf("invalid ssh packet length %d", length)
+	}
+
+	rest := make([]byte, length-1)
+	_, err = io.ReadFull(reader, rest)
+	if err != nil {
+		return nil, err
+	}
+	return rest[:length-1-padding], nil
+}
+
+func writeSSHPacket(conn net.Conn, payload []byte) error {
+	padding := 8 - (5+len(payload))%8
+	if padding < 4 {
+		padding += 8
+	}
+	packet := make([]byte, 5, 5+len(payload)+padding)
+	binary.BigEndian.PutUint32(packet[0:4], uint32(1+len(payload)+padding))
+	packet[4] = byte(padding)
+	packet = append(packet, payload...)
+	packet = append(packet, make([]byte, padding)...)
+
+	_, err := conn.Write(packet)
+	return err
+}
+
+func parseSSHKexInit(payload []byte) (*sshKexInit, error) {
+	if len(payload) < 17 {
+		return nil, fmt.Errorf("kexinit is too short")
+	}
+	pos := 17
+	lists := make([][]string, 8)
+	for i := range lists {
+		value, next, err := readSSHString(payload, pos)
+		if err != nil {
+			return nil, err
+		}
+		if len(value) > 0 {
+			lists[i] = strings.Split(string(value), ",")
+		}
+		pos = next
+	}
+	return &sshKexInit{
+		kex:         lists[0],
+		hostKey:     lists[1],
+		ciphersC2S:  lists[2],
+		ciphersS2C:  lists[3],
+		macsC2S:     lists[4],
+		macsS2C:     lists[5],
+		compressC2S: lists[6],
+		compressS2C: lists[7],
+	}, nil
+}
+
+func buildSSHKexInit(kex string, server *sshKexInit) []byte {
+	payload := []byte{sshMsgKexInit}
+	cookie := make([]byte, 16)
+	rand.Read(cookie)
+	payload = append(payload, cookie...)
+
+	// Кроме обмена ключами повторяем списки сервера, чтобы согласование точно прошло
+	lists := [][]string{
+		{kex},
+		server.hostKey,
+		server.ciphersC2S,
+		server.ciphersS2C,
+		server.macsC2S,
+		server.macsS2C,
+		server.compressC2S,
+		server.compressS2C,
+		{},
+		{},
+	}
+	for _, list := range lists {
+		payload = appendSSHString(payload, []byte(strings.Join(list, ",")))
+	}
+	payload = append(payload, 0, 0, 0, 0, 0)
+	return payload
+}
+
+func fetchSSHHostKey(conn net.Conn, reader *bufio.Reader, server *sshKexInit) (string, string, error) {
+	kex := ""
+	for _, name := range sshKexPreference {
+		if slices.Contains(server.kex, name) {
+			kex = name
+			break
+		}
+	}
+	if kex == "" {
+		return "", "", fmt.Errorf("no supported key exchange")
+	}
+
+	err := writeSSHPacket(conn, buildSSHKexInit(kex, server))
+	if err != nil {
+		return "", "", err
+	}
+
+	var publicKey []byte
+	switch {
+	case strings.HasPrefix(kex, "curve25519"):
+		publicKey, err = ecdhPublicKey(ecdh.X25519())
+	case kex == "ecdh-sha2-nistp256":
+		publicKey, err = ecdhPublicKey(ecdh.P256())
+	case kex == "ecdh-sha2-nistp384":
+		publicKey, err = ecdhPublicKey(ecdh.P384())
+	case kex == "ecdh-sha2-nistp521":
+		publicKey, err = ecdhPublicKey(ecdh.P521())
+	case kex == "diffie-hellman-group-exchange-sha256":
+		publicKey, err = requestSSHGexGroup(conn, reader)
+	case kex == "diffie-hellman-group16-sha512":
+		publicKey, err = dhPublicKey(sshGroup16Prime)
+	default:
+		publicKey, err = dhPublicKey(sshGroup14Prime)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	initType, replyType := byte(sshMsgKexDHInit), byte(sshMsgKexDHReply)
+	if kex == "diffie-hellman-group-exchange-sha256" {
+		initType, replyType = sshMsgKexGexInit, sshMsgKexGexReply
+	}
+	init := []byte{initType}
+	if strings.HasPrefix(kex, "diffie-hellman") {
+		init = appendSSHMpint(init, publicKey)
+	} else {
+		init = appendSSHString(init, publicKey)
+	}
+	err = writeSSHPacket(conn, init)
+	if err != nil {
+		return "", "", err
+	}
+
+	payload, err := readSSHKexMessage(reader, replyType)
+	if err != nil {
+		return "", "", err
+	}
+	hostKey, _, err := readSSHString(payload, 1)
+	if err != nil {
+		return "", "", err
+	}
+	keyType, _, err := readSSHString(hostKey, 0)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256(hostKey)
+	return string(keyType), "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+func readSSHKexMessage(reader *bufio.Reader, want byte) ([]byte, error) {
+	for {
+		payload, err := readSSHPacket(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) == 0 {
+			continue
+		}
+		switch payload[0] {
+		case want:
+			return payload, nil
+		case sshMsgDisconnect:
+			return nil, fmt.Errorf("server closed key exchange")
+		}
+	}
+}
+
+// Запрашивает у сервера группу в пределах 2048–8192 бит и возвращает открытый ключ в ней
+func requestSSHGexGroup(conn net.Conn, reader *bufio.Reader) ([]byte, error) {
+	request := []byte{sshMsgKexGexRequest}
+	request = binary.BigEndian.AppendUint32(request, 2048)
+	request = binary.BigEndian.AppendUint32(request, 4096)
+	request = binary.BigEndian.AppendUint32(request, 8192)
+	err := writeSSHPacket(conn, request)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := readSSHKexMessage(reader, sshMsgKexGexGroup)
+	if err != nil {
+		return nil, err
+	}
+	primeBytes, pos, err := readSSHString(payload, 1)
+	if err != nil {
+		return nil, err
+	}
+	generatorBytes, _, err := readSSHString(payload, pos)
+	if err != nil {
+		return nil, err
+	}
+	prime := new(big.Int).SetBytes(primeBytes)
+	generator := new(big.Int).SetBytes(generatorBytes)
+	if prime.BitLen() < 1024 || prime.BitLen() > 8192 || generator.Cmp(big.NewInt(1)) <= 0 || generator.Cmp(prime) >= 0 {
+		return nil, fmt.Errorf("invalid group exchange parameters")
+	}
+	return dhExchangeKey(prime, generator)
+}
+
+func ecdhPublicKey(curve ecdh.Curve) ([]byte, error) {
+	key, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return key.PublicKey().Bytes(), nil
+}
+
+func dhPublicKey(primeHex string) ([]byte, error) {
+	prime, _ := new(big.Int).SetString(primeHex, 16)
+	return dhExchangeKey(prime, big.NewInt(2))
+}
+
+func dhExchangeKey(prime, generator *big.Int) ([]byte, error) {
+	private, err := rand.Int(rand.Reader, prime)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Exp(generator, private, prime).Bytes(), nil
+}
+
+func weakSSHAlgorithms(server *sshKexInit) []domain.Finding {
+	findings := make([]domain.Finding, 0)
+	groups := []struct {
+		kind  string
+		names []string
+	}{
+		{"kex", server.kex},
+		{"hostkey", server.hostKey},
+		{"cipher", unionNames(server.ciphersC2S, server.ciphersS2C)},
+		{"mac", unionNames(server.macsC2S, server.macsS2C)},
+	}
+	for _, group := range groups {
+		for _, name := range group.names {
+			severity, ok := domain.WeakSSHAlgorithms[name]
+			if !ok {
+				continue
+			}
+			findings = append(findings, domain.Finding{
+				Check:    "ssh-weak-" + group.kind,
+				Severity: severity,
+				Detail:   fmt.Sprintf("server offers %s", name),
+			})
+		}
+	}
+	return findings
+}
+
+func readSSHString(buf []byte, pos int) ([]byte, int, error) {
+	if pos+4 > len(buf) {
+		return nil, 0, fmt.Errorf("ssh string is truncated")
+	}
+	length := int(binary.BigEndian.Uint32(buf[pos : pos+4]))
+	pos += 4
+	if length > len(buf)-pos {
+		return nil, 0, fmt.Errorf("ssh string is truncated")
+	}
+	return buf[pos : pos+length], pos + length, nil
+}
+
+func appendSSHString(buf []byte, value []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(value)))
+	return append(buf, value...)
+}
+
+func appendSSHMpint(buf []byte, value []byte) []byte {
+	if len(value) > 0 && value[0]&0x80 != 0 {
+		value = append([]byte{0}, value...)
+	}
+	return appendSSHString(buf, value)
+}
+
+func unionNames(first, second []string) []string {
+	result := append([]string{}, first...)
+	for _, name := range second {
+		if !slices.Contains(result, name) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
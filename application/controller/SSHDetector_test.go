@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Начало сессии, записанное с клиента OpenSSH 9.2p1: строка идентификации и пакет KEXINIT.
+// У сервера формат KEXINIT тот же, отличаются только списки
+func openSSHKexInit(t *testing.T) (string, []byte) {
+	capture, err := os.ReadFile("testdata/openssh-9.2-kexinit.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(bytes.NewReader(capture))
+	ident, err := readSSHIdentification(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := readSSHPacket(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ident, payload
+}
+
+func TestParseSSHKexInit(t *testing.T) {
+	ident, payload := openSSHKexInit(t)
+	if ident != "SSH-2.0-OpenSSH_9.2p1 Debian-2+deb12u7" {
+		t.Errorf("got ident %q", ident)
+	}
+	if payload[0] != sshMsgKexInit {
+		t.Fatalf("got message %d, want KEXINIT", payload[0])
+	}
+
+	kexInit, err := parseSSHKexInit(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lists := []struct {
+		name  string
+		got   []string
+		count int
+		first string
+	}{
+		{"kex", kexInit.kex, 13, "sntrup761x25519-sha512"},
+		{"hostkey", kexInit.hostKey, 16, "ssh-ed25519-cert-v01@openssh.com"},
+		{"cipher c2s", kexInit.ciphersC2S, 6, "chacha20-poly1305@openssh.com"},
+		{"cipher s2c", kexInit.ciphersS2C, 6, "chacha20-poly1305@openssh.com"},
+		{"mac c2s", kexInit.macsC2S, 10, "umac-64-etm@openssh.com"},
+		{"mac s2c", kexInit.macsS2C, 10, "umac-64-etm@openssh.com"},
+		{"compression c2s", kexInit.compressC2S, 3, "none"},
+		{"compression s2c", kexInit.compressS2C, 3, "none"},
+	}
+	for _, list := range lists {
+		if len(list.got) != list.count || list.got[0] != list.first {
+			t.Errorf("%s: got %d names starting with %q, want %d starting with %q",
+				list.name, len(list.got), list.got[0], list.count, list.first)
+		}
+	}
+	if !slices.Contains(kexInit.kex, "kex-strict-c-v00@openssh.com") {
+		t.Error("kex list lost its last entry")
+	}
+}
+
+func TestParseSSHKexInitTruncated(t *testing.T) {
+	_, payload := openSSHKexInit(t)
+	for _, length := range []int{0, 16, 17, 20, 300, len(payload) - 40} {
+		if _, err := parseSSHKexInit(payload[:length]); err == nil {
+			t.Errorf("length %d: expected error", length)
+		}
+	}
+}
+
+func TestReadSSHPacket(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   []byte
+		ok     bool
+	}{
+		{"padding stripped", []byte{0, 0, 0, 12, 4, 20, 1, 2, 3, 4, 5, 6, 0, 0, 0, 0}, []byte{20, 1, 2, 3, 4, 5, 6}, true},
+		{"padding longer than packet", []byte{0, 0, 0, 4, 8, 0, 0, 0}, nil, false},
+		{"too large", []byte{0x7f, 0, 0, 0, 4}, nil, false},
+		{"truncated", []byte{0, 0, 0, 12, 4, 20, 1}, nil, false},
+	}
+	for _, test := range tests {
+		got, err := readSSHPacket(bytes.NewReader(test.packet))
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if test.ok && !bytes.Equal(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReadSSHIdentification(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		ok    bool
+	}{
+		{"plain", "SSH-2.0-OpenSSH_9.2p1\r\n", "SSH-2.0-OpenSSH_9.2p1", true},
+		{"preamble", "Authorized use only\r\nSSH-2.0-dropbear\n", "SSH-2.0-dropbear", true},
+		{"longest line", "SSH-2.0-" + strings.Repeat("a", 245) + "\r\n", "SSH-2.0-" + strings.Repeat("a", 245), true},
+		{"line too long", "SSH-2.0-" + strings.Repeat("a", 246) + "\r\n", "", false},
+		{"no newline", strings.Repeat("x", 4096), "", false},
+	}
+	for _, test := range tests {
+		got, err := readSSHIdentification(bufio.NewReader(strings.NewReader(test.input)))
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("%s: got %q, %v", test.name, got, err)
+		}
+	}
+}
+
+// Запускает TCP-сервер, который обрабатывает каждое соединение функцией handle
+func serveTCP(t *testing.T, handle func(conn net.Conn)) (net.IP, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(2 * time.Second))
+				handle(conn)
+			}()
+		}
+	}()
+	address := listener.Addr().(*net.TCPAddr)
+	return address.IP, address.Port
+}
+
+func TestFetchSSHHostKeyGroupExchange(t *testing.T) {
+	hostKey := appendSSHString(nil, []byte("ssh-ed25519"))
+	hostKey = appendSSHString(hostKey, bytes.Repeat([]byte{7}, 32))
+	requested := make(chan []byte, 1)
+
+	ip, port := serveTCP(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		payload, err := readSSHPacket(reader)
+		if err != nil || payload[0] != sshMsgKexInit {
+			return
+		}
+		payload, err = readSSHPacket(reader)
+		if err != nil || payload[0] != sshMsgKexGexRequest {
+			return
+		}
+		requested <- payload
+
+		group := []byte{sshMsgKexGexGroup}
+		group = appendSSHMpint(group, mustHexPrime(sshGroup14Prime))
+		group = appendSSHMpint(group, []byte{2})
+		writeSSHPacket(conn, group)
+
+		payload, err = readSSHPacket(reader)
+		if err != nil || payload[0] != sshMsgKexGexInit {
+			return
+		}
+		reply := appendSSHString([]byte{sshMsgKexGexReply}, hostKey)
+		writeSSHPacket(conn, reply)
+	})
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	server := &sshKexInit{
+		kex:     []string{"diffie-hellman-group-exchange-sha256", "diffie-hellman-group14-sha1"},
+		hostKey: []string{"ssh-ed25519"},
+	}
+	keyType, fingerprint, err := fetchSSHHostKey(conn, bufio.NewReader(conn), server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(hostKey)
+	if keyType != "ssh-ed25519" || fingerprint != "SHA256:"+base64.RawStdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("got %s %s", keyType, fingerprint)
+	}
+	request := <-requested
+	if len(request) != 13 || binary.BigEndian.Uint32(request[1:5]) != 2048 || binary.BigEndian.Uint32(request[9:13]) != 8192 {
+		t.Errorf("unexpected group request %v", request)
+	}
+}
+
+func mustHexPrime(primeHex string) []byte {
+	prime, _ := new(big.Int).SetString(primeHex, 16)
+	return prime.Bytes()
+}
+
+func TestParseSSHSoftware(t *testing.T) {
+	tests := []struct {
+		ident   string
+		product string
+		version string
+	}{
+		{"SSH-2.0-OpenSSH_9.2p1 Debian-2+deb12u7", "OpenSSH", "9.2p1"},
+		{"SSH-2.0-dropbear_2022.83", "dropbear", "2022.83"},
+		{"SSH-2.0-Cisco-1.25", "Cisco-1.25", ""},
+		{"SSH-1.99-", "", ""},
+		{"SSH-2.0", "", ""},
+	}
+	for _, test := range tests {
+		product, version := parseSSHSoftware(test.ident)
+		if product != test.product || version != test.version {
+			t.Errorf("%q: got %q %q, want %q %q", test.ident, product, version, test.product, test.version)
+		}
+	}
+}
+
+func TestWeakSSHAlgorithms(t *testing.T) {
+	_, payload := openSSHKexInit(t)
+	kexInit, err := parseSSHKexInit(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, finding := range weakSSHAlgorithms(kexInit) {
+		got = append(got, finding.Check+" "+finding.Detail)
+	}
+	// В OpenSSH 9.2 остались только 64-битные UMAC
+	want := []string{
+		"ssh-weak-mac server offers umac-64-etm@openssh.com",
+		"ssh-weak-mac server offers umac-64@openssh.com",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	kexInit.kex = append(kexInit.kex, "diffie-hellman-group1-sha1")
+	kexInit.ciphersS2C = append(kexInit.ciphersS2C, "3des-cbc")
+	findings := weakSSHAlgorithms(kexInit)
+	if len(findings) != 4 || findings[0].Check != "ssh-weak-kex" || findings[1].Check != "ssh-weak-cipher" {
+		t.Errorf("unexpected findings %v", findings)
+	}
+}
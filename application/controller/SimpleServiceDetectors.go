@@ -0,0 +1,298 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+const (
+	discardPort = 9
+	fingerPort  = 79
+	identPort   = 113
+
+	// Секунды между 1900 и 1970 годом для протокола Time (RFC 868)
+	rfc868Epoch = 2208988800
+)
+
+// Порты сервисов RFC 863–868, которые отвечают без запроса или на любой запрос
+var simpleServicePorts = []int{discardPort, 13, 17, 19, 37}
+
+var daytimePattern = regexp.MustCompile(`\d{1,2}:\d{2}(:\d{2})?`)
+
+// Приветствия и отказы обычных протоколов: SMTP/FTP "421", POP3, IMAP, SSH, HTTP
+var serviceReplyPattern = regexp.MustCompile(`^(\d{3}([ -]|$)|\+OK|-ERR|\* (OK|BYE|PREAUTH)|SSH-|HTTP/)`)
+
+var identReply = regexp.MustCompile(`^\s*\d+\s*,\s*\d+\s*:\s*(USERID|ERROR)\s*:\s*(.*?)\s*$`)
+
+// Без SimpleServices эти детекторы работают только на своих портах: на остальных
+// их запросы лишние, а ответ «баннер и закрытие» слишком легко принять не за тот сервис
+func checkSimpleServicePort(port int, ports []int, cfg *domain.ScannerConfig) error {
+	if cfg.SimpleServices || slices.Contains(ports, port) {
+		return nil
+	}
+	return fmt.Errorf("probe is limited to the service ports")
+}
+
+func detectSimpleServiceTCP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	err := checkSimpleServicePort(port, simpleServicePorts, cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Discard молчит, поэтому его узнаём только на стандартном порту
+	if port == discardPort {
+		_, err = conn.Write([]byte("discard test\r\n"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data := make([]byte, 0, 1024)
+	buffer := make([]byte, 1024)
+	closed := false
+	for len(data) < cap(data) {
+		n, err := conn.Read(buffer[:cap(data)-len(data)])
+		data = append(data, buffer[:n]...)
+		if errors.Is(err, io.EOF) {
+			closed = true
+			break
+		}
+		if err != nil {
+			if len(data) == 0 && port == discardPort && errors.Is(err, os.ErrDeadlineExceeded) {
+				return &domain.Detection{Protocol: "Discard", Evidence: domain.EvidencePortHint}, nil
+			}
+			break
+		}
+		// Двух строк достаточно, чтобы узнать chargen
+		if isChargen(data) && len(data) >= 148 {
+			break
+		}
+	}
+
+	if isChargen(data) {
+		return &domain.Detection{Protocol: "Chargen", Evidence: domain.EvidenceBanner}, nil
+	}
+	if !closed {
+		return nil, fmt.Errorf("not a simple service")
+	}
+	return classifySimpleService(data)
+}
+
+func detectSimpleServiceUDP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	err := checkSimpleServicePort(port, simpleServicePorts, cfg)
+	if err != nil {
+		return nil, err
+	}
+	request := []byte("\r\n")
+	response, err := exchangeUDP(targetIP, port, cfg.Timeout, request)
+	if err != nil {
+		return nil, err
+	}
+	if string(response) == string(request) {
+		return nil, fmt.Errorf("echo service")
+	}
+
+	var detection *domain.Detection
+	if isChargen(response) {
+		detection = &domain.Detection{Protocol: "Chargen", Evidence: domain.EvidenceBanner}
+	} else {
+		detection, err = classifySimpleService(response)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if finding, ok := amplificationFinding(strings.ToLower(detection.Protocol), len(request), len(response)); ok {
+		detection.Findings = append(detection.Findings, finding)
+	}
+	return detection, nil
+}
+
+// Различает Time, Daytime и QOTD по содержимому ответа
+func classifySimpleService(data []byte) (*domain.Detection, error) {
+	if len(data) == 4 {
+		seconds := int64(binary.BigEndian.Uint32(data)) - rfc868Epoch
+		remote := time.Unix(seconds, 0).UTC()
+		skew := time.Until(remote)
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew < 365*24*time.Hour {
+			return &domain.Detection{
+				Protocol: "Time",
+				Info:     []string{"time: " + remote.Format(time.RFC3339)},
+				Evidence: domain.EvidenceBanner,
+			}, nil
+		}
+	}
+
+	text := strings.TrimSpace(string(data))
+	if text == "" || len(data) > 512 || !isPrintableText(text) || serviceReplyPattern.MatchString(text) {
+		return nil, fmt.Errorf("not a simple service")
+	}
+	if len(text) < 128 && !strings.Contains(text, "\n") && daytimePattern.MatchString(text) {
+		return &domain.Detection{
+			Protocol: "Daytime",
+			Info:     []string{"time: " + text},
+			Evidence: domain.EvidenceBannerRegex,
+		}, nil
+	}
+	quote := strings.Join(strings.Fields(text), " ")
+	if len(quote) > 80 {
+		quote = quote[:77] + "..."
+	}
+	return &domain.Detection{
+		Protocol: "QOTD",
+		Info:     []string{"quote: " + quote},
+		Evidence: domain.EvidenceBanner,
+	}, nil
+}
+
+// Chargen отдаёт строки по 72 символа, каждая сдвинута на символ относительно предыдущей
+func isChargen(data []byte) bool {
+	lines := strings.Split(string(data), "\r\n")
+	if len(lines) < 2 || len(lines[0]) != 72 || !isPrintableText(lines[0]) {
+		return false
+	}
+	next := lines[1]
+	if next == "" {
+		return false
+	}
+	if len(next) > 71 {
+		next = next[:71]
+	}
+	return strings.HasPrefix(lines[0][1:], next)
+}
+
+func isPrintableText(text string) bool {
+	for _, r := range text {
+		if (r < 32 || r > 126) && r != '\r' && r != '\n' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// Находка о том, что UDP-сервис отвечает больше, чем получает
+func amplificationFinding(service string, request int, response int) (domain.Finding, bool) {
+	if request == 0 || response <= request {
+		return domain.Finding{}, false
+	}
+	factor := float64(response) / float64(request)
+	severity := domain.SeverityMedium
+	if factor >= 10 {
+		severity = domain.SeverityHigh
+	}
+	return domain.Finding{
+		Check:    service + "-amplification",
+		Severity: severity,
+		Detail:   fmt.Sprintf("UDP response is %.1fx the request size (%d -> %d bytes)", factor, request, response),
+	}, true
+}
+
+func detectFinger(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	err := checkSimpleServicePort(port, []int{fingerPort}, cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Пустой запрос просит список вошедших пользователей
+	_, err = conn.Write([]byte("\r\n"))
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(conn, 4096))
+	if err != nil && len(data) == 0 {
+		return nil, err
+	}
+
+	text := strings.TrimSpace(string(data))
+	lower := strings.ToLower(text)
+	if text == "" || !isPrintableText(text) ||
+		!(strings.HasPrefix(lower, "login") || strings.Contains(lower, "no one logged on") || strings.Contains(lower, "finger")) {
+		return nil, fmt.Errorf("not a finger server")
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r", ""), "\n")
+	detection := &domain.Detection{
+		Protocol: "Finger",
+		Info:     []string{"response: " + lines[0]},
+		Evidence: domain.EvidenceBanner,
+	}
+	if strings.HasPrefix(lower, "login") && len(lines) > 1 {
+		detection.Info = append(detection.Info, fmt.Sprintf("users: %d", len(lines)-1))
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "finger-user-disclosure",
+			Severity: domain.SeverityLow,
+			Detail:   "finger lists logged-in users to anonymous clients",
+		})
+	}
+	return detection, nil
+}
+
+func detectIdent(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	err := checkSimpleServicePort(port, []int{identPort}, cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialProbe("tcp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Спрашиваем о владельце нашего же соединения: со стороны сервера это порт ident
+	_, localPort, err := net.SplitHostPort(conn.LocalAddr().String())
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Write([]byte(fmt.Sprintf("%d, %s\r\n", port, localPort)))
+	if err != nil {
+		return nil, err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, err
+	}
+
+	match := identReply.FindStringSubmatch(line)
+	if match == nil {
+		return nil, fmt.Errorf("not an ident server")
+	}
+	detection := &domain.Detection{Protocol: "Ident", Evidence: domain.EvidenceBannerRegex}
+	if match[1] == "ERROR" {
+		detection.Info = append(detection.Info, "error: "+match[2])
+		return detection, nil
+	}
+
+	// Ответ имеет вид "<система> : <пользователь>"
+	fields := strings.SplitN(match[2], ":", 2)
+	owner := strings.TrimSpace(fields[len(fields)-1])
+	detection.Info = append(detection.Info, "owner: "+owner, "system: "+strings.TrimSpace(fields[0]))
+	detection.Findings = append(detection.Findings, domain.Finding{
+		Check:    "ident-user-disclosure",
+		Severity: domain.SeverityLow,
+		Detail:   "ident reports the user running the daemon: " + owner,
+	})
+	return detection, nil
+}
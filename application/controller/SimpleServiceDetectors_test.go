@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+// Строки chargen по RFC 864: 72 символа из кольца печатных ASCII со сдвигом на один
+func chargenLines(count int) string {
+	ring := make([]byte, 0, 95)
+	for c := byte(' '); c <= '~'; c++ {
+		ring = append(ring, c)
+	}
+	lines := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		line := make([]byte, 72)
+		for j := range line {
+			line[j] = ring[(i+j)%len(ring)]
+		}
+		lines = append(lines, string(line))
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func TestIsChargen(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{"two lines", chargenLines(2), true},
+		{"second line cut", chargenLines(2)[:100], true},
+		{"one line", chargenLines(1), false},
+		{"not shifted", chargenLines(1) + chargenLines(1), false},
+		{"short lines", "abc\r\nbcd\r\n", false},
+		{"binary", strings.Repeat("\x00", 72) + "\r\n" + strings.Repeat("\x00", 72), false},
+	}
+	for _, test := range tests {
+		if got := isChargen([]byte(test.data)); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestClassifySimpleService(t *testing.T) {
+	now := make([]byte, 4)
+	binary.BigEndian.PutUint32(now, uint32(time.Now().Unix()+rfc868Epoch))
+	tests := []struct {
+		name     string
+		data     []byte
+		protocol string
+	}{
+		{"time", now, "Time"},
+		{"daytime", []byte("Mon Oct 19 10:41:46 2026\r\n"), "Daytime"},
+		{"nist daytime", []byte("61332 26-10-19 10:41:46 00 0 0 123.4 UTC(NIST) *\r\n"), "Daytime"},
+		{"quote", []byte("\"The only way to do great work is to love what you do.\"\r\n Steve Jobs\r\n"), "QOTD"},
+		{"smtp refusal", []byte("421 4.3.2 Service not available, closing transmission channel\r\n"), ""},
+		{"ftp refusal", []byte("421 Too many connections (8) from this IP\r\n"), ""},
+		{"multiline greeting", []byte("220-mail.example.com ESMTP\r\n220 ready at 10:41:46\r\n"), ""},
+		{"pop3", []byte("+OK Dovecot ready.\r\n"), ""},
+		{"pop3 error", []byte("-ERR [SYS/TEMP] Server shutting down\r\n"), ""},
+		{"imap", []byte("* BYE Too many connections\r\n"), ""},
+		{"ssh", []byte("SSH-2.0-OpenSSH_9.2p1\r\n"), ""},
+		{"http", []byte("HTTP/1.0 408 Request Timeout\r\n\r\n"), ""},
+		{"binary", []byte{0x16, 0x03, 0x01, 0x00, 0x02, 0x02, 0x28}, ""},
+		{"empty", []byte("\r\n"), ""},
+		{"too long", []byte(strings.Repeat("quote ", 100)), ""},
+	}
+	for _, test := range tests {
+		detection, err := classifySimpleService(test.data)
+		got := ""
+		if err == nil {
+			got = detection.Protocol
+		}
+		if got != test.protocol {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.protocol)
+		}
+	}
+}
+
+func TestIdentReply(t *testing.T) {
+	tests := []struct {
+		line   string
+		kind   string
+		detail string
+	}{
+		{"113, 40001 : USERID : UNIX : root\r\n", "USERID", "UNIX : root"},
+		{"6191,23:USERID:UNIX,US-ASCII:joe", "USERID", "UNIX,US-ASCII:joe"},
+		{"113 , 40001 : ERROR : NO-USER\r\n", "ERROR", "NO-USER"},
+		{"113, 40001 : ERROR : INVALID-PORT", "ERROR", "INVALID-PORT"},
+		{"220 mail.example.com ESMTP\r\n", "", ""},
+		{"113, 40001 : UNKNOWN : x", "", ""},
+	}
+	for _, test := range tests {
+		match := identReply.FindStringSubmatch(test.line)
+		if test.kind == "" {
+			if match != nil {
+				t.Errorf("%q: unexpected match %q", test.line, match)
+			}
+			continue
+		}
+		if match == nil || match[1] != test.kind || match[2] != test.detail {
+			t.Errorf("%q: got %q", test.line, match)
+		}
+	}
+}
+
+func TestAmplificationFinding(t *testing.T) {
+	tests := []struct {
+		request  int
+		response int
+		ok       bool
+		severity string
+		detail   string
+	}{
+		{2, 2, false, "", ""},
+		{2, 1, false, "", ""},
+		{0, 100, false, "", ""},
+		{2, 10, true, domain.SeverityMedium, "UDP response is 5.0x the request size (2 -> 10 bytes)"},
+		{2, 20, true, domain.SeverityHigh, "UDP response is 10.0x the request size (2 -> 20 bytes)"},
+		{2, 1024, true, domain.SeverityHigh, "UDP response is 512.0x the request size (2 -> 1024 bytes)"},
+	}
+	for _, test := range tests {
+		finding, ok := amplificationFinding("chargen", test.request, test.response)
+		if ok != test.ok {
+			t.Errorf("%d -> %d: got %v", test.request, test.response, ok)
+			continue
+		}
+		if ok && (finding.Check != "chargen-amplification" || finding.Severity != test.severity || finding.Detail != test.detail) {
+			t.Errorf("%d -> %d: got %+v", test.request, test.response, finding)
+		}
+	}
+}
+
+func TestSimpleServicesLimitedToTheirPorts(t *testing.T) {
+	ip, port := serveTCP(t, func(conn net.Conn) { conn.Write([]byte("Mon Oct 19 10:41:46 2026\r\n")) })
+	if _, err := detectSimpleServiceTCP(ip, port, testConfig()); err == nil {
+		t.Error("daytime probe sent outside the service ports")
+	}
+	if _, err := detectFinger(ip, port, testConfig()); err == nil {
+		t.Error("finger probe sent outside the service ports")
+	}
+	if _, err := detectIdent(ip, port, testConfig()); err == nil {
+		t.Error("ident probe sent outside the service ports")
+	}
+
+	cfg := testConfig()
+	cfg.SimpleServices = true
+	detection, err := detectSimpleServiceTCP(ip, port, cfg)
+	if err != nil || detection.Protocol != "Daytime" {
+		t.Errorf("got %+v, error %v", detection, err)
+	}
+
+	ip, port = serveTCP(t, func(conn net.Conn) {
+		buffer := make([]byte, 64)
+		n, _ := conn.Read(buffer)
+		ports := strings.TrimSpace(string(buffer[:n]))
+		conn.Write([]byte(ports + " : USERID : UNIX : nobody\r\n"))
+	})
+	detection, err = detectIdent(ip, port, cfg)
+	if err != nil || detection.Protocol != "Ident" || len(detection.Findings) != 1 {
+		t.Errorf("got %+v, error %v", detection, err)
+	}
+}
@@ -2,10 +2,64 @@ package controller
 
 import (
 	"net"
+	"slices"
 	"time"
+
+	"github.com/futig/PortScannerGo/domain"
 )
 
-func scanUDP(targetIP net.IP, port int, timeout time.Duration) (bool, error) {
+// Дополнительные пакеты для UDP-сервисов, которые молча отбрасывают HTTP-запрос
+func udpProbes(port int, cfg *domain.ScannerConfig) [][]byte {
+	probes := make([][]byte, 0)
+	if cfg.Quic || slices.Contains(quicPorts, port) {
+		// QUIC-сервер обязан ответить Version Negotiation на неизвестную версию
+		probe, _ := buildQUICVersionProbe()
+		probes = append(probes, probe)
+	}
+	switch port {
+	case coapPort:
+		probes = append(probes, buildCoAPDiscovery())
+	case stunPort:
+		probe, _ := buildSTUNBindingRequest()
+		probes = append(probes, probe)
+	case kerberosPort:
+		probes = append(probes, buildASRequest("PORTSCAN.INVALID", "portscan"))
+	case netbiosPort:
+		probes = append(probes, buildNetBIOSStatus())
+	case ntpPort:
+		probes = append(probes, buildNTPRequest())
+	case snmpPort:
+		// Запрос v2c на каждое community: на неверное community агент молчит
+		for i, community := range cfg.SnmpCommunities {
+			probes = append(probes, buildSNMPGet(1, community, int64(i+1)))
+		}
+	case tftpPort:
+		probes = append(probes, buildTFTPRead())
+	case sipPort:
+		probes = append(probes, buildSIPOptions(cfg.Ip, port, "portscan.invalid", port))
+	case ikePort:
+		probes = append(probes, buildIKEv2SAInit(), buildIKEv1MainMode())
+	case ikeNATTPort:
+		probes = append(probes, withNonESPMarker(buildIKEv2SAInit()))
+	case memcachedPort:
+		probes = append(probes, buildMemcachedUDPVersion())
+	}
+	if cfg.Industrial {
+		switch port {
+		case bacnetPort:
+			probes = append(probes, bacnetReadProperty(bacnetWildcardDevice, bacnetPropertyObjectIdentifier, 1))
+		case enipPort:
+			probes = append(probes, enipListIdentity())
+		}
+	}
+	return probes
+}
+
+func scanUDP(targetIP net.IP, port int, timeout time.Duration, probes [][]byte) (bool, error) {
+	if port == tftpPort {
+		return scanUDPAnySourcePort(targetIP, port, timeout, probes)
+	}
+
 	addr := net.UDPAddr{
 		IP:   targetIP,
 		Port: port,
@@ -25,10 +79,46 @@ func scanUDP(targetIP net.IP, port int, timeout time.Duration) (bool, error) {
 		return false, err
 	}
 
-	buffer := make([]byte, 1024)
+	for _, probe := range probes {
+		_, err = conn.Write(probe)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	buffer := make([]byte, 1500)
 	_, err = conn.Read(buffer)
 	if err != nil {
 		return false, err
 	}
 	return true, nil
 }
+
+// TFTP-сервер отвечает с нового порта, а подключённый сокет такие датаграммы отбрасывает
+func scanUDPAnySourcePort(targetIP net.IP, port int, timeout time.Duration, probes [][]byte) (bool, error) {
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	addr := &net.UDPAddr{IP: targetIP, Port: port}
+	for _, probe := range probes {
+		_, err = conn.WriteTo(probe, addr)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	buffer := make([]byte, 1500)
+	for {
+		_, from, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return false, err
+		}
+		if udpAddr, ok := from.(*net.UDPAddr); ok && udpAddr.IP.Equal(targetIP) {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+// Запускает UDP-сервер, который отвечает только на датаграммы, принятые функцией reply
+func serveUDP(t *testing.T, reply func(request []byte) []byte) (net.IP, int) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buffer := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			if response := reply(buffer[:n]); response != nil {
+				conn.WriteToUDP(response, addr)
+			}
+		}
+	}()
+	address := conn.LocalAddr().(*net.UDPAddr)
+	return address.IP, address.Port
+}
+
+func TestUDPProbesMemcached(t *testing.T) {
+	ip, port := serveUDP(t, func(request []byte) []byte {
+		if len(request) < 8 || !bytes.Equal(request[8:], []byte("version\r\n")) {
+			return nil
+		}
+		return append(append([]byte{}, request[:8]...), "VERSION 1.6.21\r\n"...)
+	})
+	cfg := testConfig()
+
+	// На порту 11211 scanUDP отправит memcached-запрос, на других портах — нет
+	if open, _ := scanUDP(ip, port, cfg.Timeout, udpProbes(memcachedPort, cfg)); !open {
+		t.Error("memcached did not answer the probe for port 11211")
+	}
+	if len(udpProbes(memcachedPort+1, cfg)) != 0 {
+		t.Error("memcached probe sent to another port")
+	}
+}
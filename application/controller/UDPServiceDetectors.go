@@ -0,0 +1,502 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+var ikeVendorIDs = map[string]string{
+	"4048b7d56ebce88525e7de7f00d6c2d3": "IKE fragmentation",
+	"afcad71368a1f1c96b8696fc77570100": "Dead Peer Detection",
+	"882fe56d6fd20dbc2251613b2ebe5beb": "strongSwan",
+	"09002689dfd6b712":                 "XAUTH",
+	"4a131c81070358455c5728f20e95452f": "NAT-T (RFC 3947)",
+	"12f5f28c457168a9702d9fe274cc0100": "Cisco Unity",
+	"1f07f70eaa6514d3b0fa96542a500100": "Cisco FlexVPN",
+	"4865617274426561745f4e6f74696679": "Heartbeat Notify",
+}
+
+const snmpSysDescr = "\x2b\x06\x01\x02\x01\x01\x01\x00"
+
+const (
+	tftpPort    = 69
+	ntpPort     = 123
+	snmpPort    = 161
+	ikePort     = 500
+	ikeNATTPort = 4500
+	sipPort     = 5060
+)
+
+func exchangeUDP(targetIP net.IP, port int, timeout time.Duration, request []byte) ([]byte, error) {
+	conn, err := dialProbe("udp", targetIP, port, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(request)
+	if err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, 4096)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer[:n], nil
+}
+
+func buildNTPRequest() []byte {
+	// LI = 0, версия 4, режим 3 (клиент)
+	request := make([]byte, 48)
+	request[0] = 0x23
+	return request
+}
+
+func detectNTP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	response, err := exchangeUDP(targetIP, port, cfg.Timeout, buildNTPRequest())
+	if err != nil {
+		return nil, err
+	}
+	if len(response) < 48 || response[0]&0x07 != 4 {
+		return nil, fmt.Errorf("not an ntp server response")
+	}
+
+	stratum := response[1]
+	detection := &domain.Detection{
+		Protocol: "NTP",
+		Evidence: domain.EvidenceHandshake,
+		Version:  fmt.Sprintf("%d", (response[0]>>3)&0x07),
+		Info:     []string{fmt.Sprintf("stratum: %d", stratum)},
+	}
+
+	refID := response[12:16]
+	switch {
+	case stratum == 0:
+		detection.Info = append(detection.Info, "kiss code: "+strings.TrimRight(string(refID), "\x00"))
+	case stratum == 1:
+		detection.Info = append(detection.Info, "reference: "+strings.TrimRight(string(refID), "\x00"))
+	default:
+		detection.Info = append(detection.Info, "reference: "+net.IP(refID).String())
+	}
+	return detection, nil
+}
+
+func detectSNMP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("udp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Отправляем все комбинации сразу, чтобы не ждать таймаут на каждое неверное community
+	type attempt struct {
+		community string
+		version   string
+	}
+	attempts := make([]attempt, 0, len(cfg.SnmpCommunities)*2)
+	for _, community := range cfg.SnmpCommunities {
+		for version, name := range []string{"v1", "v2c"} {
+			requestID := int64(len(attempts) + 1)
+			attempts = append(attempts, attempt{community, name})
+			_, err = conn.Write(buildSNMPGet(int64(version), community, requestID))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	buffer := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return nil, err
+		}
+		requestID, descr, err := parseSNMPResponse(buffer[:n])
+		if err != nil || requestID < 1 || requestID > int64(len(attempts)) {
+			continue
+		}
+
+		accepted := attempts[requestID-1]
+		detection := &domain.Detection{
+			Protocol: "SNMP",
+			Evidence: domain.EvidenceHandshake,
+			Version:  accepted.version,
+			Info: []string{
+				"community: " + accepted.community,
+				"sysDescr: " + descr,
+			},
+		}
+		severity := domain.SeverityMedium
+		if accepted.community == "public" || accepted.community == "private" {
+			severity = domain.SeverityHigh
+		}
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "snmp-community",
+			Severity: severity,
+			Detail:   fmt.Sprintf("community '%s' is accepted over SNMP %s", accepted.community, accepted.version),
+		})
+		return detection, nil
+	}
+}
+
+func buildSNMPGet(version int64, community string, requestID int64) []byte {
+	varbind := berTLV(berSequence,
+		berTLV(berOID, []byte(snmpSysDescr)),
+		berTLV(berNull),
+	)
+	pdu := berTLV(0xa0,
+		berInt(berInteger, requestID),
+		berInt(berInteger, 0),
+		berInt(berInteger, 0),
+		berTLV(berSequence, varbind),
+	)
+	return berTLV(berSequence,
+		berInt(berInteger, version),
+		berString(berOctetString, community),
+		pdu,
+	)
+}
+
+func parseSNMPResponse(message []byte) (int64, string, error) {
+	_, content, _, err := berRead(message)
+	if err != nil {
+		return 0, "", err
+	}
+	_, _, rest, err := berRead(content)
+	if err != nil {
+		return 0, "", err
+	}
+	_, _, rest, err = berRead(rest)
+	if err != nil {
+		return 0, "", err
+	}
+	tag, pdu, _, err := berRead(rest)
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != 0xa2 {
+		return 0, "", fmt.Errorf("not an snmp get-response")
+	}
+
+	_, id, rest, err := berRead(pdu)
+	if err != nil {
+		return 0, "", err
+	}
+	_, status, rest, err := berRead(rest)
+	if err != nil {
+		return 0, "", err
+	}
+	if berReadInt(status) != 0 {
+		return berReadInt(id), "", nil
+	}
+	_, _, rest, err = berRead(rest)
+	if err != nil {
+		return 0, "", err
+	}
+	_, varbinds, _, err := berRead(rest)
+	if err != nil {
+		return 0, "", err
+	}
+	_, varbind, _, err := berRead(varbinds)
+	if err != nil {
+		return 0, "", err
+	}
+	_, _, value, err := berRead(varbind)
+	if err != nil {
+		return 0, "", err
+	}
+	_, descr, _, err := berRead(value)
+	if err != nil {
+		return 0, "", err
+	}
+	return berReadInt(id), strings.TrimSpace(string(descr)), nil
+}
+
+// Чтение файла, которого на сервере быть не должно
+func buildTFTPRead() []byte {
+	request := []byte{0x00, 0x01}
+	return append(request, "portscan-probe.txt\x00octet\x00"...)
+}
+
+func detectTFTP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	// Сервер отвечает с другого порта, поэтому сокет не привязывается к адресу
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(cfg.Timeout))
+
+	_, err = conn.WriteTo(buildTFTPRead(), &net.UDPAddr{IP: targetIP, Port: port})
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := make([]byte, 1024)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return nil, err
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok || !udpAddr.IP.Equal(targetIP) || n < 4 {
+			continue
+		}
+
+		switch binary.BigEndian.Uint16(buffer[0:2]) {
+		case 3:
+			return &domain.Detection{
+				Protocol: "TFTP",
+				Evidence: domain.EvidenceHandshake,
+				Findings: []domain.Finding{{
+					Check:    "tftp-read",
+					Severity: domain.SeverityHigh,
+					Detail:   "server returned data for an arbitrary file name",
+				}},
+			}, nil
+		case 5:
+			code := binary.BigEndian.Uint16(buffer[2:4])
+			message := strings.TrimRight(string(buffer[4:n]), "\x00")
+			return &domain.Detection{
+				Protocol: "TFTP",
+				Evidence: domain.EvidenceHandshake,
+				Info:     []string{fmt.Sprintf("error %d: %s", code, message)},
+			}, nil
+		}
+		return nil, fmt.Errorf("not a tftp response")
+	}
+}
+
+// Благодаря rport сервер отвечает на адрес и порт отправителя, даже если в Via указан другой
+func buildSIPOptions(targetIP net.IP, port int, host string, localPort int) []byte {
+	random := make([]byte, 8)
+	rand.Read(random)
+	tag := hex.EncodeToString(random)
+	target := net.JoinHostPort(targetIP.String(), strconv.Itoa(port))
+	source := net.JoinHostPort(host, strconv.Itoa(localPort))
+
+	return []byte(strings.Join([]string{
+		fmt.Sprintf("OPTIONS sip:portscan@%s SIP/2.0", target),
+		fmt.Sprintf("Via: SIP/2.0/UDP %s;branch=z9hG4bK%s;rport", source, tag),
+		"Max-Forwards: 70",
+		fmt.Sprintf("From: <sip:portscan@%s>;tag=%s", host, tag[:8]),
+		fmt.Sprintf("To: <sip:portscan@%s>", target),
+		fmt.Sprintf("Call-ID: %s@%s", tag, host),
+		"CSeq: 1 OPTIONS",
+		fmt.Sprintf("Contact: <sip:portscan@%s>", source),
+		"Accept: application/sdp",
+		"Content-Length: 0",
+		"", "",
+	}, "\r\n"))
+}
+
+func detectSIP(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	conn, err := dialProbe("udp", targetIP, port, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	local := conn.LocalAddr().(*net.UDPAddr)
+	_, err = conn.Write(buildSIPOptions(targetIP, port, local.IP.String(), local.Port))
+	if err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, 4096)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(string(buffer[:n]), "\r\n")
+	if !strings.HasPrefix(lines[0], "SIP/2.0 ") {
+		return nil, fmt.Errorf("not a sip response")
+	}
+
+	detection := &domain.Detection{
+		Protocol: "SIP",
+		Evidence: domain.EvidenceHandshake,
+		Info:     []string{"status: " + strings.TrimPrefix(lines[0], "SIP/2.0 ")},
+	}
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "user-agent", "server":
+			detection.Product = value
+		case "allow":
+			detection.Info = append(detection.Info, "allow: "+value)
+		}
+	}
+	return detection, nil
+}
+
+func detectIKE(targetIP net.IP, port int, cfg *domain.ScannerConfig) (*domain.Detection, error) {
+	detection := &domain.Detection{Protocol: "IKE", Evidence: domain.EvidenceHandshake}
+	versions := make([]string, 0)
+
+	response, err := exchangeIKE(targetIP, port, cfg.Timeout, buildIKEv2SAInit())
+	if err == nil && response[17] == 0x20 {
+		versions = append(versions, "IKEv2")
+	}
+
+	response, err = exchangeIKE(targetIP, port, cfg.Timeout, buildIKEv1MainMode())
+	if err == nil && response[17] == 0x10 {
+		versions = append(versions, "IKEv1")
+		detection.Info = append(detection.Info, ikeVendors(response)...)
+		detection.Findings = append(detection.Findings, domain.Finding{
+			Check:    "ike-v1-enabled",
+			Severity: domain.SeverityLow,
+			Detail:   "server responds to deprecated IKEv1 main mode",
+		})
+	}
+
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("not an ike responder")
+	}
+	detection.Version = strings.Join(versions, ",")
+	return detection, nil
+}
+
+// На порту NAT-T перед IKE-сообщением передаётся маркер из четырёх нулей
+func exchangeIKE(targetIP net.IP, port int, timeout time.Duration, message []byte) ([]byte, error) {
+	spi := message[0:8]
+	natT := port == ikeNATTPort
+	if natT {
+		message = withNonESPMarker(message)
+	}
+	response, err := exchangeUDP(targetIP, port, timeout, message)
+	if err != nil {
+		return nil, err
+	}
+	if natT {
+		if len(response) < 4 || !bytes.Equal(response[0:4], []byte{0, 0, 0, 0}) {
+			return nil, fmt.Errorf("missing non-esp marker")
+		}
+		response = response[4:]
+	}
+	if len(response) < 28 || !bytes.Equal(response[0:8], spi) {
+		return nil, fmt.Errorf("not an ike response")
+	}
+	return response, nil
+}
+
+func withNonESPMarker(message []byte) []byte {
+	return append([]byte{0, 0, 0, 0}, message...)
+}
+
+func ikeHeader(nextPayload, version, exchange, flags byte) []byte {
+	header := make([]byte, 28)
+	rand.Read(header[0:8])
+	header[16] = nextPayload
+	header[17] = version
+	header[18] = exchange
+	header[19] = flags
+	return header
+}
+
+func ikePayload(next byte, body []byte) []byte {
+	payload := []byte{next, 0x00}
+	payload = binary.BigEndian.AppendUint16(payload, uint16(4+len(body)))
+	return append(payload, body...)
+}
+
+func finishIKEMessage(message []byte) []byte {
+	binary.BigEndian.PutUint32(message[24:28], uint32(len(message)))
+	return message
+}
+
+func buildIKEv2SAInit() []byte {
+	transform := func(last bool, kind byte, id uint16, attributes ...byte) []byte {
+		next := byte(3)
+		if last {
+			next = 0
+		}
+		body := []byte{kind, 0x00}
+		body = binary.BigEndian.AppendUint16(body, id)
+		body = append(body, attributes...)
+		return ikePayload(next, append([]byte{}, body...))
+	}
+	transforms := make([]byte, 0)
+	// AES-CBC-256, PRF-HMAC-SHA256, HMAC-SHA256-128, MODP-2048
+	transforms = append(transforms, transform(false, 1, 12, 0x80, 0x0e, 0x01, 0x00)...)
+	transforms = append(transforms, transform(false, 2, 5)...)
+	transforms = append(transforms, transform(false, 3, 12)...)
+	transforms = append(transforms, transform(true, 4, 14)...)
+
+	proposal := ikePayload(0, append([]byte{1, 1, 0, 4}, transforms...))
+
+	publicKey, _ := dhPublicKey(sshGroup14Prime)
+	ke := make([]byte, 4, 4+256)
+	binary.BigEndian.PutUint16(ke[0:2], 14)
+	ke = append(ke, make([]byte, 256-len(publicKey))...)
+	ke = append(ke, publicKey...)
+
+	nonce := make([]byte, 32)
+	rand.Read(nonce)
+
+	message := ikeHeader(33, 0x20, 34, 0x08)
+	message = append(message, ikePayload(34, proposal)...)
+	message = append(message, ikePayload(40, ke)...)
+	message = append(message, ikePayload(0, nonce)...)
+	return finishIKEMessage(message)
+}
+
+func buildIKEv1MainMode() []byte {
+	// AES-CBC-256, SHA1, PSK, MODP-1024, время жизни 28800 секунд
+	attributes := []byte{
+		0x80, 0x01, 0x00, 0x07,
+		0x80, 0x0e, 0x01, 0x00,
+		0x80, 0x02, 0x00, 0x02,
+		0x80, 0x03, 0x00, 0x01,
+		0x80, 0x04, 0x00, 0x02,
+		0x80, 0x0b, 0x00, 0x01,
+		0x80, 0x0c, 0x70, 0x80,
+	}
+	transform := ikePayload(0, append([]byte{1, 1, 0, 0}, attributes...))
+	proposal := ikePayload(0, append([]byte{1, 1, 0, 1}, transform...))
+	sa := ikePayload(0, append([]byte{0, 0, 0, 1, 0, 0, 0, 1}, proposal...))
+
+	message := ikeHeader(1, 0x10, 2, 0x00)
+	message = append(message, sa...)
+	return finishIKEMessage(message)
+}
+
+func ikeVendors(message []byte) []string {
+	vendors := make([]string, 0)
+	next := message[16]
+	pos := 28
+	for next != 0 && pos+4 <= len(message) {
+		length := int(binary.BigEndian.Uint16(message[pos+2 : pos+4]))
+		if length < 4 || pos+length > len(message) {
+			break
+		}
+		if next == 13 {
+			id := hex.EncodeToString(message[pos+4 : pos+length])
+			name := id
+			for prefix, vendor := range ikeVendorIDs {
+				if strings.HasPrefix(id, prefix) {
+					name = vendor
+					break
+				}
+			}
+			vendors = append(vendors, "vendor id: "+name)
+		}
+		next = message[pos]
+		pos += length
+	}
+	return vendors
+}
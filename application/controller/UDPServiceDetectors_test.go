@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"slices"
+	"testing"
+)
+
+// Ответ SNMP-агента на get sysDescr.0
+func snmpResponse(version int64, community string, requestID int64, status int64, descr string) []byte {
+	varbind := berTLV(berSequence, berTLV(berOID, []byte(snmpSysDescr)), berString(berOctetString, descr))
+	return berTLV(berSequence,
+		berInt(berInteger, version),
+		berString(berOctetString, community),
+		berTLV(0xa2,
+			berInt(berInteger, requestID),
+			berInt(berInteger, status),
+			berInt(berInteger, 0),
+			berTLV(berSequence, varbind),
+		),
+	)
+}
+
+func TestParseSNMPResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		message []byte
+		id      int64
+		descr   string
+		ok      bool
+	}{
+		{"sysDescr", snmpResponse(1, "public", 2, 0, "Linux gw 6.1.0-18-amd64 #1 SMP x86_64\n"), 2, "Linux gw 6.1.0-18-amd64 #1 SMP x86_64", true},
+		{"noSuchName", snmpResponse(0, "private", 3, 2, ""), 3, "", true},
+		{"get request", buildSNMPGet(1, "public", 1), 0, "", false},
+		{"truncated", snmpResponse(1, "public", 2, 0, "Linux")[:20], 0, "", false},
+		{"not ber", []byte("HTTP/1.0 400 Bad Request\r\n"), 0, "", false},
+	}
+	for _, test := range tests {
+		id, descr, err := parseSNMPResponse(test.message)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if id != test.id || descr != test.descr {
+			t.Errorf("%s: got %d %q, want %d %q", test.name, id, descr, test.id, test.descr)
+		}
+	}
+}
+
+// Ответ IKEv1 Main Mode с SA и двумя Vendor ID
+func ikeMainModeResponse(spi []byte) []byte {
+	message := make([]byte, 28)
+	copy(message, spi[0:8])
+	copy(message[8:16], "RESPONDR")
+	message[16], message[17], message[18] = 1, 0x10, 2
+	message = append(message, ikePayload(13, []byte{0, 0, 0, 1, 0, 0, 0, 1})...)
+	message = append(message, ikePayload(13, []byte{0xaf, 0xca, 0xd7, 0x13, 0x68, 0xa1, 0xf1, 0xc9, 0x6b, 0x86, 0x96, 0xfc, 0x77, 0x57, 0x01, 0x00})...)
+	message = append(message, ikePayload(0, []byte{0xde, 0xad, 0xbe, 0xef})...)
+	return finishIKEMessage(message)
+}
+
+func TestIKEVendors(t *testing.T) {
+	response := ikeMainModeResponse(make([]byte, 8))
+	want := []string{"vendor id: Dead Peer Detection", "vendor id: deadbeef"}
+	if got := ikeVendors(response); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// Длина последнего payload выходит за конец сообщения
+	if got := ikeVendors(response[:len(response)-2]); len(got) != 1 {
+		t.Errorf("truncated: got %q", got)
+	}
+}
+
+func TestUDPProbesPerPort(t *testing.T) {
+	cfg := testConfig()
+	cfg.Ip = net.IPv4(127, 0, 0, 1)
+	cfg.SnmpCommunities = []string{"public", "secret"}
+
+	tests := []struct {
+		name  string
+		port  int
+		reply func(request []byte) []byte
+	}{
+		{"ntp", ntpPort, func(request []byte) []byte {
+			if len(request) != 48 || request[0] != 0x23 {
+				return nil
+			}
+			response := make([]byte, 48)
+			response[0], response[1] = 0x24, 2
+			return response
+		}},
+		{"snmp", snmpPort, func(request []byte) []byte {
+			// Агент с единственным community secret
+			_, content, _, err := berRead(request)
+			if err != nil {
+				return nil
+			}
+			_, _, rest, _ := berRead(content)
+			if _, community, _, err := berRead(rest); err != nil || string(community) != "secret" {
+				return nil
+			}
+			return snmpResponse(1, "secret", 2, 0, "RouterOS CCR2004")
+		}},
+		{"sip", sipPort, func(request []byte) []byte {
+			if !bytes.HasPrefix(request, []byte("OPTIONS sip:")) {
+				return nil
+			}
+			return []byte("SIP/2.0 200 OK\r\nServer: Asterisk PBX 20.5.0\r\nContent-Length: 0\r\n\r\n")
+		}},
+		{"ike", ikePort, func(request []byte) []byte {
+			if len(request) < 28 || request[17] != 0x10 {
+				return nil
+			}
+			return ikeMainModeResponse(request)
+		}},
+		{"ike nat-t", ikeNATTPort, func(request []byte) []byte {
+			if len(request) < 32 || binary.BigEndian.Uint32(request) != 0 || request[4+17] != 0x20 {
+				return nil
+			}
+			return withNonESPMarker(make([]byte, 28))
+		}},
+	}
+	for _, test := range tests {
+		ip, port := serveUDP(t, test.reply)
+		if open, err := scanUDP(ip, port, cfg.Timeout, udpProbes(test.port, cfg)); !open {
+			t.Errorf("%s: port reported closed: %v", test.name, err)
+		}
+		if open, _ := scanUDP(ip, port, cfg.Timeout/4, udpProbes(test.port+10000, cfg)); open {
+			t.Errorf("%s: server answered without its probe", test.name)
+		}
+	}
+}
+
+func TestScanUDPTFTP(t *testing.T) {
+	// Сервер отвечает ошибкой с нового сокета, как tftpd-hpa
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		buffer := make([]byte, 1500)
+		for {
+			n, addr, err := listener.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(buffer[:n], buildTFTPRead()) {
+				continue
+			}
+			transfer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				return
+			}
+			transfer.WriteToUDP(append([]byte{0, 5, 0, 1}, "File not found\x00"...), addr)
+			transfer.Close()
+		}
+	}()
+	address := listener.LocalAddr().(*net.UDPAddr)
+
+	cfg := testConfig()
+	if open, err := scanUDPAnySourcePort(address.IP, address.Port, cfg.Timeout, udpProbes(tftpPort, cfg)); !open {
+		t.Errorf("tftp reply from another port was dropped: %v", err)
+	}
+	detection, err := detectTFTP(address.IP, address.Port, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(detection.Info, []string{"error 1: File not found"}) {
+		t.Errorf("got %q", detection.Info)
+	}
+}
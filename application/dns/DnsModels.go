@@ -36,7 +36,7 @@ type ResponseData struct {
 var Classes = map[uint16]string{
 	1: "IN",
 	2: "CS",
-	3: "NCHS",
+	3: "CH",
 	4: "HS",
 }
 
@@ -46,6 +46,26 @@ var Types = map[uint16]string{
 	2: "NS",
 	5: "CNAME",
 	15: "MX",
+	12: "PTR",
+	16: "TXT",
+	33: "SRV",
+	6: "SOA",
+	13: "HINFO",
+	41: "OPT",
+	257: "CAA",
+	48: "DNSKEY",
+	252: "AXFR",
+	255: "ANY",
+}
+
+type SOA struct {
+	MName   string
+	RName   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
 }
 
 type Address struct {
@@ -56,6 +76,7 @@ type Address struct {
 type Request struct {
 	Header Header
 	Question Question
+	EDNS *EDNS
 }
 
 type Response struct {
@@ -64,6 +85,10 @@ type Response struct {
 	Answers []*ResponseData
 	Authorities []*ResponseData
 	Additionals []*ResponseData
+	// Разобранная запись OPT из дополнительной секции, если сервер её прислал
+	EDNS *EDNS
+	// Размер сообщения в байтах, как оно пришло по сети
+	Size int
 }
 
 
@@ -0,0 +1,135 @@
+package dns
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	TypeA      uint16 = 1
+	TypeNS     uint16 = 2
+	TypeCNAME  uint16 = 5
+	TypeSOA    uint16 = 6
+	TypePTR    uint16 = 12
+	TypeHINFO  uint16 = 13
+	TypeMX     uint16 = 15
+	TypeTXT    uint16 = 16
+	TypeAAAA   uint16 = 28
+	TypeSRV    uint16 = 33
+	TypeOPT    uint16 = 41
+	TypeDNSKEY uint16 = 48
+	TypeAXFR   uint16 = 252
+	TypeANY    uint16 = 255
+	TypeCAA    uint16 = 257
+
+	ClassIN    uint16 = 1
+	ClassCHAOS uint16 = 3
+
+	// Старший бит класса в вопросе mDNS просит ответить напрямую, а не в группу (RFC 6762)
+	ClassUnicastResponse uint16 = 0x8000
+
+	// Размер UDP-ответа, при котором не бывает фрагментации (DNS Flag Day 2020)
+	DefaultUDPSize uint16 = 1232
+)
+
+type EDNSOption struct {
+	Code uint16
+	Data []byte
+}
+
+// Псевдозапись OPT из RFC 6891
+type EDNS struct {
+	UDPSize uint16
+	// Старшие биты кода ответа и версия EDNS
+	ExtendedRCode uint8
+	Version       uint8
+	// Просит прислать подписи DNSSEC
+	DO      bool
+	Options []EDNSOption
+}
+
+// Создаёт запрос с одним вопросом, случайным ID и флагом рекурсии
+func NewQuery(name string, qtype uint16, class uint16) (*Request, error) {
+	qname, err := NameToRecord(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{
+		Header: Header{
+			ID:      NewID(),
+			RD:      1,
+			QDCount: 1,
+		},
+		Question: Question{
+			QName:  qname,
+			QType:  qtype,
+			QClass: class,
+		},
+	}, nil
+}
+
+// Случайный ID затрудняет подделку ответов
+func NewID() uint16 {
+	id := make([]byte, 2)
+	rand.Read(id)
+	return binary.BigEndian.Uint16(id)
+}
+
+// Добавляет к запросу запись OPT с размером UDP-ответа и опциями
+func (r *Request) WithEDNS(udpSize uint16, options ...EDNSOption) *Request {
+	r.EDNS = &EDNS{UDPSize: udpSize, Options: options}
+	return r
+}
+
+func (e *EDNS) encode() []byte {
+	var rdata []byte
+	for _, option := range e.Options {
+		rdata = append(rdata, uint16ToBytes(option.Code)...)
+		rdata = append(rdata, uint16ToBytes(uint16(len(option.Data)))...)
+		rdata = append(rdata, option.Data...)
+	}
+
+	// Корневое имя, тип OPT, в классе размер UDP, в TTL расширенный код ответа, версия и флаги
+	record := []byte{0}
+	record = append(record, uint16ToBytes(TypeOPT)...)
+	record = append(record, uint16ToBytes(e.UDPSize)...)
+	flags := uint32(e.ExtendedRCode)<<24 | uint32(e.Version)<<16
+	if e.DO {
+		flags |= 1 << 15
+	}
+	record = binary.BigEndian.AppendUint32(record, flags)
+	record = append(record, uint16ToBytes(uint16(len(rdata)))...)
+	return append(record, rdata...)
+}
+
+// Название типа записи или обозначение TYPE<номер> из RFC 3597
+func TypeName(rType uint16) string {
+	if name, ok := Types[rType]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", rType)
+}
+
+// Разбирает запись OPT: размер UDP передаётся в классе, а флаги — в TTL
+func ParseEDNS(record *ResponseData) *EDNS {
+	edns := &EDNS{
+		UDPSize:       record.Class,
+		ExtendedRCode: uint8(record.TTL >> 24),
+		Version:       uint8(record.TTL >> 16),
+		DO:            record.TTL&(1<<15) != 0,
+	}
+	data := record.Data
+	for len(data) >= 4 {
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if 4+length > len(data) {
+			break
+		}
+		edns.Options = append(edns.Options, EDNSOption{
+			Code: binary.BigEndian.Uint16(data[0:2]),
+			Data: data[4 : 4+length],
+		})
+		data = data[4+length:]
+	}
+	return edns
+}
@@ -0,0 +1,89 @@
+package dns
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Имя в wire-формате для заведомо допустимых имён из тестов
+func mustName(name string) []byte {
+	record, err := NameToRecord(name)
+	if err != nil {
+		panic(err)
+	}
+	return record
+}
+
+func mustQuery(name string, qtype uint16, class uint16) *Request {
+	request, err := NewQuery(name, qtype, class)
+	if err != nil {
+		panic(err)
+	}
+	return request
+}
+
+func TestNewQueryNameLimits(t *testing.T) {
+	label := strings.Repeat("a", 63)
+	longest := strings.Join([]string{label, label, label, strings.Repeat("b", 61)}, ".")
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"example.com", true},
+		{"example.com.", true},
+		{".", true},
+		{label + ".example.com", true},
+		{label + "a.example.com", false},
+		// 253 символа дают ровно 255 байт в wire-формате
+		{longest, true},
+		{longest + "b", false},
+		{longest + ".", true},
+	}
+	for _, test := range tests {
+		request, err := NewQuery(test.name, TypeA, ClassIN)
+		if (err == nil) != test.ok {
+			t.Errorf("%d bytes: got error %v", len(test.name), err)
+			continue
+		}
+		if test.ok && RecordToName(request.Question.QName) != strings.Trim(test.name, ".") {
+			t.Errorf("%d bytes: got %q", len(test.name), RecordToName(request.Question.QName))
+		}
+	}
+}
+
+func TestParseRequestEDNS(t *testing.T) {
+	query := mustQuery("example.com", TypeA, ClassIN).WithEDNS(DefaultUDPSize, EDNSOption{Code: 10, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}})
+	query.EDNS.DO = true
+	raw := query.Encode()
+
+	request, err := ParseRequest(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.EDNS == nil || request.EDNS.UDPSize != DefaultUDPSize || !request.EDNS.DO || len(request.EDNS.Options) != 1 {
+		t.Fatalf("got edns %+v", request.EDNS)
+	}
+	if request.Header.ARCount != 0 {
+		t.Errorf("ARCount %d is left for the parsed OPT", request.Header.ARCount)
+	}
+	if encoded := request.Encode(); !bytes.Equal(encoded, raw) {
+		t.Errorf("re-encoded request differs:\n%x\n%x", encoded, raw)
+	}
+
+	// Записи, которые запрос хранить не умеет, отбрасываются вместе со счётчиком
+	signed := append([]byte{}, raw...)
+	signed[11]++
+	signed = append(signed, 0, 0, 250, 0, 255, 0, 0, 0, 0, 0, 2, 0xab, 0xcd)
+	request, err = ParseRequest(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded := request.Encode(); !bytes.Equal(encoded, raw) {
+		t.Errorf("re-encoded request differs:\n%x\n%x", encoded, raw)
+	}
+
+	if _, err := ParseRequest(raw[:len(raw)-3]); err == nil {
+		t.Error("truncated OPT record accepted")
+	}
+}
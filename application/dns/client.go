@@ -0,0 +1,210 @@
+package dns
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	Port = "53"
+
+	resolvConfPath = "/etc/resolv.conf"
+)
+
+type Client struct {
+	// Адрес сервера в виде host:port
+	Server  string
+	Timeout time.Duration
+}
+
+func NewClient(server string, timeout time.Duration) *Client {
+	return &Client{Server: ServerAddress(server), Timeout: timeout}
+}
+
+// Добавляет к адресу сервера стандартный порт, если он не указан
+func ServerAddress(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), Port)
+}
+
+// Первый сервер из /etc/resolv.conf, а без него — локальный резолвер
+func DefaultServer() string {
+	servers, err := ReadResolvConf(resolvConfPath)
+	if err != nil || len(servers) == 0 {
+		return net.JoinHostPort("127.0.0.1", Port)
+	}
+	return ServerAddress(servers[0])
+}
+
+func ReadResolvConf(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	servers := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		// Зона IPv6 (fe80::1%eth0) в адресе сервера не нужна для разбора
+		if ip := net.ParseIP(strings.Split(fields[1], "%")[0]); ip != nil {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers, scanner.Err()
+}
+
+// Отправляет запрос по UDP, а если ответ обрезан (TC), повторяет его по TCP
+func (c *Client) Exchange(request *Request) (*Response, error) {
+	response, err := c.ExchangeOver("udp", request)
+	if err != nil || response.Header.TC == 0 {
+		return response, err
+	}
+	return c.ExchangeOver("tcp", request)
+}
+
+func (c *Client) ExchangeOver(network string, request *Request) (*Response, error) {
+	conn, err := net.DialTimeout(network, c.Server, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+
+	if network == "tcp" {
+		err = WriteTCPMessage(conn, request.Encode())
+	} else {
+		_, err = conn.Write(request.Encode())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var raw []byte
+		if network == "tcp" {
+			raw, err = ReadTCPMessage(conn)
+		} else {
+			buffer := make([]byte, 65535)
+			var n int
+			n, err = conn.Read(buffer)
+			raw = buffer[:n]
+		}
+		if err != nil {
+			return nil, err
+		}
+		response, err := ParseResponse(raw)
+		// Чужие и повреждённые датаграммы пропускаем, пока не истечёт таймаут
+		if err != nil || response.Header.ID != request.Header.ID || response.Header.QR != 1 {
+			if network == "tcp" {
+				return nil, fmt.Errorf("unexpected response from %s", c.Server)
+			}
+			continue
+		}
+		return response, nil
+	}
+}
+
+// Имена хоста из PTR-записей его обратной зоны
+func (c *Client) LookupPTR(ip net.IP) ([]string, error) {
+	query, err := NewQuery(ReverseName(ip), TypePTR, ClassIN)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.Exchange(query)
+	if err != nil {
+		return nil, err
+	}
+	if rcode := response.RCode(); rcode != 0 {
+		return nil, fmt.Errorf("ptr lookup failed: %s", RCodeName(rcode))
+	}
+	names := make([]string, 0)
+	for _, answer := range response.Answers {
+		if answer.Type == TypePTR {
+			names = append(names, answer.RDataString())
+		}
+	}
+	return names, nil
+}
+
+// Адреса имени из записей запрошенных типов (A и AAAA), в том числе полученные через CNAME.
+// При ошибке возвращаются и адреса, найденные до неё
+func (c *Client) LookupIP(name string, qtypes ...uint16) ([]net.IP, error) {
+	addresses := make([]net.IP, 0)
+	for _, qtype := range qtypes {
+		query, err := NewQuery(name, qtype, ClassIN)
+		if err != nil {
+			return addresses, err
+		}
+		response, err := c.Exchange(query)
+		if err != nil {
+			return addresses, err
+		}
+		// Несуществующее имя — это пустой результат, а не ошибка
+		if rcode := response.RCode(); rcode == 3 {
+			return addresses, nil
+		} else if rcode != 0 {
+			return addresses, fmt.Errorf("lookup %s failed: %s", name, RCodeName(rcode))
+		}
+		for _, answer := range response.Answers {
+			if answer.Type == qtype && (len(answer.Data) == net.IPv4len || len(answer.Data) == net.IPv6len) {
+				addresses = append(addresses, net.IP(answer.Data))
+			}
+		}
+	}
+	return addresses, nil
+}
+
+// Имя в in-addr.arpa или ip6.arpa для обратного запроса
+func ReverseName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return ""
+	}
+	const digits = "0123456789abcdef"
+	var b strings.Builder
+	for i := len(ip16) - 1; i >= 0; i-- {
+		b.WriteByte(digits[ip16[i]&0xf])
+		b.WriteByte('.')
+		b.WriteByte(digits[ip16[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa")
+	return b.String()
+}
+
+// По TCP каждое сообщение предваряется двухбайтовой длиной (RFC 1035, 4.2.2)
+func WriteTCPMessage(w io.Writer, message []byte) error {
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(message)))
+	_, err := w.Write(append(framed, message...))
+	return err
+}
+
+func ReadTCPMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+	message := make([]byte, binary.BigEndian.Uint16(header))
+	_, err = io.ReadFull(r, message)
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
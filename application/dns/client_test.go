@@ -0,0 +1,48 @@
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadResolvConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	conf := `# Generated by NetworkManager
+; old style comment
+search example.com
+#nameserver 10.0.0.1
+nameserver 192.0.2.53
+  nameserver	198.51.100.53 # secondary
+nameserver 2001:db8::53
+nameserver fe80::1%eth0
+nameserver resolver.example.com
+nameserver
+options edns0 trust-ad
+`
+	if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	servers, err := ReadResolvConf(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"192.0.2.53", "198.51.100.53", "2001:db8::53", "fe80::1%eth0"}
+	if !slices.Equal(servers, want) {
+		t.Errorf("got %q, want %q", servers, want)
+	}
+
+	addresses := make([]string, 0, len(servers))
+	for _, server := range servers {
+		addresses = append(addresses, ServerAddress(server))
+	}
+	want = []string{"192.0.2.53:53", "198.51.100.53:53", "[2001:db8::53]:53", "[fe80::1%eth0]:53"}
+	if !slices.Equal(addresses, want) {
+		t.Errorf("got addresses %q, want %q", addresses, want)
+	}
+
+	if _, err := ReadResolvConf(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing file read without error")
+	}
+}
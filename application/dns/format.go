@@ -0,0 +1,388 @@
+package dns
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var Opcodes = map[uint16]string{
+	0: "QUERY",
+	1: "IQUERY",
+	2: "STATUS",
+	4: "NOTIFY",
+	5: "UPDATE",
+}
+
+var RCodes = map[uint16]string{
+	0:  "NOERROR",
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+	16: "BADVERS",
+}
+
+type questionJSON struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Class string `json:"class"`
+}
+
+type recordJSON struct {
+	Name   string         `json:"name"`
+	Type   string         `json:"type"`
+	Class  string         `json:"class"`
+	TTL    uint32         `json:"ttl"`
+	Data   string         `json:"data"`
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+type ednsJSON struct {
+	UDPSize uint16           `json:"udp_size"`
+	Version uint8            `json:"version"`
+	DO      bool             `json:"do"`
+	Options []ednsOptionJSON `json:"options,omitempty"`
+}
+
+type ednsOptionJSON struct {
+	Code uint16 `json:"code"`
+	Data string `json:"data"`
+}
+
+type responseJSON struct {
+	ID         uint16        `json:"id"`
+	Opcode     string        `json:"opcode"`
+	Status     string        `json:"status"`
+	Flags      []string      `json:"flags"`
+	Question   *questionJSON `json:"question,omitempty"`
+	Answer     []recordJSON  `json:"answer"`
+	Authority  []recordJSON  `json:"authority"`
+	Additional []recordJSON  `json:"additional"`
+	EDNS       *ednsJSON     `json:"edns,omitempty"`
+}
+
+// Название класса или обозначение CLASS<номер> из RFC 3597
+func ClassName(class uint16) string {
+	if name, ok := Classes[class]; ok {
+		return name
+	}
+	return fmt.Sprintf("CLASS%d", class)
+}
+
+func OpcodeName(opcode uint16) string {
+	if name, ok := Opcodes[opcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("OPCODE%d", opcode)
+}
+
+func RCodeName(rcode uint16) string {
+	if name, ok := RCodes[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// Полный код ответа: старшие биты приходят в записи OPT (RFC 6891, 6.1.3)
+func (r *Response) RCode() uint16 {
+	rcode := r.Header.RCode
+	if r.EDNS != nil {
+		rcode |= uint16(r.EDNS.ExtendedRCode) << 4
+	}
+	return rcode
+}
+
+// Флаги заголовка в том виде, как их показывает dig
+func (h Header) Flags() []string {
+	flags := make([]string, 0)
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{"qr", h.QR == 1},
+		{"aa", h.AA == 1},
+		{"tc", h.TC == 1},
+		{"rd", h.RD == 1},
+		{"ra", h.RA == 1},
+		// Z хранит три бита: зарезервированный, AD и CD
+		{"ad", h.Z&2 != 0},
+		{"cd", h.Z&1 != 0},
+	} {
+		if flag.set {
+			flags = append(flags, flag.name)
+		}
+	}
+	return flags
+}
+
+// Данные записи в формате зонного файла
+func (r *ResponseData) RDataString() string {
+	data := r.Data
+	switch Types[r.Type] {
+	case "A":
+		if len(data) == 4 {
+			return net.IP(data).String()
+		}
+	case "AAAA":
+		if len(data) == 16 {
+			return net.IP(data).String()
+		}
+	case "NS", "CNAME", "PTR":
+		return formatName(data)
+	case "MX":
+		if len(data) >= 2 {
+			return fmt.Sprintf("%d %s", binary.BigEndian.Uint16(data[:2]), formatName(data[2:]))
+		}
+	case "SRV":
+		if len(data) >= 6 {
+			return fmt.Sprintf("%d %d %d %s", binary.BigEndian.Uint16(data[0:2]), binary.BigEndian.Uint16(data[2:4]),
+				binary.BigEndian.Uint16(data[4:6]), formatName(data[6:]))
+		}
+	case "SOA":
+		mname, rest := splitName(data)
+		rname, _ := splitName(rest)
+		soa := ParseSoaRecord(data)
+		return fmt.Sprintf("%s %s %d %d %d %d %d", formatName(mname), formatName(rname),
+			soa.Serial, soa.Refresh, soa.Retry, soa.Expire, soa.Minimum)
+	case "TXT", "HINFO":
+		strs := ParseTxtRecord(data)
+		quoted := make([]string, 0, len(strs))
+		for _, str := range strs {
+			quoted = append(quoted, quoteString(str))
+		}
+		return strings.Join(quoted, " ")
+	case "CAA":
+		flags, tag, value := ParseCaaRecord(data)
+		if tag != "" {
+			return fmt.Sprintf("%d %s %s", flags, tag, quoteString(value))
+		}
+	}
+	// Неизвестные и повреждённые данные выводятся в общем виде из RFC 3597
+	if len(data) == 0 {
+		return `\# 0`
+	}
+	return fmt.Sprintf(`\# %d %s`, len(data), hex.EncodeToString(data))
+}
+
+// Строка зонного файла: имя, TTL, класс, тип и данные
+func (r *ResponseData) ZoneString() string {
+	return fmt.Sprintf("%s\t%d\t%s\t%s\t%s", formatName(r.Name), r.TTL, ClassName(r.Class), TypeName(r.Type), r.RDataString())
+}
+
+// Ответ целиком в формате вывода dig
+func (r *Response) DigString() string {
+	var b strings.Builder
+	h := r.Header
+	fmt.Fprintf(&b, ";; ->>HEADER<<- opcode: %s, status: %s, id: %d\n", OpcodeName(h.OPCode), RCodeName(r.RCode()), h.ID)
+	additionals := r.records(r.Additionals)
+	fmt.Fprintf(&b, ";; flags: %s; QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n",
+		strings.Join(h.Flags(), " "), h.QDCount, len(r.Answers), len(r.Authorities), len(r.Additionals))
+
+	if r.EDNS != nil {
+		flags := ""
+		if r.EDNS.DO {
+			flags = " do"
+		}
+		fmt.Fprintf(&b, "\n;; OPT PSEUDOSECTION:\n; EDNS: version: %d, flags:%s; udp: %d\n", r.EDNS.Version, flags, r.EDNS.UDPSize)
+	}
+	if h.QDCount > 0 {
+		q := r.Question
+		fmt.Fprintf(&b, "\n;; QUESTION SECTION:\n;%s\t\t%s\t%s\n", formatName(q.QName), ClassName(q.QClass), TypeName(q.QType))
+	}
+
+	for _, section := range []struct {
+		name    string
+		records []*ResponseData
+	}{
+		{"ANSWER", r.Answers},
+		{"AUTHORITY", r.Authorities},
+		{"ADDITIONAL", additionals},
+	} {
+		if len(section.records) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n;; %s SECTION:\n", section.name)
+		for _, record := range section.records {
+			b.WriteString(record.ZoneString())
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// Запись OPT выводится отдельно, а не среди дополнительных записей
+func (r *Response) records(records []*ResponseData) []*ResponseData {
+	filtered := make([]*ResponseData, 0, len(records))
+	for _, record := range records {
+		if record.Type != TypeOPT {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+func (r ResponseData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.view())
+}
+
+func (r *ResponseData) view() recordJSON {
+	view := recordJSON{
+		Name:  formatName(r.Name),
+		Type:  TypeName(r.Type),
+		Class: ClassName(r.Class),
+		TTL:   r.TTL,
+		Data:  r.RDataString(),
+	}
+
+	data := r.Data
+	switch Types[r.Type] {
+	case "A", "AAAA":
+		if len(data) == 4 || len(data) == 16 {
+			view.Fields = map[string]any{"address": net.IP(data).String()}
+		}
+	case "NS", "CNAME", "PTR":
+		view.Fields = map[string]any{"target": formatName(data)}
+	case "MX":
+		if len(data) >= 2 {
+			view.Fields = map[string]any{
+				"preference": binary.BigEndian.Uint16(data[:2]),
+				"exchange":   formatName(data[2:]),
+			}
+		}
+	case "SRV":
+		if len(data) >= 6 {
+			view.Fields = map[string]any{
+				"priority": binary.BigEndian.Uint16(data[0:2]),
+				"weight":   binary.BigEndian.Uint16(data[2:4]),
+				"port":     binary.BigEndian.Uint16(data[4:6]),
+				"target":   formatName(data[6:]),
+			}
+		}
+	case "SOA":
+		mname, rest := splitName(data)
+		rname, _ := splitName(rest)
+		soa := ParseSoaRecord(data)
+		view.Fields = map[string]any{
+			"mname":   formatName(mname),
+			"rname":   formatName(rname),
+			"serial":  soa.Serial,
+			"refresh": soa.Refresh,
+			"retry":   soa.Retry,
+			"expire":  soa.Expire,
+			"minimum": soa.Minimum,
+		}
+	case "TXT":
+		view.Fields = map[string]any{"strings": ParseTxtRecord(data)}
+	case "HINFO":
+		cpu, os := ParseHinfoRecord(data)
+		view.Fields = map[string]any{"cpu": cpu, "os": os}
+	case "CAA":
+		flags, tag, value := ParseCaaRecord(data)
+		view.Fields = map[string]any{"flags": flags, "tag": tag, "value": value}
+	case "OPT":
+		// Класс записи OPT — это размер UDP-ответа, а не класс
+		view.Class = strconv.Itoa(int(r.Class))
+	default:
+		view.Fields = map[string]any{"rdata": hex.EncodeToString(data)}
+	}
+	return view
+}
+
+func (r Response) MarshalJSON() ([]byte, error) {
+	h := r.Header
+	view := responseJSON{
+		ID:         h.ID,
+		Opcode:     OpcodeName(h.OPCode),
+		Status:     RCodeName(r.RCode()),
+		Flags:      h.Flags(),
+		Answer:     recordViews(r.Answers),
+		Authority:  recordViews(r.Authorities),
+		Additional: recordViews(r.records(r.Additionals)),
+	}
+	if h.QDCount > 0 {
+		view.Question = &questionJSON{
+			Name:  formatName(r.Question.QName),
+			Type:  TypeName(r.Question.QType),
+			Class: ClassName(r.Question.QClass),
+		}
+	}
+	if r.EDNS != nil {
+		view.EDNS = &ednsJSON{
+			UDPSize: r.EDNS.UDPSize,
+			Version: r.EDNS.Version,
+			DO:      r.EDNS.DO,
+		}
+		for _, option := range r.EDNS.Options {
+			view.EDNS.Options = append(view.EDNS.Options, ednsOptionJSON{Code: option.Code, Data: hex.EncodeToString(option.Data)})
+		}
+	}
+	return json.Marshal(view)
+}
+
+func recordViews(records []*ResponseData) []recordJSON {
+	views := make([]recordJSON, 0, len(records))
+	for _, record := range records {
+		views = append(views, record.view())
+	}
+	return views
+}
+
+// Полное имя с точкой на конце; точки и служебные символы внутри меток экранируются
+func formatName(record []byte) string {
+	if len(record) == 0 {
+		return "."
+	}
+	var b strings.Builder
+	pos := 0
+	for pos < len(record) {
+		length := int(record[pos])
+		if pos+1+length > len(record) {
+			break
+		}
+		for _, c := range record[pos+1 : pos+1+length] {
+			switch {
+			case c == '.' || c == '\\' || c == '"' || c == ';' || c == '(' || c == ')' || c == '@' || c == '$':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c <= ' ' || c >= 0x7f:
+				fmt.Fprintf(&b, "\\%03d", c)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		b.WriteByte('.')
+		pos += length + 1
+	}
+	return b.String()
+}
+
+// Строка в кавычках, как в записях TXT зонного файла
+func quoteString(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c >= 0x7f:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package dns
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func record(rType uint16, data []byte) *ResponseData {
+	return &ResponseData{Name: mustName("example.com"), Type: rType, Class: ClassIN, TTL: 300, Data: data}
+}
+
+func TestRDataString(t *testing.T) {
+	soa := append(mustName("ns1.example.com"), 0)
+	soa = append(soa, append(mustName("hostmaster.example.com"), 0)...)
+	soa = append(soa, 0, 0, 0, 1, 0, 0, 0x1c, 0x20, 0, 0, 0x0e, 0x10, 0, 0x12, 0x75, 0, 0, 0, 0x01, 0x2c)
+
+	tests := []struct {
+		name   string
+		record *ResponseData
+		want   string
+	}{
+		{"A", record(TypeA, []byte{10, 0, 0, 1}), "10.0.0.1"},
+		{"AAAA", record(TypeAAAA, []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}), "2001:db8::1"},
+		{"CNAME", record(TypeCNAME, mustName("www.example.com")), "www.example.com."},
+		{"MX", record(TypeMX, append([]byte{0, 10}, mustName("mail.example.com")...)), "10 mail.example.com."},
+		{"SRV", record(TypeSRV, append([]byte{0, 1, 0, 5, 0x13, 0xc4}, mustName("sip.example.com")...)), "1 5 5060 sip.example.com."},
+		{"SOA", record(TypeSOA, soa), "ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300"},
+		{"TXT", record(TypeTXT, []byte("\x0bv=spf1 -all\x05a\"b\\c")), `"v=spf1 -all" "a\"b\\c"`},
+		{"HINFO", record(TypeHINFO, []byte("\x03x86\x05Linux")), `"x86" "Linux"`},
+		{"CAA", record(TypeCAA, append([]byte{0, 5}, "issueletsencrypt.org"...)), `0 issue "letsencrypt.org"`},
+		{"unknown", record(99, []byte{0xde, 0xad}), `\# 2 dead`},
+		{"short A", record(TypeA, []byte{1, 2}), `\# 2 0102`},
+		{"root", record(TypeNS, nil), "."},
+		{"escaped label", record(TypePTR, []byte("\x03a.b\x03com")), `a\.b.com.`},
+	}
+	for _, test := range tests {
+		if got := test.record.RDataString(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestZoneString(t *testing.T) {
+	got := record(TypeA, []byte{192, 0, 2, 1}).ZoneString()
+	want := "example.com.\t300\tIN\tA\t192.0.2.1"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestResponseRendering(t *testing.T) {
+	response, err := ParseResponse(sampleResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dig := response.DigString()
+	for _, want := range []string{
+		";; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 4660",
+		";; flags: qr rd ra; QUERY: 1, ANSWER: 1, AUTHORITY: 0, ADDITIONAL: 0",
+		";example.com.\t\tIN\tA",
+		"example.com.\t3600\tIN\tA\t93.184.216.34",
+	} {
+		if !strings.Contains(dig, want) {
+			t.Errorf("dig output does not contain %q:\n%s", want, dig)
+		}
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Status string   `json:"status"`
+		Flags  []string `json:"flags"`
+		Answer []struct {
+			Name   string            `json:"name"`
+			Type   string            `json:"type"`
+			Data   string            `json:"data"`
+			Fields map[string]string `json:"fields"`
+		} `json:"answer"`
+	}
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Status != "NOERROR" || len(decoded.Answer) != 1 {
+		t.Fatalf("unexpected json: %s", data)
+	}
+	answer := decoded.Answer[0]
+	if answer.Name != "example.com." || answer.Type != "A" || answer.Fields["address"] != "93.184.216.34" {
+		t.Errorf("unexpected answer: %s", data)
+	}
+}
+
+func TestEDNSRendering(t *testing.T) {
+	query := mustQuery("example.com", TypeA, ClassIN).WithEDNS(DefaultUDPSize)
+	response, err := ParseResponse(query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(response.DigString(), "; EDNS: version: 0, flags:; udp: 1232") {
+		t.Errorf("missing OPT pseudosection:\n%s", response.DigString())
+	}
+	data, _ := json.Marshal(response)
+	if !strings.Contains(string(data), `"edns":{"udp_size":1232`) || !strings.Contains(string(data), `"additional":[]`) {
+		t.Errorf("unexpected json: %s", data)
+	}
+}
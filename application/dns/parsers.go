@@ -6,6 +6,14 @@ import (
 	"strings"
 )
 
+const (
+	// Максимальные длины имени в wire-формате и метки (RFC 1035, 3.1)
+	maxNameLength  = 255
+	maxLabelLength = 63
+	// Указатель сжатия хранит смещение в 14 битах
+	maxPointerOffset = 0x3fff
+)
+
 func ParseRequest(buf []byte) (*Request, error) {
 	header, err := readHeader(buf)
 	if err != nil {
@@ -17,11 +25,30 @@ func ParseRequest(buf []byte) (*Request, error) {
 	if header.OPCode != 0 {
 		return nil, fmt.Errorf("недопустимый тип запроса: %v", header.OPCode)
 	}
-	question, _ := readQuestion(buf, 12)
+	question, pos, err := readQuestion(buf, 12)
+	if err != nil {
+		return nil, err
+	}
 	request := &Request{
 		Header:   *header,
 		Question: *question,
 	}
+
+	// Запрос хранит только вопрос и запись OPT, поэтому остальные записи
+	// проверяются и отбрасываются, а счётчики обнуляются: Encode посчитает OPT сам
+	for range int(header.ANCount) + int(header.NSCount) + int(header.ARCount) {
+		record, ind, err := readResponseData(buf, pos)
+		if err != nil {
+			return nil, err
+		}
+		pos = ind
+		if record.Type == TypeOPT {
+			request.EDNS = ParseEDNS(record)
+		}
+	}
+	request.Header.ANCount = 0
+	request.Header.NSCount = 0
+	request.Header.ARCount = 0
 	return request, nil
 }
 
@@ -30,54 +57,73 @@ func ParseResponse(buf []byte) (*Response, error) {
 	if err != nil {
 		return nil, err
 	}
-	question, pos := readQuestion(buf, 12)
-
-	parts := [...][]*ResponseData{
-		make([]*ResponseData, header.ANCount),
-		make([]*ResponseData, header.NSCount),
-		make([]*ResponseData, header.ARCount),
+	// В ответах mDNS секция вопросов обычно пуста
+	question, pos := &Question{}, 12
+	for i := range header.QDCount {
+		q, ind, err := readQuestion(buf, pos)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			question = q
+		}
+		pos = ind
 	}
 
-	for i := range parts {
-		n := len(parts[i])
-		parts[i] = parts[i][:0]
-		for range n {
+	// Записи читаются строго по счётчикам заголовка: обрезанная или битая запись
+	// делает ошибочным весь ответ, а не отбрасывается молча
+	counts := [...]uint16{header.ANCount, header.NSCount, header.ARCount}
+	var parts [3][]*ResponseData
+	for i, count := range counts {
+		parts[i] = make([]*ResponseData, 0)
+		for range count {
 			data, ind, err := readResponseData(buf, pos)
 			if err != nil {
-				continue
+				return nil, err
 			}
 			pos = ind
 			parts[i] = append(parts[i], data)
 		}
 	}
 
-	header.ANCount = uint16(len(parts[0]))
-	header.NSCount = uint16(len(parts[1]))
-	header.ARCount = uint16(len(parts[2]))
-
 	response := &Response{
 		Header:      *header,
 		Question:    *question,
 		Answers:     parts[0],
 		Authorities: parts[1],
 		Additionals: parts[2],
+		Size:        len(buf),
+	}
+	for _, record := range response.Additionals {
+		if record.Type == TypeOPT {
+			response.EDNS = ParseEDNS(record)
+		}
 	}
 	return response, nil
 }
 
-func (r *Request) encode() []byte {
+func (r *Request) Encode() []byte {
 	var request []byte
 	names := make(map[string]uint16)
-	request = append(request, r.Header.encode()...)
+	header := r.Header
+	if r.EDNS != nil {
+		header.ARCount++
+	}
+	request = append(request, header.encode()...)
 	request = append(request, r.Question.encode(12, &names)...)
+	if r.EDNS != nil {
+		request = append(request, r.EDNS.encode()...)
+	}
 	return request
 }
 
-func (r *Response) encode() []byte {
+func (r *Response) Encode() []byte {
 	var response []byte
 	names := make(map[string]uint16)
 	response = append(response, r.Header.encode()...)
-	response = append(response, r.Question.encode(len(response), &names)...)
+	if r.Header.QDCount > 0 {
+		response = append(response, r.Question.encode(len(response), &names)...)
+	}
 
 	parts := [...][]*ResponseData{
 		r.Answers,
@@ -135,8 +181,14 @@ func (h *Header) encode() []byte {
 	return header
 }
 
-func readQuestion(buf []byte, start int) (*Question, int) {
-	questionName, ind := readNameRecord(buf, start)
+func readQuestion(buf []byte, start int) (*Question, int, error) {
+	questionName, ind, err := readNameRecord(buf, start)
+	if err != nil {
+		return nil, 0, err
+	}
+	if ind+4 > len(buf) {
+		return nil, 0, fmt.Errorf("вопрос выходит за границы сообщения")
+	}
 
 	questionType := binary.BigEndian.Uint16(buf[ind : ind+2])
 	questionClass := binary.BigEndian.Uint16(buf[ind+2 : ind+4])
@@ -147,7 +199,7 @@ func readQuestion(buf []byte, start int) (*Question, int) {
 		QClass: questionClass,
 	}
 
-	return &q, ind + 4
+	return &q, ind + 4, nil
 }
 
 func (q *Question) encode(start int, namesPtr *map[string]uint16) []byte {
@@ -159,28 +211,50 @@ func (q *Question) encode(start int, namesPtr *map[string]uint16) []byte {
 	return question
 }
 
+// Данные записей неизвестного типа сохраняются как есть, длиной DataLength
 func readResponseData(buf []byte, start int) (*ResponseData, int, error) {
-	name, ind := readNameRecord(buf, start)
-
-	rType := binary.BigEndian.Uint16(buf[ind : ind+2])
-	if _, ok := Types[rType]; !ok {
-		return nil, 0, fmt.Errorf("недопустимый тип записи: %d", rType)
+	name, ind, err := readNameRecord(buf, start)
+	if err != nil {
+		return nil, 0, err
+	}
+	if ind+10 > len(buf) {
+		return nil, 0, fmt.Errorf("запись выходит за границы сообщения")
 	}
 
+	rType := binary.BigEndian.Uint16(buf[ind : ind+2])
 	rClass := binary.BigEndian.Uint16(buf[ind+2 : ind+4])
 	timeToLive := binary.BigEndian.Uint32(buf[ind+4 : ind+8])
 	dataLength := binary.BigEndian.Uint16(buf[ind+8 : ind+10])
-
+	start = ind + 10
+	end := start + int(dataLength)
+	if end > len(buf) {
+		return nil, 0, fmt.Errorf("данные записи выходят за границы сообщения")
+	}
+	// Имена внутри данных могут ссылаться на любое место сообщения,
+	// но сами данные не должны выходить за DataLength
 	var data []byte
 	switch Types[rType] {
 	case "A":
-		data, ind = readIpv4(buf, ind+10)
+		data, ind, err = readFixed(buf, start, 4)
 	case "AAAA":
-		data, ind = readIpv6(buf, ind+10)
+		data, ind, err = readFixed(buf, start, 16)
 	case "MX":
-		data, ind = readMxRecord(buf, ind+10)
-	case "NS", "CNAME":
-		data, ind = readNameRecord(buf, ind+10)
+		data, ind, err = readPrefixedName(buf[:end], start, 2)
+	case "SRV":
+		data, ind, err = readPrefixedName(buf[:end], start, 6)
+	case "NS", "CNAME", "PTR":
+		data, ind, err = readNameRecord(buf[:end], start)
+	case "SOA":
+		data, ind, err = readSoaRecord(buf[:end], start)
+	default:
+		// TXT, HINFO, CAA, OPT и неизвестные типы не содержат сжатых имён
+		data, ind = buf[start:end], end
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if ind != end {
+		return nil, 0, fmt.Errorf("длина данных записи %s не совпадает с DataLength", TypeName(rType))
 	}
 
 	d := ResponseData{
@@ -192,7 +266,7 @@ func readResponseData(buf []byte, start int) (*ResponseData, int, error) {
 		Data:       data,
 	}
 
-	return &d, ind, nil
+	return &d, end, nil
 }
 
 func (r *ResponseData) encode(start int, namesPtr *map[string]uint16) []byte {
@@ -206,21 +280,42 @@ func (r *ResponseData) encode(start int, namesPtr *map[string]uint16) []byte {
 	binary.BigEndian.PutUint32(time, r.TTL)
 
 	response = append(response, time...)
-	response = append(response, uint16ToBytes(r.DataLength)...)
 
+	// Сжатые имена меняют длину данных, поэтому DataLength считается заново
+	dataStart := start + len(response) + 2
+	var data []byte
 	switch Types[r.Type] {
-	case "A", "AAAA":
-		response = append(response, r.Data...)
 	case "MX":
-		response = append(response, r.Data[:2]...)
-		response = append(response, writeName(r.Data[2:], start+len(response), namesPtr)...)
-	case "NS", "CNAME":
-		response = append(response, writeName(r.Data, start+len(response), namesPtr)...)
+		data = append(data, writePrefixedName(r.Data, 2, dataStart, namesPtr)...)
+	case "SRV":
+		data = append(data, writePrefixedName(r.Data, 6, dataStart, namesPtr)...)
+	case "NS", "CNAME", "PTR":
+		data = append(data, writeName(r.Data, dataStart, namesPtr)...)
+	case "SOA":
+		mname, rest := splitName(r.Data)
+		rname, fixed := splitName(rest)
+		data = append(data, writeName(mname, dataStart, namesPtr)...)
+		data = append(data, writeName(rname, dataStart+len(data), namesPtr)...)
+		data = append(data, fixed...)
+	default:
+		data = append(data, r.Data...)
 	}
 
+	response = append(response, uint16ToBytes(uint16(len(data)))...)
+	response = append(response, data...)
+
 	return response
 }
 
+// Данные MX и SRV без имени после полей фиксированной длины записываются как есть
+func writePrefixedName(data []byte, prefix int, start int, namesPtr *map[string]uint16) []byte {
+	if len(data) < prefix {
+		return data
+	}
+	fixed := append([]byte{}, data[:prefix]...)
+	return append(fixed, writeName(data[prefix:], start+prefix, namesPtr)...)
+}
+
 func writeName(name []byte, start int, namesPtr *map[string]uint16) []byte {
 	names := *namesPtr
 	var data []byte
@@ -236,7 +331,10 @@ func writeName(name []byte, start int, namesPtr *map[string]uint16) []byte {
 		} else {
 			length := int(name[0])
 			data = append(data, name[:length + 1]...)
-			names[nameKey] = uint16(start)
+			// Дальше 0x3FFF указатель сослаться не может
+			if start <= maxPointerOffset {
+				names[nameKey] = uint16(start)
+			}
 			start += length + 1
 			name = name[length+1:]
 		}
@@ -247,73 +345,189 @@ func writeName(name []byte, start int, namesPtr *map[string]uint16) []byte {
 	return data
 }
 
-func readIpv4(buf []byte, start int) ([]byte, int) {
-	return buf[start : start+4], start + 4
+func readFixed(buf []byte, start int, length int) ([]byte, int, error) {
+	if start+length > len(buf) {
+		return nil, 0, fmt.Errorf("данные записи выходят за границы сообщения")
+	}
+	return buf[start : start+length], start + length, nil
 }
 
-func readIpv6(buf []byte, start int) ([]byte, int) {
-	return buf[start : start+16], start + 16
+// Данные MX и SRV: поля фиксированной длины, за которыми следует имя
+func readPrefixedName(buf []byte, start int, prefix int) ([]byte, int, error) {
+	fixed, ind, err := readFixed(buf, start, prefix)
+	if err != nil {
+		return nil, 0, err
+	}
+	name, ind, err := readNameRecord(buf, ind)
+	if err != nil {
+		return nil, 0, err
+	}
+	var data []byte
+	data = append(data, fixed...)
+	data = append(data, name...)
+	return data, ind, nil
 }
 
-func readMxRecord(buf []byte, start int) ([]byte, int) {
+// Данные SOA: два имени, каждое с завершающим нулём, и пять 32-битных полей
+func readSoaRecord(buf []byte, start int) ([]byte, int, error) {
 	var data []byte
-	data = append(data, buf[start:start+2]...)
-	name, ind := readNameRecord(buf, start+2)
-	data = append(data, name...)
-	return data, ind
+	ind := start
+	for range 2 {
+		name, next, err := readNameRecord(buf, ind)
+		if err != nil {
+			return nil, 0, err
+		}
+		data = append(data, name...)
+		data = append(data, 0)
+		ind = next
+	}
+	fixed, ind, err := readFixed(buf, ind, 20)
+	if err != nil {
+		return nil, 0, err
+	}
+	return append(data, fixed...), ind, nil
+}
+
+// Отделяет имя с завершающим нулём от следующих за ним данных
+func splitName(buf []byte) ([]byte, []byte) {
+	pos := 0
+	for pos < len(buf) && buf[pos] != 0 {
+		pos += int(buf[pos]) + 1
+	}
+	if pos >= len(buf) {
+		return buf, nil
+	}
+	return buf[:pos], buf[pos+1:]
 }
 
-func readNameRecord(buf []byte, pos int) ([]byte, int) {
+// Читает имя, раскрывая указатели сжатия. Указатели ведут только назад, а длина
+// имени ограничена, поэтому зациклиться разбор не может
+func readNameRecord(buf []byte, pos int) ([]byte, int, error) {
 	var record []byte
-	var old int = -1
+	var next int = -1
 	for {
-		if mark := buf[pos] >> 6; mark != 0 {
-			if old == -1 {
-				old = pos + 2
+		if pos >= len(buf) {
+			return nil, 0, fmt.Errorf("имя выходит за границы сообщения")
+		}
+		switch buf[pos] >> 6 {
+		case 3:
+			if pos+1 >= len(buf) {
+				return nil, 0, fmt.Errorf("указатель сжатия выходит за границы сообщения")
 			}
-			pos = int(buf[pos]<<2)<<6 | int(buf[pos+1])
+			if next == -1 {
+				next = pos + 2
+			}
+			target := int(buf[pos]&0x3f)<<8 | int(buf[pos+1])
+			if target >= pos {
+				return nil, 0, fmt.Errorf("указатель сжатия не ведёт назад: %d", target)
+			}
+			pos = target
 			continue
+		case 1, 2:
+			return nil, 0, fmt.Errorf("недопустимый тип метки: %#x", buf[pos])
 		}
-		length := int((buf[pos] << 2) >> 2)
+
+		length := int(buf[pos])
 		if length == 0 {
 			break
 		}
-		pos++
+		if len(record)+length+2 > maxNameLength {
+			return nil, 0, fmt.Errorf("имя длиннее %d байт", maxNameLength)
+		}
+		if pos+1+length > len(buf) {
+			return nil, 0, fmt.Errorf("метка выходит за границы сообщения")
+		}
 		record = append(record, byte(length))
-		record = append(record, buf[pos:pos+length]...)
-		pos += length
+		record = append(record, buf[pos+1:pos+1+length]...)
+		pos += length + 1
 	}
-	var nextPos int
-	if old != -1 {
-		nextPos = old
-	} else {
-		nextPos = pos + 1
+	if next == -1 {
+		next = pos + 1
 	}
 
-	return record, nextPos
+	return record, next, nil
+}
+
+// Возвращает порт и целевой хост записи SRV
+func ParseSrvRecord(buf []byte) (uint16, string) {
+	if len(buf) < 6 {
+		return 0, ""
+	}
+	return binary.BigEndian.Uint16(buf[4:6]), parseNameRecord(buf[6:])
 }
 
-func parseIpv4(buf []byte) string {
-	res := make([]string, 4)
-	for i, el := range buf {
-		res[i] = string(el)
+func ParseSoaRecord(buf []byte) SOA {
+	mname, rest := splitName(buf)
+	rname, fixed := splitName(rest)
+	soa := SOA{
+		MName: parseNameRecord(mname),
+		RName: parseNameRecord(rname),
+	}
+	if len(fixed) >= 20 {
+		soa.Serial = binary.BigEndian.Uint32(fixed[0:4])
+		soa.Refresh = binary.BigEndian.Uint32(fixed[4:8])
+		soa.Retry = binary.BigEndian.Uint32(fixed[8:12])
+		soa.Expire = binary.BigEndian.Uint32(fixed[12:16])
+		soa.Minimum = binary.BigEndian.Uint32(fixed[16:20])
 	}
-	return strings.Join(res, ".")
+	return soa
 }
 
-func parseIpv6(buf []byte) string {
-	res := make([]string, 8)
-	for i := 0; i < 16; i += 2 {
-		part := uint16(buf[i])<<8 | uint16(buf[i+1])
-		res[i] = string(part)
+// Возвращает флаги, тег и значение записи CAA (RFC 8659)
+func ParseCaaRecord(buf []byte) (uint8, string, string) {
+	if len(buf) < 2 || 2+int(buf[1]) > len(buf) {
+		return 0, "", ""
 	}
-	return strings.Join(res, ".")
+	tagEnd := 2 + int(buf[1])
+	return buf[0], string(buf[2:tagEnd]), string(buf[tagEnd:])
 }
 
-func parseMxRecord(buf []byte) string {
-	bufName := buf[2:]
-	name := parseNameRecord(bufName)
-	return name
+// Возвращает процессор и операционную систему из записи HINFO
+func ParseHinfoRecord(buf []byte) (string, string) {
+	strs := ParseTxtRecord(buf)
+	for len(strs) < 2 {
+		strs = append(strs, "")
+	}
+	return strs[0], strs[1]
+}
+
+// Раскладывает запись TXT на строки
+func ParseTxtRecord(buf []byte) []string {
+	var strs []string
+	pos := 0
+	for pos < len(buf) {
+		length := int(buf[pos])
+		if pos+1+length > len(buf) {
+			break
+		}
+		strs = append(strs, string(buf[pos+1:pos+1+length]))
+		pos += length + 1
+	}
+	return strs
+}
+
+// Переводит имя вида "host.local" в последовательность меток
+func NameToRecord(name string) ([]byte, error) {
+	var record []byte
+	for _, label := range strings.Split(strings.Trim(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		if len(label) > maxLabelLength {
+			return nil, fmt.Errorf("метка %q длиннее %d байт", label, maxLabelLength)
+		}
+		record = append(record, byte(len(label)))
+		record = append(record, label...)
+	}
+	// Ещё один байт занимает завершающая нулевая метка
+	if len(record)+1 > maxNameLength {
+		return nil, fmt.Errorf("имя длиннее %d байт", maxNameLength)
+	}
+	return record, nil
+}
+
+func RecordToName(buf []byte) string {
+	return parseNameRecord(buf)
 }
 
 func parseNameRecord(buf []byte) string {
@@ -321,6 +535,9 @@ func parseNameRecord(buf []byte) string {
 	pos := 0
 	for pos < len(buf) {
 		length := int(buf[pos])
+		if pos+length+1 > len(buf) {
+			break
+		}
 		nameParts = append(nameParts, string(buf[pos+1:pos+length+1]))
 		pos += length + 1
 	}
@@ -333,17 +550,3 @@ func uint16ToBytes(u uint16) []byte {
 	bytes[1] = byte((u << 8) >> 8)
 	return bytes
 }
-
-func dataToString(t string, data []byte) (string, error) {
-	switch t {
-	case "A":
-		return parseIpv4(data), nil
-	case "AAAA":
-		return parseIpv6(data), nil
-	case "MX":
-		return parseMxRecord(data), nil
-	case "CNAME", "NS":
-		return parseNameRecord(data), nil
-	}
-	return "", nil
-}
\ No newline at end of file
@@ -0,0 +1,448 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// Ответ на запрос A для example.com с указателем сжатия на имя из вопроса
+var sampleResponse = []byte{
+	0x12, 0x34, 0x81, 0x80, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+	0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00,
+	0x00, 0x01, 0x00, 0x01,
+	0xc0, 0x0c, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x0e, 0x10, 0x00, 0x04,
+	93, 184, 216, 34,
+}
+
+func fuzzSeeds(f *testing.F) {
+	f.Add(mustQuery("example.com", TypeA, ClassIN).Encode())
+	f.Add(mustQuery(".", TypeNS, ClassIN).WithEDNS(DefaultUDPSize).Encode())
+	f.Add(sampleResponse)
+	f.Add(sampleResponse[:len(sampleResponse)-3])
+	// Указатель сжатия, который ссылается сам на себя
+	f.Add([]byte{0, 0, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0, 0xc0, 0x0c, 0, 1, 0, 1})
+}
+
+func FuzzParseRequest(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		request, err := ParseRequest(data)
+		if err != nil {
+			return
+		}
+		// Разобранный запрос должен кодироваться в корректное сообщение
+		if _, err := ParseRequest(request.Encode()); err != nil {
+			t.Errorf("re-encoded request is malformed: %v", err)
+		}
+	})
+}
+
+func FuzzParseResponse(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		response, err := ParseResponse(data)
+		if err != nil {
+			return
+		}
+		response.Encode()
+	})
+}
+
+// Ответ mDNS без секции вопросов: PTR на экземпляр сервиса, SRV и TXT этого экземпляра.
+// Имена в данных PTR и SRV сжаты указателями на владельцев предыдущих записей
+var mdnsResponse = []byte{
+	0x00, 0x00, 0x84, 0x00, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00,
+	// _http._tcp.local PTR printer._http._tcp.local
+	0x05, '_', 'h', 't', 't', 'p', 0x04, '_', 't', 'c', 'p', 0x05, 'l', 'o', 'c', 'a', 'l', 0x00,
+	0x00, 0x0c, 0x00, 0x01, 0x00, 0x00, 0x11, 0x94, 0x00, 0x0a,
+	0x07, 'p', 'r', 'i', 'n', 't', 'e', 'r', 0xc0, 0x0c,
+	// printer._http._tcp.local SRV 0 0 631 printer.local
+	0xc0, 0x28, 0x00, 0x21, 0x80, 0x01, 0x00, 0x00, 0x00, 0x78, 0x00, 0x10,
+	0x00, 0x00, 0x00, 0x00, 0x02, 0x77, 0x07, 'p', 'r', 'i', 'n', 't', 'e', 'r', 0xc0, 0x17,
+	// printer._http._tcp.local TXT "txtvers=1" "rp=ipp/print"
+	0xc0, 0x28, 0x00, 0x10, 0x80, 0x01, 0x00, 0x00, 0x11, 0x94, 0x00, 0x17,
+	0x09, 't', 'x', 't', 'v', 'e', 'r', 's', '=', '1', 0x0c, 'r', 'p', '=', 'i', 'p', 'p', '/', 'p', 'r', 'i', 'n', 't',
+}
+
+func TestParseDiscoveryRecords(t *testing.T) {
+	response, err := ParseResponse(mdnsResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Answers) != 3 {
+		t.Fatalf("got %d answers, want 3", len(response.Answers))
+	}
+	ptr, srv, txt := response.Answers[0], response.Answers[1], response.Answers[2]
+
+	if got := RecordToName(ptr.Data); got != "printer._http._tcp.local" {
+		t.Errorf("PTR: got %q", got)
+	}
+	if got := RecordToName(srv.Name); got != "printer._http._tcp.local" {
+		t.Errorf("SRV owner: got %q", got)
+	}
+	if port, target := ParseSrvRecord(srv.Data); port != 631 || target != "printer.local" {
+		t.Errorf("SRV: got %d %q", port, target)
+	}
+	if got := ParseTxtRecord(txt.Data); len(got) != 2 || got[0] != "txtvers=1" || got[1] != "rp=ipp/print" {
+		t.Errorf("TXT: got %q", got)
+	}
+
+	// После кодирования и повторного разбора данные записей не меняются
+	again, err := ParseResponse(response.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, record := range again.Answers {
+		if record.RDataString() != response.Answers[i].RDataString() {
+			t.Errorf("%s: got %q after round trip, want %q",
+				TypeName(record.Type), record.RDataString(), response.Answers[i].RDataString())
+		}
+	}
+}
+
+func TestParseTxtRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+	}{
+		{"single", []byte("\x05hello"), []string{"hello"}},
+		{"empty string", []byte{0}, []string{""}},
+		{"several", []byte("\x01a\x00\x02bc"), []string{"a", "", "bc"}},
+		{"truncated tail", []byte("\x01a\x05bc"), []string{"a"}},
+		{"no data", nil, nil},
+	}
+	for _, test := range tests {
+		got := ParseTxtRecord(test.data)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+			}
+		}
+	}
+}
+
+func TestParseSrvRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		port   uint16
+		target string
+	}{
+		{"target", append([]byte{0, 10, 0, 60, 0x13, 0xc4}, mustName("sip.example.com")...), 5060, "sip.example.com"},
+		{"root target", []byte{0, 0, 0, 0, 0, 0}, 0, ""},
+		{"short", []byte{0, 0, 0}, 0, ""},
+	}
+	for _, test := range tests {
+		port, target := ParseSrvRecord(test.data)
+		if port != test.port || target != test.target {
+			t.Errorf("%s: got %d %q, want %d %q", test.name, port, target, test.port, test.target)
+		}
+	}
+}
+
+// Заголовок ответа без вопросов, за которым сразу идёт проверяемое имя
+func nameMessage(name ...byte) []byte {
+	return append([]byte{0, 0, 0x81, 0x80, 0, 0, 0, 1, 0, 0, 0, 0}, name...)
+}
+
+func TestReadNameRecord(t *testing.T) {
+	example := []byte{0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00}
+	longName := bytes.Repeat(append([]byte{63}, bytes.Repeat([]byte{'a'}, 63)...), 4)
+
+	tests := []struct {
+		name  string
+		buf   []byte
+		start int
+		want  string
+		next  int
+		fails bool
+	}{
+		{name: "plain", buf: nameMessage(example...), start: 12, want: "example.com", next: 25},
+		{name: "root", buf: nameMessage(0), start: 12, want: "", next: 13},
+		{name: "backward pointer", buf: nameMessage(append(example, 0x03, 'w', 'w', 'w', 0xc0, 0x0c)...),
+			start: 25, want: "www.example.com", next: 31},
+		{name: "pointer to itself", buf: nameMessage(0xc0, 0x0c), start: 12, fails: true},
+		{name: "pointer loop through a label", buf: nameMessage(0x01, 'a', 0xc0, 0x0c), start: 12, fails: true},
+		{name: "forward pointer", buf: nameMessage(0xc0, 0x0e, 0x01, 'a', 0x00), start: 12, fails: true},
+		{name: "truncated pointer", buf: nameMessage(0xc0), start: 12, fails: true},
+		{name: "truncated label", buf: nameMessage(0x05, 'a', 'b'), start: 12, fails: true},
+		{name: "missing terminator", buf: nameMessage(0x01, 'a'), start: 12, fails: true},
+		{name: "reserved label type", buf: nameMessage(0x41, 'a', 0x00), start: 12, fails: true},
+		{name: "longer than 255 bytes", buf: nameMessage(append(longName, 0)...), start: 12, fails: true},
+	}
+	for _, test := range tests {
+		record, next, err := readNameRecord(test.buf, test.start)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got %q, expected error", test.name, RecordToName(record))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := RecordToName(record); got != test.want || next != test.next {
+			t.Errorf("%s: got %q, next %d, want %q, next %d", test.name, got, next, test.want, test.next)
+		}
+	}
+}
+
+func TestParseResponseRejectsBrokenRecords(t *testing.T) {
+	withAnswer := func(count byte, answer ...byte) []byte {
+		buf := bytes.Clone(sampleResponse[:29])
+		buf[7] = count
+		return append(buf, answer...)
+	}
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"truncated header", sampleResponse[:11]},
+		{"truncated question", sampleResponse[:27]},
+		{"truncated A data", sampleResponse[:len(sampleResponse)-1]},
+		{"A data length mismatch", withAnswer(1, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 0, 0, 3, 1, 2, 3)},
+		{"MX name past data length", withAnswer(1, 0xc0, 0x0c, 0, 15, 0, 1, 0, 0, 0, 0, 0, 4, 0, 10, 0x02, 'm', 'x', 0)},
+		{"CNAME shorter than data length", withAnswer(1, 0xc0, 0x0c, 0, 5, 0, 1, 0, 0, 0, 0, 0, 4, 0xc0, 0x0c, 0, 0)},
+		{"SOA without serials", withAnswer(1, 0xc0, 0x0c, 0, 6, 0, 1, 0, 0, 0, 0, 0, 4, 0xc0, 0x0c, 0xc0, 0x0c)},
+		{"more answers than records", withAnswer(2, sampleResponse[29:]...)},
+	}
+	for _, test := range tests {
+		if response, err := ParseResponse(test.buf); err == nil {
+			t.Errorf("%s: got %d answers, expected error", test.name, len(response.Answers))
+		}
+	}
+}
+
+func TestResponseEncodeRoundTrip(t *testing.T) {
+	mx := append([]byte{0, 10}, mustName("mail.example.com")...)
+	soa := append(mustName("ns1.example.com"), 0)
+	soa = append(soa, append(mustName("hostmaster.example.com"), 0)...)
+	soa = append(soa, 0, 0, 0, 1, 0, 0, 0x0e, 0x10, 0, 0, 0x02, 0x58, 0, 0x09, 0x3a, 0x80, 0, 0, 0x01, 0x2c)
+	response := &Response{
+		Header:   Header{ID: 0x1234, QR: 1, RD: 1, RA: 1, QDCount: 1, ANCount: 3, NSCount: 1, ARCount: 1},
+		Question: Question{QName: mustName("example.com"), QType: TypeANY, QClass: ClassIN},
+		Answers: []*ResponseData{
+			record(TypeA, []byte{93, 184, 216, 34}),
+			record(TypeMX, mx),
+			record(TypeCNAME, mustName("www.example.com")),
+		},
+		Authorities: []*ResponseData{record(TypeSOA, soa)},
+		Additionals: []*ResponseData{{Name: mustName("mail.example.com"), Type: TypeA, Class: ClassIN, TTL: 60, Data: []byte{10, 0, 0, 1}}},
+	}
+
+	encoded := response.Encode()
+	// Повторяющиеся имена должны сжиматься, а не записываться целиком
+	if n := bytes.Count(encoded, []byte("\x07example")); n != 1 {
+		t.Errorf("example.com is written %d times", n)
+	}
+	again, err := ParseResponse(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Header != response.Header || !bytes.Equal(again.Question.QName, response.Question.QName) {
+		t.Errorf("got header %v, question %v", again.Header, again.Question)
+	}
+	sections := [][2][]*ResponseData{
+		{response.Answers, again.Answers},
+		{response.Authorities, again.Authorities},
+		{response.Additionals, again.Additionals},
+	}
+	for _, section := range sections {
+		want, got := section[0], section[1]
+		if len(got) != len(want) {
+			t.Errorf("got %d records, want %d", len(got), len(want))
+			continue
+		}
+		for i := range want {
+			if !bytes.Equal(got[i].Name, want[i].Name) || got[i].Type != want[i].Type ||
+				got[i].TTL != want[i].TTL || !bytes.Equal(got[i].Data, want[i].Data) {
+				t.Errorf("%s: got %s, want %s", TypeName(want[i].Type),
+					strings.TrimSpace(got[i].ZoneString()), strings.TrimSpace(want[i].ZoneString()))
+			}
+		}
+	}
+}
+
+// Разбирает записи, прошедшие через Response.Encode, чтобы проверить и сжатие имён в данных
+func roundTrip(t *testing.T, records ...*ResponseData) []*ResponseData {
+	t.Helper()
+	response := &Response{
+		Header:   Header{QR: 1, QDCount: 1, ANCount: uint16(len(records))},
+		Question: Question{QName: mustName("example.com"), QType: TypeANY, QClass: ClassIN},
+		Answers:  records,
+	}
+	again, err := ParseResponse(response.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return again.Answers
+}
+
+func TestSoaRoundTrip(t *testing.T) {
+	want := SOA{MName: "ns1.example.com", RName: "hostmaster.example.com",
+		Serial: 2024010101, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300}
+	data := append(mustName(want.MName), 0)
+	data = append(data, append(mustName(want.RName), 0)...)
+	for _, value := range []uint32{want.Serial, want.Refresh, want.Retry, want.Expire, want.Minimum} {
+		data = binary.BigEndian.AppendUint32(data, value)
+	}
+
+	answers := roundTrip(t, record(TypeSOA, data))
+	if got := ParseSoaRecord(answers[0].Data); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := ParseSoaRecord(data[:len(data)-1]); got.MName != want.MName || got.Serial != 0 {
+		t.Errorf("truncated: got %+v", got)
+	}
+}
+
+func TestHinfoRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		cpu, os string
+	}{
+		{"both", []byte("\x07INTEL-X\x05LINUX"), "INTEL-X", "LINUX"},
+		{"with spaces", []byte("\x0aARM Cortex\x00"), "ARM Cortex", ""},
+		{"cpu only", []byte("\x03RFC"), "RFC", ""},
+	}
+	for _, test := range tests {
+		answers := roundTrip(t, record(TypeHINFO, test.data))
+		if cpu, os := ParseHinfoRecord(answers[0].Data); cpu != test.cpu || os != test.os {
+			t.Errorf("%s: got %q %q, want %q %q", test.name, cpu, os, test.cpu, test.os)
+		}
+	}
+}
+
+func TestCaaRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		flags uint8
+		tag   string
+		value string
+	}{
+		{"issue", []byte("\x00\x05issueletsencrypt.org"), 0, "issue", "letsencrypt.org"},
+		{"critical iodef", []byte("\x80\x05iodefmailto:security@example.com"), 128, "iodef", "mailto:security@example.com"},
+		{"empty value", []byte("\x00\x09issuewild"), 0, "issuewild", ""},
+		{"tag past data", []byte("\x00\x09issue"), 0, "", ""},
+	}
+	for _, test := range tests {
+		answers := roundTrip(t, record(TypeCAA, test.data))
+		flags, tag, value := ParseCaaRecord(answers[0].Data)
+		if flags != test.flags || tag != test.tag || value != test.value {
+			t.Errorf("%s: got %d %q %q", test.name, flags, tag, value)
+		}
+	}
+}
+
+func TestEDNSRoundTrip(t *testing.T) {
+	cookie := EDNSOption{Code: 10, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}
+	nsid := EDNSOption{Code: 3}
+	request := mustQuery("example.com", TypeA, ClassIN).WithEDNS(1232, cookie, nsid)
+	request.EDNS.DO = true
+	request.EDNS.Version = 1
+
+	// Запрос и ответ совпадают по формату, поэтому OPT из запроса разбирается как из ответа
+	response, err := ParseResponse(request.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Additionals) != 1 || response.Additionals[0].Type != TypeOPT {
+		t.Fatalf("got additionals %v", response.Additionals)
+	}
+	edns := response.EDNS
+	if edns == nil || edns.UDPSize != 1232 || edns.Version != 1 || !edns.DO || edns.ExtendedRCode != 0 {
+		t.Fatalf("got %+v", edns)
+	}
+	if len(edns.Options) != 2 || edns.Options[0].Code != cookie.Code || !bytes.Equal(edns.Options[0].Data, cookie.Data) ||
+		edns.Options[1].Code != nsid.Code || len(edns.Options[1].Data) != 0 {
+		t.Errorf("got options %+v", edns.Options)
+	}
+
+	// Обрезанная опция отбрасывается, предыдущие остаются
+	opt := &ResponseData{Type: TypeOPT, Class: 512, Data: []byte{0, 3, 0, 0, 0, 10, 0, 8, 1}}
+	if got := ParseEDNS(opt); got.UDPSize != 512 || len(got.Options) != 1 || got.Options[0].Code != 3 {
+		t.Errorf("truncated: got %+v", got)
+	}
+}
+
+func TestUnknownTypeKeepsRData(t *testing.T) {
+	// Данные неизвестного типа похожи на сжатое имя, но разворачиваться не должны
+	unknown := record(65280, []byte{0xc0, 0x0c, 0xde, 0xad})
+	answers := roundTrip(t, unknown, record(TypeA, []byte{192, 0, 2, 1}))
+	if len(answers) != 2 {
+		t.Fatalf("got %d answers", len(answers))
+	}
+	if answers[0].Type != 65280 || !bytes.Equal(answers[0].Data, unknown.Data) || answers[0].DataLength != 4 {
+		t.Errorf("got %s", answers[0].ZoneString())
+	}
+	if answers[1].Type != TypeA || !bytes.Equal(answers[1].Data, []byte{192, 0, 2, 1}) {
+		t.Errorf("record after unknown type: got %s", answers[1].ZoneString())
+	}
+	if got := answers[0].RDataString(); got != `\# 4 c00cdead` {
+		t.Errorf("got %q", got)
+	}
+}
+
+// Данные MX и SRV короче полей фиксированной длины записываются как есть
+func TestEncodeShortRData(t *testing.T) {
+	response := &Response{
+		Header:   Header{ID: 1, QR: 1, QDCount: 1, ANCount: 3},
+		Question: Question{QName: mustName("example.com"), QType: TypeANY, QClass: ClassIN},
+		Answers: []*ResponseData{
+			record(TypeMX, []byte{0}),
+			record(TypeSRV, []byte{0, 1, 0, 5}),
+			// Null MX из RFC 7505: приоритет 0 и корневое имя
+			record(TypeMX, []byte{0, 0}),
+		},
+	}
+	raw := response.Encode()
+	if !bytes.HasSuffix(raw, []byte{0, 3, 0, 0, 0}) {
+		t.Errorf("null mx encoded as %x", raw)
+	}
+	if _, err := ParseResponse(raw); err == nil {
+		t.Error("short mx and srv data parsed as valid records")
+	}
+}
+
+// Указатель сжатия хранит 14 бит, поэтому имена дальше 0x3FFF не сжимаются
+func TestEncodeCompressionLimit(t *testing.T) {
+	txt := append([]byte{255}, bytes.Repeat([]byte{'x'}, 255)...)
+	response := &Response{
+		Header:   Header{ID: 1, QR: 1, QDCount: 1},
+		Question: Question{QName: mustName("example.com"), QType: TypeANY, QClass: ClassIN},
+	}
+	for range 70 {
+		response.Answers = append(response.Answers, record(TypeTXT, txt))
+	}
+	late := &ResponseData{Name: mustName("late.example.com"), Type: TypeCNAME, Class: ClassIN, TTL: 60, Data: mustName("target.late.example.com")}
+	response.Answers = append(response.Answers, late, late)
+	response.Header.ANCount = uint16(len(response.Answers))
+
+	raw := response.Encode()
+	if len(raw) <= maxPointerOffset {
+		t.Fatalf("message of %d bytes is too short for the test", len(raw))
+	}
+	parsed, err := ParseResponse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, answer := range parsed.Answers[70:] {
+		if RecordToName(answer.Name) != "late.example.com" || RecordToName(answer.Data) != "target.late.example.com" {
+			t.Errorf("got %s", answer.ZoneString())
+		}
+	}
+	// Суффикс из вопроса по-прежнему сжимается указателем на смещение 12
+	if !bytes.Contains(raw[maxPointerOffset:], []byte{4, 'l', 'a', 't', 'e', 0xc0, 0x0c}) {
+		t.Error("names before 0x3FFF are no longer compressed")
+	}
+}
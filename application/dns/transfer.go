@@ -0,0 +1,99 @@
+package dns
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Ограничения передачи зоны: сервер может слать сообщения без завершающей SOA бесконечно
+const (
+	maxTransferRecords = 500000
+	maxTransferBytes   = 64 << 20
+	// Вся передача должна уложиться в столько таймаутов клиента
+	transferTimeouts = 30
+)
+
+// Запрашивает передачу зоны (RFC 5936) и возвращает её записи, начиная и заканчивая SOA
+func (c *Client) Transfer(zone string) ([]*ResponseData, error) {
+	request, err := NewQuery(zone, TypeAXFR, ClassIN)
+	if err != nil {
+		return nil, err
+	}
+	// Рекурсия для передачи зоны не нужна
+	request.Header.RD = 0
+
+	conn, err := net.DialTimeout("tcp", c.Server, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+	err = WriteTCPMessage(conn, request.Encode())
+	if err != nil {
+		return nil, err
+	}
+	reader := &deadlineReader{conn: conn, timeout: c.Timeout, deadline: time.Now().Add(transferTimeouts * c.Timeout)}
+	return ReadTransfer(reader, request.Header.ID)
+}
+
+// Читает сообщения передачи зоны, пока не встретится завершающая SOA
+// или не будет превышено число записей или байт
+func ReadTransfer(r io.Reader, id uint16) ([]*ResponseData, error) {
+	records := make([]*ResponseData, 0)
+	size := 0
+	for {
+		raw, err := ReadTCPMessage(r)
+		if err != nil {
+			return nil, err
+		}
+		size += 2 + len(raw)
+		if size > maxTransferBytes {
+			return nil, fmt.Errorf("zone transfer exceeds %d bytes", maxTransferBytes)
+		}
+		response, err := ParseResponse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if response.Header.ID != id || response.Header.QR != 1 {
+			return nil, fmt.Errorf("unexpected message in zone transfer")
+		}
+		if rcode := response.RCode(); rcode != 0 {
+			return nil, fmt.Errorf("zone transfer failed: %s", RCodeName(rcode))
+		}
+		for _, answer := range response.Answers {
+			if len(records) == 0 && answer.Type != TypeSOA {
+				return nil, fmt.Errorf("zone transfer does not start with SOA")
+			}
+			records = append(records, answer)
+			if len(records) > 1 && answer.Type == TypeSOA {
+				return records, nil
+			}
+			if len(records) >= maxTransferRecords {
+				return nil, fmt.Errorf("zone transfer exceeds %d records", maxTransferRecords)
+			}
+		}
+		if len(response.Answers) == 0 {
+			return nil, fmt.Errorf("zone transfer ended without records")
+		}
+	}
+}
+
+// Продлевает таймаут перед каждым чтением: большая зона приходит дольше одного таймаута.
+// Дальше общего срока deadline таймаут не продлевается, чтобы медленный сервер не держал соединение вечно
+type deadlineReader struct {
+	conn     net.Conn
+	timeout  time.Duration
+	deadline time.Time
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	deadline := time.Now().Add(r.timeout)
+	if deadline.After(r.deadline) {
+		deadline = r.deadline
+	}
+	r.conn.SetReadDeadline(deadline)
+	return r.conn.Read(p)
+}
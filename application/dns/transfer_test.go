@@ -0,0 +1,143 @@
+package dns
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func transferMessage(id uint16, rcode uint16, records ...*ResponseData) []byte {
+	response := &Response{
+		Header:   Header{ID: id, QR: 1, AA: 1, RCode: rcode, QDCount: 1, ANCount: uint16(len(records))},
+		Question: Question{QName: mustName("example.com"), QType: TypeAXFR, QClass: ClassIN},
+		Answers:  records,
+	}
+	return response.Encode()
+}
+
+func TestReadTransfer(t *testing.T) {
+	soa := append(mustName("ns1.example.com"), 0)
+	soa = append(soa, append(mustName("hostmaster.example.com"), 0)...)
+	soa = append(soa, make([]byte, 20)...)
+
+	var stream bytes.Buffer
+	WriteTCPMessage(&stream, transferMessage(7, 0, record(TypeSOA, soa), record(TypeA, []byte{192, 0, 2, 1})))
+	WriteTCPMessage(&stream, transferMessage(7, 0, record(TypeNS, mustName("ns1.example.com"))))
+	WriteTCPMessage(&stream, transferMessage(7, 0, record(TypeSOA, soa)))
+
+	records, err := ReadTransfer(&stream, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, r := range records {
+		types = append(types, TypeName(r.Type))
+	}
+	if got := len(records); got != 4 {
+		t.Fatalf("got %d records %v, want 4", got, types)
+	}
+	if records[3].Type != TypeSOA || records[2].RDataString() != "ns1.example.com." {
+		t.Errorf("unexpected records %v", types)
+	}
+}
+
+func TestReadTransferErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		message []byte
+	}{
+		{"refused", transferMessage(7, 5)},
+		{"wrong id", transferMessage(8, 0, record(TypeA, []byte{192, 0, 2, 1}))},
+		{"no soa", transferMessage(7, 0, record(TypeA, []byte{192, 0, 2, 1}))},
+		{"truncated", transferMessage(7, 0)[:10]},
+	}
+	for _, test := range tests {
+		var stream bytes.Buffer
+		WriteTCPMessage(&stream, test.message)
+		if _, err := ReadTransfer(&stream, 7); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
+
+// Сервер, который шлёт сообщения передачи зоны без завершающей SOA
+type endlessTransfer struct {
+	first   []byte
+	message []byte
+	pending bytes.Buffer
+}
+
+func (e *endlessTransfer) Read(p []byte) (int, error) {
+	if e.pending.Len() == 0 {
+		if e.first != nil {
+			WriteTCPMessage(&e.pending, e.first)
+			e.first = nil
+		} else {
+			WriteTCPMessage(&e.pending, e.message)
+		}
+	}
+	return e.pending.Read(p)
+}
+
+func TestReadTransferEndlessStream(t *testing.T) {
+	soa := append(mustName("ns1.example.com"), 0)
+	soa = append(soa, append(mustName("hostmaster.example.com"), 0)...)
+	soa = append(soa, make([]byte, 20)...)
+
+	many := make([]*ResponseData, 200)
+	for i := range many {
+		many[i] = record(TypeA, []byte{192, 0, 2, byte(i)})
+	}
+	large := record(65280, make([]byte, 60000))
+
+	tests := []struct {
+		name    string
+		message []byte
+	}{
+		{"record limit", transferMessage(7, 0, many...)},
+		{"byte limit", transferMessage(7, 0, large)},
+	}
+	for _, test := range tests {
+		stream := &endlessTransfer{first: transferMessage(7, 0, record(TypeSOA, soa)), message: test.message}
+		records, err := ReadTransfer(stream, 7)
+		if err == nil {
+			t.Errorf("%s: got %d records, expected error", test.name, len(records))
+		} else if !strings.Contains(err.Error(), "exceeds") {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+}
+
+// Сервер отдаёт по байту чуть быстрее таймаута: передача должна оборваться по общему сроку
+func TestTransferDeadline(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte{0xff, 0xff})
+		for {
+			time.Sleep(10 * time.Millisecond)
+			if _, err := conn.Write([]byte{0}); err != nil {
+				return
+			}
+		}
+	}()
+
+	client := NewClient(listener.Addr().String(), 50*time.Millisecond)
+	start := time.Now()
+	if _, err := client.Transfer("example.com"); err == nil {
+		t.Fatal("expected error")
+	}
+	if elapsed := time.Since(start); elapsed > 3*transferTimeouts*client.Timeout {
+		t.Errorf("transfer took %v", elapsed)
+	}
+}
@@ -0,0 +1,15 @@
+package domain
+
+const (
+	EvidencePortHint    = "port hint"
+	EvidenceBanner      = "banner"
+	EvidenceBannerRegex = "banner regex"
+	EvidenceHandshake   = "handshake"
+)
+
+// Кандидат на роль протокола порта с уверенностью в процентах
+type Candidate struct {
+	Protocol   string
+	Confidence int
+	Evidence   []string
+}
@@ -0,0 +1,11 @@
+package domain
+
+type Detection struct {
+	Protocol string
+	Product  string
+	Version  string
+	Info     []string
+	Findings []Finding
+	// Насколько убедителен ответ: одна из констант Evidence*
+	Evidence string
+}
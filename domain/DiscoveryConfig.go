@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+var DiscoveryProtocols = []string{"mdns", "ssdp", "llmnr", "wsd"}
+
+type DiscoveryConfig struct {
+	Timeout   time.Duration
+	Verbose   bool
+	Protocols []string
+}
+
+func NewDefaultDiscoveryConfig() *DiscoveryConfig {
+	return &DiscoveryConfig{
+		Timeout:   time.Second * 3,
+		Protocols: DiscoveryProtocols,
+	}
+}
@@ -0,0 +1,11 @@
+package domain
+
+type DiscoveryResult struct {
+	Protocol string
+	Host     string
+	Service  string
+	Name     string
+	Ports    []int
+	Info     []string
+	Findings []Finding
+}
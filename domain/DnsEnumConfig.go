@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+type DnsEnumConfig struct {
+	Timeout  time.Duration
+	Threads  int
+	Verbose  bool
+	Resolver string
+	Domain   string
+	Words    []string
+	// Выводить и адреса из AAAA-записей: portscan их не принимает
+	IPv6 bool
+}
+
+func NewDefaultDnsEnumConfig() *DnsEnumConfig {
+	return &DnsEnumConfig{
+		Timeout: time.Second * 2,
+		Threads: 100,
+	}
+}
@@ -0,0 +1,10 @@
+package domain
+
+import "net"
+
+type DnsEnumResult struct {
+	Name      string
+	Addresses []net.IP
+	// Результат описывает wildcard-запись зоны (*.DOMAIN), а не найденное имя
+	Wildcard bool
+}
@@ -0,0 +1,14 @@
+package domain
+
+const (
+	SeverityInfo   = "info"
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+type Finding struct {
+	Check    string
+	Severity string
+	Detail   string
+}
@@ -0,0 +1,33 @@
+package domain
+
+const (
+	// Заголовок должен присутствовать в ответе
+	AuditCheckPresent = "present"
+	// Заголовок не должен присутствовать в ответе
+	AuditCheckAbsent = "absent"
+	// Значение заголовка не должно совпадать с регулярным выражением Value
+	AuditCheckMatch = "match"
+	// Каждая cookie из Set-Cookie должна содержать атрибут Value
+	AuditCheckCookieFlag = "cookie-flag"
+)
+
+type HttpAuditRule struct {
+	Name     string `json:"name"`
+	Header   string `json:"header"`
+	Check    string `json:"check"`
+	Value    string `json:"value,omitempty"`
+	Severity string `json:"severity"`
+	TLSOnly  bool   `json:"tls_only,omitempty"`
+}
+
+var DefaultHttpAuditRules = []HttpAuditRule{
+	{Name: "missing-hsts", Header: "Strict-Transport-Security", Check: AuditCheckPresent, Severity: SeverityMedium, TLSOnly: true},
+	{Name: "missing-csp", Header: "Content-Security-Policy", Check: AuditCheckPresent, Severity: SeverityMedium},
+	{Name: "missing-x-frame-options", Header: "X-Frame-Options", Check: AuditCheckPresent, Severity: SeverityLow},
+	{Name: "missing-x-content-type-options", Header: "X-Content-Type-Options", Check: AuditCheckPresent, Severity: SeverityLow},
+	{Name: "server-version-disclosure", Header: "Server", Check: AuditCheckMatch, Value: `[0-9]+\.[0-9]+`, Severity: SeverityLow},
+	{Name: "powered-by-disclosure", Header: "X-Powered-By", Check: AuditCheckAbsent, Severity: SeverityLow},
+	{Name: "cookie-without-httponly", Header: "Set-Cookie", Check: AuditCheckCookieFlag, Value: "HttpOnly", Severity: SeverityMedium},
+	{Name: "cookie-without-secure", Header: "Set-Cookie", Check: AuditCheckCookieFlag, Value: "Secure", Severity: SeverityMedium, TLSOnly: true},
+	{Name: "cookie-without-samesite", Header: "Set-Cookie", Check: AuditCheckCookieFlag, Value: "SameSite", Severity: SeverityLow},
+}
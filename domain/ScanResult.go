@@ -4,7 +4,15 @@ import "time"
 
 type ScanResult struct {
 	Protocol string
-	Port int
+	Port     int
 	Duration time.Duration
-	Guess string
-}
\ No newline at end of file
+	Guess    string
+	Product  string
+	Version  string
+	Info     []string
+	Findings []Finding
+	// Имена хоста из его PTR-записей
+	Hostnames []string
+	// Все подошедшие протоколы, от самого вероятного к наименее вероятному
+	Candidates []Candidate
+}
@@ -6,20 +6,38 @@ import (
 )
 
 type ScannerConfig struct {
-	Timeout    time.Duration
-	Threads    int
-	Verbose    bool
-	Guess      bool
-	Ports      []PortScanInfo
-	PortsCount int
-	Ip         net.IP
+	Timeout           time.Duration
+	Threads           int
+	Verbose           bool
+	Guess             bool
+	HttpAudit         bool
+	HttpAuditRules    []HttpAuditRule
+	SnmpCommunities   []string
+	Quic              bool
+	QuicHandshake     bool
+	Industrial        bool
+	IndustrialDetails bool
+	SimpleServices    bool
+	GrpcReflection    bool
+	Resolve           bool
+	Resolver          string
+	Axfr              bool
+	AxfrZones         []string
+	AxfrDir           string
+	DnsFingerprint    bool
+	DnsAudit          bool
+	Ports             []PortScanInfo
+	PortsCount        int
+	Ip                net.IP
 }
 
 func NewDefaultScannerConfig() *ScannerConfig {
 	return &ScannerConfig{
-		Timeout: time.Second * 2,
-		Threads: 0,
-		Ports:   make([]PortScanInfo, 0),
-		Ip:      nil,
+		Timeout:         time.Second * 2,
+		Threads:         0,
+		HttpAuditRules:  DefaultHttpAuditRules,
+		SnmpCommunities: []string{"public", "private"},
+		Ports:           make([]PortScanInfo, 0),
+		Ip:              nil,
 	}
 }
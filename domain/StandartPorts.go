@@ -1,25 +1,63 @@
 package domain
 
 var StandartPorts = map[int]string{
-	80:   "HTTP",
-	443:  "HTTPS",
-	20:   "FTP",
-	21:   "FTP",
-	22:   "SSH",
-	23:   "Telnet",
-	25:   "SMTP",
-	53:   "DNS",
-	69:   "TFTP",
-	110:  "POP3",
-	143:  "IMAP",
-	161:  "SNMP",
-	179:  "BGP",
-	389:  "LDAP",
-	636:  "LDAPS",
-	3389: "RDP",
-	3306: "MySQL",
-	5432: "PostgreSQL",
-	123:  "NTP",
-	88:   "Kerberos",
-	445:  "SMB",
+	80:    "HTTP",
+	443:   "HTTPS",
+	20:    "FTP",
+	21:    "FTP",
+	22:    "SSH",
+	23:    "Telnet",
+	25:    "SMTP",
+	53:    "DNS",
+	69:    "TFTP",
+	110:   "POP3",
+	143:   "IMAP",
+	161:   "SNMP",
+	179:   "BGP",
+	389:   "LDAP",
+	636:   "LDAPS",
+	3389:  "RDP",
+	5900:  "VNC",
+	3306:  "MySQL",
+	5432:  "PostgreSQL",
+	1433:  "MSSQL",
+	27017: "MongoDB",
+	6379:  "Redis",
+	5672:  "AMQP",
+	1883:  "MQTT",
+	9092:  "Kafka",
+	11211: "memcached",
+	4222:  "NATS",
+	123:   "NTP",
+	88:    "Kerberos",
+	445:   "SMB",
+	137:   "NetBIOS",
+	5060:  "SIP",
+	500:   "IKE",
+	4500:  "IKE",
+	502:   "Modbus",
+	102:   "S7",
+	47808: "BACnet",
+	44818: "EtherNet/IP",
+	2375:  "Docker",
+	2376:  "Docker",
+	6443:  "Kubernetes",
+	10250: "kubelet",
+	10255: "kubelet",
+	2379:  "etcd",
+	8500:  "Consul",
+	4646:  "Nomad",
+	631:   "IPP",
+	9100:  "JetDirect",
+	554:   "RTSP",
+	5683:  "CoAP",
+	3478:  "STUN",
+	9:     "Discard",
+	13:    "Daytime",
+	17:    "QOTD",
+	19:    "Chargen",
+	37:    "Time",
+	79:    "Finger",
+	113:   "Ident",
+	50051: "gRPC",
 }
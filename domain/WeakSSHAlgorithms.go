@@ -0,0 +1,37 @@
+package domain
+
+var WeakSSHAlgorithms = map[string]string{
+	// Обмен ключами
+	"diffie-hellman-group1-sha1":               SeverityHigh,
+	"diffie-hellman-group14-sha1":              SeverityLow,
+	"diffie-hellman-group-exchange-sha1":       SeverityMedium,
+	"gss-group1-sha1-toWM5Slw5Ew8Mqkay+al2g==": SeverityHigh,
+	"rsa1024-sha1":                             SeverityHigh,
+	// Ключи хоста
+	"ssh-dss":         SeverityHigh,
+	"ssh-rsa":         SeverityLow,
+	"ssh-rsa1":        SeverityHigh,
+	"x509v3-sign-dss": SeverityHigh,
+	// Шифры
+	"3des-cbc":                    SeverityMedium,
+	"des-cbc":                     SeverityHigh,
+	"blowfish-cbc":                SeverityMedium,
+	"cast128-cbc":                 SeverityMedium,
+	"arcfour":                     SeverityHigh,
+	"arcfour128":                  SeverityHigh,
+	"arcfour256":                  SeverityHigh,
+	"aes128-cbc":                  SeverityLow,
+	"aes192-cbc":                  SeverityLow,
+	"aes256-cbc":                  SeverityLow,
+	"rijndael-cbc@lysator.liu.se": SeverityLow,
+	"none":                        SeverityHigh,
+	// Коды аутентификации сообщений
+	"hmac-md5":                    SeverityMedium,
+	"hmac-md5-96":                 SeverityMedium,
+	"hmac-md5-etm@openssh.com":    SeverityMedium,
+	"hmac-md5-96-etm@openssh.com": SeverityMedium,
+	"hmac-sha1-96":                SeverityLow,
+	"hmac-ripemd160":              SeverityLow,
+	"umac-64@openssh.com":         SeverityLow,
+	"umac-64-etm@openssh.com":     SeverityLow,
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	cli "github.com/futig/PortScannerGo/presentation"
 	"github.com/futig/PortScannerGo/application/controller"
@@ -10,6 +12,30 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "discover" {
+		cfg, err := cli.ParseDiscoverArgs(os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		controller.Discover(cfg, PrintDiscovery)
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "dns-enum" {
+		cfg, err := cli.ParseDnsEnumArgs(os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		err = controller.EnumerateDNS(cfg, PrintDnsEnum)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	cfg, err := cli.ParseArgs()
 	if err != nil {
 		fmt.Println(err)
@@ -21,6 +47,14 @@ func main() {
 func PrintOpenPort(result domain.ScanResult, cfg *domain.ScannerConfig) {
 	line := fmt.Sprintf("%s %-10s %d %-10s", result.Protocol, " ", result.Port, " ")
 
+	if cfg.Resolve {
+		hostname := strings.Join(result.Hostnames, ",")
+		if hostname == "" {
+			hostname = "-"
+		}
+		line += fmt.Sprintf(" %-30s", hostname)
+	}
+
 	if cfg.Verbose {
 		if result.Protocol == "tcp" {
 			line += fmt.Sprintf(" [%dms] %-10s", result.Duration.Milliseconds(), " ")
@@ -35,7 +69,80 @@ func PrintOpenPort(result domain.ScanResult, cfg *domain.ScannerConfig) {
 			guess = "-"
 		}
 		line += fmt.Sprintf(" %-6s", guess)
+		if result.Product != "" {
+			line += fmt.Sprintf(" %s %s", result.Product, result.Version)
+		}
 	}
 
 	fmt.Println(line)
-}
\ No newline at end of file
+
+	if cfg.Verbose {
+		for _, info := range result.Info {
+			fmt.Printf("    %s\n", info)
+		}
+	}
+
+	// Остальных кандидатов показываем всегда, чтобы неоднозначность была видна
+	for i, candidate := range result.Candidates {
+		if i == 0 && !cfg.Verbose {
+			continue
+		}
+		fmt.Printf("    ? %s %d%% (%s)\n", candidate.Protocol, candidate.Confidence, strings.Join(candidate.Evidence, ", "))
+	}
+
+	for _, finding := range result.Findings {
+		fmt.Printf("    ! [%s] %s: %s\n", finding.Severity, finding.Check, finding.Detail)
+	}
+}
+
+func PrintDiscovery(result domain.DiscoveryResult, cfg *domain.DiscoveryConfig) {
+	line := fmt.Sprintf("%-6s %-16s %-30s", result.Protocol, result.Host, result.Service)
+	if len(result.Ports) > 0 {
+		ports := make([]string, 0, len(result.Ports))
+		for _, port := range result.Ports {
+			ports = append(ports, strconv.Itoa(port))
+		}
+		line += fmt.Sprintf(" %-10s", strings.Join(ports, ","))
+	} else {
+		line += fmt.Sprintf(" %-10s", "-")
+	}
+	if result.Name != "" {
+		line += " " + result.Name
+	}
+
+	fmt.Println(line)
+
+	if cfg.Verbose {
+		for _, info := range result.Info {
+			fmt.Printf("    %s\n", info)
+		}
+	}
+
+	for _, finding := range result.Findings {
+		fmt.Printf("    ! [%s] %s: %s\n", finding.Severity, finding.Check, finding.Detail)
+	}
+}
+
+// Адреса, уже выведенные командой dns-enum
+var printedAddresses = make(map[string]bool)
+
+// В stdout попадают только адреса, по одному на строку, чтобы их можно было передать в portscan
+func PrintDnsEnum(result domain.DnsEnumResult, cfg *domain.DnsEnumConfig) {
+	addresses := make([]string, 0, len(result.Addresses))
+	for _, ip := range result.Addresses {
+		addresses = append(addresses, ip.String())
+	}
+	if result.Wildcard {
+		fmt.Fprintf(os.Stderr, "wildcard %s -> %s\n", result.Name, strings.Join(addresses, ","))
+		return
+	}
+	if cfg.Verbose {
+		fmt.Fprintf(os.Stderr, "%-40s %s\n", result.Name, strings.Join(addresses, ","))
+	}
+	for _, address := range addresses {
+		if !printedAddresses[address] {
+			printedAddresses[address] = true
+			fmt.Println(address)
+		}
+	}
+}
@@ -1,13 +1,18 @@
 package presentation
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
 	"math"
 	"net"
 	"os"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/futig/PortScannerGo/domain"
 )
@@ -51,6 +56,22 @@ func readOptions(args []string, cfg *domain.ScannerConfig) (int, error) {
 	threadsSet := false
 	verboseSet := false
 	guessSet := false
+	auditSet := false
+	auditRulesSet := false
+	communitySet := false
+	quicSet := false
+	quicHandshakeSet := false
+	industrialSet := false
+	industrialDetailsSet := false
+	simpleServicesSet := false
+	reflectionSet := false
+	resolveSet := false
+	resolverSet := false
+	axfrSet := false
+	axfrZonesSet := false
+	axfrDirSet := false
+	dnsFingerprintSet := false
+	dnsAuditSet := false
 	i := 0
 	for ; i < len(args); i++ {
 		switch args[i] {
@@ -90,6 +111,155 @@ func readOptions(args []string, cfg *domain.ScannerConfig) (int, error) {
 			cfg.Guess = true
 			guessSet = true
 
+		case "--http-audit":
+			if auditSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			cfg.HttpAudit = true
+			cfg.Guess = true
+			auditSet = true
+
+		case "--http-audit-rules":
+			if auditRulesSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			err := parseHttpAuditRulesOption(i, args, cfg)
+			if err != nil {
+				return 0, err
+			}
+			i++
+			cfg.HttpAudit = true
+			cfg.Guess = true
+			auditRulesSet = true
+
+		case "--snmp-community":
+			if communitySet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			err := parseSnmpCommunityOption(i, args, cfg)
+			if err != nil {
+				return 0, err
+			}
+			i++
+			communitySet = true
+
+		case "--quic":
+			if quicSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			cfg.Quic = true
+			quicSet = true
+
+		case "--quic-handshake":
+			if quicHandshakeSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			cfg.QuicHandshake = true
+			cfg.Guess = true
+			quicHandshakeSet = true
+
+		case "--industrial":
+			if industrialSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			cfg.Industrial = true
+			cfg.Guess = true
+			industrialSet = true
+
+		case "--industrial-details":
+			if industrialDetailsSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			cfg.IndustrialDetails = true
+			cfg.Industrial = true
+			cfg.Guess = true
+			industrialDetailsSet = true
+
+		case "--simple-services":
+			if simpleServicesSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			cfg.SimpleServices = true
+			cfg.Guess = true
+			simpleServicesSet = true
+
+		case "--grpc-reflection":
+			if reflectionSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			cfg.GrpcReflection = true
+			cfg.Guess = true
+			reflectionSet = true
+
+		case "--resolve":
+			if resolveSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			cfg.Resolve = true
+			resolveSet = true
+
+		case "--resolver":
+			if resolverSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			err := parseResolverOption(i, args, cfg)
+			if err != nil {
+				return 0, err
+			}
+			i++
+			cfg.Resolve = true
+			resolverSet = true
+
+		case "--axfr":
+			if axfrSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			cfg.Axfr = true
+			cfg.Guess = true
+			axfrSet = true
+
+		case "--axfr-zone":
+			if axfrZonesSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			err := parseAxfrZoneOption(i, args, cfg)
+			if err != nil {
+				return 0, err
+			}
+			i++
+			cfg.Axfr = true
+			cfg.Guess = true
+			axfrZonesSet = true
+
+		case "--axfr-save":
+			if axfrDirSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			err := parseAxfrSaveOption(i, args, cfg)
+			if err != nil {
+				return 0, err
+			}
+			i++
+			cfg.Axfr = true
+			cfg.Guess = true
+			axfrDirSet = true
+
+		case "--dns-fingerprint":
+			if dnsFingerprintSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			cfg.DnsFingerprint = true
+			cfg.Guess = true
+			dnsFingerprintSet = true
+
+		case "--dns-audit":
+			if dnsAuditSet {
+				return 0, fmt.Errorf("option '%v' is repeated", args[i])
+			}
+			cfg.DnsAudit = true
+			cfg.Guess = true
+			dnsAuditSet = true
+
 		default:
 			if strings.HasPrefix(args[i], "-") {
 				return 0, fmt.Errorf("there is no such option: %v", args[i])
@@ -104,7 +274,11 @@ func readOptions(args []string, cfg *domain.ScannerConfig) (int, error) {
 func readIp(ip string, cfg *domain.ScannerConfig) error {
 	ipv6 := net.ParseIP(ip)
 	if ipv6 == nil {
-		fmt.Errorf("invalid IP address '%s'\n", ip)
+		return fmt.Errorf("invalid IP address '%s'", ip)
+	}
+	// Пакеты TCP-сканирования собираются только для IPv4
+	if ipv6.To4() == nil {
+		return fmt.Errorf("IPv6 address '%s' is not supported", ip)
 	}
 	cfg.Ip = ipv6.To4()
 	return nil
@@ -171,3 +345,265 @@ func parseThreadOption(i int, args []string, cfg *domain.ScannerConfig) error {
 	cfg.Threads = int(math.Max(0, math.Min(float64(value), 100)))
 	return nil
 }
+
+func parseResolverOption(i int, args []string, cfg *domain.ScannerConfig) error {
+	resolver, err := readResolverValue(i, args)
+	if err != nil {
+		return err
+	}
+	cfg.Resolver = resolver
+	return nil
+}
+
+func readResolverValue(i int, args []string) (string, error) {
+	if i+1 >= len(args) {
+		return "", fmt.Errorf("there is no value for option '%v'", args[i])
+	}
+	host := args[i+1]
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("resolver must be an IP address, not '%v'", args[i+1])
+	}
+	return args[i+1], nil
+}
+
+func parseAxfrZoneOption(i int, args []string, cfg *domain.ScannerConfig) error {
+	if i+1 >= len(args) {
+		return fmt.Errorf("there is no value for option '%v'", args[i])
+	}
+	zones := make([]string, 0)
+	for _, zone := range strings.Split(args[i+1], ",") {
+		if zone != "" {
+			zones = append(zones, strings.TrimSuffix(zone, "."))
+		}
+	}
+	if len(zones) == 0 {
+		return fmt.Errorf("option '%v' needs at least one zone", args[i])
+	}
+	cfg.AxfrZones = zones
+	return nil
+}
+
+func parseAxfrSaveOption(i int, args []string, cfg *domain.ScannerConfig) error {
+	if i+1 >= len(args) {
+		return fmt.Errorf("there is no value for option '%v'", args[i])
+	}
+	info, err := os.Stat(args[i+1])
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("option '%v' needs an existing directory, not '%v'", args[i], args[i+1])
+	}
+	cfg.AxfrDir = args[i+1]
+	return nil
+}
+
+func parseSnmpCommunityOption(i int, args []string, cfg *domain.ScannerConfig) error {
+	if i+1 >= len(args) {
+		return fmt.Errorf("there is no value for option '%v'", args[i])
+	}
+	communities := make([]string, 0)
+	for _, community := range strings.Split(args[i+1], ",") {
+		if community != "" {
+			communities = append(communities, community)
+		}
+	}
+	if len(communities) == 0 {
+		return fmt.Errorf("option '%v' needs at least one community", args[i])
+	}
+	cfg.SnmpCommunities = communities
+	return nil
+}
+
+func parseHttpAuditRulesOption(i int, args []string, cfg *domain.ScannerConfig) error {
+	if i+1 >= len(args) {
+		return fmt.Errorf("there is no value for option '%v'", args[i])
+	}
+	data, err := os.ReadFile(args[i+1])
+	if err != nil {
+		return fmt.Errorf("failed to read http audit rules: %w", err)
+	}
+	rules := make([]domain.HttpAuditRule, 0)
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return fmt.Errorf("failed to parse http audit rules: %w", err)
+	}
+	for _, rule := range rules {
+		switch rule.Check {
+		case domain.AuditCheckPresent, domain.AuditCheckAbsent,
+			domain.AuditCheckMatch, domain.AuditCheckCookieFlag:
+		default:
+			return fmt.Errorf("http audit rule '%s' has unknown check '%s'", rule.Name, rule.Check)
+		}
+		if rule.Check == domain.AuditCheckMatch {
+			if _, err := regexp.Compile(rule.Value); err != nil {
+				return fmt.Errorf("http audit rule '%s' has invalid pattern: %w", rule.Name, err)
+			}
+		}
+	}
+	cfg.HttpAuditRules = rules
+	return nil
+}
+
+func ParseDiscoverArgs(args []string) (*domain.DiscoveryConfig, error) {
+	cfg := domain.NewDefaultDiscoveryConfig()
+	timeoutSet := false
+	verboseSet := false
+	protocols := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--timeout":
+			if timeoutSet {
+				return nil, fmt.Errorf("failed to parse options: option '%v' is repeated", args[i])
+			}
+			value, err := readIntValue(i, args)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse options: %w", err)
+			}
+			cfg.Timeout = time.Second * time.Duration(value)
+			i++
+			timeoutSet = true
+
+		case "-v", "--verbose":
+			if verboseSet {
+				return nil, fmt.Errorf("failed to parse options: option '%v' is repeated", args[i])
+			}
+			cfg.Verbose = true
+			verboseSet = true
+
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				return nil, fmt.Errorf("failed to parse options: there is no such option: %v", args[i])
+			}
+			if !slices.Contains(domain.DiscoveryProtocols, args[i]) {
+				return nil, fmt.Errorf("unknown discovery protocol '%v'", args[i])
+			}
+			if !slices.Contains(protocols, args[i]) {
+				protocols = append(protocols, args[i])
+			}
+		}
+	}
+
+	if len(protocols) > 0 {
+		cfg.Protocols = protocols
+	}
+	return cfg, nil
+}
+
+func ParseDnsEnumArgs(args []string) (*domain.DnsEnumConfig, error) {
+	cfg := domain.NewDefaultDnsEnumConfig()
+	timeoutSet := false
+	threadsSet := false
+	verboseSet := false
+	resolverSet := false
+	ipv6Set := false
+	positional := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--timeout":
+			if timeoutSet {
+				return nil, fmt.Errorf("failed to parse options: option '%v' is repeated", args[i])
+			}
+			value, err := readIntValue(i, args)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse options: %w", err)
+			}
+			cfg.Timeout = time.Second * time.Duration(value)
+			i++
+			timeoutSet = true
+
+		case "-j", "--num-threads":
+			if threadsSet {
+				return nil, fmt.Errorf("failed to parse options: option '%v' is repeated", args[i])
+			}
+			value, err := readIntValue(i, args)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse options: %w", err)
+			}
+			cfg.Threads = int(math.Max(1, math.Min(float64(value), 1000)))
+			i++
+			threadsSet = true
+
+		case "-v", "--verbose":
+			if verboseSet {
+				return nil, fmt.Errorf("failed to parse options: option '%v' is repeated", args[i])
+			}
+			cfg.Verbose = true
+			verboseSet = true
+
+		case "--resolver":
+			if resolverSet {
+				return nil, fmt.Errorf("failed to parse options: option '%v' is repeated", args[i])
+			}
+			resolver, err := readResolverValue(i, args)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse options: %w", err)
+			}
+			cfg.Resolver = resolver
+			i++
+			resolverSet = true
+
+		case "-6", "--ipv6":
+			if ipv6Set {
+				return nil, fmt.Errorf("failed to parse options: option '%v' is repeated", args[i])
+			}
+			cfg.IPv6 = true
+			ipv6Set = true
+
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				return nil, fmt.Errorf("failed to parse options: there is no such option: %v", args[i])
+			}
+			positional = append(positional, args[i])
+		}
+	}
+
+	if len(positional) != 2 {
+		return nil, fmt.Errorf("usage: dns-enum [OPTIONS] DOMAIN WORDLIST")
+	}
+	cfg.Domain = strings.ToLower(strings.Trim(positional[0], "."))
+	if cfg.Domain == "" {
+		return nil, fmt.Errorf("invalid domain '%v'", positional[0])
+	}
+	words, err := readWordlist(positional[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wordlist: %w", err)
+	}
+	cfg.Words = words
+	return cfg, nil
+}
+
+// Предельная длина метки DNS-имени (RFC 1035, 2.3.4)
+const maxLabelLength = 63
+
+// Слова по одному на строку; пустые строки, комментарии и повторы пропускаются
+func readWordlist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	words := make([]string, 0)
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		word := strings.ToLower(strings.Trim(strings.TrimSpace(scanner.Text()), "."))
+		if word == "" || strings.HasPrefix(word, "#") || seen[word] {
+			continue
+		}
+		// Слово становится одной меткой имени, поэтому точки и пробелы в нём недопустимы
+		if len(word) > maxLabelLength || strings.Contains(word, ".") || strings.ContainsFunc(word, unicode.IsSpace) {
+			return nil, fmt.Errorf("wordlist '%v': line %d: '%v' is not a valid dns label", path, line, word)
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("wordlist '%v' is empty", path)
+	}
+	return words, nil
+}
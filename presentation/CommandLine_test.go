@@ -0,0 +1,141 @@
+package presentation
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/futig/PortScannerGo/domain"
+)
+
+func writeWordlist(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadWordlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"one per line", "www\nmail\nftp\n", []string{"www", "mail", "ftp"}},
+		{"no trailing newline", "www\r\nmail", []string{"www", "mail"}},
+		{"comments and blanks", "# common names\n\nwww\n  \n#mail\napi\n", []string{"www", "api"}},
+		{"case and dots", "WWW\n.dev.\nwww.\n", []string{"www", "dev"}},
+		{"duplicates", "www\nmail\nwww\n", []string{"www", "mail"}},
+		{"spaces around", "  www  \n\tmail\n", []string{"www", "mail"}},
+		{"longest label", strings.Repeat("a", 63), []string{strings.Repeat("a", 63)}},
+	}
+	for _, test := range tests {
+		words, err := readWordlist(writeWordlist(t, test.content))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !slices.Equal(words, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, words, test.want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"# only comments\n\n",
+		"www\ndev.www\n",
+		"www\nmy host\n",
+		"a\tb\n",
+		strings.Repeat("a", 64) + "\n",
+	}
+	for _, content := range invalid {
+		if words, err := readWordlist(writeWordlist(t, content)); err == nil {
+			t.Errorf("%q: got %q, expected error", content, words)
+		}
+	}
+	if _, err := readWordlist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("missing file: expected error")
+	}
+}
+
+func TestParseDnsEnumArgs(t *testing.T) {
+	wordlist := writeWordlist(t, "www\nmail\n")
+
+	cfg, err := ParseDnsEnumArgs([]string{"--timeout", "5", "-j", "5000", "-v", "--resolver", "192.0.2.53", "-6", "Example.COM.", wordlist})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := domain.DnsEnumConfig{
+		Timeout:  5 * time.Second,
+		Threads:  1000,
+		Verbose:  true,
+		Resolver: "192.0.2.53",
+		Domain:   "example.com",
+		Words:    []string{"www", "mail"},
+		IPv6:     true,
+	}
+	if cfg.Timeout != want.Timeout || cfg.Threads != want.Threads || cfg.Verbose != want.Verbose ||
+		cfg.Resolver != want.Resolver || cfg.Domain != want.Domain || !slices.Equal(cfg.Words, want.Words) || cfg.IPv6 != want.IPv6 {
+		t.Errorf("got %+v, want %+v", *cfg, want)
+	}
+
+	cfg, err = ParseDnsEnumArgs([]string{"example.com", wordlist})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Threads != 100 || cfg.Timeout != 2*time.Second || cfg.Resolver != "" || cfg.IPv6 {
+		t.Errorf("defaults: got %+v", *cfg)
+	}
+
+	failures := []struct {
+		name string
+		args []string
+	}{
+		{"no arguments", nil},
+		{"no wordlist", []string{"example.com"}},
+		{"extra argument", []string{"example.com", wordlist, "more"}},
+		{"root domain", []string{".", wordlist}},
+		{"unknown option", []string{"--axfr", "example.com", wordlist}},
+		{"repeated option", []string{"-6", "--ipv6", "example.com", wordlist}},
+		{"timeout without value", []string{"example.com", wordlist, "--timeout"}},
+		{"threads not a number", []string{"-j", "many", "example.com", wordlist}},
+		{"missing wordlist", []string{"example.com", filepath.Join(t.TempDir(), "missing.txt")}},
+	}
+	for _, test := range failures {
+		if cfg, err := ParseDnsEnumArgs(test.args); err == nil {
+			t.Errorf("%s: got %+v, expected error", test.name, *cfg)
+		}
+	}
+}
+
+func TestReadIp(t *testing.T) {
+	tests := []struct {
+		ip    string
+		want  string
+		fails bool
+	}{
+		{ip: "192.0.2.1", want: "192.0.2.1"},
+		{ip: "::ffff:192.0.2.1", want: "192.0.2.1"},
+		{ip: "2001:db8::1", fails: true},
+		{ip: "example.com", fails: true},
+		{ip: "192.0.2.256", fails: true},
+	}
+	for _, test := range tests {
+		cfg := domain.NewDefaultScannerConfig()
+		err := readIp(test.ip, cfg)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got %v, expected error", test.ip, cfg.Ip)
+			}
+			continue
+		}
+		if err != nil || cfg.Ip.String() != test.want || len(cfg.Ip) != 4 {
+			t.Errorf("%s: got %v, error %v", test.ip, cfg.Ip, err)
+		}
+	}
+}